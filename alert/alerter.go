@@ -0,0 +1,325 @@
+// Package alert evaluates conditions against the collected state and
+// notifies a webhook when they start and stop holding, for setups without
+// Prometheus and Alertmanager.
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ninnemana/hue-exporter/collector"
+	"github.com/ninnemana/tracelog"
+	"go.uber.org/zap"
+)
+
+const (
+	// AlertBatteryLow fires while the battery of a sensor is below the
+	// threshold.
+	AlertBatteryLow = "battery_low"
+	// AlertLightUnreachable fires once a light has been unreachable for
+	// longer than the configured duration.
+	AlertLightUnreachable = "light_unreachable"
+
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+
+	// notifyTimeout bounds each notification.
+	notifyTimeout = time.Second * 10
+)
+
+var (
+	// ErrInvalidLogger is returned when the alerter is created without a
+	// logger.
+	ErrInvalidLogger = errors.New("a logger is required to send alerts")
+
+	// ErrNoReceiver is returned when the alerter is created without a
+	// webhook or URL template to notify.
+	ErrNoReceiver = errors.New("a webhook or url template is required to send alerts")
+)
+
+// Notification is sent when an alert starts firing and when it resolves.
+// Webhooks receive it as JSON, URL templates are executed with it.
+type Notification struct {
+	Status string    `json:"status"`
+	Alert  string    `json:"alert"`
+	Bridge string    `json:"bridge"`
+	ID     int       `json:"id"`
+	Name   string    `json:"name"`
+	Value  float64   `json:"value"`
+	Since  time.Time `json:"since"`
+	Time   time.Time `json:"time"`
+}
+
+// Alerter checks the collected state on an interval for low batteries and
+// unreachable lights, notifying once when each alert fires and once when
+// it resolves.
+type Alerter struct {
+	log         *tracelog.TraceLogger
+	client      *http.Client
+	webhook     string
+	urlTemplate string
+	template    *template.Template
+	interval    time.Duration
+	battery     float64
+	unreachable time.Duration
+
+	// pending are the conditions currently holding, keyed by alert, bridge
+	// and id, firing once they've held long enough.
+	pending map[string]*pending
+}
+
+type pending struct {
+	Notification
+	fired bool
+}
+
+type Option func(*Alerter)
+
+func WithLogger(l *tracelog.TraceLogger) Option {
+	return func(a *Alerter) {
+		a.log = l
+	}
+}
+
+// WithWebhook POSTs notifications as JSON to url.
+func WithWebhook(url string) Option {
+	return func(a *Alerter) {
+		a.webhook = url
+	}
+}
+
+// WithURLTemplate requests the URL rendered from the template with each
+// notification, e.g. https://example.com/notify?msg={{query .Name}}. The
+// query function escapes values for use in a query.
+func WithURLTemplate(tmpl string) Option {
+	return func(a *Alerter) {
+		a.urlTemplate = tmpl
+	}
+}
+
+// WithInterval sets how often the state is checked, defaults to a minute.
+func WithInterval(d time.Duration) Option {
+	return func(a *Alerter) {
+		a.interval = d
+	}
+}
+
+// WithBatteryThreshold sets the battery percentage below which sensors
+// alert, defaults to 15.
+func WithBatteryThreshold(percent float64) Option {
+	return func(a *Alerter) {
+		a.battery = percent
+	}
+}
+
+// WithUnreachableAfter sets how long a light must be unreachable before it
+// alerts, defaults to 10 minutes.
+func WithUnreachableAfter(d time.Duration) Option {
+	return func(a *Alerter) {
+		a.unreachable = d
+	}
+}
+
+// New creates an alerter notifying the configured webhook or URL template.
+func New(opts ...Option) (*Alerter, error) {
+	a := &Alerter{
+		client:      &http.Client{Timeout: notifyTimeout},
+		interval:    time.Minute,
+		battery:     15,
+		unreachable: time.Minute * 10,
+		pending:     map[string]*pending{},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	if a.log == nil {
+		return nil, ErrInvalidLogger
+	}
+
+	if a.webhook == "" && a.urlTemplate == "" {
+		return nil, ErrNoReceiver
+	}
+
+	if a.urlTemplate != "" {
+		t, err := template.New("url").Funcs(template.FuncMap{
+			"query": url.QueryEscape,
+		}).Parse(a.urlTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid url template: %w", err)
+		}
+
+		a.template = t
+	}
+
+	return a, nil
+}
+
+// Run checks the state collected by c on every interval until ctx is done.
+func (a *Alerter) Run(ctx context.Context, c collector.Collector) error {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, n := range a.Evaluate(c.State(), now) {
+				if err := a.notify(ctx, n); err != nil {
+					a.log.Error(
+						"failed to send alert",
+						zap.String("alert", n.Alert),
+						zap.String("status", n.Status),
+						zap.Error(err),
+					)
+				}
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Evaluate checks the conditions against the state, returning the
+// notifications of alerts which started firing or resolved since the last
+// evaluation.
+func (a *Alerter) Evaluate(st collector.State, now time.Time) []Notification {
+	holding := map[string]Notification{}
+	for _, b := range st.Bridges {
+		for _, l := range b.Lights {
+			if l.State == nil || l.State.Reachable {
+				continue
+			}
+
+			holding[key(AlertLightUnreachable, b.Name, l.ID)] = Notification{
+				Alert:  AlertLightUnreachable,
+				Bridge: b.Name,
+				ID:     l.ID,
+				Name:   l.Name,
+			}
+		}
+
+		for _, s := range b.Sensors {
+			battery, ok := s.Config["battery"].(float64)
+			if !ok || battery >= a.battery {
+				continue
+			}
+
+			holding[key(AlertBatteryLow, b.Name, s.ID)] = Notification{
+				Alert:  AlertBatteryLow,
+				Bridge: b.Name,
+				ID:     s.ID,
+				Name:   s.Name,
+				Value:  battery,
+			}
+		}
+	}
+
+	var out []Notification
+	for k, n := range holding {
+		p, ok := a.pending[k]
+		if !ok {
+			n.Since = now
+			p = &pending{Notification: n}
+			a.pending[k] = p
+		}
+		p.Value = n.Value
+
+		wait := time.Duration(0)
+		if p.Alert == AlertLightUnreachable {
+			wait = a.unreachable
+		}
+
+		if !p.fired && now.Sub(p.Since) >= wait {
+			p.fired = true
+
+			n := p.Notification
+			n.Status, n.Time = StatusFiring, now
+			out = append(out, n)
+		}
+	}
+
+	for k, p := range a.pending {
+		if _, ok := holding[k]; ok {
+			continue
+		}
+
+		delete(a.pending, k)
+		if p.fired {
+			n := p.Notification
+			n.Status, n.Time = StatusResolved, now
+			out = append(out, n)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return key(out[i].Alert, out[i].Bridge, out[i].ID) < key(out[j].Alert, out[j].Bridge, out[j].ID)
+	})
+
+	return out
+}
+
+func key(alert, bridge string, id int) string {
+	return alert + "/" + bridge + "/" + strconv.Itoa(id)
+}
+
+// notify sends the notification to the webhook and the URL template.
+func (a *Alerter) notify(ctx context.Context, n Notification) error {
+	if a.webhook != "" {
+		body, err := json.Marshal(n)
+		if err != nil {
+			return fmt.Errorf("failed to encode alert: %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.webhook, bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		if err := a.send(req); err != nil {
+			return err
+		}
+	}
+
+	if a.template != nil {
+		var u strings.Builder
+		if err := a.template.Execute(&u, n); err != nil {
+			return fmt.Errorf("failed to render url template: %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+
+		if err := a.send(req); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *Alerter) send(req *http.Request) error {
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("failed to notify %s: %s", req.URL.Redacted(), resp.Status)
+	}
+
+	return nil
+}
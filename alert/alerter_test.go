@@ -0,0 +1,199 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ninnemana/hue-exporter/collector"
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"github.com/ninnemana/tracelog"
+	"go.uber.org/zap"
+)
+
+var testLogger = tracelog.NewLogger(tracelog.WithLogger(zap.NewNop()))
+
+// testState reports the desk lamp's reachability and the hallway sensor's
+// battery.
+func testState(reachable bool, battery float64) collector.State {
+	return collector.State{Bridges: []collector.BridgeState{{
+		Name: "Office",
+		Lights: []collector.Light{
+			{ID: 1, Light: hueclient.Light{Name: "Desk", State: &hueclient.State{Reachable: reachable}}},
+			// lights which haven't reported a state never alert
+			{ID: 2, Light: hueclient.Light{Name: "Shelf"}},
+		},
+		Sensors: []collector.Sensor{
+			{ID: 4, Sensor: hueclient.Sensor{Name: "Hallway", Config: map[string]interface{}{"battery": battery}}},
+			{ID: 5, Sensor: hueclient.Sensor{Name: "Daylight"}},
+		},
+	}}}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		want    error
+		wantErr bool
+	}{
+		{name: "without logger", opts: []Option{WithWebhook("http://localhost")}, want: ErrInvalidLogger},
+		{name: "without receiver", opts: []Option{WithLogger(testLogger)}, want: ErrNoReceiver},
+		{name: "invalid template", opts: []Option{WithLogger(testLogger), WithURLTemplate("{{.Name")}, wantErr: true},
+		{name: "template", opts: []Option{WithLogger(testLogger), WithURLTemplate("http://localhost/?msg={{query .Name}}")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.opts...)
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("error: %v, want %v", err, tt.want)
+			}
+			if (err != nil) != (tt.want != nil || tt.wantErr) {
+				t.Errorf("error: %v, want error %v", err, tt.want != nil || tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	a, err := New(
+		WithLogger(testLogger),
+		WithWebhook("http://localhost"),
+		WithBatteryThreshold(20),
+		WithUnreachableAfter(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create alerter: %v", err)
+	}
+
+	start := time.Unix(1600000000, 0)
+	type notified struct {
+		alert  string
+		status string
+	}
+
+	steps := []struct {
+		name  string
+		after time.Duration
+		state collector.State
+		want  []notified
+	}{
+		{
+			name:  "healthy",
+			state: testState(true, 80),
+		},
+		{
+			name:  "battery low fires at once",
+			after: time.Minute,
+			state: testState(false, 10),
+			want:  []notified{{AlertBatteryLow, StatusFiring}},
+		},
+		{
+			name:  "unreachable pending",
+			after: 5 * time.Minute,
+			state: testState(false, 12),
+		},
+		{
+			name:  "unreachable fires",
+			after: 11 * time.Minute,
+			state: testState(false, 12),
+			want:  []notified{{AlertLightUnreachable, StatusFiring}},
+		},
+		{
+			name:  "still firing",
+			after: 12 * time.Minute,
+			state: testState(false, 12),
+		},
+		{
+			name:  "resolved",
+			after: 13 * time.Minute,
+			state: testState(true, 100),
+			want: []notified{
+				{AlertBatteryLow, StatusResolved},
+				{AlertLightUnreachable, StatusResolved},
+			},
+		},
+	}
+
+	for _, s := range steps {
+		var got []notified
+		for _, n := range a.Evaluate(s.state, start.Add(s.after)) {
+			got = append(got, notified{n.Alert, n.Status})
+
+			if n.Bridge != "Office" {
+				t.Errorf("%s: %s notified for bridge %q", s.name, n.Alert, n.Bridge)
+			}
+		}
+
+		if !reflect.DeepEqual(got, s.want) {
+			t.Errorf("%s: notified %v, want %v", s.name, got, s.want)
+		}
+	}
+
+	// a light becoming reachable again before the wait elapses never fires
+	a.Evaluate(testState(false, 100), start.Add(time.Hour))
+	if got := a.Evaluate(testState(true, 100), start.Add(time.Hour+time.Minute)); len(got) != 0 {
+		t.Errorf("notified %v for a light unreachable briefly", got)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	var (
+		posted Notification
+		query  string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			if err := json.NewDecoder(r.Body).Decode(&posted); err != nil {
+				t.Errorf("failed to decode webhook: %v", err)
+			}
+		case http.MethodGet:
+			query = r.URL.Query().Get("msg")
+		}
+	}))
+	defer srv.Close()
+
+	a, err := New(
+		WithLogger(testLogger),
+		WithWebhook(srv.URL),
+		WithURLTemplate(srv.URL+"/?msg={{query .Name}}+{{.Status}}"),
+	)
+	if err != nil {
+		t.Fatalf("failed to create alerter: %v", err)
+	}
+
+	n := Notification{Status: StatusFiring, Alert: AlertBatteryLow, Bridge: "Office", ID: 4, Name: "Hallway & Stairs", Value: 10}
+	if err := a.notify(context.Background(), n); err != nil {
+		t.Fatalf("failed to notify: %v", err)
+	}
+
+	if posted != n {
+		t.Errorf("webhook received %+v, want %+v", posted, n)
+	}
+	if want := "Hallway & Stairs firing"; query != want {
+		t.Errorf("url template received %q, want %q", query, want)
+	}
+}
+
+func TestNotifyFailed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	a, err := New(WithLogger(testLogger), WithWebhook(srv.URL))
+	if err != nil {
+		t.Fatalf("failed to create alerter: %v", err)
+	}
+
+	if err := a.notify(context.Background(), Notification{Status: StatusFiring}); err == nil {
+		t.Error("notified a failing webhook without error")
+	}
+}
@@ -0,0 +1,109 @@
+package clipv2
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Event is a message received from the bridge event stream.
+type Event struct {
+	ID           string      `json:"id"`
+	Type         string      `json:"type"`
+	CreationTime time.Time   `json:"creationtime"`
+	Data         []EventData `json:"data"`
+}
+
+// EventData is a partial resource carried by an event, only the fields that
+// changed are set.
+type EventData struct {
+	ID    string       `json:"id"`
+	IDV1  string       `json:"id_v1,omitempty"`
+	Type  string       `json:"type"`
+	Owner *ResourceRef `json:"owner,omitempty"`
+	On    *struct {
+		On bool `json:"on"`
+	} `json:"on,omitempty"`
+	Dimming *struct {
+		Brightness float64 `json:"brightness"`
+	} `json:"dimming,omitempty"`
+
+	// Raw holds the full resource update for fields not modelled above.
+	Raw json.RawMessage `json:"-"`
+}
+
+func (d *EventData) UnmarshalJSON(data []byte) error {
+	type alias EventData
+
+	var v alias
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	*d = EventData(v)
+	d.Raw = append(json.RawMessage(nil), data...)
+
+	return nil
+}
+
+// Subscribe streams events from the bridge to fn until the context is
+// cancelled or the stream is closed, it always returns a non-nil error.
+func (c *Client) Subscribe(ctx context.Context, fn func(Event)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url("/eventstream/clip/v2"), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set(applicationKeyHeader, c.Key)
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to open event stream: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to open event stream: %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var data bytes.Buffer
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		switch {
+		case len(line) == 0:
+			// a blank line dispatches the buffered message
+			if data.Len() > 0 {
+				var events []Event
+				if err := json.Unmarshal(data.Bytes(), &events); err != nil {
+					return fmt.Errorf("failed to decode event: %w", err)
+				}
+
+				for _, e := range events {
+					fn(e)
+				}
+			}
+			data.Reset()
+		case bytes.HasPrefix(line, []byte("data:")):
+			data.Write(bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:"))))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("event stream failed: %w", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return io.ErrUnexpectedEOF
+}
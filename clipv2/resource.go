@@ -0,0 +1,104 @@
+package clipv2
+
+// ResourceRef references another resource on the bridge.
+type ResourceRef struct {
+	RID   string `json:"rid"`
+	RType string `json:"rtype"`
+}
+
+type Device struct {
+	ID       string `json:"id"`
+	IDV1     string `json:"id_v1,omitempty"`
+	Metadata struct {
+		Name      string `json:"name"`
+		Archetype string `json:"archetype"`
+	} `json:"metadata"`
+	ProductData struct {
+		ModelID          string `json:"model_id"`
+		ManufacturerName string `json:"manufacturer_name"`
+		ProductName      string `json:"product_name"`
+		SoftwareVersion  string `json:"software_version"`
+	} `json:"product_data"`
+	Services []ResourceRef `json:"services"`
+}
+
+type Light struct {
+	ID       string      `json:"id"`
+	IDV1     string      `json:"id_v1,omitempty"`
+	Owner    ResourceRef `json:"owner"`
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	On struct {
+		On bool `json:"on"`
+	} `json:"on"`
+	Dimming *struct {
+		Brightness float64 `json:"brightness"`
+	} `json:"dimming,omitempty"`
+}
+
+type GroupedLight struct {
+	ID    string      `json:"id"`
+	IDV1  string      `json:"id_v1,omitempty"`
+	Owner ResourceRef `json:"owner"`
+	On    struct {
+		On bool `json:"on"`
+	} `json:"on"`
+	Dimming *struct {
+		Brightness float64 `json:"brightness"`
+	} `json:"dimming,omitempty"`
+}
+
+type ZigbeeConnectivity struct {
+	ID         string      `json:"id"`
+	Owner      ResourceRef `json:"owner"`
+	Status     string      `json:"status"`
+	MACAddress string      `json:"mac_address"`
+}
+
+type DevicePower struct {
+	ID         string      `json:"id"`
+	Owner      ResourceRef `json:"owner"`
+	PowerState struct {
+		BatteryState string `json:"battery_state"`
+		BatteryLevel int    `json:"battery_level"`
+	} `json:"power_state"`
+}
+
+type Button struct {
+	ID       string      `json:"id"`
+	IDV1     string      `json:"id_v1,omitempty"`
+	Owner    ResourceRef `json:"owner"`
+	Metadata struct {
+		ControlID int `json:"control_id"`
+	} `json:"metadata"`
+}
+
+type Scene struct {
+	ID       string `json:"id"`
+	IDV1     string `json:"id_v1,omitempty"`
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	// Group is the room or zone the scene belongs to.
+	Group  ResourceRef  `json:"group"`
+	Status *SceneStatus `json:"status,omitempty"`
+}
+
+// SceneStatus is the activation state of a scene, Active is one of inactive,
+// static or dynamic_palette. LastRecall is only reported by recent bridge
+// software.
+type SceneStatus struct {
+	Active     string `json:"active"`
+	LastRecall string `json:"last_recall,omitempty"`
+}
+
+// Group is a room or zone.
+type Group struct {
+	ID       string `json:"id"`
+	IDV1     string `json:"id_v1,omitempty"`
+	Type     string `json:"type"`
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+}
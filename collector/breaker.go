@@ -0,0 +1,142 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/unit"
+)
+
+const (
+	// breakerThreshold is the number of consecutive cycles a bridge must be
+	// unreachable in before collection from it backs off.
+	breakerThreshold = 3
+
+	// defaultMaxBackoff caps the time between attempts to reach a bridge
+	// that is down.
+	defaultMaxBackoff = time.Minute * 5
+)
+
+// breaker backs off collection from a bridge while it is unreachable. Once
+// open, the bridge is retried after a backoff doubling with every failed
+// attempt, a successful attempt closes the breaker again.
+type breaker struct {
+	bridge string
+	base   time.Duration
+	max    time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	// up is whether every job of the last cycle collected from the bridge
+	// succeeded, attempted whether any cycle collected from it yet.
+	up        bool
+	attempted bool
+}
+
+func newBreaker(bridge string, base, max time.Duration) *breaker {
+	return &breaker{
+		bridge: bridge,
+		base:   base,
+		max:    max,
+	}
+}
+
+// allow reports whether the bridge should be collected from at now.
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return !now.Before(b.openUntil)
+}
+
+// failure records a cycle the bridge was unreachable in, returning the time
+// the bridge is next attempted when the breaker is open.
+func (b *breaker) failure(now time.Time) (time.Time, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.failures < breakerThreshold {
+		return time.Time{}, false
+	}
+
+	backoff := b.base
+	for i := breakerThreshold; i < b.failures && backoff < b.max; i++ {
+		backoff *= 2
+	}
+	if backoff > b.max {
+		backoff = b.max
+	}
+
+	b.openUntil = now.Add(backoff)
+
+	return b.openUntil, true
+}
+
+// success records a cycle the bridge was reachable in, reporting whether
+// the breaker was open.
+func (b *breaker) success() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wasOpen := b.failures >= breakerThreshold
+	b.failures = 0
+	b.openUntil = time.Time{}
+
+	return wasOpen
+}
+
+// collected records whether every job of a cycle the bridge was attempted in
+// succeeded.
+func (b *breaker) collected(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.up = ok
+	b.attempted = true
+}
+
+func (b *breaker) register(inst *instruments) error {
+	if err := inst.int64Gauge(
+		"bridge_up",
+		"Whether the last collection from the bridge succeeded.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			// the bridge is not reported down before it is first
+			// collected from
+			if !b.attempted {
+				return
+			}
+
+			res.Observe(boolValue(b.up), attribute.String("bridge", b.bridge))
+		},
+	); err != nil {
+		return err
+	}
+
+	return inst.int64Gauge(
+		"bridge_circuit_open",
+		"Whether collection from the bridge is backing off because it is unreachable.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			res.Observe(boolValue(b.failures >= breakerThreshold), attribute.String("bridge", b.bridge))
+		},
+	)
+}
+
+// unreachable reports whether the error is caused by failing to reach the
+// bridge, rather than the bridge failing a request.
+func unreachable(err error) bool {
+	return errors.Is(err, ErrBridgeUnreachable) || errors.Is(err, ErrTimeout)
+}
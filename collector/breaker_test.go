@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker("Office", time.Second, 5*time.Second)
+	now := time.Unix(1600000000, 0)
+
+	// the backoff after each consecutive failure, zero while the breaker
+	// stays closed
+	want := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, backoff := range want {
+		until, open := b.failure(now)
+		if open != (backoff != 0) {
+			t.Fatalf("failure %d: open %v, want %v", i+1, open, backoff != 0)
+		}
+		if !open {
+			if !b.allow(now) {
+				t.Errorf("failure %d: collection backed off before the threshold", i+1)
+			}
+
+			continue
+		}
+
+		if got := until.Sub(now); got != backoff {
+			t.Errorf("failure %d: backoff %s, want %s", i+1, got, backoff)
+		}
+		if b.allow(until.Add(-time.Millisecond)) {
+			t.Errorf("failure %d: collection allowed during the backoff", i+1)
+		}
+		if !b.allow(until) {
+			t.Errorf("failure %d: collection not allowed after the backoff", i+1)
+		}
+	}
+
+	if !b.success() {
+		t.Error("success did not report the breaker open")
+	}
+	if !b.allow(now) {
+		t.Error("collection not allowed once closed")
+	}
+	if b.success() {
+		t.Error("success reported a closed breaker open")
+	}
+
+	// the failures were reset, so the threshold applies again
+	if _, open := b.failure(now); open {
+		t.Error("breaker opened on the first failure after closing")
+	}
+}
+
+func TestUnreachable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: ErrBridgeUnreachable, want: true},
+		{err: fmt.Errorf("failed to collect lights: %w", ErrTimeout), want: true},
+		{err: ErrRateLimited},
+		{err: errors.New("unauthorized user")},
+	}
+
+	for _, tt := range tests {
+		if got := unreachable(tt.err); got != tt.want {
+			t.Errorf("unreachable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+)
+
+// Bridge is the v1 API of a Hue bridge, as used by the jobs collecting from
+// it. It is implemented by *hueclient.Client, and can be replaced through
+// WithBridge to collect from a fake bridge.
+type Bridge interface {
+	GetConfigContext(ctx context.Context) (*hueclient.Config, error)
+	GetCapabilitiesContext(ctx context.Context) (*hueclient.Capabilities, error)
+	GetGroupsContext(ctx context.Context) ([]hueclient.Group, error)
+	GetLightsContext(ctx context.Context) ([]hueclient.Light, error)
+	GetNewLightsContext(ctx context.Context) (*hueclient.NewLight, error)
+	GetRulesContext(ctx context.Context) ([]*hueclient.Rule, error)
+	GetScenesContext(ctx context.Context) ([]hueclient.Scene, error)
+	GetSchedulesContext(ctx context.Context) ([]*hueclient.Schedule, error)
+	GetSensorsContext(ctx context.Context) ([]hueclient.Sensor, error)
+	GetNewSensorsContext(ctx context.Context) (*hueclient.NewSensor, error)
+}
+
+var _ Bridge = (*hueclient.Client)(nil)
+
+// searcher is implemented by bridges able to start a search for new lights
+// and sensors, which Scan is limited to.
+type searcher interface {
+	FindLightsContext(ctx context.Context) error
+	FindSensorsContext(ctx context.Context) error
+}
+
+var _ searcher = (*hueclient.Client)(nil)
+
+// rawGetter is implemented by bridges able to fetch v1 API paths directly,
+// for fields the models leave out. Jobs relying on it are only run for
+// those bridges.
+type rawGetter interface {
+	Get(ctx context.Context, path string, v interface{}) error
+}
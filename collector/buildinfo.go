@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/unit"
+)
+
+// buildInfo reports the build of the exporter and when it started, as
+// Prometheus exporters conventionally do.
+type buildInfo struct {
+	version  string
+	revision string
+	start    time.Time
+}
+
+func (b *buildInfo) register(inst *instruments) error {
+	if err := inst.int64Gauge(
+		"exporter_build_info",
+		"Version, revision and Go version the exporter was built with, always 1.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			res.Observe(
+				1,
+				attribute.String("version", b.version),
+				attribute.String("revision", b.revision),
+				attribute.String("goversion", runtime.Version()),
+			)
+		},
+	); err != nil {
+		return err
+	}
+
+	return inst.float64Gauge(
+		"exporter_start_time_seconds",
+		"Time the exporter started, in seconds since the epoch.",
+		unitSeconds,
+		func(ctx context.Context, res metric.Float64ObserverResult) {
+			res.Observe(float64(b.start.UnixNano()) / 1e9)
+		},
+	)
+}
@@ -0,0 +1,188 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+
+	"github.com/ninnemana/hue-exporter/clipv2"
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/unit"
+)
+
+var (
+	// buttonEvents maps the last three digits of a v1 buttonevent to the
+	// kind of press, the leading digit is the button number.
+	buttonEvents = map[int]string{
+		0: "initial_press",
+		1: "repeat",
+		2: "short_release",
+		3: "long_release",
+	}
+)
+
+// buttonPress identifies a counted kind of press on a button.
+type buttonPress struct {
+	id     string
+	button int
+	event  string
+}
+
+// buttonTracker counts button presses on switches by comparing the last
+// reported button event of each switch between collection cycles.
+type buttonTracker struct {
+	bridge string
+	// legacy also reports presses under the name used before counters were
+	// suffixed with _total.
+	legacy bool
+
+	mu      sync.Mutex
+	seen    map[int]string
+	presses map[buttonPress]int64
+}
+
+func newButtonTracker(bridge string, legacy bool) *buttonTracker {
+	return &buttonTracker{
+		bridge:  bridge,
+		legacy:  legacy,
+		seen:    map[int]string{},
+		presses: map[buttonPress]int64{},
+	}
+}
+
+// register registers the press counters, identifying the switches of the
+// v1 API through id as the other sensor series are.
+func (b *buttonTracker) register(inst *instruments, id identifier) error {
+	names := []string{"button_presses_total"}
+	if b.legacy {
+		names = append(names, "button_presses")
+	}
+
+	for _, name := range names {
+		if err := inst.int64Counter(
+			name,
+			"Number of button events from dimmer switches and smart buttons.",
+			unit.Dimensionless,
+			id.int64s(func(ctx context.Context, res metric.Int64ObserverResult) {
+				b.mu.Lock()
+				defer b.mu.Unlock()
+
+				for p, n := range b.presses {
+					// switches of the v1 API are known by their numeric
+					// id, which the identifier replaces, those of the
+					// event stream by their device
+					device := attribute.String("id", p.id)
+					if sensor, err := strconv.Atoi(p.id); err == nil {
+						device = attribute.Int("id", sensor)
+					}
+
+					res.Observe(
+						n,
+						attribute.String("bridge", b.bridge),
+						device,
+						attribute.Int("button", p.button),
+						attribute.String("event", p.event),
+					)
+				}
+			}),
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// observe records a press for every switch whose last update changed since
+// the previous cycle. The first cycle only establishes the baseline. Presses
+// of switches no longer on the bridge are forgotten.
+func (b *buttonTracker) observe(sensors []hueclient.Sensor) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.forgetRemoved(sensors)
+
+	for _, s := range sensors {
+		code, ok := sensorState(s, "buttonevent")
+		if !ok {
+			continue
+		}
+
+		updated, _ := s.State["lastupdated"].(string)
+		prev, known := b.seen[s.ID]
+		b.seen[s.ID] = updated
+
+		if !known || prev == updated {
+			continue
+		}
+
+		event := int(code)
+		b.presses[buttonPress{
+			id:     strconv.Itoa(s.ID),
+			button: event / 1000,
+			event:  buttonEvents[event%1000],
+		}]++
+	}
+}
+
+// forgetRemoved drops the switches missing from sensors along with their
+// presses, b.mu must be held. Presses seen on the event stream are keyed by
+// device rather than sensor and kept.
+func (b *buttonTracker) forgetRemoved(sensors []hueclient.Sensor) {
+	known := make(map[int]bool, len(sensors))
+	for _, s := range sensors {
+		known[s.ID] = true
+	}
+
+	for id := range b.seen {
+		if known[id] {
+			continue
+		}
+
+		delete(b.seen, id)
+		for p := range b.presses {
+			if p.id == strconv.Itoa(id) {
+				delete(b.presses, p)
+			}
+		}
+	}
+}
+
+// buttonEvent is the portion of a v2 button resource update describing the
+// press.
+type buttonEvent struct {
+	Button struct {
+		LastEvent string `json:"last_event"`
+	} `json:"button"`
+}
+
+// observeEvent records a press from a CLIP v2 button update, control is the
+// button number on the device.
+func (b *buttonTracker) observeEvent(d clipv2.EventData, control int) error {
+	var e buttonEvent
+	if err := json.Unmarshal(d.Raw, &e); err != nil {
+		return err
+	}
+
+	if e.Button.LastEvent == "" {
+		return nil
+	}
+
+	var device string
+	if d.Owner != nil {
+		device = d.Owner.RID
+	}
+
+	b.mu.Lock()
+	b.presses[buttonPress{
+		id:     device,
+		button: control,
+		event:  e.Button.LastEvent,
+	}]++
+	b.mu.Unlock()
+
+	return nil
+}
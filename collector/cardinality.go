@@ -0,0 +1,129 @@
+package collector
+
+import (
+	"context"
+	"sort"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/unit"
+)
+
+// overflowMetric counts the series dropped by the series limit, it is
+// exempt from the limit itself.
+const overflowMetric = "series_overflow_total"
+
+// seriesLimit caps the series reported by a single collection of an
+// instrument. Observations beyond the limit are summed into one overflow
+// series, labelled overflow="true", so the total of the instrument is kept
+// while its cardinality is bounded.
+type seriesLimit struct {
+	limit int
+	seen  map[attribute.Distinct]bool
+	buf   []attribute.KeyValue
+	// dropped is the number of observations summed into overflow.
+	dropped  int64
+	overflow float64
+}
+
+// newLimit returns the limit of a collection of the named instrument, nil
+// when its series are unlimited.
+func (i *instruments) newLimit(name string) *seriesLimit {
+	if i.seriesLimit <= 0 || name == overflowMetric {
+		return nil
+	}
+
+	return &seriesLimit{
+		limit: i.seriesLimit,
+		seen:  map[attribute.Distinct]bool{},
+	}
+}
+
+// admit reports whether the observation is reported as is, adding its value
+// to the overflow series otherwise. Observations of a series already
+// admitted are always admitted.
+func (l *seriesLimit) admit(labels []attribute.KeyValue, value float64) bool {
+	if l == nil {
+		return true
+	}
+
+	set := labelSet(&l.buf, labels)
+	if l.seen[set.Equivalent()] {
+		return true
+	}
+
+	if len(l.seen) >= l.limit {
+		l.dropped++
+		l.overflow += value
+
+		return false
+	}
+
+	l.seen[set.Equivalent()] = true
+
+	return true
+}
+
+// flush reports the overflow series of the collection, if any observation
+// was dropped, and counts the dropped observations against the instrument.
+func (i *instruments) flush(name string, l *seriesLimit, observe func(float64, []attribute.KeyValue)) {
+	if l == nil || l.dropped == 0 {
+		return
+	}
+
+	labels := append([]attribute.KeyValue{}, i.labels...)
+	observe(l.overflow, append(labels, attribute.String("overflow", "true")))
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.overflows == nil {
+		i.overflows = map[string]int64{}
+	}
+	i.overflows[name] += l.dropped
+}
+
+// registerOverflow registers the counter of the series dropped by the series
+// limit, labelled with the instrument they were dropped from.
+func (i *instruments) registerOverflow() error {
+	return i.int64Counter(
+		overflowMetric,
+		"Number of observations summed into the overflow series of each metric because it reached the series limit, counted each time metrics are collected.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			i.mu.RLock()
+			defer i.mu.RUnlock()
+
+			names := make([]string, 0, len(i.overflows))
+			for name := range i.overflows {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				res.Observe(i.overflows[name], attribute.String("metric", name))
+			}
+		},
+	)
+}
+
+// truncate shortens the value to at most max bytes without splitting a
+// character, marking the cut with an ellipsis.
+func truncate(value string, max int) string {
+	if max <= 0 || len(value) <= max {
+		return value
+	}
+
+	const ellipsis = "…"
+	if max <= len(ellipsis) {
+		return ""
+	}
+
+	cut := max - len(ellipsis)
+	for cut > 0 && !utf8.RuneStart(value[cut]) {
+		cut--
+	}
+
+	return value[:cut] + ellipsis
+}
@@ -0,0 +1,41 @@
+package collector
+
+import "time"
+
+// Clock tells the time collection cycles are scheduled against and creates
+// the tickers they wait on, so tests can drive cycles without sleeping.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks on C, as time.Ticker does. The gatherer resets it to
+// the start of each following cycle, which jitter and alignment move off a
+// fixed period.
+type Ticker interface {
+	C() <-chan time.Time
+	Reset(d time.Duration)
+	Stop()
+}
+
+// TickerFactory creates a ticker with the period d.
+type TickerFactory func(d time.Duration) Ticker
+
+// systemClock is the wall clock.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
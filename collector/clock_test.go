@@ -0,0 +1,183 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+)
+
+// fakeClock is a clock only moving when advanced, handing out a single
+// ticker ticking when told to.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	ticker *fakeTicker
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		ticker: &fakeTicker{
+			c:      make(chan time.Time),
+			resets: make(chan time.Duration, 16),
+		},
+	}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	return c.now
+}
+
+func (c *fakeClock) NewTicker(time.Duration) Ticker {
+	return c.ticker
+}
+
+// fakeTicker records the waits it is reset to, ticking only when sent to.
+type fakeTicker struct {
+	c      chan time.Time
+	resets chan time.Duration
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Reset(d time.Duration) {
+	t.resets <- d
+}
+
+func (t *fakeTicker) Stop() {}
+
+// waitReset returns the wait the ticker is next reset to, once the cycle
+// before it is done.
+func waitReset(t *testing.T, ticker *fakeTicker) time.Duration {
+	t.Helper()
+
+	select {
+	case d := <-ticker.resets:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("no cycle completed")
+
+		return 0
+	}
+}
+
+func TestRunClock(t *testing.T) {
+	hue := newFakeBridge()
+	clock := newFakeClock()
+
+	var periods []time.Duration
+	g, _ := newTestGatherer(t,
+		WithBridge("fake", hue),
+		WithTicker(time.Minute),
+		WithClock(clock),
+		WithTickerFactory(func(d time.Duration) Ticker {
+			periods = append(periods, d)
+
+			return clock.ticker
+		}),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := g.Subscribe(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- g.Run(ctx)
+	}()
+
+	// the next cycle is a full interval away on the unmoved clock
+	if d := waitReset(t, clock.ticker); d != time.Minute {
+		t.Errorf("waiting %v after the first cycle, want 1m", d)
+	}
+
+	// the collected lights are never modified, so they are replaced
+	lights := append([]hueclient.Light(nil), hue.lights...)
+	state := *lights[1].State
+	state.On = true
+	lights[1].State = &state
+
+	hue.mu.Lock()
+	hue.lights = lights
+	hue.mu.Unlock()
+
+	// the second cycle starts 10s late, the one after it a full interval
+	// after its start
+	now := clock.advance(time.Minute + 10*time.Second)
+	clock.ticker.c <- now
+
+	if d := waitReset(t, clock.ticker); d != time.Minute {
+		t.Errorf("waiting %v after the second cycle, want 1m", d)
+	}
+
+	select {
+	case e := <-events:
+		if e.Type != EventLightOn || e.ID != 2 || !e.Time.Equal(now) {
+			t.Errorf("got %s of light %d at %v, want light 2 switched on at %v", e.Type, e.ID, e.Time, now)
+		}
+	default:
+		t.Error("switching light 2 on was not published")
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run returned %v, want context.Canceled", err)
+	}
+
+	if len(periods) != 1 || periods[0] != time.Minute {
+		t.Errorf("created tickers with periods %v, want a single one of 1m", periods)
+	}
+	if hue.fetches != 2 {
+		t.Errorf("fetched lights %d times, want once per cycle", hue.fetches)
+	}
+}
+
+func TestStaleTTLClock(t *testing.T) {
+	hue := newFakeBridge()
+	clock := newFakeClock()
+	g, reg := newTestGatherer(t,
+		WithBridge("fake", hue),
+		WithClock(clock),
+		WithStaleTTL(time.Minute),
+	)
+
+	if err := g.Collect(context.Background()); err != nil {
+		t.Fatalf("failed to collect: %v", err)
+	}
+
+	hue.mu.Lock()
+	hue.errs["sensors"] = errors.New("bridge unavailable")
+	hue.mu.Unlock()
+
+	// failing within the TTL of the last success keeps serving its state
+	clock.advance(30 * time.Second)
+	if err := g.Collect(context.Background()); err == nil {
+		t.Fatal("expected the failing sensors job to fail the cycle")
+	}
+	if _, ok := gather(t, reg)[`sensor_temperature_celsius{bridge="fake",id="4",type="ZLLTemperature"}`]; !ok {
+		t.Error("sensors are dropped within the stale TTL")
+	}
+
+	clock.advance(time.Minute)
+	if _, ok := gather(t, reg)[`sensor_temperature_celsius{bridge="fake",id="4",type="ZLLTemperature"}`]; ok {
+		t.Error("sensors are still reported past the stale TTL")
+	}
+}
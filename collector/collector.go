@@ -2,10 +2,94 @@ package collector
 
 import (
 	"context"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 )
 
 type Collector interface {
 	http.Handler
 	Run(ctx context.Context) error
+	Collect(ctx context.Context) error
+	// State returns the state last collected, without contacting the
+	// bridges.
+	State() State
+	// Subscribe returns a channel receiving the state changes found
+	// between collection cycles until ctx is done.
+	Subscribe(ctx context.Context) <-chan Event
+	// Scan starts a search for new lights and sensors on the bridges.
+	Scan(ctx context.Context) error
+	Controller
+}
+
+// CollectHandler runs a collection cycle out of band on POST, e.g. to see a
+// change made through the Hue app without waiting for the next cycle.
+// Collections are triggered at most once per interval, requests arriving
+// sooner are refused with 429 Too Many Requests. Cycles run one at a time,
+// so a triggered collection waits for one already in progress.
+func CollectHandler(c Collector, interval time.Duration) http.Handler {
+	return triggerHandler(interval, func(w http.ResponseWriter, r *http.Request) {
+		if err := c.Collect(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// ScanHandler starts a search for new lights and sensors on POST, rate
+// limited as CollectHandler. The search runs on the bridges for about a
+// minute, the devices found are reported by the new_light and new_sensor
+// metrics once collected.
+func ScanHandler(c Collector, interval time.Duration) http.Handler {
+	return triggerHandler(interval, func(w http.ResponseWriter, r *http.Request) {
+		if err := c.Scan(r.Context()); err != nil {
+			status := http.StatusServiceUnavailable
+			if errors.Is(err, ErrSearchUnsupported) {
+				status = http.StatusNotImplemented
+			}
+			http.Error(w, err.Error(), status)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// triggerHandler serves POST requests through handler at most once per
+// interval, refusing those arriving sooner with 429 Too Many Requests.
+func triggerHandler(interval time.Duration, handler http.HandlerFunc) http.Handler {
+	var (
+		mu   sync.Mutex
+		last time.Time
+	)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		mu.Lock()
+		if wait := interval - time.Since(last); !last.IsZero() && wait > 0 {
+			mu.Unlock()
+
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+
+			return
+		}
+		last = time.Now()
+		mu.Unlock()
+
+		handler(w, r)
+	})
 }
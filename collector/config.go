@@ -0,0 +1,350 @@
+package collector
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"github.com/ninnemana/tracelog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.uber.org/zap"
+)
+
+// bridgeConfig collects the bridge configuration and metadata.
+type bridgeConfig struct {
+	log    *tracelog.TraceLogger
+	hue    Bridge
+	bridge string
+
+	mu    sync.RWMutex
+	state *bridgeConfigState
+}
+
+// bridgeConfigState is the configuration last collected from the bridge.
+type bridgeConfigState struct {
+	cfg  *hueclient.Config
+	caps *hueclient.Capabilities
+	// drift is measured when the config is fetched rather than when it is
+	// observed, ok is false when the bridge reported no time.
+	drift   time.Duration
+	driftOK bool
+}
+
+func (b *bridgeConfig) snapshot() *bridgeConfigState {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.state
+}
+
+func (b *bridgeConfig) Collect(ctx context.Context) func() error {
+	ctx, span := tracer.Start(ctx, "bridgeConfig.Collect")
+	log := b.log.SetContext(ctx)
+
+	return func() error {
+		defer span.End()
+
+		cfg, err := b.hue.GetConfigContext(ctx)
+		if err != nil {
+			log.Error("failed to fetch config", zap.Error(err))
+
+			return err
+		}
+
+		caps, err := b.hue.GetCapabilitiesContext(ctx)
+		if err != nil {
+			log.Error("failed to fetch capabilities", zap.Error(err))
+
+			return err
+		}
+
+		drift, ok := bridgeTimeDrift(cfg, time.Now())
+
+		log.Debug("collected bridge config metrics")
+
+		b.mu.Lock()
+		b.state = &bridgeConfigState{
+			cfg:     cfg,
+			caps:    caps,
+			drift:   drift,
+			driftOK: ok,
+		}
+		b.mu.Unlock()
+
+		return nil
+	}
+}
+
+func (b *bridgeConfig) register(inst *instruments) error {
+	// observe adapts an observer of the config to read the last collected
+	// state
+	observe := func(fn func(*bridgeConfigState) metric.Int64ObserverFunc) metric.Int64ObserverFunc {
+		return func(ctx context.Context, res metric.Int64ObserverResult) {
+			if st := b.snapshot(); st != nil {
+				fn(st)(ctx, res)
+			}
+		}
+	}
+
+	if err := inst.int64Gauge(
+		"bridge_info",
+		"Bridge metadata. Includes identifier, model, and API and software versions.",
+		unit.Dimensionless,
+		observe(func(st *bridgeConfigState) metric.Int64ObserverFunc {
+			return bridgeInfoObserver(b.bridge, st.cfg)
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"bridge_zigbee_channel",
+		"Zigbee channel the bridge operates on.",
+		unit.Dimensionless,
+		observe(func(st *bridgeConfigState) metric.Int64ObserverFunc {
+			return func(ctx context.Context, res metric.Int64ObserverResult) {
+				res.Observe(int64(st.cfg.ZigbeeChannel), attribute.String("bridge", b.bridge))
+			}
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"bridge_internet_service_connected",
+		"Whether the bridge is connected to each of the Hue internet services.",
+		unit.Dimensionless,
+		observe(func(st *bridgeConfigState) metric.Int64ObserverFunc {
+			return bridgeInternetObserver(b.bridge, st.cfg)
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"bridge_portal_connected",
+		"Whether the bridge is signed on to the Hue portal.",
+		unit.Dimensionless,
+		observe(func(st *bridgeConfigState) metric.Int64ObserverFunc {
+			return func(ctx context.Context, res metric.Int64ObserverResult) {
+				res.Observe(
+					boolValue(st.cfg.PortalState.SignedOn),
+					attribute.String("bridge", b.bridge),
+					attribute.String("communication", st.cfg.PortalState.Communication),
+				)
+			}
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"bridge_software_update_state",
+		"Software update state of the bridge and its devices, 1 for the current state.",
+		unit.Dimensionless,
+		observe(func(st *bridgeConfigState) metric.Int64ObserverFunc {
+			return softwareUpdateObserver(b.bridge, st.cfg)
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"bridge_capability_available",
+		"Number of additional resources of each type the bridge can store.",
+		unit.Dimensionless,
+		observe(func(st *bridgeConfigState) metric.Int64ObserverFunc {
+			return capabilitiesObserver(b.bridge, st.caps)
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"whitelist_users",
+		"Number of applications whitelisted to use the bridge API.",
+		unit.Dimensionless,
+		observe(func(st *bridgeConfigState) metric.Int64ObserverFunc {
+			return func(ctx context.Context, res metric.Int64ObserverResult) {
+				res.Observe(int64(len(st.cfg.Whitelist)), attribute.String("bridge", b.bridge))
+			}
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"whitelist_last_used_timestamp_seconds",
+		"Time each whitelisted application last used the bridge API, in seconds since the epoch.",
+		unitSeconds,
+		observe(func(st *bridgeConfigState) metric.Int64ObserverFunc {
+			return whitelistLastUsedObserver(b.bridge, st.cfg.Whitelist)
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.float64Gauge(
+		"bridge_time_drift_seconds",
+		"Difference between the bridge clock and the exporter clock.",
+		unitSeconds,
+		func(ctx context.Context, res metric.Float64ObserverResult) {
+			if st := b.snapshot(); st != nil && st.driftOK {
+				res.Observe(st.drift.Seconds(), attribute.String("bridge", b.bridge))
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func bridgeInfoObserver(bridge string, cfg *hueclient.Config) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		res.Observe(
+			1,
+			attribute.String("bridge", bridge),
+			attribute.String("id", cfg.BridgeID),
+			attribute.String("name", cfg.Name),
+			attribute.String("model", cfg.ModelID),
+			attribute.String("api_version", cfg.APIVersion),
+			attribute.String("sw_version", cfg.SwVersion),
+		)
+	}
+}
+
+func bridgeInternetObserver(bridge string, cfg *hueclient.Config) metric.Int64ObserverFunc {
+	services := map[string]string{
+		"internet":     cfg.InternetService.Internet,
+		"remoteaccess": cfg.InternetService.RemoteAccess,
+		"time":         cfg.InternetService.Time,
+		"swupdate":     cfg.InternetService.SwUpdate,
+	}
+
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for service, state := range services {
+			res.Observe(
+				boolValue(state == "connected"),
+				attribute.String("bridge", bridge),
+				attribute.String("service", service),
+			)
+		}
+	}
+}
+
+var (
+	// softwareUpdateStates are the states reported through swupdate2, both
+	// for the system as a whole and the bridge itself.
+	softwareUpdateStates = []string{
+		"unknown",
+		"noupdates",
+		"transferring",
+		"anyreadytoinstall",
+		"allreadytoinstall",
+		"readytoinstall",
+		"installing",
+	}
+)
+
+// softwareUpdateState maps the update state reported by the bridge onto one
+// of softwareUpdateStates, unknown when it is missing or not recognized.
+func softwareUpdateState(state string) string {
+	state = strings.ToLower(strings.TrimSpace(state))
+	for _, s := range softwareUpdateStates {
+		if s == state {
+			return s
+		}
+	}
+
+	return "unknown"
+}
+
+// softwareUpdateObserver reports the update state as a state set, observing
+// every known state so alerts can match on the state turning to 1. Exactly
+// one state of each component is 1.
+func softwareUpdateObserver(bridge string, cfg *hueclient.Config) metric.Int64ObserverFunc {
+	components := map[string]string{
+		"system": softwareUpdateState(cfg.SwUpdate2.State),
+		"bridge": softwareUpdateState(cfg.SwUpdate2.Bridge.State),
+	}
+
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for component, current := range components {
+			for _, state := range softwareUpdateStates {
+				res.Observe(
+					boolValue(state == current),
+					attribute.String("bridge", bridge),
+					attribute.String("component", component),
+					attribute.String("state", state),
+				)
+			}
+		}
+	}
+}
+
+func capabilitiesObserver(bridge string, caps *hueclient.Capabilities) metric.Int64ObserverFunc {
+	available := map[string]int{
+		"groups":        caps.Groups.Available,
+		"lights":        caps.Lights.Available,
+		"resourcelinks": caps.Resourcelinks.Available,
+		"schedules":     caps.Schedules.Available,
+		"rules":         caps.Rules.Available,
+		"scenes":        caps.Scenes.Available,
+		"sensors":       caps.Sensors.Available,
+		"streaming":     caps.Streaming.Available,
+	}
+
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for resource, n := range available {
+			res.Observe(
+				int64(n),
+				attribute.String("bridge", bridge),
+				attribute.String("resource", resource),
+			)
+		}
+	}
+}
+
+func whitelistLastUsedObserver(bridge string, whitelist []hueclient.Whitelist) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for _, w := range whitelist {
+			used, ok := parseTime(w.LastUseDate)
+			if !ok {
+				continue
+			}
+
+			res.Observe(
+				used.Unix(),
+				attribute.String("bridge", bridge),
+				attribute.String("id", whitelistID(w.Username)),
+				attribute.String("name", w.Name),
+			)
+		}
+	}
+}
+
+// whitelistID derives a stable identifier for a whitelisted application
+// without exposing its username, which grants full access to the bridge.
+func whitelistID(username string) string {
+	sum := sha256.Sum256([]byte(username))
+
+	return hex.EncodeToString(sum[:4])
+}
+
+// bridgeTimeDrift reports how far ahead of now the bridge clock is.
+func bridgeTimeDrift(cfg *hueclient.Config, now time.Time) (time.Duration, bool) {
+	t, ok := parseTime(cfg.UTC)
+	if !ok {
+		return 0, false
+	}
+
+	// the bridge reports time with second precision
+	return t.Sub(now.Truncate(time.Second)), true
+}
@@ -0,0 +1,24 @@
+package collector
+
+import "testing"
+
+func TestSoftwareUpdateState(t *testing.T) {
+	tests := []struct {
+		state string
+		want  string
+	}{
+		{state: "noupdates", want: "noupdates"},
+		{state: "anyreadytoinstall", want: "anyreadytoinstall"},
+		{state: "ReadyToInstall", want: "readytoinstall"},
+		{state: "", want: "unknown"},
+		{state: "downloading", want: "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.state, func(t *testing.T) {
+			if got := softwareUpdateState(tt.state); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
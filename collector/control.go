@@ -0,0 +1,207 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrUnknownBridge is returned when controlling a bridge that isn't
+	// configured.
+	ErrUnknownBridge = errors.New("unknown bridge")
+
+	// ErrControlUnsupported is returned when controlling a bridge whose API
+	// can't change the state of its lights, such as one provided through
+	// WithBridge.
+	ErrControlUnsupported = errors.New("bridge does not support control")
+)
+
+// Controller changes the state of the lights and groups of the bridges
+// through the connections they are collected from.
+type Controller interface {
+	// SetLight changes the state of the light with the given id.
+	SetLight(ctx context.Context, bridge string, id int, action hueclient.Action) error
+	// SetGroup changes the state of the lights of the group with the given
+	// id, or recalls a scene on them.
+	SetGroup(ctx context.Context, bridge string, id int, action hueclient.Action) error
+}
+
+// actuator is implemented by bridges able to change the state of their
+// lights.
+type actuator interface {
+	SetLightStateContext(ctx context.Context, id int, action hueclient.Action) error
+	SetGroupStateContext(ctx context.Context, id int, action hueclient.Action) error
+}
+
+var _ actuator = (*hueclient.Client)(nil)
+
+func (g *Gatherer) actuator(bridge string) (actuator, error) {
+	for _, b := range g.bridges {
+		if b.name != bridge {
+			continue
+		}
+
+		a, ok := g.actuators[bridge]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrControlUnsupported, bridge)
+		}
+
+		return a, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnknownBridge, bridge)
+}
+
+// SetLight implements Controller. The change is reported once the following
+// cycle collects it.
+func (g *Gatherer) SetLight(ctx context.Context, bridge string, id int, action hueclient.Action) error {
+	ctx, span := tracer.Start(ctx, "collector/gatherer.SetLight")
+	defer span.End()
+
+	a, err := g.actuator(bridge)
+	if err != nil {
+		return err
+	}
+
+	g.log.SetContext(ctx).Info("changing light state", zap.String("bridge", bridge), zap.Int("id", id))
+
+	return a.SetLightStateContext(ctx, id, action)
+}
+
+// SetGroup implements Controller. The change is reported once the following
+// cycle collects it.
+func (g *Gatherer) SetGroup(ctx context.Context, bridge string, id int, action hueclient.Action) error {
+	ctx, span := tracer.Start(ctx, "collector/gatherer.SetGroup")
+	defer span.End()
+
+	a, err := g.actuator(bridge)
+	if err != nil {
+		return err
+	}
+
+	g.log.SetContext(ctx).Info("changing group state", zap.String("bridge", bridge), zap.Int("id", id), zap.String("scene", action.Scene))
+
+	return a.SetGroupStateContext(ctx, id, action)
+}
+
+// ControlHandler serves a minimal REST API changing the state of lights and
+// groups, to be mounted with its prefix stripped:
+//
+//	PUT  /{bridge}/lights/{id}/state         change the state of a light
+//	PUT  /{bridge}/groups/{id}/action        change the state of a group
+//	POST /{bridge}/scenes/{id}/recall?group= recall a scene, on group 0 by default
+//
+// State changes are read from the request body as a hueclient.Action, and
+// applied as the bridge would through its own API. The handler doesn't
+// authenticate requests itself, and must only be served behind
+// authentication.
+func ControlHandler(c Controller) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// paths are /<bridge>/<resource>/<id>/<operation>
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 4 {
+			http.NotFound(w, r)
+
+			return
+		}
+		bridge, resource, id, op := parts[0], parts[1], parts[2], parts[3]
+
+		method := http.MethodPut
+		if resource == "scenes" {
+			method = http.MethodPost
+		}
+
+		var (
+			apply func(ctx context.Context, action hueclient.Action) error
+			known bool
+		)
+		switch {
+		case resource == "lights" && op == "state":
+			n, err := strconv.Atoi(id)
+			known = err == nil
+			apply = func(ctx context.Context, action hueclient.Action) error {
+				return c.SetLight(ctx, bridge, n, action)
+			}
+		case resource == "groups" && op == "action":
+			n, err := strconv.Atoi(id)
+			known = err == nil
+			apply = func(ctx context.Context, action hueclient.Action) error {
+				return c.SetGroup(ctx, bridge, n, action)
+			}
+		case resource == "scenes" && op == "recall":
+			group := 0
+			if v := r.URL.Query().Get("group"); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					http.Error(w, "invalid group: "+v, http.StatusBadRequest)
+
+					return
+				}
+				group = n
+			}
+			known = true
+			apply = func(ctx context.Context, _ hueclient.Action) error {
+				return c.SetGroup(ctx, bridge, group, hueclient.Action{Scene: id})
+			}
+		}
+		if !known {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		var action hueclient.Action
+		if method == http.MethodPut {
+			if err := json.NewDecoder(r.Body).Decode(&action); err != nil {
+				http.Error(w, "invalid action: "+err.Error(), http.StatusBadRequest)
+
+				return
+			}
+		}
+
+		if err := apply(r.Context(), action); err != nil {
+			http.Error(w, err.Error(), controlStatus(err))
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// controlStatus returns the status a failed control request is answered
+// with.
+func controlStatus(err error) int {
+	var apiErr *hueclient.APIError
+	switch {
+	case errors.Is(err, ErrUnknownBridge):
+		return http.StatusNotFound
+	case errors.Is(err, ErrControlUnsupported):
+		return http.StatusNotImplemented
+	case errors.As(err, &apiErr):
+		// the bridge reports unknown lights, groups and scenes as
+		// unavailable resources
+		if apiErr.Type == 3 {
+			return http.StatusNotFound
+		}
+
+		return http.StatusBadRequest
+	default:
+		return http.StatusBadGateway
+	}
+}
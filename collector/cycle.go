@@ -0,0 +1,76 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// cycleStats reports the duration of the last collection cycle and how far
+// it overran the interval, delaying the cycle after it.
+type cycleStats struct {
+	interval time.Duration
+	// pull cycles are driven by scrapes rather than the interval, so they
+	// can't overrun it.
+	pull bool
+
+	mu       sync.Mutex
+	duration time.Duration
+	done     bool
+}
+
+// observe records the duration of a cycle.
+func (c *cycleStats) observe(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.duration = d
+	c.done = true
+}
+
+func (c *cycleStats) register(inst *instruments) error {
+	if err := inst.float64Gauge(
+		"collect_cycle_duration_seconds",
+		"Duration of the last collection cycle across all jobs and bridges.",
+		unitSeconds,
+		func(ctx context.Context, res metric.Float64ObserverResult) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			if !c.done {
+				return
+			}
+
+			res.Observe(c.duration.Seconds())
+		},
+	); err != nil {
+		return err
+	}
+
+	if c.pull {
+		return nil
+	}
+
+	return inst.float64Gauge(
+		"collect_cycle_overrun_seconds",
+		"Time the last collection cycle ran past the collection interval, 0 when it completed within it.",
+		unitSeconds,
+		func(ctx context.Context, res metric.Float64ObserverResult) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			if !c.done {
+				return
+			}
+
+			overrun := c.duration - c.interval
+			if overrun < 0 {
+				overrun = 0
+			}
+
+			res.Observe(overrun.Seconds())
+		},
+	)
+}
@@ -0,0 +1,237 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/unit"
+)
+
+// DerivedMetric declares a metric computed from the state collected from
+// each bridge by an expression, such as count(lights.on && group ==
+// "Kitchen"), for aggregates otherwise left to recording rules.
+//
+// Lights have the fields id, name, type, modelid, uniqueid, on, bri, hue,
+// sat, ct, colormode, reachable, room, the name of the room of the light,
+// and group, the names of every group of the light. Groups have id, name,
+// type, class, any_on, all_on, on, bri and lights, the number of their
+// lights. Sensors have id, name, type, modelid, uniqueid and the fields of
+// their state and config as the bridge reports them, such as temperature
+// in hundredths of a degree.
+type DerivedMetric struct {
+	// Name is the name of the metric, prefixed as the built-in metrics are.
+	Name string `yaml:"name"`
+	Help string `yaml:"help"`
+	Expr string `yaml:"expr"`
+}
+
+// valid reports why the derived metric can't be registered, if it can't.
+func (d DerivedMetric) valid() error {
+	if !model.IsValidMetricName(model.LabelValue(d.Name)) {
+		return fmt.Errorf("%w: invalid metric name %q", ErrInvalidExpression, d.Name)
+	}
+
+	if _, err := parseExpr(d.Expr); err != nil {
+		return fmt.Errorf("%s: %w", d.Name, err)
+	}
+
+	return nil
+}
+
+// registerDerived registers a gauge for each derived metric, evaluated
+// against the state last collected from each bridge whenever metrics are
+// collected.
+func (g *Gatherer) registerDerived(inst *instruments) error {
+	for _, d := range g.derived {
+		x, err := parseExpr(d.Expr)
+		if err != nil {
+			return fmt.Errorf("%s: %w", d.Name, err)
+		}
+
+		if err := inst.float64Gauge(d.Name, d.Help, unit.Dimensionless, func(ctx context.Context, res metric.Float64ObserverResult) {
+			for _, b := range g.State().Bridges {
+				v, ok := numeric(x.eval(newBridgeScope(b), nil))
+				if !ok || math.IsNaN(v) || math.IsInf(v, 0) {
+					continue
+				}
+
+				res.Observe(v, attribute.String("bridge", b.Name))
+			}
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bridgeScope provides the resources collected from a bridge to the
+// aggregates of an expression.
+type bridgeScope struct {
+	state BridgeState
+	// groups are the names of the groups of each light and rooms the name
+	// of its room, by light id.
+	groups map[string][]string
+	rooms  map[string]string
+}
+
+func newBridgeScope(b BridgeState) *bridgeScope {
+	s := &bridgeScope{
+		state:  b,
+		groups: map[string][]string{},
+		rooms:  map[string]string{},
+	}
+	for _, g := range b.Groups {
+		for _, id := range g.Lights {
+			s.groups[id] = append(s.groups[id], g.Name)
+			if g.Type == "Room" {
+				s.rooms[id] = g.Name
+			}
+		}
+	}
+
+	return s
+}
+
+func (s *bridgeScope) elements(collection string) []element {
+	var elements []element
+	switch collection {
+	case "lights":
+		for _, l := range s.state.Lights {
+			elements = append(elements, s.light(l))
+		}
+	case "groups":
+		for _, g := range s.state.Groups {
+			elements = append(elements, groupElement(g))
+		}
+	case "sensors":
+		for _, sensor := range s.state.Sensors {
+			elements = append(elements, sensorElement(sensor))
+		}
+	}
+
+	return elements
+}
+
+func (s *bridgeScope) light(l Light) element {
+	id := strconv.Itoa(l.ID)
+
+	return func(name string) interface{} {
+		switch name {
+		case "id":
+			return float64(l.ID)
+		case "name":
+			return l.Name
+		case "type":
+			return l.Type
+		case "modelid":
+			return l.ModelID
+		case "uniqueid":
+			return l.UniqueID
+		case "room":
+			return s.rooms[id]
+		case "group":
+			return s.groups[id]
+		}
+
+		st := l.State
+		if st == nil {
+			return nil
+		}
+
+		switch name {
+		case "on":
+			return st.On
+		case "bri":
+			return float64(st.Bri)
+		case "hue":
+			return float64(st.Hue)
+		case "sat":
+			return float64(st.Sat)
+		case "ct":
+			return float64(st.Ct)
+		case "colormode":
+			return st.ColorMode
+		case "reachable":
+			return st.Reachable
+		default:
+			return nil
+		}
+	}
+}
+
+func groupElement(g Group) element {
+	return func(name string) interface{} {
+		switch name {
+		case "id":
+			return float64(g.ID)
+		case "name":
+			return g.Name
+		case "type":
+			return g.Type
+		case "class":
+			return g.Class
+		case "lights":
+			return float64(len(g.Lights))
+		case "any_on", "all_on":
+			if g.GroupState == nil {
+				return nil
+			}
+			if name == "any_on" {
+				return g.GroupState.AnyOn
+			}
+
+			return g.GroupState.AllOn
+		case "on", "bri":
+			if g.State == nil {
+				return nil
+			}
+			if name == "on" {
+				return g.State.On
+			}
+
+			return float64(g.State.Bri)
+		default:
+			return nil
+		}
+	}
+}
+
+func sensorElement(s Sensor) element {
+	return func(name string) interface{} {
+		switch name {
+		case "id":
+			return float64(s.ID)
+		case "name":
+			return s.Name
+		case "type":
+			return s.Type
+		case "modelid":
+			return s.ModelID
+		case "uniqueid":
+			return s.UniqueID
+		}
+
+		if v, ok := s.State[name]; ok {
+			return jsonValue(v)
+		}
+
+		return jsonValue(s.Config[name])
+	}
+}
+
+// jsonValue returns the decoded JSON value as an expression value, nil for
+// objects, lists and null.
+func jsonValue(v interface{}) interface{} {
+	switch v.(type) {
+	case float64, string, bool:
+		return v
+	default:
+		return nil
+	}
+}
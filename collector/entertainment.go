@@ -0,0 +1,121 @@
+package collector
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ninnemana/tracelog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.uber.org/zap"
+)
+
+// entertainmentGroup is a v1 group including the stream state the models omit.
+type entertainmentGroup struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Class  string   `json:"class"`
+	Lights []string `json:"lights"`
+	Stream *struct {
+		Active    bool   `json:"active"`
+		Owner     string `json:"owner"`
+		ProxyMode string `json:"proxymode"`
+	} `json:"stream"`
+}
+
+type entertainment struct {
+	log    *tracelog.TraceLogger
+	hue    rawGetter
+	bridge string
+
+	mu    sync.RWMutex
+	areas map[string]entertainmentGroup
+}
+
+func (e *entertainment) snapshot() map[string]entertainmentGroup {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.areas
+}
+
+func (e *entertainment) Collect(ctx context.Context) func() error {
+	ctx, span := tracer.Start(ctx, "entertainment.Collect")
+	log := e.log.SetContext(ctx)
+
+	return func() error {
+		defer span.End()
+
+		var all map[string]entertainmentGroup
+		if err := e.hue.Get(ctx, "groups", &all); err != nil {
+			log.Error("failed to fetch groups", zap.Error(err))
+
+			return err
+		}
+
+		areas := map[string]entertainmentGroup{}
+		for id, g := range all {
+			if g.Type == "Entertainment" {
+				areas[id] = g
+			}
+		}
+
+		log.Debug("collected entertainment metrics", zap.Int("count", len(areas)))
+
+		e.mu.Lock()
+		e.areas = areas
+		e.mu.Unlock()
+
+		return nil
+	}
+}
+
+func (e *entertainment) register(inst *instruments) error {
+	if err := inst.int64Gauge(
+		"entertainment_streaming_active",
+		"Whether an application such as Hue Sync is streaming to the entertainment area.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			entertainmentObserver(e.bridge, e.snapshot(), func(g entertainmentGroup) int64 {
+				return boolValue(g.Stream != nil && g.Stream.Active)
+			})(ctx, res)
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"entertainment_area_lights",
+		"Number of lights in the entertainment area.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			entertainmentObserver(e.bridge, e.snapshot(), func(g entertainmentGroup) int64 {
+				return int64(len(g.Lights))
+			})(ctx, res)
+		},
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func entertainmentObserver(bridge string, areas map[string]entertainmentGroup, value func(entertainmentGroup) int64) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for id, g := range areas {
+			var owner string
+			if g.Stream != nil {
+				owner = g.Stream.Owner
+			}
+
+			res.Observe(
+				value(g),
+				attribute.String("bridge", bridge),
+				attribute.String("id", id),
+				attribute.String("name", g.Name),
+				attribute.String("owner", owner),
+			)
+		}
+	}
+}
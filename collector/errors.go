@@ -0,0 +1,109 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/ninnemana/hue-exporter/clipv2"
+	"github.com/ninnemana/hue-exporter/hueclient"
+)
+
+var (
+	// ErrBridgeUnreachable is matched by collections which failed to
+	// connect to the bridge.
+	ErrBridgeUnreachable = errors.New("bridge is unreachable")
+
+	// ErrUnauthorized is matched by collections the bridge refused the
+	// username of, the exporter must be paired with it again.
+	ErrUnauthorized = errors.New("bridge refused the username")
+
+	// ErrRateLimited is matched by collections which couldn't send their
+	// requests within the rate limit, or which the bridge turned away as
+	// too busy.
+	ErrRateLimited = errors.New("bridge requests were rate limited")
+
+	// ErrTimeout is matched by collections whose requests timed out.
+	ErrTimeout = errors.New("bridge request timed out")
+)
+
+// unauthorizedUser is the type of the error the v1 API reports for an
+// unknown username.
+const unauthorizedUser = 1
+
+// CollectError is the failure of a job to collect from a bridge. It matches
+// one of ErrBridgeUnreachable, ErrUnauthorized, ErrRateLimited or
+// ErrTimeout through errors.Is when the cause is known, the underlying error
+// is unwrapped as usual.
+type CollectError struct {
+	// Bridge is the name of the bridge, empty for jobs registered through
+	// RegisterJob.
+	Bridge string
+	Job    string
+	// Kind is the sentinel the failure is classified as, nil when unknown.
+	Kind error
+	Err  error
+}
+
+func (e *CollectError) Error() string {
+	if e.Bridge == "" {
+		return fmt.Sprintf("failed to collect %s: %v", e.Job, e.Err)
+	}
+
+	return fmt.Sprintf("failed to collect %s from %s: %v", e.Job, e.Bridge, e.Err)
+}
+
+func (e *CollectError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CollectError) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+// classify returns the sentinel the error of a collection falls under, nil
+// when the cause isn't one of them.
+func classify(err error) error {
+	var (
+		apiErr *hueclient.APIError
+		status *hueclient.StatusError
+		v2     *clipv2.StatusError
+		nerr   net.Error
+	)
+	switch {
+	case errors.Is(err, ErrRateLimited):
+		return ErrRateLimited
+	case errors.As(err, &apiErr):
+		if apiErr.Type == unauthorizedUser {
+			return ErrUnauthorized
+		}
+	case errors.As(err, &status):
+		return statusKind(status.Code)
+	case errors.As(err, &v2):
+		return statusKind(v2.Code)
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrTimeout
+	case errors.As(err, &nerr):
+		if nerr.Timeout() {
+			return ErrTimeout
+		}
+
+		return ErrBridgeUnreachable
+	}
+
+	return nil
+}
+
+// statusKind returns the sentinel a failed response status falls under.
+func statusKind(code int) error {
+	switch code {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return ErrRateLimited
+	}
+
+	return nil
+}
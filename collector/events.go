@@ -0,0 +1,243 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+)
+
+const (
+	// eventBuffer is the number of events buffered for each subscriber,
+	// events are dropped for subscribers falling further behind.
+	eventBuffer = 64
+
+	// eventKeepAlive is the interval comments are sent to idle event
+	// stream clients, keeping proxies from closing the connection.
+	eventKeepAlive = time.Second * 15
+)
+
+// Event types reported for state changes between collection cycles.
+const (
+	EventLightOn         = "light_on"
+	EventLightOff        = "light_off"
+	EventLightBrightness = "light_brightness"
+	EventGroupOn         = "group_on"
+	EventGroupOff        = "group_off"
+	EventSensorUpdated   = "sensor_updated"
+)
+
+// Event is a change in state found between collection cycles.
+type Event struct {
+	Time   time.Time `json:"time"`
+	Type   string    `json:"type"`
+	Bridge string    `json:"bridge"`
+	ID     int       `json:"id"`
+	Name   string    `json:"name"`
+	// Value is the brightness of brightness changes and the state of
+	// updated sensors, Delta the change in brightness.
+	Value interface{} `json:"value,omitempty"`
+	Delta int         `json:"delta,omitempty"`
+}
+
+// broker fans the events found by the jobs out to subscribers.
+type broker struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+func newBroker() *broker {
+	return &broker{
+		subs: map[chan Event]struct{}{},
+	}
+}
+
+// subscribe returns a channel receiving events until ctx is done.
+func (b *broker) subscribe(ctx context.Context) <-chan Event {
+	ch := make(chan Event, eventBuffer)
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		b.mu.Lock()
+		delete(b.subs, ch)
+		close(ch)
+		b.mu.Unlock()
+	}()
+
+	return ch
+}
+
+// publish sends the events to every subscriber, without waiting on
+// subscribers which are behind.
+func (b *broker) publish(events ...Event) {
+	if b == nil || len(events) == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		for _, e := range events {
+			select {
+			case ch <- e:
+			default:
+			}
+		}
+	}
+}
+
+// Subscribe returns a channel receiving the state changes found between
+// collection cycles until ctx is done.
+func (g *Gatherer) Subscribe(ctx context.Context) <-chan Event {
+	return g.events.subscribe(ctx)
+}
+
+// diffLights returns the lights switched on or off and changed in
+// brightness between two collections.
+func diffLights(bridge string, prev, next []hueclient.Light, now time.Time) []Event {
+	before := make(map[int]hueclient.Light, len(prev))
+	for _, l := range prev {
+		before[l.ID] = l
+	}
+
+	var events []Event
+	for _, l := range next {
+		p, ok := before[l.ID]
+		if !ok || p.State == nil || l.State == nil {
+			continue
+		}
+
+		e := Event{Time: now, Bridge: bridge, ID: l.ID, Name: l.Name}
+		switch {
+		case !p.State.On && l.State.On:
+			e.Type = EventLightOn
+			events = append(events, e)
+		case p.State.On && !l.State.On:
+			e.Type = EventLightOff
+			events = append(events, e)
+		}
+
+		if p.State.Bri != l.State.Bri {
+			e.Type = EventLightBrightness
+			e.Value = l.State.Bri
+			e.Delta = int(l.State.Bri) - int(p.State.Bri)
+			events = append(events, e)
+		}
+	}
+
+	return events
+}
+
+// diffGroups returns the groups switched on or off between two
+// collections, a group being on while any of its lights are.
+func diffGroups(bridge string, prev, next []hueclient.Group, now time.Time) []Event {
+	before := make(map[int]hueclient.Group, len(prev))
+	for _, g := range prev {
+		before[g.ID] = g
+	}
+
+	var events []Event
+	for _, g := range next {
+		p, ok := before[g.ID]
+		if !ok || p.GroupState == nil || g.GroupState == nil || p.GroupState.AnyOn == g.GroupState.AnyOn {
+			continue
+		}
+
+		e := Event{Time: now, Type: EventGroupOff, Bridge: bridge, ID: g.ID, Name: g.Name}
+		if g.GroupState.AnyOn {
+			e.Type = EventGroupOn
+		}
+
+		events = append(events, e)
+	}
+
+	return events
+}
+
+// diffSensors returns the sensors whose state was updated between two
+// collections, such as buttons pressed or motion detected.
+func diffSensors(bridge string, prev, next []hueclient.Sensor, now time.Time) []Event {
+	before := make(map[int]hueclient.Sensor, len(prev))
+	for _, s := range prev {
+		before[s.ID] = s
+	}
+
+	var events []Event
+	for _, s := range next {
+		p, ok := before[s.ID]
+		if !ok {
+			continue
+		}
+
+		updated, _ := s.State["lastupdated"].(string)
+		if updated == "" || updated == "none" || updated == p.State["lastupdated"] {
+			continue
+		}
+
+		events = append(events, Event{
+			Time:   now,
+			Type:   EventSensorUpdated,
+			Bridge: bridge,
+			ID:     s.ID,
+			Name:   s.Name,
+			Value:  s.State,
+		})
+	}
+
+	return events
+}
+
+// EventsHandler streams the state changes found by the collector to
+// clients as server-sent events, named after the event type.
+func EventsHandler(c Collector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+
+			return
+		}
+
+		events := c.Subscribe(r.Context())
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		keepAlive := time.NewTicker(eventKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case e, ok := <-events:
+				if !ok {
+					return
+				}
+
+				data, err := json.Marshal(e)
+				if err != nil {
+					continue
+				}
+
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+			case <-r.Context().Done():
+				return
+			}
+
+			flusher.Flush()
+		}
+	})
+}
@@ -0,0 +1,391 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ninnemana/hue-exporter/clipv2"
+	"github.com/ninnemana/tracelog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.uber.org/zap"
+)
+
+const (
+	// streamRetryInterval is how long to wait before reconnecting to the
+	// event stream after it fails.
+	streamRetryInterval = time.Second * 5
+)
+
+// eventState holds the light state of a bridge as reported by the CLIP v2
+// event stream. It is seeded from the resource endpoints on connect and
+// updated as events arrive.
+type eventState struct {
+	log    *tracelog.TraceLogger
+	client *throttledClient
+	bridge string
+
+	presses *buttonTracker
+
+	mu            sync.RWMutex
+	lights        map[string]clipv2.Light
+	groupedLights map[string]clipv2.GroupedLight
+	// buttons maps button resources to their control number on the device.
+	buttons map[string]int
+	scenes  map[string]clipv2.Scene
+	// groupNames maps rooms and zones to their name, labelling the scenes
+	// belonging to them.
+	groupNames map[string]string
+	// recalls counts the recalls of each scene seen on the stream.
+	recalls map[string]int64
+}
+
+func newEventState(log *tracelog.TraceLogger, client *throttledClient, bridge string, legacy bool) *eventState {
+	return &eventState{
+		log:           log,
+		client:        client,
+		bridge:        bridge,
+		presses:       newButtonTracker(bridge, legacy),
+		lights:        map[string]clipv2.Light{},
+		groupedLights: map[string]clipv2.GroupedLight{},
+		buttons:       map[string]int{},
+		scenes:        map[string]clipv2.Scene{},
+		groupNames:    map[string]string{},
+		recalls:       map[string]int64{},
+	}
+}
+
+// run keeps the state subscribed to the event stream until the context is
+// cancelled, reconnecting after failures.
+func (s *eventState) run(ctx context.Context) {
+	for {
+		err := s.subscribe(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.log.SetContext(ctx).Error(
+			"event stream disconnected",
+			zap.String("bridge", s.bridge),
+			zap.Error(err),
+		)
+
+		select {
+		case <-time.After(streamRetryInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *eventState) subscribe(ctx context.Context) error {
+	if err := s.seed(ctx); err != nil {
+		return err
+	}
+
+	return s.client.Subscribe(ctx, s.apply)
+}
+
+// seed replaces the state with the current resources on the bridge so
+// changes missed while disconnected are not lost.
+func (s *eventState) seed(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "eventState.seed")
+	defer span.End()
+
+	lights, err := s.client.Lights(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to seed lights: %w", err)
+	}
+
+	groupedLights, err := s.client.GroupedLights(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to seed grouped lights: %w", err)
+	}
+
+	buttons, err := s.client.Buttons(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to seed buttons: %w", err)
+	}
+
+	scenes, err := s.client.Scenes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to seed scenes: %w", err)
+	}
+
+	rooms, err := s.client.Rooms(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to seed rooms: %w", err)
+	}
+
+	zones, err := s.client.Zones(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to seed zones: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buttons = make(map[string]int, len(buttons))
+	for _, b := range buttons {
+		s.buttons[b.ID] = b.Metadata.ControlID
+	}
+
+	// recalls are kept across reconnects so the counter doesn't reset
+	s.scenes = make(map[string]clipv2.Scene, len(scenes))
+	for _, sc := range scenes {
+		s.scenes[sc.ID] = sc
+	}
+
+	s.groupNames = make(map[string]string, len(rooms)+len(zones))
+	for _, g := range append(rooms, zones...) {
+		s.groupNames[g.ID] = g.Metadata.Name
+	}
+
+	s.lights = make(map[string]clipv2.Light, len(lights))
+	for _, l := range lights {
+		s.lights[l.ID] = l
+	}
+
+	s.groupedLights = make(map[string]clipv2.GroupedLight, len(groupedLights))
+	for _, g := range groupedLights {
+		s.groupedLights[g.ID] = g
+	}
+
+	return nil
+}
+
+func (s *eventState) apply(e clipv2.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range e.Data {
+		switch d.Type {
+		case "light":
+			if e.Type == "delete" {
+				delete(s.lights, d.ID)
+
+				continue
+			}
+
+			l := s.lights[d.ID]
+			l.ID = d.ID
+			if d.Owner != nil {
+				l.Owner = *d.Owner
+			}
+			if d.On != nil {
+				l.On.On = d.On.On
+			}
+			if d.Dimming != nil {
+				l.Dimming = d.Dimming
+			}
+			s.lights[d.ID] = l
+		case "grouped_light":
+			if e.Type == "delete" {
+				delete(s.groupedLights, d.ID)
+
+				continue
+			}
+
+			g := s.groupedLights[d.ID]
+			g.ID = d.ID
+			if d.Owner != nil {
+				g.Owner = *d.Owner
+			}
+			if d.On != nil {
+				g.On.On = d.On.On
+			}
+			if d.Dimming != nil {
+				g.Dimming = d.Dimming
+			}
+			s.groupedLights[d.ID] = g
+		case "button":
+			if e.Type != "update" {
+				continue
+			}
+
+			if err := s.presses.observeEvent(d, s.buttons[d.ID]); err != nil {
+				s.log.Error("failed to record button event", zap.String("bridge", s.bridge), zap.Error(err))
+			}
+		case "scene":
+			if e.Type == "delete" {
+				delete(s.scenes, d.ID)
+				delete(s.recalls, d.ID)
+
+				continue
+			}
+
+			if err := s.applyScene(d); err != nil {
+				s.log.Error("failed to record scene event", zap.String("bridge", s.bridge), zap.Error(err))
+			}
+		}
+	}
+}
+
+// applyScene updates the scene from a CLIP v2 scene event, counting a recall
+// when the bridge reports a new last recall or, on bridges which don't, when
+// the scene becomes active. Callers must hold the lock.
+func (s *eventState) applyScene(d clipv2.EventData) error {
+	var update clipv2.Scene
+	if err := json.Unmarshal(d.Raw, &update); err != nil {
+		return err
+	}
+
+	sc, ok := s.scenes[d.ID]
+	if !ok {
+		sc = update
+	}
+	if update.Metadata.Name != "" {
+		sc.Metadata.Name = update.Metadata.Name
+	}
+	if update.Group.RID != "" {
+		sc.Group = update.Group
+	}
+
+	if update.Status != nil {
+		prev := clipv2.SceneStatus{Active: "inactive"}
+		if sc.Status != nil {
+			prev = *sc.Status
+		}
+
+		status := *update.Status
+		if status.Active == "" {
+			status.Active = prev.Active
+		}
+		if status.LastRecall == "" {
+			status.LastRecall = prev.LastRecall
+		}
+
+		switch {
+		case update.Status.LastRecall != "":
+			if update.Status.LastRecall != prev.LastRecall {
+				s.recalls[d.ID]++
+			}
+		case prev.Active == "inactive" && status.Active != "inactive":
+			s.recalls[d.ID]++
+		}
+
+		sc.Status = &status
+	}
+
+	s.scenes[d.ID] = sc
+
+	return nil
+}
+
+// groups returns the grouped lights currently held by the stream.
+func (s *eventState) groups() []clipv2.GroupedLight {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	groups := make([]clipv2.GroupedLight, 0, len(s.groupedLights))
+	for _, g := range s.groupedLights {
+		groups = append(groups, g)
+	}
+
+	return groups
+}
+
+// register registers the instruments reporting the event stream state. They
+// read the state as it is at collection time.
+func (s *eventState) register(inst *instruments) error {
+	if err := s.presses.register(inst, identifier{}); err != nil {
+		return err
+	}
+
+	if err := inst.int64Counter(
+		"scene_recalled_total",
+		"Number of times the scene was recalled, as reported by the event stream.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+
+			for id, n := range s.recalls {
+				sc := s.scenes[id]
+				res.Observe(
+					n,
+					attribute.String("bridge", s.bridge),
+					attribute.String("id", id),
+					attribute.String("name", sc.Metadata.Name),
+					attribute.String("group", s.groupNames[sc.Group.RID]),
+				)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"v2_light_on",
+		"Whether the light is on, as reported by the event stream.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+
+			for _, l := range s.lights {
+				res.Observe(
+					boolValue(l.On.On),
+					attribute.String("bridge", s.bridge),
+					attribute.String("id", l.ID),
+					attribute.String("name", l.Metadata.Name),
+				)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.float64Gauge(
+		"v2_light_brightness",
+		"Brightness of the light in percent, as reported by the event stream.",
+		unitPercent,
+		func(ctx context.Context, res metric.Float64ObserverResult) {
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+
+			for _, l := range s.lights {
+				if l.Dimming == nil {
+					continue
+				}
+
+				res.Observe(
+					l.Dimming.Brightness,
+					attribute.String("bridge", s.bridge),
+					attribute.String("id", l.ID),
+					attribute.String("name", l.Metadata.Name),
+				)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"grouped_light_on",
+		"Whether any light in the grouped light is on.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			groupedLightOnObserver(s.bridge, s.groups())(ctx, res)
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.float64Gauge(
+		"grouped_light_brightness",
+		"Brightness of grouped lights in percent.",
+		unitPercent,
+		func(ctx context.Context, res metric.Float64ObserverResult) {
+			groupedLightBrightnessObserver(s.bridge, s.groups())(ctx, res)
+		},
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
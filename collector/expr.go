@@ -0,0 +1,613 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// expressions are parsed from a small language over the collected state,
+// deliberately limited to what derived metrics need:
+//
+//	count(lights.on && group == "Kitchen")
+//	avg(sensors.temperature / 100, sensors.type == "ZLLTemperature")
+//	count(lights.reachable) / count(lights)
+//
+// The aggregates count, sum, avg, min and max evaluate their first argument
+// for each of the lights, groups or sensors it refers to, limited to those
+// their optional second argument holds for. Within an aggregate fields are
+// referred to either qualified, lights.on, or bare, on. Outside aggregates
+// only numbers and the arithmetic of aggregates are allowed.
+//
+// Values are numbers, strings, booleans or lists of strings, a list equals
+// a string when any of its elements does. Missing fields and operations on
+// mismatched values evaluate to nothing, which aggregates skip and
+// comparisons are false for.
+
+// collections are the resources aggregates may refer to.
+var collections = map[string]bool{
+	"lights":  true,
+	"groups":  true,
+	"sensors": true,
+}
+
+// aggregates are the functions reducing a collection to a number.
+var aggregates = map[string]bool{
+	"count": true,
+	"sum":   true,
+	"avg":   true,
+	"min":   true,
+	"max":   true,
+}
+
+// element returns the value of the named field of a light, group or
+// sensor, nil when it has none.
+type element func(field string) interface{}
+
+// scope provides the elements of each collection to aggregates.
+type scope interface {
+	elements(collection string) []element
+}
+
+type expr interface {
+	eval(s scope, e element) interface{}
+}
+
+type literal struct {
+	v interface{}
+}
+
+func (l literal) eval(scope, element) interface{} {
+	return l.v
+}
+
+// field is a field of the element being aggregated, the element itself when
+// name is empty, which is always true.
+type field struct {
+	name string
+}
+
+func (f field) eval(_ scope, e element) interface{} {
+	if f.name == "" {
+		return true
+	}
+
+	return e(f.name)
+}
+
+type unary struct {
+	op string
+	x  expr
+}
+
+func (u unary) eval(s scope, e element) interface{} {
+	x := u.x.eval(s, e)
+	switch u.op {
+	case "!":
+		return !truthy(x)
+	default:
+		if n, ok := numeric(x); ok {
+			return -n
+		}
+
+		return nil
+	}
+}
+
+type binary struct {
+	op   string
+	x, y expr
+}
+
+func (b binary) eval(s scope, e element) interface{} {
+	switch b.op {
+	case "&&":
+		return truthy(b.x.eval(s, e)) && truthy(b.y.eval(s, e))
+	case "||":
+		return truthy(b.x.eval(s, e)) || truthy(b.y.eval(s, e))
+	}
+
+	x, y := b.x.eval(s, e), b.y.eval(s, e)
+	if x == nil || y == nil {
+		switch b.op {
+		case "==", "<", "<=", ">", ">=":
+			return false
+		case "!=":
+			return true
+		default:
+			// arithmetic on a missing field is skipped by aggregates
+			return nil
+		}
+	}
+
+	switch b.op {
+	case "==":
+		return equal(x, y)
+	case "!=":
+		return !equal(x, y)
+	case "<", "<=", ">", ">=":
+		c, ok := compare(x, y)
+		if !ok {
+			return false
+		}
+
+		switch b.op {
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		default:
+			return c >= 0
+		}
+	}
+
+	a, ok := numeric(x)
+	if !ok {
+		return nil
+	}
+	c, ok := numeric(y)
+	if !ok {
+		return nil
+	}
+
+	switch b.op {
+	case "+":
+		return a + c
+	case "-":
+		return a - c
+	case "*":
+		return a * c
+	default:
+		if c == 0 {
+			return nil
+		}
+
+		return a / c
+	}
+}
+
+// aggregate reduces the elements of collection the filter holds for to a
+// number, nil when there are none to reduce other than for count.
+type aggregate struct {
+	fn         string
+	collection string
+	x, filter  expr
+}
+
+func (a aggregate) eval(s scope, _ element) interface{} {
+	var (
+		n      int
+		result float64
+	)
+	for _, e := range s.elements(a.collection) {
+		if a.filter != nil && !truthy(a.filter.eval(s, e)) {
+			continue
+		}
+
+		x := a.x.eval(s, e)
+		if a.fn == "count" {
+			if truthy(x) {
+				n++
+			}
+
+			continue
+		}
+
+		v, ok := numeric(x)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case n == 0:
+			result = v
+		case a.fn == "min":
+			result = math.Min(result, v)
+		case a.fn == "max":
+			result = math.Max(result, v)
+		default:
+			result += v
+		}
+		n++
+	}
+
+	switch {
+	case a.fn == "count":
+		return float64(n)
+	case n == 0:
+		return nil
+	case a.fn == "avg":
+		return result / float64(n)
+	default:
+		return result
+	}
+}
+
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []string:
+		return len(v) > 0
+	default:
+		return false
+	}
+}
+
+// numeric returns the value as a number, counting booleans as 0 or 1.
+func numeric(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case bool:
+		return float64(boolValue(v)), true
+	default:
+		return 0, false
+	}
+}
+
+func equal(x, y interface{}) bool {
+	if list, ok := x.([]string); ok {
+		for _, item := range list {
+			if equal(item, y) {
+				return true
+			}
+		}
+
+		return false
+	}
+	if _, ok := y.([]string); ok {
+		return equal(y, x)
+	}
+
+	if a, ok := numeric(x); ok {
+		b, ok := numeric(y)
+
+		return ok && a == b
+	}
+
+	return x == y
+}
+
+func compare(x, y interface{}) (int, bool) {
+	if a, ok := x.(string); ok {
+		b, ok := y.(string)
+
+		return strings.Compare(a, b), ok
+	}
+
+	a, ok := numeric(x)
+	if !ok {
+		return 0, false
+	}
+	b, ok := numeric(y)
+	if !ok {
+		return 0, false
+	}
+
+	switch {
+	case a < b:
+		return -1, true
+	case a > b:
+		return 1, true
+	default:
+		return 0, true
+	}
+}
+
+// token is a lexed token of an expression, text holding the unquoted value
+// of strings.
+type token struct {
+	kind string
+	text string
+	pos  int
+}
+
+const (
+	tokenEOF    = "end of expression"
+	tokenNumber = "number"
+	tokenString = "string"
+	tokenIdent  = "identifier"
+	tokenOp     = "operator"
+)
+
+// operators are ordered so longer operators are lexed first.
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "(", ")", ",", "."}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c):
+			start := i
+			for i < len(src) && (unicode.IsDigit(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: src[start:i], pos: start})
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(src) && (src[i] == '_' || unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i]))) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: src[start:i], pos: start})
+		case c == '"':
+			start := i
+			for i++; i < len(src) && src[i] != '"'; i++ {
+				if src[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(src) {
+				return nil, fmt.Errorf("%w: unterminated string at %d", ErrInvalidExpression, start)
+			}
+			i++
+
+			s, err := strconv.Unquote(src[start:i])
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid string at %d: %v", ErrInvalidExpression, start, err)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: s, pos: start})
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("%w: unexpected %q at %d", ErrInvalidExpression, c, i)
+			}
+			tokens = append(tokens, token{kind: tokenOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, pos: len(src)}), nil
+}
+
+// parser parses expressions by recursive descent, collection being the
+// collection of the aggregate being parsed, if any.
+type parser struct {
+	tokens     []token
+	pos        int
+	collection string
+	// inAggregate is set while parsing the arguments of an aggregate.
+	inAggregate bool
+}
+
+// parseExpr parses the expression of a derived metric.
+func parseExpr(src string) (expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	x, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.unexpected(t)
+	}
+
+	return x, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+
+	return t
+}
+
+// accept consumes the next token if it is one of the operators.
+func (p *parser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokenOp {
+		return "", false
+	}
+
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+
+			return op, true
+		}
+	}
+
+	return "", false
+}
+
+func (p *parser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		return p.unexpected(p.peek())
+	}
+
+	return nil
+}
+
+func (p *parser) unexpected(t token) error {
+	if t.kind == tokenEOF {
+		return fmt.Errorf("%w: unexpected end of expression", ErrInvalidExpression)
+	}
+
+	return fmt.Errorf("%w: unexpected %s %q at %d", ErrInvalidExpression, t.kind, t.text, t.pos)
+}
+
+// binaryLevel parses a left associative sequence of operands separated by
+// the operators.
+func (p *parser) binaryLevel(operand func() (expr, error), ops ...string) (expr, error) {
+	x, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.accept(ops...)
+		if !ok {
+			return x, nil
+		}
+
+		y, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		x = binary{op: op, x: x, y: y}
+	}
+}
+
+func (p *parser) or() (expr, error) {
+	return p.binaryLevel(p.and, "||")
+}
+
+func (p *parser) and() (expr, error) {
+	return p.binaryLevel(p.comparison, "&&")
+}
+
+func (p *parser) comparison() (expr, error) {
+	return p.binaryLevel(p.additive, "==", "!=", "<=", ">=", "<", ">")
+}
+
+func (p *parser) additive() (expr, error) {
+	return p.binaryLevel(p.multiplicative, "+", "-")
+}
+
+func (p *parser) multiplicative() (expr, error) {
+	return p.binaryLevel(p.unary, "*", "/")
+}
+
+func (p *parser) unary() (expr, error) {
+	if op, ok := p.accept("!", "-"); ok {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+
+		return unary{op: op, x: x}, nil
+	}
+
+	return p.primary()
+}
+
+func (p *parser) primary() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid number %q at %d", ErrInvalidExpression, t.text, t.pos)
+		}
+
+		return literal{v: n}, nil
+	case tokenString:
+		return literal{v: t.text}, nil
+	case tokenIdent:
+		switch {
+		case t.text == "true" || t.text == "false":
+			return literal{v: t.text == "true"}, nil
+		case aggregates[t.text]:
+			return p.aggregate(t)
+		default:
+			return p.field(t)
+		}
+	case tokenOp:
+		if t.text == "(" {
+			x, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+
+			return x, p.expect(")")
+		}
+	}
+
+	return nil, p.unexpected(t)
+}
+
+// aggregate parses the arguments of an aggregate, inferring its collection
+// from the fields they refer to.
+func (p *parser) aggregate(fn token) (expr, error) {
+	if p.inAggregate {
+		return nil, fmt.Errorf("%w: %s at %d is nested in another aggregate", ErrInvalidExpression, fn.text, fn.pos)
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	p.inAggregate, p.collection = true, ""
+	defer func() {
+		p.inAggregate = false
+	}()
+
+	a := aggregate{fn: fn.text}
+	x, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	a.x = x
+
+	if _, ok := p.accept(","); ok {
+		if a.filter, err = p.or(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	if p.collection == "" {
+		return nil, fmt.Errorf("%w: %s at %d doesn't refer to lights, groups or sensors", ErrInvalidExpression, fn.text, fn.pos)
+	}
+	a.collection = p.collection
+
+	return a, nil
+}
+
+// field parses a reference to a field of the element being aggregated,
+// either qualified by its collection or bare.
+func (p *parser) field(t token) (expr, error) {
+	if !p.inAggregate {
+		return nil, fmt.Errorf("%w: %q at %d is outside of an aggregate", ErrInvalidExpression, t.text, t.pos)
+	}
+
+	if !collections[t.text] {
+		return field{name: t.text}, nil
+	}
+
+	if p.collection != "" && p.collection != t.text {
+		return nil, fmt.Errorf("%w: %s at %d in an aggregate of %s", ErrInvalidExpression, t.text, t.pos, p.collection)
+	}
+	p.collection = t.text
+
+	if _, ok := p.accept("."); !ok {
+		return field{}, nil
+	}
+
+	name := p.next()
+	if name.kind != tokenIdent {
+		return nil, p.unexpected(name)
+	}
+
+	return field{name: name.text}, nil
+}
@@ -0,0 +1,91 @@
+package collector
+
+import "testing"
+
+// fieldScope provides sensors with the given fields to aggregates.
+type fieldScope []map[string]interface{}
+
+func (s fieldScope) elements(string) []element {
+	elements := make([]element, 0, len(s))
+	for _, fields := range s {
+		fields := fields
+		elements = append(elements, func(name string) interface{} {
+			return fields[name]
+		})
+	}
+
+	return elements
+}
+
+func TestBinaryNilOperands(t *testing.T) {
+	missing := field{name: "missing"}
+	one := literal{v: 1.0}
+	// the element has none of the fields referred to
+	empty := func(string) interface{} { return nil }
+
+	tests := []struct {
+		op   string
+		want interface{}
+	}{
+		{op: "+", want: nil},
+		{op: "-", want: nil},
+		{op: "*", want: nil},
+		{op: "/", want: nil},
+		{op: "==", want: false},
+		{op: "!=", want: true},
+		{op: "<", want: false},
+		{op: "<=", want: false},
+		{op: ">", want: false},
+		{op: ">=", want: false},
+		{op: "&&", want: false},
+		{op: "||", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.op, func(t *testing.T) {
+			for _, b := range []binary{
+				{op: tt.op, x: missing, y: one},
+				{op: tt.op, x: one, y: missing},
+			} {
+				if got := b.eval(nil, empty); got != tt.want {
+					t.Errorf("%v %s %v = %v, want %v", b.x, tt.op, b.y, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAggregateSkipsMissingFields(t *testing.T) {
+	sensors := fieldScope{
+		{"type": "ZLLTemperature", "temperature": 2100.0},
+		{"type": "ZLLTemperature", "temperature": 2300.0},
+		{"type": "ZLLPresence", "presence": true},
+		{"type": "Daylight", "daylight": false},
+	}
+
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{expr: "avg(sensors.temperature / 100)", want: 22.0},
+		{expr: "sum(sensors.temperature - 100)", want: 4200.0},
+		{expr: "min(sensors.temperature * 2)", want: 4200.0},
+		{expr: "max(sensors.temperature + 1)", want: 2301.0},
+		{expr: "count(sensors.temperature / 100 > 21)", want: 1.0},
+		{expr: "count(sensors.temperature != 2100)", want: 3.0},
+		{expr: "avg(sensors.lightlevel / 100)", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			x, err := parseExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+
+			if got := x.eval(sensors, nil); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
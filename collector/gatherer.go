@@ -4,17 +4,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
 	"net/http"
-	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/amimof/huego"
+	"github.com/ninnemana/hue-exporter/clipv2"
+	"github.com/ninnemana/hue-exporter/discovery"
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"github.com/ninnemana/hue-exporter/openmetrics"
 	"github.com/ninnemana/tracelog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
-	"go.opentelemetry.io/otel/metric/unit"
-
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 )
@@ -24,82 +29,570 @@ var (
 )
 
 type HueConfig struct {
+	// Name identifies the bridge through the `bridge` label attached to
+	// every series, defaults to the bridge address when empty.
+	Name string
+	// ID is the bridge identifier, used to find the bridge again through
+	// discovery when its address changes.
+	ID       string
 	IP       string
 	Username string
+	// ClipV2 enables collection of CLIP v2 resources alongside the v1 API.
+	ClipV2 bool
+}
+
+// bridge is a configured Hue bridge along with the name used to label the
+// metrics collected from it.
+type bridge struct {
+	name string
+	id   string
+	// hue addresses a configured bridge, api replaces it for bridges
+	// provided through WithBridge.
+	hue *hueclient.Client
+	api Bridge
+	v2  *clipv2.Client
 }
 
 type Gatherer struct {
-	log    *tracelog.TraceLogger
-	meter  metric.Meter
-	ticker *time.Ticker
-	hue    *huego.Bridge
-	jobs   []CollectJob
+	log *tracelog.TraceLogger
+	// meters report the collected state through OTel, registry through a
+	// native Prometheus collector. Any combination may be configured.
+	meters   []metric.Meter
+	registry prometheus.Registerer
+	// handler serves the metrics from ServeHTTP.
+	handler http.Handler
+	// prefix is applied to metric names served from the collected state
+	// when no handler is configured.
+	prefix string
+	// labels are attached to every series, replace rewrites substrings of
+	// label values.
+	labels  map[string]string
+	replace map[string]string
+	// seriesLimit caps the series of each metric and valueLimit the length
+	// of label values, both are unlimited when zero.
+	seriesLimit int
+	valueLimit  int
+	// interval is the time between the start of collection cycles, which
+	// are delayed by up to jitter and optionally aligned to multiples of
+	// the interval on the wall clock.
+	interval time.Duration
+	jitter   time.Duration
+	align    bool
+	rand     *rand.Rand
+	bridges  []bridge
+	jobs     []*trackedJob
+	// snapshots share the resources fetched from each bridge between the
+	// jobs of a cycle.
+	snapshots []*snapshotBridge
+	// searchers start searches for new devices on the bridges able to, by
+	// bridge name, actuators change the state of their lights.
+	searchers map[string]searcher
+	actuators map[string]actuator
+	// datastore fetches most resources through a single request for the
+	// full datastore of each bridge.
+	datastore bool
+	// events fans out the state changes found between cycles.
+	events *broker
+	// custom are the jobs registered by applications embedding the
+	// collector, run alongside the jobs of every bridge.
+	custom []customJob
+	// disabled are the collectors not run against any bridge.
+	disabled map[string]bool
+	// mappings declare the metrics reported from fields of the resources
+	// of each bridge.
+	mappings []FieldMapping
+	// derived are the metrics computed from the state collected from each
+	// bridge.
+	derived []DerivedMetric
+	// breakers back off collection from each bridge while it is
+	// unreachable, up to maxBackoff between attempts.
+	breakers   map[string]*breaker
+	maxBackoff time.Duration
+	// throttle paces and bounds the requests of every job, timeout bounds
+	// each collection cycle.
+	throttle *throttle
+	timeout  time.Duration
+	// concurrency bounds the requests in flight to each bridge.
+	concurrency int
+	// client sends the v1 API requests to the bridges.
+	client *http.Client
+
+	// clock schedules the cycles, which wait on tickers created by
+	// newTicker.
+	clock     Clock
+	newTicker TickerFactory
+
+	discover discovery.Discoverer
+
+	// eventStream replaces polling of CLIP v2 light state with a subscription
+	// to the bridge event stream.
+	eventStream bool
+	streams     []*eventState
+
+	// pull disables the background collection loop, collection is instead driven by
+	// calls to Collect, typically as metrics are scraped.
+	pull     bool
+	cacheTTL time.Duration
+	// staleTTL bounds how long the state of failing jobs is reported.
+	staleTTL time.Duration
+
+	build buildInfo
+	cycle cycleStats
+	// power is the power drawn at full brightness by each light model.
+	power map[string]float64
+	// temperatureUnits are the units temperatures are reported in.
+	temperatureUnits []TemperatureUnit
+	// legacy also reports metrics in the form used before their units and
+	// types were corrected.
+	legacy bool
+	// uniqueIDs identifies lights and sensors by their uniqueid.
+	uniqueIDs bool
+	// names labels light and sensor metrics with the device name.
+	names bool
+
+	mu          sync.Mutex
+	lastCollect time.Time
 }
 
 func NewGatherer(opts ...Option) (Collector, error) {
 	g := &Gatherer{
-		ticker: time.NewTicker(time.Second * 5),
+		interval:   time.Second * 5,
+		prefix:     "hue_",
+		breakers:   map[string]*breaker{},
+		searchers:  map[string]searcher{},
+		actuators:  map[string]actuator{},
+		maxBackoff: defaultMaxBackoff,
+		throttle:   newThrottle(),
+		client:     http.DefaultClient,
+		events:     newBroker(),
+		timeout:    defaultCycleTimeout,
+		build:      buildInfo{version: "unknown", revision: "unknown"},
+		power:      DefaultPowerTable,
+		clock:      systemClock{},
+		// requests to each bridge are bounded unless configured otherwise
+		concurrency: defaultConcurrency,
+		// temperatures are reported in Celsius unless configured otherwise
+		temperatureUnits: []TemperatureUnit{Celsius},
+		// jitter only needs to differ between exporters
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())), //nolint:gosec
 	}
 	for _, opt := range opts {
 		opt(g)
 	}
 
+	if g.newTicker == nil {
+		g.newTicker = g.clock.NewTicker
+	}
+
 	if err := g.valid(); err != nil {
 		return nil, err
 	}
 
-	g.jobs = []CollectJob{
-		&lights{
-			log:   g.log,
-			meter: g.meter,
-			hue:   g.hue,
-		},
-		&groups{
-			log:   g.log,
-			meter: g.meter,
-			hue:   g.hue,
-		},
-		&sensors{
-			log:   g.log,
-			meter: g.meter,
-			hue:   g.hue,
-		},
+	for _, b := range g.bridges {
+		api := b.api
+		if api == nil {
+			api = hueBridge(b.hue, g.client)
+		}
+		throttle := g.throttle.forBridge(g.concurrency)
+		hue := newSnapshotBridge(&throttledBridge{Bridge: api, throttle: throttle})
+		if raw, ok := api.(rawGetter); ok {
+			hue.raw = &throttledRaw{rawGetter: raw, throttle: throttle}
+			if g.datastore {
+				hue.full = hue.raw
+			}
+		}
+		g.snapshots = append(g.snapshots, hue)
+		if s, ok := api.(searcher); ok {
+			g.searchers[b.name] = &throttledSearcher{searcher: s, throttle: throttle}
+		}
+		if a, ok := api.(actuator); ok {
+			g.actuators[b.name] = &throttledActuator{actuator: a, throttle: throttle}
+		}
+
+		g.addJob(b, "lights", &lights{
+			log:    g.log,
+			hue:    hue,
+			bridge: b.name,
+			events: g.events,
+			clock:  g.clock,
+			power:  g.power,
+			legacy: g.legacy,
+			// identified by uniqueid and name when configured
+			uniqueIDs: g.uniqueIDs,
+			names:     g.names,
+		})
+		g.addJob(b, "groups", &groups{
+			log:    g.log,
+			hue:    hue,
+			bridge: b.name,
+			events: g.events,
+			clock:  g.clock,
+			legacy: g.legacy,
+		})
+		g.addJob(b, "sensors", &sensors{
+			log:     g.log,
+			hue:     hue,
+			bridge:  b.name,
+			events:  g.events,
+			clock:   g.clock,
+			buttons: newButtonTracker(b.name, g.legacy),
+			units:   g.temperatureUnits,
+			legacy:  g.legacy,
+			// identified by uniqueid and name when configured
+			uniqueIDs: g.uniqueIDs,
+			names:     g.names,
+		})
+		g.addJob(b, "scenes", &scenes{
+			log:    g.log,
+			hue:    hue,
+			bridge: b.name,
+		})
+		g.addJob(b, "schedules", &schedules{
+			log:    g.log,
+			hue:    hue,
+			bridge: b.name,
+		})
+		g.addJob(b, "rules", &rules{
+			log:    g.log,
+			hue:    hue,
+			bridge: b.name,
+			legacy: g.legacy,
+		})
+		g.addJob(b, "config", &bridgeConfig{
+			log:    g.log,
+			hue:    hue,
+			bridge: b.name,
+		})
+
+		if links, ok := api.(resourcelinker); ok {
+			g.addJob(b, "resourcelinks", &resourcelinks{
+				log:    g.log,
+				links:  &throttledResourcelinker{resourcelinker: links, throttle: throttle},
+				hue:    hue,
+				bridge: b.name,
+			})
+		}
+
+		if hue.raw != nil {
+			g.addJob(b, "entertainment", &entertainment{
+				log:    g.log,
+				hue:    rawSnapshot{hue},
+				bridge: b.name,
+			})
+
+			if len(g.mappings) > 0 {
+				g.addJob(b, "mappings", &mappings{
+					log:      g.log,
+					hue:      rawSnapshot{hue},
+					bridge:   b.name,
+					mappings: g.mappings,
+				})
+			}
+		}
+
+		if b.v2 != nil && !g.disabled["v2"] {
+			client := &throttledClient{Client: b.v2, throttle: throttle}
+
+			g.addJob(b, "v2", &v2Resources{
+				log:      g.log,
+				client:   client,
+				bridge:   b.name,
+				streamed: g.eventStream,
+			})
+
+			if g.eventStream {
+				g.streams = append(g.streams, newEventState(g.log, client, b.name, g.legacy))
+			}
+		}
+	}
+
+	for _, c := range g.custom {
+		g.jobs = append(g.jobs, &trackedJob{
+			CollectJob: c.job,
+			name:       c.name,
+			clock:      g.clock,
+			ttl:        g.staleTTL,
+		})
+	}
+
+	// instruments are registered once, reporting whatever state their job
+	// last collected
+	inst := newInstruments(g.meters, g.labels, g.replace)
+	inst.seriesLimit, inst.valueLimit = g.seriesLimit, g.valueLimit
+
+	g.build.start = time.Now()
+	if err := g.build.register(inst); err != nil {
+		return nil, err
+	}
+
+	g.cycle.interval, g.cycle.pull = g.interval, g.pull
+	if err := g.cycle.register(inst); err != nil {
+		return nil, err
+	}
+
+	for _, job := range g.jobs {
+		if err := job.register(inst); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, b := range g.breakers {
+		if err := b.register(inst); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range g.streams {
+		if err := s.register(inst); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := g.registerDerived(inst); err != nil {
+		return nil, err
+	}
+
+	// registered last so it counts the series the others dropped during the
+	// same collection
+	if g.seriesLimit > 0 {
+		if err := inst.registerOverflow(); err != nil {
+			return nil, err
+		}
+	}
+
+	if g.registry != nil {
+		if err := g.registry.Register(&promCollector{inst: inst}); err != nil {
+			return nil, fmt.Errorf("failed to register prometheus collector: %w", err)
+		}
+	}
+
+	// without an exporter handler the collected state is served directly
+	if g.handler == nil {
+		reg := prometheus.NewRegistry()
+		if err := reg.Register(&promCollector{inst: inst, prefix: g.prefix}); err != nil {
+			return nil, fmt.Errorf("failed to register prometheus collector: %w", err)
+		}
+
+		mirrored := MirroredCounters(g.mappings...)
+		for i := range mirrored {
+			mirrored[i] = g.prefix + mirrored[i]
+		}
+		g.handler = openmetrics.Handler(reg, openmetrics.WithoutCreated(mirrored...))
 	}
 
 	return g, nil
 }
 
+// addJob adds a job collecting from the bridge, tracking the health of its
+// collections under name, reported as the collector label since Prometheus
+// reserves job for the scrape target.
+func (g *Gatherer) addJob(b bridge, name string, job CollectJob) {
+	if g.disabled[name] {
+		return
+	}
+
+	br, ok := g.breakers[b.name]
+	if !ok {
+		br = newBreaker(b.name, g.interval, g.maxBackoff)
+		g.breakers[b.name] = br
+	}
+
+	g.jobs = append(g.jobs, &trackedJob{
+		CollectJob: job,
+		name:       name,
+		bridge:     b.name,
+		breaker:    br,
+		clock:      g.clock,
+		ttl:        g.staleTTL,
+	})
+}
+
 var (
 	// ErrInvalidLogger is thrown when the logger provided does not satisfy
 	// requirements.
 	ErrInvalidLogger = errors.New("the provided logger is not valid")
+
+	// ErrNoBridges is thrown when no Hue bridge was configured to collect
+	// from.
+	ErrNoBridges = errors.New("no hue bridges were configured")
+
+	// ErrInvalidBridgeName is thrown when a bridge is configured without a
+	// name to label its series with, or with the name of another bridge,
+	// whose series it would overwrite.
+	ErrInvalidBridgeName = errors.New("invalid bridge name")
+
+	// ErrInvalidTemperatureUnit is thrown when temperatures are configured
+	// to be reported in a unit other than Celsius or Fahrenheit.
+	ErrInvalidTemperatureUnit = errors.New("temperature unit must be celsius or fahrenheit")
+
+	// ErrInvalidLabel is thrown when a static label has a name Prometheus
+	// does not accept.
+	ErrInvalidLabel = errors.New("invalid static label name")
+
+	// ErrInvalidJob is thrown when a custom job is registered without a
+	// name or implementation.
+	ErrInvalidJob = errors.New("invalid custom job")
+
+	// ErrSearchUnsupported is returned by Scan when none of the bridges is
+	// able to search for new devices.
+	ErrSearchUnsupported = errors.New("no bridge supports searching for new devices")
+
+	// ErrUnknownCollector is thrown when a collector other than those listed
+	// in Collectors is disabled.
+	ErrUnknownCollector = errors.New("unknown collector")
+
+	// ErrInvalidMapping is thrown when a field mapping can't be registered.
+	ErrInvalidMapping = errors.New("invalid field mapping")
+
+	// ErrInvalidExpression is thrown when a derived metric can't be
+	// registered, typically because its expression doesn't parse.
+	ErrInvalidExpression = errors.New("invalid derived metric")
 )
 
-func (g Gatherer) valid() error {
+// Collectors are the names of the collectors run against each bridge, which
+// are reported as the collector label of their health metrics.
+var Collectors = []string{
+	"lights",
+	"groups",
+	"sensors",
+	"scenes",
+	"schedules",
+	"rules",
+	"config",
+	"resourcelinks",
+	"entertainment",
+	"mappings",
+	"v2",
+}
+
+// MirroredCounters returns the names of the counters mirroring counts kept
+// by the bridge, or derived from its state, which started before the
+// exporter first saw them: how often rules triggered, button presses and
+// the counters declared by the field mappings.
+func MirroredCounters(mappings ...FieldMapping) []string {
+	names := []string{"rule_triggered_total", "rule_triggered", "button_presses_total", "button_presses"}
+	for _, m := range mappings {
+		if m.Type == "counter" {
+			names = append(names, m.Name)
+		}
+	}
+
+	return names
+}
+
+func (g *Gatherer) valid() error {
 	if g.log == nil {
 		return ErrInvalidLogger
 	}
 
+	if len(g.bridges) == 0 {
+		return ErrNoBridges
+	}
+
+	names := make(map[string]bool, len(g.bridges))
+	for _, b := range g.bridges {
+		if b.name == "" {
+			return fmt.Errorf("%w: a bridge has no name", ErrInvalidBridgeName)
+		}
+		if names[b.name] {
+			return fmt.Errorf("%w: %q is configured more than once", ErrInvalidBridgeName, b.name)
+		}
+		names[b.name] = true
+	}
+
+	for name := range g.labels {
+		if !model.LabelName(name).IsValid() {
+			return fmt.Errorf("%w: %q", ErrInvalidLabel, name)
+		}
+	}
+
+	for _, u := range g.temperatureUnits {
+		if u != Celsius && u != Fahrenheit {
+			return fmt.Errorf("%w: %q", ErrInvalidTemperatureUnit, u)
+		}
+	}
+
+	for _, c := range g.custom {
+		if c.name == "" || c.job == nil {
+			return fmt.Errorf("%w: %q", ErrInvalidJob, c.name)
+		}
+	}
+
+	for name := range g.disabled {
+		if !knownCollector(name) {
+			return fmt.Errorf("%w: %q", ErrUnknownCollector, name)
+		}
+	}
+
+	for _, m := range g.mappings {
+		if err := m.valid(); err != nil {
+			return err
+		}
+	}
+
+	for _, d := range g.derived {
+		if err := d.valid(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+func knownCollector(name string) bool {
+	for _, c := range Collectors {
+		if c == name {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (g *Gatherer) Run(ctx context.Context) error {
+	for _, s := range g.streams {
+		go s.run(ctx)
+	}
+
+	if g.pull {
+		<-ctx.Done()
+
+		return ctx.Err()
+	}
+
+	ticker := g.newTicker(g.interval)
+	defer ticker.Stop()
+
 	for {
 		ctx, span := tracer.Start(ctx, "collector/gatherer.Run")
 		log := g.log.SetContext(ctx)
+		start := g.clock.Now()
 
-		grp, _ := errgroup.WithContext(ctx)
+		if err := g.Collect(ctx); err != nil {
+			log.Error("job failed to collect metrics", zap.Error(err))
 
-		for _, job := range g.jobs {
-			grp.Go(job.Collect(ctx))
+			var cerr *CollectError
+			if errors.Is(err, ErrUnauthorized) && errors.As(err, &cerr) {
+				log.Warn("bridge refused the username, pair the exporter with it again", zap.String("bridge", cerr.Bridge))
+			}
 		}
 
-		if err := grp.Wait(); err != nil {
-			log.Error("job failed to collect metrics", zap.Error(err))
+		// a tick delivered while collecting would cut the wait short
+		select {
+		case <-ticker.C():
+		default:
 		}
 
+		wait := g.next(start).Sub(g.clock.Now())
+		if wait <= 0 {
+			// tickers require a positive period, the cycle overran so
+			// the next one starts right away
+			wait = time.Nanosecond
+		}
+		ticker.Reset(wait)
+
 		select {
-		case <-g.ticker.C:
+		case <-ticker.C():
 			span.End()
 		case <-ctx.Done():
 			err := ctx.Err()
@@ -113,300 +606,348 @@ func (g *Gatherer) Run(ctx context.Context) error {
 	}
 }
 
-func (g *Gatherer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// g.exporter.ServeHTTP(w, r)
-}
+// next returns the time the cycle following one started at start should run.
+func (g *Gatherer) next(start time.Time) time.Time {
+	next := start.Add(g.interval)
+	if g.align {
+		next = start.Truncate(g.interval).Add(g.interval)
+	}
 
-type CollectJob interface {
-	Collect(context.Context) func() error
-}
+	if g.jitter > 0 {
+		next = next.Add(time.Duration(g.rand.Int63n(int64(g.jitter))))
+	}
 
-type lights struct {
-	log   *tracelog.TraceLogger
-	hue   *huego.Bridge
-	meter metric.Meter
+	return next
 }
 
-func (l *lights) Collect(ctx context.Context) func() error {
-	ctx, span := tracer.Start(ctx, "lights.Collect")
-	log := l.log.SetContext(ctx)
-	return func() error {
-		defer span.End()
-
-		hueGroups, err := l.hue.GetGroupsContext(ctx)
-		if err != nil {
-			log.Error("failed to fetch groups", zap.Error(err))
+// Collect runs a single collection cycle across all jobs. When a cache TTL is
+// configured, calls made within the TTL of the last successful cycle are
+// served from the previously collected state without contacting the bridge.
+// Jobs failing to collect are reported as a *CollectError.
+func (g *Gatherer) Collect(ctx context.Context) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 
-			return err
-		}
+	if g.cacheTTL > 0 && g.clock.Now().Sub(g.lastCollect) < g.cacheTTL {
+		return nil
+	}
 
-		var groups lightGroups
-		for _, group := range hueGroups {
-			groups = append(groups, lightGroup{group})
-		}
+	ctx, span := tracer.Start(ctx, "collector/gatherer.Collect")
+	defer span.End()
 
-		lights, err := l.hue.GetLightsContext(ctx)
-		if err != nil {
-			log.Error("failed to fetch lights", zap.Error(err))
+	start := g.clock.Now()
+	defer func() {
+		g.cycle.observe(g.clock.Now().Sub(start))
+	}()
 
-			return err
-		}
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
 
-		log.Info("collecting lights", zap.Int("count", len(lights)))
-		if _, err := l.meter.NewInt64GaugeObserver(
-			"light",
-			lightObserver(lights, groups),
-			metric.WithDescription("Number of lights in the current state. Includes brightness, identifer, and on state."),
-			metric.WithUnit(unit.Dimensionless),
-		); err != nil {
-			log.Error("failed to record light count", zap.Error(err))
+	for _, s := range g.snapshots {
+		s.reset()
+	}
 
-			return fmt.Errorf("failed to collect light count: %w", err)
+	// bridges failing to be located are skipped, the others are collected
+	// from before the cycle is failed
+	var (
+		unlocated    []*bridge
+		undiscovered map[string]error
+		discoverErr  error
+	)
+	for i := range g.bridges {
+		if g.bridges[i].hue != nil && g.bridges[i].hue.Host() == "" {
+			unlocated = append(unlocated, &g.bridges[i])
+		}
+	}
+	if len(unlocated) > 0 {
+		undiscovered = g.rediscover(ctx, unlocated)
+	}
+	for _, b := range unlocated {
+		err, ok := undiscovered[b.name]
+		if !ok {
+			continue
 		}
 
-		log.Info("collecting light brightness", zap.Int("count", len(lights)))
-		if _, err := l.meter.NewInt64GaugeObserver(
-			"light_brightness",
-			lightBrightnessObserver(lights, groups),
-			metric.WithDescription("Brightness of lights."),
-			metric.WithUnit(unit.Dimensionless),
-		); err != nil {
-			log.Error("failed to record light brightness", zap.Error(err))
-
-			return fmt.Errorf("failed to collect light brightness: %w", err)
+		g.log.SetContext(ctx).Error("failed to rediscover bridge", zap.Error(err))
+		if br, ok := g.breakers[b.name]; ok {
+			br.collected(false)
 		}
+		if discoverErr == nil {
+			discoverErr = err
+		}
+	}
 
-		log.Info("collected light metrics")
+	grp, _ := errgroup.WithContext(ctx)
+
+	// bridges backing off are skipped, continuing to serve the state last
+	// collected from them
+	var (
+		now       = g.clock.Now()
+		mu        sync.Mutex
+		attempted = map[*breaker]bool{}
+		failed    = map[*breaker]bool{}
+		errored   = map[*breaker]bool{}
+	)
+	for _, job := range g.jobs {
+		job := job
+		if _, ok := undiscovered[job.bridge]; ok {
+			continue
+		}
+		if job.breaker != nil {
+			if !job.breaker.allow(now) {
+				continue
+			}
+			attempted[job.breaker] = true
+		}
 
-		newLights, err := l.hue.GetNewLightsContext(ctx)
-		if err != nil {
-			log.Error("failed to fetch new lights", zap.Error(err))
+		collect := job.Collect(ctx)
+		grp.Go(func() error {
+			err := collect()
+			if job.breaker != nil && err != nil {
+				mu.Lock()
+				errored[job.breaker] = true
+				if unreachable(err) {
+					failed[job.breaker] = true
+				}
+				mu.Unlock()
+			}
 
 			return err
-		}
+		})
+	}
 
-		log.Info("collecting new lights", zap.Int("count", len(lights)))
-		if _, err := l.meter.NewInt64GaugeObserver(
-			"new_light",
-			newLightObserver(newLights),
-			metric.WithDescription("Number of new lights."),
-			metric.WithUnit(unit.Dimensionless),
-		); err != nil {
-			log.Error("failed to record new light count", zap.Error(err))
+	err := grp.Wait()
+	for b := range attempted {
+		b.collected(!errored[b])
+		g.trip(ctx, b, failed[b], now)
+	}
 
-			return fmt.Errorf("failed to collect new light count: %w", err)
-		}
+	if err != nil {
+		g.relocate(ctx, failed)
 
-		return nil
+		return err
 	}
+	if discoverErr != nil {
+		return discoverErr
+	}
+
+	g.lastCollect = g.clock.Now()
+
+	return nil
 }
 
-type lightGroups []lightGroup
+// Scan starts a search for new lights and sensors on every bridge able to,
+// which the bridges run for about a minute. The devices found are reported
+// by the new_light and new_sensor metrics as the following cycles collect
+// them.
+func (g *Gatherer) Scan(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "collector/gatherer.Scan")
+	defer span.End()
+
+	var scanned bool
+	for _, b := range g.bridges {
+		s, ok := g.searchers[b.name]
+		if !ok {
+			continue
+		}
+		scanned = true
 
-func (lgs lightGroups) lightExists(id int) *lightGroup {
-	for _, g := range lgs {
-		if g.lightExists(id) {
-			return &g
+		if err := s.FindLightsContext(ctx); err != nil {
+			return fmt.Errorf("failed to search for lights on %s: %w", b.name, err)
 		}
+		if err := s.FindSensorsContext(ctx); err != nil {
+			return fmt.Errorf("failed to search for sensors on %s: %w", b.name, err)
+		}
+
+		g.log.SetContext(ctx).Info("started search for new devices", zap.String("bridge", b.name))
+	}
+
+	if !scanned {
+		return ErrSearchUnsupported
 	}
 
 	return nil
 }
 
-type lightGroup struct {
-	huego.Group
-}
+// trip records the outcome of a cycle with the bridge's breaker, logging as
+// it opens and closes.
+func (g *Gatherer) trip(ctx context.Context, b *breaker, failed bool, now time.Time) {
+	log := g.log.SetContext(ctx)
 
-func (lg *lightGroup) lightExists(id int) bool {
-	for _, light := range lg.Group.Lights {
-		if light == strconv.Itoa(id) {
-			return true
+	if !failed {
+		if b.success() {
+			log.Info("bridge is reachable again, resuming collection", zap.String("bridge", b.bridge))
 		}
+
+		return
 	}
 
-	return false
+	if retry, open := b.failure(now); open {
+		log.Warn(
+			"bridge is unreachable, backing off",
+			zap.String("bridge", b.bridge),
+			zap.Time("retry", retry),
+		)
+	}
 }
 
-func lightObserver(lights []huego.Light, groups lightGroups) metric.Int64ObserverFunc {
-	return func(ctx context.Context, res metric.Int64ObserverResult) {
-		if len(lights) == 0 {
-			res.Observe(0)
+// relocate rediscovers the bridges found unreachable by a cycle, whose
+// address may have changed. The cycle has typically run out of time in this
+// case, the bridges are located within a fresh timeout instead.
+func (g *Gatherer) relocate(ctx context.Context, failed map[*breaker]bool) {
+	if g.discover == nil || len(failed) == 0 {
+		return
+	}
 
-			return
+	var lost []*bridge
+	for i := range g.bridges {
+		if g.bridges[i].hue == nil {
+			continue
 		}
 
-		for _, l := range lights {
-			var assignedGroup string
+		if br, ok := g.breakers[g.bridges[i].name]; ok && failed[br] {
+			lost = append(lost, &g.bridges[i])
+		}
+	}
+	if len(lost) == 0 {
+		return
+	}
 
-			// check if this light has been assigned a group
-			if group := groups.lightExists(l.ID); group != nil {
-				assignedGroup = group.Group.Name
-			}
+	// the span of the cycle is carried over, its deadline is not
+	dctx, cancel := context.WithTimeout(trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx)), rediscoverTimeout)
+	defer cancel()
 
-			res.Observe(
-				1,
-				attribute.Bool("on", l.State.On),
-				attribute.Int("id", l.ID),
-				attribute.String("group", assignedGroup),
-			)
-		}
+	for _, err := range g.rediscover(dctx, lost) {
+		g.log.SetContext(ctx).Error("failed to rediscover bridge", zap.Error(err))
 	}
 }
 
-func lightBrightnessObserver(lights []huego.Light, groups lightGroups) metric.Int64ObserverFunc {
-	return func(ctx context.Context, res metric.Int64ObserverResult) {
-		if len(lights) == 0 {
-			res.Observe(0)
-
-			return
+// rediscover locates the bridges in a single round of the configured
+// Discoverer and updates the addresses they are collected from, returning
+// the errors of the bridges that could not be located keyed by their name.
+// Bridges are matched on their identifier, when none is known the bridge is
+// only resolved if it is the single bridge configured and discovered.
+func (g *Gatherer) rediscover(ctx context.Context, bridges []*bridge) map[string]error {
+	errs := map[string]error{}
+	if g.discover == nil {
+		for _, b := range bridges {
+			errs[b.name] = fmt.Errorf("bridge %q has no address and discovery is disabled", b.name)
 		}
 
-		for _, l := range lights {
-			var assignedGroup string
-
-			// check if this light has been assigned a group
-			if group := groups.lightExists(l.ID); group != nil {
-				assignedGroup = group.Group.Name
-			}
-			res.Observe(
-				int64(l.State.Bri),
-				attribute.Bool("on", l.State.On),
-				attribute.Int("id", l.ID),
-				attribute.String("group", assignedGroup),
-			)
-		}
+		return errs
 	}
-}
 
-func newLightObserver(v *huego.NewLight) metric.Int64ObserverFunc {
-	return func(ctx context.Context, res metric.Int64ObserverResult) {
-		if len(v.Lights) == 0 {
-			res.Observe(
-				0,
-				attribute.String("lastScan", v.LastScan),
-			)
+	ctx, span := tracer.Start(ctx, "collector/gatherer.rediscover")
+	defer span.End()
 
-			return
+	found, err := g.discover.Discover(ctx)
+	for _, b := range bridges {
+		if err != nil {
+			errs[b.name] = fmt.Errorf("failed to discover bridge %q: %w", b.name, err)
+
+			continue
 		}
 
-		for _, l := range v.Lights {
-			res.Observe(
-				1,
-				attribute.String("name", l),
-				attribute.String("lastScan", v.LastScan),
-			)
+		if err := g.locate(ctx, b, found); err != nil {
+			errs[b.name] = err
 		}
 	}
-}
 
-type groups struct {
-	log   *tracelog.TraceLogger
-	hue   *huego.Bridge
-	meter metric.Meter
+	return errs
 }
 
-func (g *groups) Collect(ctx context.Context) func() error {
-	ctx, span := tracer.Start(ctx, "groups.Collect")
-	log := g.log.SetContext(ctx)
-
-	return func() error {
-		defer span.End()
-
-		groups, err := g.hue.GetGroupsContext(ctx)
-		if err != nil {
-			log.Error("failed to fetch groups", zap.Error(err))
-
-			return err
+// locate updates the address of the bridge to that it was discovered at.
+func (g *Gatherer) locate(ctx context.Context, b *bridge, found []discovery.Bridge) error {
+	for _, f := range found {
+		if b.id != "" && !strings.EqualFold(b.id, f.ID) {
+			continue
 		}
 
-		log.Info("collecting groups", zap.Int("count", len(groups)))
-		if _, err := g.meter.NewInt64GaugeObserver(
-			"group",
-			groupObserver(groups),
-			metric.WithDescription("Number of groups in the current state. Includes brightness, identifer, and on state."),
-			metric.WithUnit(unit.Dimensionless),
-		); err != nil {
-			log.Error("failed to record group count", zap.Error(err))
-
-			return fmt.Errorf("failed to collect group count: %w", err)
+		if b.id == "" && (len(found) > 1 || len(g.bridges) > 1) {
+			break
 		}
 
-		log.Info("collected group metrics")
+		g.log.SetContext(ctx).Info(
+			"discovered bridge",
+			zap.String("bridge", b.name),
+			zap.String("id", f.ID),
+			zap.String("address", f.Address),
+		)
+		b.hue.SetHost(f.Address)
+		if b.v2 != nil {
+			b.v2.SetHost(f.Address)
+		}
 
 		return nil
 	}
+
+	return fmt.Errorf("failed to discover bridge %q: %w", b.name, discovery.ErrNotFound)
 }
 
-func groupObserver(groups []huego.Group) metric.Int64ObserverFunc {
-	return func(ctx context.Context, res metric.Int64ObserverResult) {
-		if len(groups) == 0 {
-			res.Observe(0)
+// ServeHTTP serves the metrics handler configured through WithMetricsHandler,
+// or the last collected state when none was configured, so the collector
+// can be mounted into an existing mux. In pull mode a collection cycle is
+// run before each request is served.
+func (g *Gatherer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if g.pull {
+		if err := g.Collect(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
 
 			return
 		}
-
-		for _, g := range groups {
-			res.Observe(
-				1,
-				attribute.Bool("on", g.State.On),
-				attribute.Int("id", g.ID),
-				attribute.Int("bri", int(g.State.Bri)),
-				attribute.String("name", g.Name),
-			)
-		}
 	}
-}
 
-type sensors struct {
-	log   *tracelog.TraceLogger
-	hue   *huego.Bridge
-	meter metric.Meter
+	g.handler.ServeHTTP(w, r)
 }
 
-func (s *sensors) Collect(ctx context.Context) func() error {
-	ctx, span := tracer.Start(ctx, "sensors.Collect")
-	log := s.log.SetContext(ctx)
-
-	return func() error {
-		defer span.End()
-
-		sensors, err := s.hue.GetSensorsContext(ctx)
-		if err != nil {
-			log.Error("failed to fetch sensors", zap.Error(err))
-
-			return err
-		}
+// CollectJob collects state during each collection cycle. Collect is called
+// at the start of the cycle and the returned function run concurrently with
+// the other jobs, its error failing the cycle.
+type CollectJob interface {
+	Collect(context.Context) func() error
+}
 
-		log.Info("collecting sensors", zap.Int("count", len(sensors)))
-		if _, err := s.meter.NewInt64GaugeObserver(
-			"sensors",
-			sensorObserver(sensors),
-		); err != nil {
-			log.Error("failed to record group count", zap.Error(err))
+// customJob is a job registered through RegisterJob.
+type customJob struct {
+	name string
+	job  CollectJob
+}
 
-			return fmt.Errorf("failed to collect group count: %w", err)
-		}
+const (
+	// rediscoverTimeout bounds locating bridges found unreachable by a
+	// cycle.
+	rediscoverTimeout = 30 * time.Second
 
-		log.Info("collected group metrics")
+	// timeLayout is the layout of timestamps reported by the bridge, they
+	// are in UTC without a zone designator.
+	timeLayout = "2006-01-02T15:04:05"
+)
 
-		return nil
+// parseTime parses a bridge timestamp, reporting false for unset values
+// which the bridge reports as "none".
+func parseTime(v string) (time.Time, bool) {
+	t, err := time.ParseInLocation(timeLayout, v, time.UTC)
+	if err != nil {
+		return time.Time{}, false
 	}
+
+	return t, true
 }
 
-func sensorObserver(sensors []huego.Sensor) metric.Int64ObserverFunc {
-	return func(ctx context.Context, res metric.Int64ObserverResult) {
-		if len(sensors) == 0 {
-			res.Observe(0)
+// boolValue converts a flag into a gauge value.
+func boolValue(b bool) int64 {
+	if b {
+		return 1
+	}
 
-			return
-		}
+	return 0
+}
 
-		for _, s := range sensors {
-			res.Observe(
-				1,
-				attribute.String("type", s.Type),
-				attribute.Int("id", s.ID),
-			)
-		}
-	}
+// brightnessPercent scales a brightness reported by the bridge, ranging up
+// to 254, to percent.
+func brightnessPercent(bri uint8) float64 {
+	return float64(bri) / maxBrightness * 100
 }
@@ -0,0 +1,441 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"github.com/ninnemana/tracelog"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// fakeBridge is a bridge serving fixed resources, failing requests for the
+// kinds of resources set in errs.
+type fakeBridge struct {
+	mu      sync.Mutex
+	lights  []hueclient.Light
+	groups  []hueclient.Group
+	sensors []hueclient.Sensor
+	errs    map[string]error
+	// fetches counts the requests for lights.
+	fetches int
+}
+
+func (b *fakeBridge) fail(resource string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.errs[resource]
+}
+
+func (b *fakeBridge) GetConfigContext(ctx context.Context) (*hueclient.Config, error) {
+	return &hueclient.Config{Name: "Fake bridge"}, b.fail("config")
+}
+
+func (b *fakeBridge) GetCapabilitiesContext(ctx context.Context) (*hueclient.Capabilities, error) {
+	return &hueclient.Capabilities{}, b.fail("capabilities")
+}
+
+func (b *fakeBridge) GetGroupsContext(ctx context.Context) ([]hueclient.Group, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.groups, b.errs["groups"]
+}
+
+func (b *fakeBridge) GetLightsContext(ctx context.Context) ([]hueclient.Light, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.fetches++
+
+	return b.lights, b.errs["lights"]
+}
+
+func (b *fakeBridge) GetNewLightsContext(ctx context.Context) (*hueclient.NewLight, error) {
+	return &hueclient.NewLight{LastScan: "none"}, b.fail("lights/new")
+}
+
+func (b *fakeBridge) GetRulesContext(ctx context.Context) ([]*hueclient.Rule, error) {
+	return nil, b.fail("rules")
+}
+
+func (b *fakeBridge) GetScenesContext(ctx context.Context) ([]hueclient.Scene, error) {
+	return nil, b.fail("scenes")
+}
+
+func (b *fakeBridge) GetSchedulesContext(ctx context.Context) ([]*hueclient.Schedule, error) {
+	return nil, b.fail("schedules")
+}
+
+func (b *fakeBridge) GetSensorsContext(ctx context.Context) ([]hueclient.Sensor, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.sensors, b.errs["sensors"]
+}
+
+func (b *fakeBridge) GetNewSensorsContext(ctx context.Context) (*hueclient.NewSensor, error) {
+	return &hueclient.NewSensor{LastScan: "none"}, b.fail("sensors/new")
+}
+
+func newFakeBridge() *fakeBridge {
+	return &fakeBridge{
+		lights: []hueclient.Light{
+			{
+				ID:       1,
+				Name:     "Ceiling",
+				Type:     "Extended color light",
+				ModelID:  "LCT015",
+				UniqueID: "00:17:88:01:00:00:00:01-0b",
+				State:    &hueclient.State{On: true, Bri: 254, ColorMode: "xy", Xy: []float32{0.5, 0.25}, Reachable: true},
+			},
+			{
+				ID:       2,
+				Name:     "Desk",
+				Type:     "Dimmable light",
+				ModelID:  "LWB010",
+				UniqueID: "00:17:88:01:00:00:00:02-0b",
+				State:    &hueclient.State{On: false, Bri: 1, Reachable: false},
+			},
+		},
+		groups: []hueclient.Group{
+			{
+				ID:         1,
+				Name:       "Living room",
+				Type:       "Room",
+				Class:      "Living room",
+				Lights:     []string{"1", "2"},
+				GroupState: &hueclient.GroupState{AnyOn: true},
+				State:      &hueclient.State{On: true, Bri: 254},
+			},
+		},
+		sensors: []hueclient.Sensor{
+			{
+				ID:       4,
+				Name:     "Hallway temperature",
+				Type:     "ZLLTemperature",
+				UniqueID: "00:17:88:01:00:00:00:04-02-0402",
+				State:    map[string]interface{}{"temperature": 2150.0, "lastupdated": "2021-01-01T00:00:00"},
+				Config:   map[string]interface{}{"on": true, "battery": 80.0, "reachable": true},
+			},
+		},
+		errs: map[string]error{},
+	}
+}
+
+// testLogger discards the logs of the code under test.
+var testLogger = tracelog.NewLogger(tracelog.WithLogger(zap.NewNop()))
+
+// newTestGatherer returns a gatherer collecting from the bridges, reporting
+// through the returned registry.
+func newTestGatherer(t testing.TB, opts ...Option) (*Gatherer, *prometheus.Registry) {
+	t.Helper()
+
+	reg := prometheus.NewRegistry()
+	opts = append([]Option{
+		WithLogger(testLogger),
+		WithPrometheusRegistry(reg),
+		WithRateLimit(0),
+	}, opts...)
+
+	c, err := NewGatherer(opts...)
+	if err != nil {
+		t.Fatalf("failed to create gatherer: %v", err)
+	}
+
+	return c.(*Gatherer), reg
+}
+
+// gather returns the value of each series reported through reg, keyed by
+// the name of its metric followed by its labels sorted by name, such as
+// light_on{bridge="fake",id="1"}.
+func gather(t *testing.T, reg prometheus.Gatherer) map[string]float64 {
+	t.Helper()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+
+	series := map[string]float64{}
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			labels := make([]string, 0, len(m.GetLabel()))
+			for _, l := range m.GetLabel() {
+				labels = append(labels, l.GetName()+"=\""+l.GetValue()+"\"")
+			}
+			sort.Strings(labels)
+
+			var v float64
+			switch {
+			case m.GetGauge() != nil:
+				v = m.GetGauge().GetValue()
+			case m.GetCounter() != nil:
+				v = m.GetCounter().GetValue()
+			case m.GetUntyped() != nil:
+				v = m.GetUntyped().GetValue()
+			}
+
+			series[f.GetName()+"{"+strings.Join(labels, ",")+"}"] = v
+		}
+	}
+
+	return series
+}
+
+// expectSeries fails the test for each series not reported with the
+// expected value.
+func expectSeries(t *testing.T, got map[string]float64, want map[string]float64) {
+	t.Helper()
+
+	for name, v := range want {
+		if g, ok := got[name]; !ok {
+			t.Errorf("%s is not reported", name)
+		} else if g != v {
+			t.Errorf("%s = %v, want %v", name, g, v)
+		}
+	}
+}
+
+func TestGathererCollect(t *testing.T) {
+	g, reg := newTestGatherer(t, WithBridge("fake", newFakeBridge()))
+
+	if err := g.Collect(context.Background()); err != nil {
+		t.Fatalf("failed to collect: %v", err)
+	}
+
+	expectSeries(t, gather(t, reg), map[string]float64{
+		`light_on{bridge="fake",id="1"}`:                                                        1,
+		`light_on{bridge="fake",id="2"}`:                                                        0,
+		`light_brightness_percent{bridge="fake",id="1"}`:                                        100,
+		`light_reachable{bridge="fake",id="1"}`:                                                 1,
+		`light_reachable{bridge="fake",id="2"}`:                                                 0,
+		`light_color_x{bridge="fake",colormode="xy",id="1"}`:                                    0.5,
+		`light_estimated_power_watts{bridge="fake",id="2",model="LWB010"}`:                      0,
+		`group_any_on{bridge="fake",class="Living room",id="1",name="Living room",type="Room"}`: 1,
+		`sensor_temperature_celsius{bridge="fake",id="4",type="ZLLTemperature"}`:                21.5,
+		`sensor_battery_percent{bridge="fake",id="4",type="ZLLTemperature"}`:                    80,
+		`collect_errors_total{bridge="fake",collector="lights"}`:                                0,
+	})
+}
+
+func TestGathererBridgeUp(t *testing.T) {
+	hue := newFakeBridge()
+	g, reg := newTestGatherer(t, WithBridge("fake", hue))
+
+	if _, ok := gather(t, reg)[`bridge_up{bridge="fake"}`]; ok {
+		t.Error("bridge_up is reported before the bridge is collected from")
+	}
+
+	if err := g.Collect(context.Background()); err != nil {
+		t.Fatalf("failed to collect: %v", err)
+	}
+	expectSeries(t, gather(t, reg), map[string]float64{`bridge_up{bridge="fake"}`: 1})
+
+	hue.mu.Lock()
+	hue.errs["lights"] = errors.New("bridge unavailable")
+	hue.mu.Unlock()
+
+	if err := g.Collect(context.Background()); err == nil {
+		t.Fatal("expected the failing lights job to fail the cycle")
+	}
+	expectSeries(t, gather(t, reg), map[string]float64{`bridge_up{bridge="fake"}`: 0})
+}
+
+func TestGathererCollectRemovesSeries(t *testing.T) {
+	hue := newFakeBridge()
+	g, reg := newTestGatherer(t, WithBridge("fake", hue))
+
+	if err := g.Collect(context.Background()); err != nil {
+		t.Fatalf("failed to collect: %v", err)
+	}
+
+	hue.mu.Lock()
+	hue.lights = hue.lights[:1]
+	hue.mu.Unlock()
+
+	if err := g.Collect(context.Background()); err != nil {
+		t.Fatalf("failed to collect: %v", err)
+	}
+
+	got := gather(t, reg)
+	if _, ok := got[`light_on{bridge="fake",id="2"}`]; ok {
+		t.Error("light 2 is still reported once removed from the bridge")
+	}
+	expectSeries(t, got, map[string]float64{
+		`light_on{bridge="fake",id="1"}`: 1,
+	})
+}
+
+func TestGathererCollectFailingJob(t *testing.T) {
+	hue := newFakeBridge()
+	hue.errs["sensors"] = errors.New("bridge unavailable")
+	g, reg := newTestGatherer(t, WithBridge("fake", hue))
+
+	if err := g.Collect(context.Background()); err == nil {
+		t.Fatal("expected the failing sensors job to fail the cycle")
+	}
+
+	got := gather(t, reg)
+	if _, ok := got[`sensor_temperature_celsius{bridge="fake",id="4",type="ZLLTemperature"}`]; ok {
+		t.Error("sensors are reported though they were never collected")
+	}
+	expectSeries(t, got, map[string]float64{
+		// the lights are still collected alongside the failing job
+		`light_on{bridge="fake",id="1"}`:                          1,
+		`collect_errors_total{bridge="fake",collector="sensors"}`: 1,
+		`collect_errors_total{bridge="fake",collector="lights"}`:  0,
+	})
+}
+
+func TestNewGathererBridgeNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		bridges []Option
+		err     error
+	}{
+		{
+			name:    "distinct",
+			bridges: []Option{WithBridge("upstairs", newFakeBridge()), WithBridge("downstairs", newFakeBridge())},
+		},
+		{
+			// a bridge located through discovery is named default
+			name:    "discovered",
+			bridges: []Option{WithHueConfig(HueConfig{Username: "user"})},
+		},
+		{
+			name:    "empty",
+			bridges: []Option{WithBridge("", newFakeBridge())},
+			err:     ErrInvalidBridgeName,
+		},
+		{
+			name:    "discovered twice",
+			bridges: []Option{WithHueConfig(HueConfig{Username: "user"}, HueConfig{Username: "other"})},
+			err:     ErrInvalidBridgeName,
+		},
+		{
+			name:    "duplicate",
+			bridges: []Option{WithBridge("upstairs", newFakeBridge()), WithBridge("upstairs", newFakeBridge())},
+			err:     ErrInvalidBridgeName,
+		},
+		{
+			name: "duplicate address",
+			bridges: []Option{WithHueConfig(
+				HueConfig{IP: "192.168.1.2", Username: "user"},
+				HueConfig{IP: "192.168.1.2", Username: "other"},
+			)},
+			err: ErrInvalidBridgeName,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewGatherer(append([]Option{WithLogger(testLogger)}, tt.bridges...)...)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got error %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestWithTemperatureUnits(t *testing.T) {
+	tests := []struct {
+		name  string
+		units []TemperatureUnit
+		want  []string
+	}{
+		{name: "none", want: []string{"sensor_temperature_celsius"}},
+		{name: "fahrenheit", units: []TemperatureUnit{Fahrenheit}, want: []string{"sensor_temperature_fahrenheit"}},
+		{
+			name:  "both",
+			units: []TemperatureUnit{Celsius, Fahrenheit},
+			want:  []string{"sensor_temperature_celsius", "sensor_temperature_fahrenheit"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, reg := newTestGatherer(t, WithBridge("fake", newFakeBridge()), WithTemperatureUnits(tt.units...))
+			if err := g.Collect(context.Background()); err != nil {
+				t.Fatalf("failed to collect: %v", err)
+			}
+
+			got := gather(t, reg)
+			for _, name := range tt.want {
+				if _, ok := got[name+`{bridge="fake",id="4",type="ZLLTemperature"}`]; !ok {
+					t.Errorf("%s is not reported", name)
+				}
+			}
+		})
+	}
+}
+
+func TestGathererButtonPressesUniqueIDs(t *testing.T) {
+	hue := newFakeBridge()
+	hue.sensors = append(hue.sensors, hueclient.Sensor{
+		ID:       2,
+		Name:     "Dimmer",
+		Type:     "ZLLSwitch",
+		UniqueID: "00:17:88:01:00:00:00:02-02-fc00",
+		State:    map[string]interface{}{"buttonevent": 1000.0, "lastupdated": "2021-01-01T00:00:00"},
+	})
+	g, reg := newTestGatherer(t, WithBridge("fake", hue), WithUniqueIDLabels())
+
+	if err := g.Collect(context.Background()); err != nil {
+		t.Fatalf("failed to collect: %v", err)
+	}
+
+	hue.mu.Lock()
+	hue.sensors[1].State = map[string]interface{}{"buttonevent": 1002.0, "lastupdated": "2021-01-01T00:00:05"}
+	hue.mu.Unlock()
+
+	if err := g.Collect(context.Background()); err != nil {
+		t.Fatalf("failed to collect: %v", err)
+	}
+
+	got := gather(t, reg)
+	if _, ok := got[`button_presses_total{bridge="fake",button="1",event="short_release",id="2"}`]; ok {
+		t.Error("button presses are labelled with the numeric id of the switch")
+	}
+	expectSeries(t, got, map[string]float64{
+		`button_presses_total{bridge="fake",button="1",event="short_release",id="00:17:88:01:00:00:00:02-02-fc00"}`: 1,
+	})
+}
+
+func TestGathererSensorTypeLabels(t *testing.T) {
+	hue := newFakeBridge()
+	hue.sensors = append(hue.sensors,
+		hueclient.Sensor{
+			ID:    5,
+			Name:  "Hallway light level",
+			Type:  "ZLLLightLevel",
+			State: map[string]interface{}{"lightlevel": 10001.0, "dark": false, "daylight": true},
+		},
+		hueclient.Sensor{
+			ID:     1,
+			Name:   "Daylight",
+			Type:   "Daylight",
+			State:  map[string]interface{}{"daylight": true},
+			Config: map[string]interface{}{"on": true, "configured": true},
+		},
+	)
+	g, reg := newTestGatherer(t, WithBridge("fake", hue))
+
+	if err := g.Collect(context.Background()); err != nil {
+		t.Fatalf("failed to collect: %v", err)
+	}
+
+	expectSeries(t, gather(t, reg), map[string]float64{
+		`sensor_temperature_celsius{bridge="fake",id="4",type="ZLLTemperature"}`: 21.5,
+		`sensor_light_level_lux{bridge="fake",id="5",type="ZLLLightLevel"}`:      10,
+		`sensor_dark{bridge="fake",id="5",type="ZLLLightLevel"}`:                 0,
+		`sensor_daylight{bridge="fake",id="5",type="ZLLLightLevel"}`:             1,
+		`daylight{bridge="fake",id="1",type="Daylight"}`:                         1,
+	})
+}
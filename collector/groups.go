@@ -0,0 +1,277 @@
+package collector
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"github.com/ninnemana/tracelog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.uber.org/zap"
+)
+
+type groups struct {
+	log    *tracelog.TraceLogger
+	hue    Bridge
+	bridge string
+	events *broker
+	clock  Clock
+	// legacy also reports groups in the form used before their units and
+	// types were corrected.
+	legacy bool
+
+	mu        sync.RWMutex
+	collected bool
+	groups    []hueclient.Group
+	// on holds whether each light is on, keyed by light id.
+	on map[string]bool
+}
+
+// snapshot returns the groups last collected, reporting false until the
+// first collection succeeds.
+func (g *groups) snapshot() ([]hueclient.Group, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.groups, g.collected
+}
+
+func (g *groups) Collect(ctx context.Context) func() error {
+	ctx, span := tracer.Start(ctx, "groups.Collect")
+	log := g.log.SetContext(ctx)
+
+	return func() error {
+		defer span.End()
+
+		groups, err := g.hue.GetGroupsContext(ctx)
+		if err != nil {
+			log.Error("failed to fetch groups", zap.Error(err))
+
+			return err
+		}
+
+		// the lights are shared with the lights job through the cycle's
+		// snapshot, so counting them costs no extra request
+		lights, err := g.hue.GetLightsContext(ctx)
+		if err != nil {
+			log.Error("failed to fetch lights", zap.Error(err))
+
+			return err
+		}
+
+		on := make(map[string]bool, len(lights))
+		for _, l := range lights {
+			on[strconv.Itoa(l.ID)] = l.State != nil && l.State.On
+		}
+
+		log.Debug("collected group metrics", zap.Int("count", len(groups)))
+
+		g.mu.Lock()
+		if g.collected {
+			g.events.publish(diffGroups(g.bridge, g.groups, groups, g.clock.Now())...)
+		}
+		g.groups = groups
+		g.on = on
+		g.collected = true
+		g.mu.Unlock()
+
+		return nil
+	}
+}
+
+func (g *groups) register(inst *instruments) error {
+	if g.legacy {
+		if err := inst.int64Gauge(
+			"group",
+			"Number of groups in the current state. Includes brightness, identifer, and on state.",
+			unit.Dimensionless,
+			func(ctx context.Context, res metric.Int64ObserverResult) {
+				if groups, ok := g.snapshot(); ok {
+					groupObserver(g.bridge, groups)(ctx, res)
+				}
+			},
+		); err != nil {
+			return err
+		}
+
+		if err := inst.int64Gauge(
+			"group_brightness",
+			"Brightness of the last action applied to the group.",
+			unit.Dimensionless,
+			func(ctx context.Context, res metric.Int64ObserverResult) {
+				if groups, ok := g.snapshot(); ok {
+					groupValueObserver(g.bridge, groups, func(g hueclient.Group) (int64, bool) {
+						if g.State == nil {
+							return 0, false
+						}
+
+						return int64(g.State.Bri), true
+					})(ctx, res)
+				}
+			},
+		); err != nil {
+			return err
+		}
+	}
+
+	if err := inst.int64Gauge(
+		"group_info",
+		"Groups known to the bridge, always 1. Includes name, type and class.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			if groups, ok := g.snapshot(); ok {
+				groupValueObserver(g.bridge, groups, func(hueclient.Group) (int64, bool) {
+					return 1, true
+				})(ctx, res)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.float64Gauge(
+		"group_brightness_percent",
+		"Brightness of the last action applied to the group in percent.",
+		unitPercent,
+		func(ctx context.Context, res metric.Float64ObserverResult) {
+			groups, ok := g.snapshot()
+			if !ok {
+				return
+			}
+
+			for _, grp := range groups {
+				if grp.State == nil {
+					continue
+				}
+
+				res.Observe(
+					brightnessPercent(grp.State.Bri),
+					attribute.String("bridge", g.bridge),
+					attribute.Int("id", grp.ID),
+					attribute.String("name", grp.Name),
+					attribute.String("type", grp.Type),
+					attribute.String("class", grp.Class),
+				)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	values := []struct {
+		name  string
+		desc  string
+		value func(hueclient.Group) (int64, bool)
+	}{
+		{"group_any_on", "Whether any light in the group is on.", func(g hueclient.Group) (int64, bool) {
+			if g.GroupState == nil {
+				return 0, false
+			}
+
+			return boolValue(g.GroupState.AnyOn), true
+		}},
+		{"group_all_on", "Whether all lights in the group are on.", func(g hueclient.Group) (int64, bool) {
+			if g.GroupState == nil {
+				return 0, false
+			}
+
+			return boolValue(g.GroupState.AllOn), true
+		}},
+		{"group_lights_total", "Number of lights in the group.", func(g hueclient.Group) (int64, bool) {
+			return int64(len(g.Lights)), true
+		}},
+	}
+	for _, v := range values {
+		value := v.value
+		if err := inst.int64Gauge(
+			v.name,
+			v.desc,
+			unit.Dimensionless,
+			func(ctx context.Context, res metric.Int64ObserverResult) {
+				if groups, ok := g.snapshot(); ok {
+					groupValueObserver(g.bridge, groups, value)(ctx, res)
+				}
+			},
+		); err != nil {
+			return err
+		}
+	}
+
+	if err := inst.int64Gauge(
+		"group_lights_on_count",
+		"Number of lights in the group that are on.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			g.mu.RLock()
+			groups, on, ok := g.groups, g.on, g.collected
+			g.mu.RUnlock()
+
+			if !ok {
+				return
+			}
+
+			groupValueObserver(g.bridge, groups, func(grp hueclient.Group) (int64, bool) {
+				var n int64
+				for _, id := range grp.Lights {
+					if on[id] {
+						n++
+					}
+				}
+
+				return n, true
+			})(ctx, res)
+		},
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// groupValueObserver observes the value extracted from each group, groups
+// the value can't be extracted from are skipped.
+func groupValueObserver(bridge string, groups []hueclient.Group, value func(hueclient.Group) (int64, bool)) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for _, g := range groups {
+			v, ok := value(g)
+			if !ok {
+				continue
+			}
+
+			res.Observe(
+				v,
+				attribute.String("bridge", bridge),
+				attribute.Int("id", g.ID),
+				attribute.String("name", g.Name),
+				attribute.String("type", g.Type),
+				attribute.String("class", g.Class),
+			)
+		}
+	}
+}
+
+func groupObserver(bridge string, groups []hueclient.Group) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		if len(groups) == 0 {
+			res.Observe(0, attribute.String("bridge", bridge))
+
+			return
+		}
+
+		for _, g := range groups {
+			res.Observe(
+				1,
+				attribute.String("bridge", bridge),
+				attribute.Bool("on", g.State.On),
+				attribute.Int("id", g.ID),
+				attribute.Int("bri", int(g.State.Bri)),
+				attribute.String("name", g.Name),
+				attribute.String("type", g.Type),
+				attribute.String("class", g.Class),
+			)
+		}
+	}
+}
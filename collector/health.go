@@ -0,0 +1,201 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// trackedJob wraps a job to report the duration and outcome of its
+// collections, so failures to reach the bridge are visible even while the
+// last collected state continues to be served.
+type trackedJob struct {
+	CollectJob
+	name    string
+	bridge  string
+	breaker *breaker
+	// clock times collections.
+	clock Clock
+	// inst records exemplars linking collections to their trace.
+	inst *instruments
+	// ttl bounds how long the state collected before failing collections
+	// is reported, zero reporting it indefinitely.
+	ttl time.Duration
+
+	mu          sync.Mutex
+	duration    time.Duration
+	total       time.Duration
+	errors      int64
+	lastSuccess time.Time
+	// failed is whether the last collection failed, leaving the state of
+	// an earlier one reported.
+	failed bool
+}
+
+func (t *trackedJob) Collect(ctx context.Context) func() error {
+	collect := t.CollectJob.Collect(ctx)
+
+	return func() error {
+		start := t.clock.Now()
+		err := collect()
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		t.duration = t.clock.Now().Sub(start)
+		t.total += t.duration
+		t.failed = err != nil
+		if err != nil {
+			t.errors++
+			err = &CollectError{
+				Bridge: t.bridge,
+				Job:    t.name,
+				Kind:   classify(err),
+				Err:    err,
+			}
+		} else {
+			t.lastSuccess = t.clock.Now()
+		}
+
+		t.exemplars(ctx, err)
+
+		return err
+	}
+}
+
+// exemplars links the collection to the trace of its cycle, when the cycle
+// is sampled. They are only served through WithPrometheusRegistry.
+func (t *trackedJob) exemplars(ctx context.Context, err error) {
+	sc := trace.SpanContextFromContext(ctx)
+	if t.inst == nil || !sc.IsSampled() {
+		return
+	}
+
+	now := t.clock.Now()
+	t.inst.setExemplar("collect_seconds_total", exemplar{
+		traceID: sc.TraceID().String(),
+		value:   t.duration.Seconds(),
+		time:    now,
+	}, t.labels()...)
+
+	if err != nil {
+		t.inst.setExemplar("collect_errors_total", exemplar{
+			traceID: sc.TraceID().String(),
+			value:   1,
+			time:    now,
+		}, t.labels()...)
+	}
+}
+
+func (t *trackedJob) register(inst *instruments) error {
+	t.inst = inst
+
+	if r, ok := t.CollectJob.(registerer); ok {
+		if err := inst.expiring(t.expired, func() error {
+			return r.register(inst)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err := inst.float64Gauge(
+		"collect_duration_seconds",
+		"Duration of the last collection of each job.",
+		unitSeconds,
+		func(ctx context.Context, res metric.Float64ObserverResult) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+
+			res.Observe(t.duration.Seconds(), t.labels()...)
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.float64Counter(
+		"collect_seconds_total",
+		"Total time spent on the collections of each job.",
+		unitSeconds,
+		func(ctx context.Context, res metric.Float64ObserverResult) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+
+			res.Observe(t.total.Seconds(), t.labels()...)
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Counter(
+		"collect_errors_total",
+		"Number of failed collections of each job.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+
+			res.Observe(t.errors, t.labels()...)
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"data_stale",
+		"Whether the state reported for each job was collected before its last collection, which failed.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+
+			if t.lastSuccess.IsZero() {
+				return
+			}
+
+			res.Observe(boolValue(t.failed), t.labels()...)
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"last_collect_success_timestamp_seconds",
+		"Time each job last collected successfully, in seconds since the epoch.",
+		unitSeconds,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+
+			if t.lastSuccess.IsZero() {
+				return
+			}
+
+			res.Observe(t.lastSuccess.Unix(), t.labels()...)
+		},
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// expired reports whether the state last collected by the job is older than
+// its TTL, its series being dropped until it collects again.
+func (t *trackedJob) expired() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.ttl > 0 && t.failed && t.clock.Now().Sub(t.lastSuccess) > t.ttl
+}
+
+func (t *trackedJob) labels() []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("bridge", t.bridge),
+		attribute.String("collector", t.name),
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !huego
+// +build !huego
+
+package collector
+
+import (
+	"net/http"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+)
+
+// hueBridge returns the API of a configured bridge, requested through
+// client.
+func hueBridge(hue *hueclient.Client, client *http.Client) Bridge {
+	hueclient.WithHTTPClient(client)(hue)
+
+	return hue
+}
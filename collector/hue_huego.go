@@ -0,0 +1,244 @@
+//go:build huego
+// +build huego
+
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/amimof/huego"
+	"github.com/ninnemana/hue-exporter/hueclient"
+)
+
+// hueBridge returns the API of a configured bridge requested through huego,
+// kept as a fallback while the collector moves to hueclient. huego sends
+// requests through its own client, and can't fetch the paths of the jobs
+// relying on a rawGetter.
+func hueBridge(hue *hueclient.Client, _ *http.Client) Bridge {
+	return &huegoBridge{hue: hue}
+}
+
+// huegoBridge converts the huego models into their hueclient counterparts,
+// which share their encoding.
+type huegoBridge struct {
+	hue *hueclient.Client
+}
+
+// bridge addresses the bridge at its current address, which changes when
+// it is rediscovered.
+func (b *huegoBridge) bridge() *huego.Bridge {
+	return huego.New(b.hue.Host(), b.hue.User)
+}
+
+// convert copies from into to through their common encoding, identifiers
+// left out of it are copied by the callers.
+func convert(from, to interface{}) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, to)
+}
+
+func (b *huegoBridge) GetConfigContext(ctx context.Context) (*hueclient.Config, error) {
+	cfg, err := b.bridge().GetConfigContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var out hueclient.Config
+	if err := convert(cfg, &out); err != nil {
+		return nil, err
+	}
+	for _, w := range cfg.Whitelist {
+		out.Whitelist = append(out.Whitelist, hueclient.Whitelist(w))
+	}
+
+	return &out, nil
+}
+
+func (b *huegoBridge) GetCapabilitiesContext(ctx context.Context) (*hueclient.Capabilities, error) {
+	caps, err := b.bridge().GetCapabilitiesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var out hueclient.Capabilities
+	if err := convert(caps, &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+func (b *huegoBridge) GetGroupsContext(ctx context.Context) ([]hueclient.Group, error) {
+	groups, err := b.bridge().GetGroupsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]hueclient.Group, len(groups))
+	for i, g := range groups {
+		if err := convert(g, &out[i]); err != nil {
+			return nil, err
+		}
+		out[i].ID = g.ID
+	}
+
+	return out, nil
+}
+
+func (b *huegoBridge) GetLightsContext(ctx context.Context) ([]hueclient.Light, error) {
+	lights, err := b.bridge().GetLightsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]hueclient.Light, len(lights))
+	for i, l := range lights {
+		if err := convert(l, &out[i]); err != nil {
+			return nil, err
+		}
+		out[i].ID = l.ID
+	}
+
+	return out, nil
+}
+
+func (b *huegoBridge) GetNewLightsContext(ctx context.Context) (*hueclient.NewLight, error) {
+	n, err := b.bridge().GetNewLightsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &hueclient.NewLight{Lights: n.Lights, LastScan: n.LastScan}, nil
+}
+
+func (b *huegoBridge) GetRulesContext(ctx context.Context) ([]*hueclient.Rule, error) {
+	rules, err := b.bridge().GetRulesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*hueclient.Rule, len(rules))
+	for i, r := range rules {
+		out[i] = &hueclient.Rule{}
+		if err := convert(r, out[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+func (b *huegoBridge) GetScenesContext(ctx context.Context) ([]hueclient.Scene, error) {
+	scenes, err := b.bridge().GetScenesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]hueclient.Scene, len(scenes))
+	for i, s := range scenes {
+		if err := convert(s, &out[i]); err != nil {
+			return nil, err
+		}
+		out[i].ID = s.ID
+	}
+
+	return out, nil
+}
+
+func (b *huegoBridge) GetSchedulesContext(ctx context.Context) ([]*hueclient.Schedule, error) {
+	schedules, err := b.bridge().GetSchedulesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*hueclient.Schedule, len(schedules))
+	for i, s := range schedules {
+		out[i] = &hueclient.Schedule{ID: s.ID}
+		if err := convert(s, out[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+func (b *huegoBridge) GetSensorsContext(ctx context.Context) ([]hueclient.Sensor, error) {
+	sensors, err := b.bridge().GetSensorsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]hueclient.Sensor, len(sensors))
+	for i, s := range sensors {
+		if err := convert(s, &out[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+func (b *huegoBridge) GetNewSensorsContext(ctx context.Context) (*hueclient.NewSensor, error) {
+	n, err := b.bridge().GetNewSensorsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &hueclient.NewSensor{LastScan: n.LastScan, Sensors: make([]*hueclient.Sensor, len(n.Sensors))}
+	for i, s := range n.Sensors {
+		out.Sensors[i] = &hueclient.Sensor{}
+		if err := convert(s, out.Sensors[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+func (b *huegoBridge) FindLightsContext(ctx context.Context) error {
+	_, err := b.bridge().FindLightsContext(ctx)
+
+	return err
+}
+
+func (b *huegoBridge) FindSensorsContext(ctx context.Context) error {
+	_, err := b.bridge().FindSensorsContext(ctx)
+
+	return err
+}
+
+// SetLightStateContext changes the state of a light through hueclient, since
+// huego can't leave the on state of a light unchanged.
+func (b *huegoBridge) SetLightStateContext(ctx context.Context, id int, action hueclient.Action) error {
+	return b.hue.SetLightStateContext(ctx, id, action)
+}
+
+// SetGroupStateContext changes the state of a group through hueclient, as
+// SetLightStateContext does.
+func (b *huegoBridge) SetGroupStateContext(ctx context.Context, id int, action hueclient.Action) error {
+	return b.hue.SetGroupStateContext(ctx, id, action)
+}
+
+func (b *huegoBridge) GetResourcelinksContext(ctx context.Context) ([]*hueclient.Resourcelink, error) {
+	links, err := b.bridge().GetResourcelinksContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*hueclient.Resourcelink, len(links))
+	for i, l := range links {
+		out[i] = &hueclient.Resourcelink{}
+		if err := convert(l, out[i]); err != nil {
+			return nil, err
+		}
+		out[i].ID = l.ID
+	}
+
+	return out, nil
+}
@@ -0,0 +1,149 @@
+package huetest
+
+// The canned state is a small home: two lights in a living room, a dimmer
+// switch and a motion sensor.
+const (
+	cannedLights = `{
+	"1": {
+		"name": "Ceiling",
+		"type": "Extended color light",
+		"modelid": "LCT015",
+		"manufacturername": "Signify Netherlands B.V.",
+		"productname": "Hue color lamp",
+		"uniqueid": "00:17:88:01:00:00:00:01-0b",
+		"swversion": "1.88.1",
+		"state": {"on": true, "bri": 200, "hue": 8402, "sat": 140, "xy": [0.4575, 0.4099], "ct": 366, "alert": "none", "effect": "none", "colormode": "ct", "reachable": true}
+	},
+	"2": {
+		"name": "Floor lamp",
+		"type": "Dimmable light",
+		"modelid": "LWB010",
+		"manufacturername": "Signify Netherlands B.V.",
+		"productname": "Hue white lamp",
+		"uniqueid": "00:17:88:01:00:00:00:02-0b",
+		"swversion": "1.88.1",
+		"state": {"on": false, "bri": 1, "alert": "none", "reachable": true}
+	}
+}`
+
+	cannedGroups = `{
+	"1": {
+		"name": "Living room",
+		"lights": ["1", "2"],
+		"type": "Room",
+		"class": "Living room",
+		"state": {"all_on": false, "any_on": true},
+		"action": {"on": true, "bri": 200, "ct": 366, "alert": "none", "colormode": "ct"}
+	}
+}`
+
+	cannedSensors = `{
+	"1": {
+		"name": "Daylight",
+		"type": "Daylight",
+		"modelid": "PHDL00",
+		"manufacturername": "Signify Netherlands B.V.",
+		"swversion": "1.0",
+		"state": {"daylight": true, "lastupdated": "2021-01-01T07:30:00"},
+		"config": {"on": true, "configured": true, "sunriseoffset": 30, "sunsetoffset": -30}
+	},
+	"2": {
+		"name": "Dimmer switch",
+		"type": "ZLLSwitch",
+		"modelid": "RWL021",
+		"manufacturername": "Signify Netherlands B.V.",
+		"uniqueid": "00:17:88:01:00:00:00:03-02-fc00",
+		"swversion": "6.1.1.28573",
+		"state": {"buttonevent": 1002, "lastupdated": "2021-01-01T00:00:00"},
+		"config": {"on": true, "battery": 90, "reachable": true}
+	},
+	"3": {
+		"name": "Hallway sensor",
+		"type": "ZLLPresence",
+		"modelid": "SML001",
+		"manufacturername": "Signify Netherlands B.V.",
+		"uniqueid": "00:17:88:01:00:00:00:04-02-0406",
+		"swversion": "6.1.1.27575",
+		"state": {"presence": false, "lastupdated": "2021-01-01T00:00:00"},
+		"config": {"on": true, "battery": 75, "reachable": true, "sensitivity": 2, "sensitivitymax": 2, "ledindication": false}
+	},
+	"4": {
+		"name": "Hallway temperature",
+		"type": "ZLLTemperature",
+		"modelid": "SML001",
+		"manufacturername": "Signify Netherlands B.V.",
+		"uniqueid": "00:17:88:01:00:00:00:04-02-0402",
+		"swversion": "6.1.1.27575",
+		"state": {"temperature": 2100, "lastupdated": "2021-01-01T00:00:00"},
+		"config": {"on": true, "battery": 75, "reachable": true}
+	},
+	"5": {
+		"name": "Hallway scene cycle",
+		"type": "CLIPGenericStatus",
+		"modelid": "GENERICSTATUS",
+		"manufacturername": "Philips",
+		"uniqueid": "HALLWAYCYCLE",
+		"swversion": "1.0",
+		"state": {"status": 2, "lastupdated": "2021-01-01T00:00:00"},
+		"config": {"on": true, "reachable": true}
+	},
+	"6": {
+		"name": "Away mode",
+		"type": "CLIPGenericFlag",
+		"modelid": "GENERICFLAG",
+		"manufacturername": "Philips",
+		"uniqueid": "AWAYMODE",
+		"swversion": "1.0",
+		"state": {"flag": false, "lastupdated": "2021-01-01T00:00:00"},
+		"config": {"on": true, "reachable": true}
+	},
+	"7": {
+		"name": "Pixel 5",
+		"type": "Geofence",
+		"modelid": "HA_GEOFENCE",
+		"manufacturername": "Philips",
+		"uniqueid": "L_04_6rEya",
+		"swversion": "A_1",
+		"state": {"presence": true, "lastupdated": "2021-01-01T00:00:00"},
+		"config": {"on": true, "reachable": true}
+	}
+}`
+
+	cannedResourcelinks = `{
+	"12345": {
+		"name": "Hallway motion",
+		"description": "Motion sensor configuration",
+		"type": "Link",
+		"classid": 10020,
+		"owner": "huetest",
+		"recycle": false,
+		"links": ["/sensors/3", "/rules/1", "/rules/2"]
+	}
+}`
+
+	cannedConfig = `{
+	"name": "Fake bridge",
+	"bridgeid": "001788FFFE000000",
+	"mac": "00:17:88:00:00:00",
+	"modelid": "BSB002",
+	"apiversion": "1.46.0",
+	"swversion": "1946157000",
+	"timezone": "UTC",
+	"zigbeechannel": 25,
+	"swupdate2": {
+		"state": "anyreadytoinstall",
+		"bridge": {"state": "noupdates"}
+	},
+	"whitelist": {}
+}`
+
+	cannedCapabilities = `{
+	"lights": {"available": 61},
+	"sensors": {"available": 247},
+	"groups": {"available": 62},
+	"scenes": {"available": 198},
+	"rules": {"available": 242},
+	"schedules": {"available": 96},
+	"resourcelinks": {"available": 63}
+}`
+)
@@ -0,0 +1,332 @@
+// Package huetest provides a fake Hue bridge serving the v1 API from memory,
+// so the collector can be run without hardware.
+package huetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+)
+
+// Username is the only user the fake bridge authorizes.
+const Username = "huetest"
+
+// Server is a fake Hue bridge. It serves canned lights, groups, sensors and
+// resourcelinks, the first three of which can be changed between
+// collections through its mutation hooks. Other v1 resources are served
+// empty. Searches for new devices are
+// accepted and reported as active, without ever finding any, and changes to
+// the state of lights and groups are applied.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	lights   map[string]hueclient.Light
+	groups   map[string]hueclient.Group
+	sensors  map[string]hueclient.Sensor
+	links    map[string]hueclient.Resourcelink
+	config   hueclient.Config
+	requests int
+	// scanning holds the resources a search for new devices was started
+	// for, which is reported as active.
+	scanning map[string]bool
+}
+
+// NewServer starts a fake bridge serving the canned state. It must be closed
+// once done with.
+func NewServer() *Server {
+	s := &Server{scanning: map[string]bool{}}
+	s.mustDecode(cannedLights, &s.lights)
+	s.mustDecode(cannedGroups, &s.groups)
+	s.mustDecode(cannedSensors, &s.sensors)
+	s.mustDecode(cannedResourcelinks, &s.links)
+	s.mustDecode(cannedConfig, &s.config)
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+
+	return s
+}
+
+func (s *Server) mustDecode(data string, v interface{}) {
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		panic("huetest: invalid canned state: " + err.Error())
+	}
+}
+
+// Host returns the address of the fake bridge, as configured for a real
+// bridge.
+func (s *Server) Host() string {
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+// Bridge returns a client authorized with the fake bridge.
+func (s *Server) Bridge() *hueclient.Client {
+	return hueclient.New(s.Host(), Username)
+}
+
+// Requests returns the number of API requests served.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+// SetLight adds or replaces the light with the given id.
+func (s *Server) SetLight(id string, l hueclient.Light) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lights[id] = l
+}
+
+// UpdateLight changes the light with the given id through fn, reporting
+// whether the light exists.
+func (s *Server) UpdateLight(id string, fn func(*hueclient.Light)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.lights[id]
+	if !ok {
+		return false
+	}
+
+	fn(&l)
+	s.lights[id] = l
+
+	return true
+}
+
+// DeleteLight removes the light with the given id.
+func (s *Server) DeleteLight(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.lights, id)
+}
+
+// SetGroup adds or replaces the group with the given id.
+func (s *Server) SetGroup(id string, g hueclient.Group) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.groups[id] = g
+}
+
+// UpdateGroup changes the group with the given id through fn, reporting
+// whether the group exists.
+func (s *Server) UpdateGroup(id string, fn func(*hueclient.Group)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.groups[id]
+	if !ok {
+		return false
+	}
+
+	fn(&g)
+	s.groups[id] = g
+
+	return true
+}
+
+// DeleteGroup removes the group with the given id.
+func (s *Server) DeleteGroup(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.groups, id)
+}
+
+// SetSensor adds or replaces the sensor with the given id.
+func (s *Server) SetSensor(id string, sensor hueclient.Sensor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sensors[id] = sensor
+}
+
+// UpdateSensor changes the sensor with the given id through fn, reporting
+// whether the sensor exists.
+func (s *Server) UpdateSensor(id string, fn func(*hueclient.Sensor)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sensor, ok := s.sensors[id]
+	if !ok {
+		return false
+	}
+
+	fn(&sensor)
+	s.sensors[id] = sensor
+
+	return true
+}
+
+// DeleteSensor removes the sensor with the given id.
+func (s *Server) DeleteSensor(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sensors, id)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+
+	// paths are /api/<username>/<resource>
+	parts := strings.SplitN(strings.Trim(r.URL.Path, "/"), "/", 3)
+	if len(parts) < 2 || parts[0] != "api" {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	var resource string
+	if len(parts) == 3 {
+		resource = strings.Trim(parts[2], "/")
+	}
+
+	// only searches for new devices and state changes change the bridge
+	search := r.Method == http.MethodPost && (resource == "lights" || resource == "sensors")
+	change := r.Method == http.MethodPut && stateChange.MatchString(resource)
+	if r.Method != http.MethodGet && !search && !change {
+		writeError(w, 3, r.URL.Path, "method, "+r.Method+", not available for resource, "+r.URL.Path)
+
+		return
+	}
+
+	if parts[1] != Username {
+		writeError(w, 1, "/", "unauthorized user")
+
+		return
+	}
+
+	if change {
+		s.change(w, r, resource)
+
+		return
+	}
+
+	if search {
+		s.scanning[resource] = true
+		writeJSON(w, []map[string]interface{}{{
+			"success": map[string]interface{}{"/" + resource: "Searching for new devices"},
+		}})
+
+		return
+	}
+
+	// the bridge clock follows real time
+	cfg := s.config
+	cfg.UTC = time.Now().UTC().Format("2006-01-02T15:04:05")
+
+	switch resource {
+	case "":
+		// the full datastore
+		writeJSON(w, map[string]interface{}{
+			"lights":        s.lights,
+			"groups":        s.groups,
+			"sensors":       s.sensors,
+			"config":        cfg,
+			"scenes":        map[string]interface{}{},
+			"rules":         map[string]interface{}{},
+			"schedules":     map[string]interface{}{},
+			"resourcelinks": s.links,
+		})
+	case "lights":
+		writeJSON(w, s.lights)
+	case "lights/new", "sensors/new":
+		lastScan := "none"
+		if s.scanning[strings.TrimSuffix(resource, "/new")] {
+			lastScan = "active"
+		}
+		writeJSON(w, map[string]string{"lastscan": lastScan})
+	case "groups":
+		writeJSON(w, s.groups)
+	case "sensors":
+		writeJSON(w, s.sensors)
+	case "config":
+		writeJSON(w, cfg)
+	case "capabilities":
+		writeJSON(w, json.RawMessage(cannedCapabilities))
+	case "resourcelinks":
+		writeJSON(w, s.links)
+	case "scenes", "rules", "schedules":
+		writeJSON(w, map[string]interface{}{})
+	default:
+		writeError(w, 4, "/"+resource, "method, GET, not available for resource, /"+resource)
+	}
+}
+
+// stateChange matches the resources changing the state of a light or group.
+var stateChange = regexp.MustCompile(`^(lights/\d+/state|groups/\d+/action)$`)
+
+// change applies a change of the state of a light or group, s.mu must be
+// held. Recalled scenes are accepted without changing any light.
+func (s *Server) change(w http.ResponseWriter, r *http.Request, resource string) {
+	parts := strings.Split(resource, "/")
+	kind, id := parts[0], parts[1]
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, 2, "/"+resource, "body contains invalid json")
+
+		return
+	}
+
+	var state *hueclient.State
+	switch kind {
+	case "lights":
+		if l, ok := s.lights[id]; ok {
+			state = l.State
+		}
+	case "groups":
+		if g, ok := s.groups[id]; ok {
+			state = g.State
+		}
+	}
+	if state == nil {
+		writeError(w, 3, "/"+kind+"/"+id, "resource, /"+kind+"/"+id+", not available")
+
+		return
+	}
+
+	// the change is merged into the state through their common encoding
+	data, _ := json.Marshal(body)
+	_ = json.Unmarshal(data, state)
+
+	success := make([]map[string]interface{}, 0, len(body))
+	for key, value := range body {
+		success = append(success, map[string]interface{}{
+			"success": map[string]interface{}{"/" + resource + "/" + key: value},
+		})
+	}
+	writeJSON(w, success)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError responds with an error the way the bridge does, as a list of
+// errors with a successful status.
+func writeError(w http.ResponseWriter, typ int, address, desc string) {
+	writeJSON(w, []map[string]interface{}{{
+		"error": map[string]interface{}{
+			"type":        typ,
+			"address":     address,
+			"description": desc,
+		},
+	}})
+}
@@ -0,0 +1,225 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ninnemana/hue-exporter/collector/huetest"
+	"github.com/ninnemana/hue-exporter/discovery"
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// cannedSeries are series reported for the canned state of huetest.
+var cannedSeries = map[string]float64{
+	`light_on{bridge="huetest",id="1"}`:                                                           1,
+	`light_on{bridge="huetest",id="2"}`:                                                           0,
+	`light_reachable{bridge="huetest",id="2"}`:                                                    1,
+	`light_saturation{bridge="huetest",colormode="ct",id="1"}`:                                    140,
+	`group_any_on{bridge="huetest",class="Living room",id="1",name="Living room",type="Room"}`:    1,
+	`group_all_on{bridge="huetest",class="Living room",id="1",name="Living room",type="Room"}`:    0,
+	`sensor_temperature_celsius{bridge="huetest",id="4",type="ZLLTemperature"}`:                   21,
+	`sensor_battery_percent{bridge="huetest",id="2",type="ZLLSwitch"}`:                            90,
+	`sensor_battery_percent{bridge="huetest",id="3",type="ZLLPresence"}`:                          75,
+	`sensor_sensitivity{bridge="huetest",id="3",type="ZLLPresence"}`:                              2,
+	`sensor_generic_status{bridge="huetest",id="5",name="Hallway scene cycle"}`:                   2,
+	`bridge_capability_available{bridge="huetest",resource="lights"}`:                             61,
+	`bridge_zigbee_channel{bridge="huetest"}`:                                                     25,
+	`bridge_software_update_state{bridge="huetest",component="system",state="anyreadytoinstall"}`: 1,
+	`bridge_software_update_state{bridge="huetest",component="system",state="noupdates"}`:         0,
+	`bridge_software_update_state{bridge="huetest",component="bridge",state="noupdates"}`:         1,
+}
+
+// newHuetestGatherer returns a gatherer collecting from a fake bridge, once
+// collected from.
+func newHuetestGatherer(t *testing.T, opts ...Option) (*huetest.Server, *Gatherer, *prometheus.Registry) {
+	t.Helper()
+
+	s := huetest.NewServer()
+	t.Cleanup(s.Close)
+
+	g, reg := newTestGatherer(t, append([]Option{
+		WithHueConfig(HueConfig{Name: "huetest", IP: s.Host(), Username: huetest.Username}),
+	}, opts...)...)
+
+	if err := g.Collect(context.Background()); err != nil {
+		t.Fatalf("failed to collect: %v", err)
+	}
+
+	return s, g, reg
+}
+
+func TestHuetestCollect(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		// requests is the number of requests a cycle sends the bridge
+		requests int
+	}{
+		{name: "resources", requests: 11},
+		{name: "datastore", opts: []Option{WithDatastore()}, requests: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _, reg := newHuetestGatherer(t, tt.opts...)
+
+			expectSeries(t, gather(t, reg), cannedSeries)
+			if s.Requests() != tt.requests {
+				t.Errorf("sent %d requests, want %d", s.Requests(), tt.requests)
+			}
+		})
+	}
+}
+
+func TestHuetestCollectChanges(t *testing.T) {
+	s, g, reg := newHuetestGatherer(t)
+
+	s.UpdateLight("1", func(l *hueclient.Light) {
+		l.State.On = false
+	})
+	s.DeleteLight("2")
+	s.SetSensor("8", hueclient.Sensor{
+		Name:    "Kitchen temperature",
+		Type:    "ZLLTemperature",
+		ModelID: "SML001",
+		State:   map[string]interface{}{"temperature": 1850.0, "lastupdated": "2021-01-01T00:00:00"},
+		Config:  map[string]interface{}{"on": true, "battery": 100.0, "reachable": true},
+	})
+
+	if err := g.Collect(context.Background()); err != nil {
+		t.Fatalf("failed to collect: %v", err)
+	}
+
+	got := gather(t, reg)
+	if _, ok := got[`light_on{bridge="huetest",id="2"}`]; ok {
+		t.Error("light 2 is still reported once deleted")
+	}
+	expectSeries(t, got, map[string]float64{
+		`light_on{bridge="huetest",id="1"}`:                                         0,
+		`sensor_temperature_celsius{bridge="huetest",id="8",type="ZLLTemperature"}`: 18.5,
+		`sensor_battery_percent{bridge="huetest",id="8",type="ZLLTemperature"}`:     100,
+	})
+}
+
+// staticDiscoverer discovers a fixed set of bridges.
+type staticDiscoverer []discovery.Bridge
+
+func (d staticDiscoverer) Discover(ctx context.Context) ([]discovery.Bridge, error) {
+	return d, nil
+}
+
+func TestHuetestCollectUndiscovered(t *testing.T) {
+	s := huetest.NewServer()
+	t.Cleanup(s.Close)
+
+	g, reg := newTestGatherer(t,
+		WithDiscovery(staticDiscoverer{{ID: "001788fffe000001", Address: s.Host()}}),
+		WithHueConfig(
+			HueConfig{Name: "huetest", ID: "001788fffe000001", Username: huetest.Username},
+			HueConfig{Name: "lost", ID: "001788fffe000002", Username: huetest.Username},
+		),
+	)
+
+	err := g.Collect(context.Background())
+	if !errors.Is(err, discovery.ErrNotFound) {
+		t.Errorf("got error %v, want the lost bridge not to be found", err)
+	}
+
+	got := gather(t, reg)
+	expectSeries(t, got, cannedSeries)
+	if _, ok := got[`light_on{bridge="lost",id="1"}`]; ok {
+		t.Error("the lost bridge is reported though it was never found")
+	}
+	expectSeries(t, got, map[string]float64{
+		`bridge_up{bridge="huetest"}`: 1,
+		`bridge_up{bridge="lost"}`:    0,
+	})
+}
+
+// TestHuetestCollectDiscoveryOnly covers a bridge configured with nothing
+// but a username, as with an empty HUE_ADDRESS, located through discovery.
+func TestHuetestCollectDiscoveryOnly(t *testing.T) {
+	s := huetest.NewServer()
+	t.Cleanup(s.Close)
+
+	g, reg := newTestGatherer(t,
+		WithDiscovery(staticDiscoverer{{ID: "001788fffe000001", Address: s.Host()}}),
+		WithHueConfig(HueConfig{Username: huetest.Username}),
+	)
+
+	if err := g.Collect(context.Background()); err != nil {
+		t.Fatalf("failed to collect: %v", err)
+	}
+
+	expectSeries(t, gather(t, reg), map[string]float64{
+		`light_on{bridge="default",id="1"}`: 1,
+		`bridge_up{bridge="default"}`:       1,
+	})
+}
+
+// countingDiscoverer discovers a fixed set of bridges, recording the calls
+// made and whether their context was done.
+type countingDiscoverer struct {
+	found []discovery.Bridge
+
+	mu    sync.Mutex
+	calls int
+	errs  []error
+}
+
+func (d *countingDiscoverer) Discover(ctx context.Context) ([]discovery.Bridge, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.calls++
+	d.errs = append(d.errs, ctx.Err())
+
+	return d.found, nil
+}
+
+func TestHuetestCollectRelocatesTimedOutBridge(t *testing.T) {
+	s := huetest.NewServer()
+	t.Cleanup(s.Close)
+
+	// hung never answers, timing the cycle out
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(hung.Close)
+
+	d := &countingDiscoverer{found: []discovery.Bridge{{ID: "001788fffe000002", Address: s.Host()}}}
+	g, _ := newTestGatherer(t,
+		WithDiscovery(d),
+		WithCycleTimeout(100*time.Millisecond),
+		WithHueConfig(
+			HueConfig{Name: "huetest", IP: s.Host(), Username: huetest.Username},
+			HueConfig{Name: "hung", ID: "001788fffe000002", IP: strings.TrimPrefix(hung.URL, "http://"), Username: huetest.Username},
+		),
+	)
+
+	if err := g.Collect(context.Background()); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("got error %v, want the hung bridge to time out", err)
+	}
+
+	if d.calls != 1 {
+		t.Errorf("discovered %d times, want once", d.calls)
+	}
+	for _, err := range d.errs {
+		if err != nil {
+			t.Errorf("discovered with a done context: %v", err)
+		}
+	}
+
+	for _, b := range g.bridges {
+		if b.hue.Host() != s.Host() {
+			t.Errorf("bridge %q is at %q, want it at %q", b.name, b.hue.Host(), s.Host())
+		}
+	}
+}
@@ -0,0 +1,432 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/unit"
+)
+
+type instrumentKind int
+
+// Units of the instruments, as UCUM codes.
+const (
+	unitSeconds    unit.Unit = "s"
+	unitPercent    unit.Unit = "%"
+	unitLux        unit.Unit = "lx"
+	unitWatts      unit.Unit = "W"
+	unitCelsius    unit.Unit = "Cel"
+	unitFahrenheit unit.Unit = "[degF]"
+)
+
+const (
+	int64GaugeKind instrumentKind = iota
+	int64CounterKind
+	float64GaugeKind
+	float64CounterKind
+)
+
+// instrument describes a registered instrument and the callbacks reporting
+// it.
+type instrument struct {
+	name     string
+	desc     string
+	kind     instrumentKind
+	int64s   []metric.Int64ObserverFunc
+	float64s []metric.Float64ObserverFunc
+}
+
+// instruments registers each asynchronous instrument with the meters once and
+// fans its collection out to every callback reporting it. Jobs for multiple
+// bridges share instruments this way, each callback observing the state last
+// collected by its job. Without meters the instruments are only recorded, to
+// be read by a native Prometheus collector.
+type instruments struct {
+	meters []metric.Meter
+	// labels are added to every observation and replacer rewrites the
+	// label values observed, which are truncated to valueLimit bytes.
+	labels     []attribute.KeyValue
+	replacer   *strings.Replacer
+	valueLimit int
+	// seriesLimit caps the series of each instrument, overflows counts the
+	// observations dropped beyond it by instrument.
+	seriesLimit int
+	overflows   map[string]int64
+	// expired is set while registering the instruments of a job whose
+	// state may expire, its callbacks stop observing while it reports
+	// true.
+	expired func() bool
+
+	mu    sync.RWMutex
+	names []string
+	defs  map[string]*instrument
+	// exemplars link the last observation of counter series to the trace of
+	// the collection it was made in, keyed by instrument and label set.
+	exemplars map[string]map[attribute.Distinct]exemplar
+}
+
+// exemplar links an observation to the trace it was made in.
+type exemplar struct {
+	traceID string
+	value   float64
+	time    time.Time
+}
+
+func newInstruments(meters []metric.Meter, labels map[string]string, replace map[string]string) *instruments {
+	i := &instruments{
+		meters:    meters,
+		defs:      map[string]*instrument{},
+		exemplars: map[string]map[attribute.Distinct]exemplar{},
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		i.labels = append(i.labels, attribute.String(k, labels[k]))
+	}
+
+	if len(replace) > 0 {
+		// longer values are replaced first so they win over any value they
+		// contain
+		olds := make([]string, 0, len(replace))
+		for old := range replace {
+			olds = append(olds, old)
+		}
+		sort.Slice(olds, func(a, b int) bool {
+			if len(olds[a]) != len(olds[b]) {
+				return len(olds[a]) > len(olds[b])
+			}
+
+			return olds[a] < olds[b]
+		})
+
+		pairs := make([]string, 0, len(replace)*2)
+		for _, old := range olds {
+			pairs = append(pairs, old, replace[old])
+		}
+		i.replacer = strings.NewReplacer(pairs...)
+	}
+
+	return i
+}
+
+// relabels reports whether observations are rewritten before being reported.
+func (i *instruments) relabels() bool {
+	return len(i.labels) > 0 || i.replacer != nil || i.valueLimit > 0
+}
+
+// relabel adds the static labels to the labels of an observation and
+// rewrites their values. Labels of the observation take precedence over
+// static labels with the same key.
+func (i *instruments) relabel(labels []attribute.KeyValue) []attribute.KeyValue {
+	out := make([]attribute.KeyValue, 0, len(i.labels)+len(labels))
+	out = append(out, i.labels...)
+	for _, kv := range labels {
+		if i.replacer != nil && kv.Value.Type() == attribute.STRING {
+			kv = attribute.String(string(kv.Key), i.replacer.Replace(kv.Value.AsString()))
+		}
+		if i.valueLimit > 0 && kv.Value.Type() == attribute.STRING {
+			kv = attribute.String(string(kv.Key), truncate(kv.Value.AsString(), i.valueLimit))
+		}
+
+		out = append(out, kv)
+	}
+
+	return out
+}
+
+// labelSet returns the set of the labels of an observation. They are copied
+// into buf first, since NewSet sorts them in place and callbacks may observe
+// the same labels on every collection.
+func labelSet(buf *[]attribute.KeyValue, labels []attribute.KeyValue) attribute.Set {
+	*buf = append((*buf)[:0], labels...)
+
+	return attribute.NewSet(*buf...)
+}
+
+// relabelInt64 wraps cb to relabel its observations.
+func (i *instruments) relabelInt64(cb metric.Int64ObserverFunc) metric.Int64ObserverFunc {
+	if !i.relabels() {
+		return cb
+	}
+
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		cb.Run(ctx, nil, func(labels []attribute.KeyValue, obs ...metric.Observation) {
+			for _, o := range obs {
+				n := o.Number()
+				res.Observe(n.AsInt64(), i.relabel(labels)...)
+			}
+		})
+	}
+}
+
+// relabelFloat64 wraps cb to relabel its observations.
+func (i *instruments) relabelFloat64(cb metric.Float64ObserverFunc) metric.Float64ObserverFunc {
+	if !i.relabels() {
+		return cb
+	}
+
+	return func(ctx context.Context, res metric.Float64ObserverResult) {
+		cb.Run(ctx, nil, func(labels []attribute.KeyValue, obs ...metric.Observation) {
+			for _, o := range obs {
+				n := o.Number()
+				res.Observe(n.AsFloat64(), i.relabel(labels)...)
+			}
+		})
+	}
+}
+
+// expiring registers the instruments of register, whose callbacks stop
+// observing while expired reports true.
+func (i *instruments) expiring(expired func() bool, register func() error) error {
+	i.expired = expired
+	defer func() { i.expired = nil }()
+
+	return register()
+}
+
+// expireInt64 wraps cb to stop observing while the job registering it is
+// expired.
+func (i *instruments) expireInt64(cb metric.Int64ObserverFunc) metric.Int64ObserverFunc {
+	expired := i.expired
+	if expired == nil {
+		return cb
+	}
+
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		if !expired() {
+			cb(ctx, res)
+		}
+	}
+}
+
+// expireFloat64 wraps cb to stop observing while the job registering it is
+// expired.
+func (i *instruments) expireFloat64(cb metric.Float64ObserverFunc) metric.Float64ObserverFunc {
+	expired := i.expired
+	if expired == nil {
+		return cb
+	}
+
+	return func(ctx context.Context, res metric.Float64ObserverResult) {
+		if !expired() {
+			cb(ctx, res)
+		}
+	}
+}
+
+func (i *instruments) int64Gauge(name, desc string, u unit.Unit, cb metric.Int64ObserverFunc) error {
+	return i.addInt64(int64GaugeKind, name, desc, u, cb)
+}
+
+func (i *instruments) int64Counter(name, desc string, u unit.Unit, cb metric.Int64ObserverFunc) error {
+	return i.addInt64(int64CounterKind, name, desc, u, cb)
+}
+
+func (i *instruments) float64Gauge(name, desc string, u unit.Unit, cb metric.Float64ObserverFunc) error {
+	return i.addFloat64(float64GaugeKind, name, desc, u, cb)
+}
+
+func (i *instruments) float64Counter(name, desc string, u unit.Unit, cb metric.Float64ObserverFunc) error {
+	return i.addFloat64(float64CounterKind, name, desc, u, cb)
+}
+
+func (i *instruments) addFloat64(kind instrumentKind, name, desc string, u unit.Unit, cb metric.Float64ObserverFunc) error {
+	cb = i.relabelFloat64(i.expireFloat64(cb))
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if def, err := i.known(name, kind); err != nil || def != nil {
+		if err == nil {
+			def.float64s = append(def.float64s, cb)
+		}
+
+		return err
+	}
+
+	observe := func(ctx context.Context, res metric.Float64ObserverResult) {
+		limit := i.newLimit(name)
+		for _, cb := range i.float64Callbacks(name) {
+			cb.Run(ctx, nil, func(labels []attribute.KeyValue, obs ...metric.Observation) {
+				for _, o := range obs {
+					n := o.Number()
+					if limit.admit(labels, n.AsFloat64()) {
+						// the meter sorts the labels in place
+						res.Observe(n.AsFloat64(), append([]attribute.KeyValue(nil), labels...)...)
+					}
+				}
+			})
+		}
+		i.flush(name, limit, func(v float64, labels []attribute.KeyValue) {
+			res.Observe(v, labels...)
+		})
+	}
+
+	for _, meter := range i.meters {
+		var err error
+		switch kind {
+		case float64CounterKind:
+			_, err = meter.NewFloat64CounterObserver(name, observe, metric.WithDescription(desc), metric.WithUnit(u))
+		default:
+			_, err = meter.NewFloat64GaugeObserver(name, observe, metric.WithDescription(desc), metric.WithUnit(u))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to register %s: %w", name, err)
+		}
+	}
+
+	i.add(&instrument{
+		name:     name,
+		desc:     desc,
+		kind:     kind,
+		float64s: []metric.Float64ObserverFunc{cb},
+	})
+
+	return nil
+}
+
+func (i *instruments) addInt64(kind instrumentKind, name, desc string, u unit.Unit, cb metric.Int64ObserverFunc) error {
+	cb = i.relabelInt64(i.expireInt64(cb))
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if def, err := i.known(name, kind); err != nil || def != nil {
+		if err == nil {
+			def.int64s = append(def.int64s, cb)
+		}
+
+		return err
+	}
+
+	observe := func(ctx context.Context, res metric.Int64ObserverResult) {
+		limit := i.newLimit(name)
+		for _, cb := range i.int64Callbacks(name) {
+			cb.Run(ctx, nil, func(labels []attribute.KeyValue, obs ...metric.Observation) {
+				for _, o := range obs {
+					n := o.Number()
+					if limit.admit(labels, float64(n.AsInt64())) {
+						// the meter sorts the labels in place
+						res.Observe(n.AsInt64(), append([]attribute.KeyValue(nil), labels...)...)
+					}
+				}
+			})
+		}
+		i.flush(name, limit, func(v float64, labels []attribute.KeyValue) {
+			res.Observe(int64(v), labels...)
+		})
+	}
+
+	for _, meter := range i.meters {
+		var err error
+		switch kind {
+		case int64CounterKind:
+			_, err = meter.NewInt64CounterObserver(name, observe, metric.WithDescription(desc), metric.WithUnit(u))
+		default:
+			_, err = meter.NewInt64GaugeObserver(name, observe, metric.WithDescription(desc), metric.WithUnit(u))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to register %s: %w", name, err)
+		}
+	}
+
+	i.add(&instrument{
+		name:   name,
+		desc:   desc,
+		kind:   kind,
+		int64s: []metric.Int64ObserverFunc{cb},
+	})
+
+	return nil
+}
+
+func (i *instruments) add(def *instrument) {
+	i.names = append(i.names, def.name)
+	i.defs[def.name] = def
+}
+
+// known returns the instrument when it was already registered, failing when
+// it was registered as a different kind.
+func (i *instruments) known(name string, kind instrumentKind) (*instrument, error) {
+	def, ok := i.defs[name]
+	if !ok {
+		return nil, nil
+	}
+
+	if def.kind != kind {
+		return nil, fmt.Errorf("instrument %s is already registered as a different kind", name)
+	}
+
+	return def, nil
+}
+
+func (i *instruments) int64Callbacks(name string) []metric.Int64ObserverFunc {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return i.defs[name].int64s
+}
+
+func (i *instruments) float64Callbacks(name string) []metric.Float64ObserverFunc {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return i.defs[name].float64s
+}
+
+// setExemplar records the exemplar of the series of the named instrument
+// with labels, replacing the last one. Exemplars are only reported by the
+// native Prometheus collector.
+func (i *instruments) setExemplar(name string, e exemplar, labels ...attribute.KeyValue) {
+	if i.relabels() {
+		labels = i.relabel(labels)
+	}
+	set := attribute.NewSet(labels...)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.exemplars[name] == nil {
+		i.exemplars[name] = map[attribute.Distinct]exemplar{}
+	}
+	i.exemplars[name][set.Equivalent()] = e
+}
+
+// exemplar returns the last exemplar recorded for the series.
+func (i *instruments) exemplar(name string, set attribute.Set) (exemplar, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	e, ok := i.exemplars[name][set.Equivalent()]
+
+	return e, ok
+}
+
+// all returns every registered instrument in registration order.
+func (i *instruments) all() []instrument {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	all := make([]instrument, 0, len(i.names))
+	for _, name := range i.names {
+		all = append(all, *i.defs[name])
+	}
+
+	return all
+}
+
+// registerer is implemented by jobs reporting their collected state through
+// instruments registered once up front.
+type registerer interface {
+	register(*instruments) error
+}
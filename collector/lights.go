@@ -0,0 +1,534 @@
+package collector
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"github.com/ninnemana/tracelog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.uber.org/zap"
+)
+
+type lights struct {
+	log    *tracelog.TraceLogger
+	hue    Bridge
+	bridge string
+	events *broker
+	clock  Clock
+	// power is the power drawn at full brightness by each light model.
+	power map[string]float64
+	// legacy also reports lights in the form used before their units and
+	// types were corrected.
+	legacy bool
+	// uniqueIDs identifies lights by their uniqueid rather than their
+	// numeric id.
+	uniqueIDs bool
+	// names labels lights with their name.
+	names bool
+
+	mu    sync.RWMutex
+	state *lightsState
+	// switchedOn and switchedOff count the times each light was found
+	// switched on or off since the previous cycle.
+	switchedOn  map[int]int64
+	switchedOff map[int]int64
+}
+
+// lightsState is the light state last collected from the bridge, it is
+// replaced as a whole and never modified once collected.
+type lightsState struct {
+	lights []hueclient.Light
+	// ids and names identify the lights when configured, and labels holds
+	// the labels of each light in the order of lights. They are computed
+	// once per cycle rather than on every collection of metrics.
+	ids       map[int64]string
+	names     map[int64]string
+	labels    []lightLabels
+	newLights *hueclient.NewLight
+	// bridge labels the series of the bridge as a whole.
+	bridge []attribute.KeyValue
+}
+
+func (l *lights) snapshot() *lightsState {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.state
+}
+
+func (l *lights) Collect(ctx context.Context) func() error {
+	ctx, span := tracer.Start(ctx, "lights.Collect")
+	log := l.log.SetContext(ctx)
+	return func() error {
+		defer span.End()
+
+		hueGroups, err := l.hue.GetGroupsContext(ctx)
+		if err != nil {
+			log.Error("failed to fetch groups", zap.Error(err))
+
+			return err
+		}
+
+		lights, err := l.hue.GetLightsContext(ctx)
+		if err != nil {
+			log.Error("failed to fetch lights", zap.Error(err))
+
+			return err
+		}
+
+		newLights, err := l.hue.GetNewLightsContext(ctx)
+		if err != nil {
+			log.Error("failed to fetch new lights", zap.Error(err))
+
+			return err
+		}
+
+		log.Debug("collected light metrics", zap.Int("count", len(lights)), zap.Int("new", len(newLights.Lights)))
+
+		state := &lightsState{
+			lights:    lights,
+			newLights: newLights,
+			bridge:    []attribute.KeyValue{attribute.String("bridge", l.bridge)},
+		}
+		state.labels = newLightLabels(l.bridge, lights, lightGroupNames(hueGroups), l.legacy)
+		if l.uniqueIDs {
+			state.ids = lightUniqueIDs(lights)
+		}
+		if l.names {
+			state.names = lightNames(lights)
+		}
+
+		l.mu.Lock()
+		if l.state != nil {
+			events := diffLights(l.bridge, l.state.lights, lights, l.clock.Now())
+			l.countSwitches(events)
+			l.events.publish(events...)
+		}
+		l.forgetRemoved(lights)
+		l.state = state
+		l.mu.Unlock()
+
+		return nil
+	}
+}
+
+func (l *lights) register(inst *instruments) error {
+	var id identifier
+	if l.uniqueIDs {
+		id.ids = func() map[int64]string {
+			if s := l.snapshot(); s != nil {
+				return s.ids
+			}
+
+			return nil
+		}
+	}
+	if l.names {
+		id.names = func() map[int64]string {
+			if s := l.snapshot(); s != nil {
+				return s.names
+			}
+
+			return nil
+		}
+	}
+
+	if l.legacy {
+		if err := inst.int64Gauge(
+			"light",
+			"Number of lights in the current state. Includes brightness, identifer, and on state.",
+			unit.Dimensionless,
+			func(ctx context.Context, res metric.Int64ObserverResult) {
+				if s := l.snapshot(); s != nil {
+					s.observeLegacy(ctx, res)
+				}
+			},
+		); err != nil {
+			return err
+		}
+
+		if err := inst.int64Gauge(
+			"light_brightness",
+			"Brightness of lights.",
+			unit.Dimensionless,
+			func(ctx context.Context, res metric.Int64ObserverResult) {
+				if s := l.snapshot(); s != nil {
+					s.observeLegacyBrightness(ctx, res)
+				}
+			},
+		); err != nil {
+			return err
+		}
+	}
+
+	if err := inst.int64Gauge(
+		"light_on",
+		"Whether the light is on.",
+		unit.Dimensionless,
+		id.int64s(func(ctx context.Context, res metric.Int64ObserverResult) {
+			if s := l.snapshot(); s != nil {
+				s.observeOn(ctx, res)
+			}
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.float64Gauge(
+		"light_brightness_percent",
+		"Brightness of lights in percent, reported whether or not the light is on.",
+		unitPercent,
+		id.float64s(func(ctx context.Context, res metric.Float64ObserverResult) {
+			if s := l.snapshot(); s != nil {
+				s.observeBrightnessPercent(ctx, res)
+			}
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"light_reachable",
+		"Whether the bridge can reach the light.",
+		unit.Dimensionless,
+		id.int64s(func(ctx context.Context, res metric.Int64ObserverResult) {
+			if s := l.snapshot(); s != nil {
+				s.observeReachable(ctx, res)
+			}
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"light_info",
+		"Light metadata, always 1. Includes name, group, model, manufacturer, product, and software version.",
+		unit.Dimensionless,
+		id.info(func(ctx context.Context, res metric.Int64ObserverResult) {
+			if s := l.snapshot(); s != nil {
+				s.observeInfo(ctx, res)
+			}
+		}),
+	); err != nil {
+		return err
+	}
+
+	colors := []struct {
+		name  string
+		desc  string
+		value func(hueclient.Light) float64
+	}{
+		{"light_hue", "Hue of color lights.", func(l hueclient.Light) float64 { return float64(l.State.Hue) }},
+		{"light_saturation", "Saturation of color lights.", func(l hueclient.Light) float64 { return float64(l.State.Sat) }},
+		{"light_color_x", "X coordinate of the color of lights in CIE color space.", func(l hueclient.Light) float64 { return float64(l.State.Xy[0]) }},
+		{"light_color_y", "Y coordinate of the color of lights in CIE color space.", func(l hueclient.Light) float64 { return float64(l.State.Xy[1]) }},
+	}
+	for _, c := range colors {
+		value := c.value
+		if err := inst.float64Gauge(
+			c.name,
+			c.desc,
+			unit.Dimensionless,
+			id.float64s(func(ctx context.Context, res metric.Float64ObserverResult) {
+				if s := l.snapshot(); s != nil {
+					s.observeColor(res, value)
+				}
+			}),
+		); err != nil {
+			return err
+		}
+	}
+
+	if err := inst.float64Gauge(
+		"light_estimated_power_watts",
+		"Power drawn by lights, estimated from their model, on state and brightness.",
+		unitWatts,
+		id.float64s(func(ctx context.Context, res metric.Float64ObserverResult) {
+			if s := l.snapshot(); s != nil {
+				s.observePower(res, l.power)
+			}
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.float64Gauge(
+		"lights_estimated_power_watts",
+		"Power drawn by all lights of the bridge with a known model, estimated from their on state and brightness.",
+		unitWatts,
+		func(ctx context.Context, res metric.Float64ObserverResult) {
+			if s := l.snapshot(); s != nil {
+				s.observeTotalPower(res, l.power)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Counter(
+		"light_switched_on_total",
+		"Number of times each light was switched on, detected between collections.",
+		unit.Dimensionless,
+		id.int64s(l.switchObserver(func() map[int]int64 { return l.switchedOn })),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Counter(
+		"light_switched_off_total",
+		"Number of times each light was switched off, detected between collections.",
+		unit.Dimensionless,
+		id.int64s(l.switchObserver(func() map[int]int64 { return l.switchedOff })),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"new_light",
+		"Number of new lights.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			if s := l.snapshot(); s != nil {
+				newLightObserver(l.bridge, s.newLights)(ctx, res)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// countSwitches counts the lights switched on or off, l.mu must be held.
+func (l *lights) countSwitches(events []Event) {
+	if l.switchedOn == nil {
+		l.switchedOn, l.switchedOff = map[int]int64{}, map[int]int64{}
+	}
+
+	for _, e := range events {
+		switch e.Type {
+		case EventLightOn:
+			l.switchedOn[e.ID]++
+		case EventLightOff:
+			l.switchedOff[e.ID]++
+		}
+	}
+}
+
+// forgetRemoved drops the switches counted for lights no longer on the
+// bridge, so their series are removed, l.mu must be held.
+func (l *lights) forgetRemoved(lights []hueclient.Light) {
+	known := make(map[int]bool, len(lights))
+	for _, light := range lights {
+		known[light.ID] = true
+	}
+
+	for id := range l.switchedOn {
+		if !known[id] {
+			delete(l.switchedOn, id)
+		}
+	}
+	for id := range l.switchedOff {
+		if !known[id] {
+			delete(l.switchedOff, id)
+		}
+	}
+}
+
+// switchObserver reports the switches counted for each light.
+func (l *lights) switchObserver(counts func() map[int]int64) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		l.mu.RLock()
+		defer l.mu.RUnlock()
+
+		for id, n := range counts() {
+			res.Observe(n, attribute.String("bridge", l.bridge), attribute.Int("id", id))
+		}
+	}
+}
+
+// lightGroupNames returns the name of the first group each light is a
+// member of, by light id.
+func lightGroupNames(groups []hueclient.Group) map[int]string {
+	names := map[int]string{}
+	for _, g := range groups {
+		for _, light := range g.Lights {
+			id, err := strconv.Atoi(light)
+			if err != nil {
+				continue
+			}
+
+			if _, ok := names[id]; !ok {
+				names[id] = g.Name
+			}
+		}
+	}
+
+	return names
+}
+
+// lightLabels are the labels of the series of a light. They are observed by
+// every collection of metrics until the next cycle, and must not be
+// modified once computed.
+type lightLabels struct {
+	// id identifies the light by bridge and id, color adds its color mode
+	// and power its model.
+	id    []attribute.KeyValue
+	color []attribute.KeyValue
+	power []attribute.KeyValue
+	// info carries the metadata of the light, and legacy its on state and
+	// group as the legacy metrics report them.
+	info   []attribute.KeyValue
+	legacy []attribute.KeyValue
+}
+
+// newLightLabels returns the labels of each light, in the order of lights.
+func newLightLabels(bridge string, lights []hueclient.Light, groups map[int]string, legacy bool) []lightLabels {
+	labels := make([]lightLabels, len(lights))
+	for i, l := range lights {
+		id := []attribute.KeyValue{
+			attribute.String("bridge", bridge),
+			attribute.Int("id", l.ID),
+		}
+
+		labels[i] = lightLabels{
+			id:    id,
+			power: append(id[:len(id):len(id)], attribute.String("model", l.ModelID)),
+			info: append(id[:len(id):len(id)],
+				attribute.String("name", l.Name),
+				attribute.String("group", groups[l.ID]),
+				attribute.String("uniqueid", l.UniqueID),
+				attribute.String("type", l.Type),
+				attribute.String("model", l.ModelID),
+				attribute.String("manufacturer", l.ManufacturerName),
+				attribute.String("product_id", l.ProductID),
+				attribute.String("sw_version", l.SwVersion),
+			),
+		}
+		if l.State != nil {
+			labels[i].color = append(id[:len(id):len(id)], attribute.String("colormode", l.State.ColorMode))
+		}
+		if legacy {
+			labels[i].legacy = append(id[:len(id):len(id)],
+				attribute.Bool("on", l.State != nil && l.State.On),
+				attribute.String("group", groups[l.ID]),
+			)
+		}
+	}
+
+	return labels
+}
+
+func (s *lightsState) observeLegacy(ctx context.Context, res metric.Int64ObserverResult) {
+	if len(s.lights) == 0 {
+		res.Observe(0, s.bridge...)
+
+		return
+	}
+
+	for i := range s.lights {
+		res.Observe(1, s.labels[i].legacy...)
+	}
+}
+
+func (s *lightsState) observeLegacyBrightness(ctx context.Context, res metric.Int64ObserverResult) {
+	if len(s.lights) == 0 {
+		res.Observe(0, s.bridge...)
+
+		return
+	}
+
+	for i, l := range s.lights {
+		var bri uint8
+		if l.State != nil {
+			bri = l.State.Bri
+		}
+
+		res.Observe(int64(bri), s.labels[i].legacy...)
+	}
+}
+
+// observeOn observes whether lights are on, labelled only with their
+// identity so the series survive renames and moves between rooms, whose
+// names are reported by light_info.
+func (s *lightsState) observeOn(ctx context.Context, res metric.Int64ObserverResult) {
+	for i, l := range s.lights {
+		if l.State == nil {
+			continue
+		}
+
+		res.Observe(boolValue(l.State.On), s.labels[i].id...)
+	}
+}
+
+// observeBrightnessPercent observes the brightness of lights scaled from
+// the 1 to 254 range of the bridge to percent, labelled as observeOn.
+func (s *lightsState) observeBrightnessPercent(ctx context.Context, res metric.Float64ObserverResult) {
+	for i, l := range s.lights {
+		if l.State == nil {
+			continue
+		}
+
+		res.Observe(brightnessPercent(l.State.Bri), s.labels[i].id...)
+	}
+}
+
+// observeReachable observes whether the bridge can reach lights, labelled
+// as observeOn.
+func (s *lightsState) observeReachable(ctx context.Context, res metric.Int64ObserverResult) {
+	for i, l := range s.lights {
+		if l.State == nil {
+			continue
+		}
+
+		res.Observe(boolValue(l.State.Reachable), s.labels[i].id...)
+	}
+}
+
+// observeInfo observes the identity of lights, the labels value metrics
+// are joined with on bridge and id.
+func (s *lightsState) observeInfo(ctx context.Context, res metric.Int64ObserverResult) {
+	for i := range s.lights {
+		res.Observe(1, s.labels[i].info...)
+	}
+}
+
+// observeColor observes a color value of lights supporting color, labeled
+// with the color mode the light is currently in.
+func (s *lightsState) observeColor(res metric.Float64ObserverResult, value func(hueclient.Light) float64) {
+	for i, l := range s.lights {
+		// white only lights don't report a color mode or coordinates
+		if l.State == nil || l.State.ColorMode == "" || len(l.State.Xy) != 2 {
+			continue
+		}
+
+		res.Observe(value(l), s.labels[i].color...)
+	}
+}
+
+func newLightObserver(bridge string, v *hueclient.NewLight) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		if len(v.Lights) == 0 {
+			res.Observe(
+				0,
+				attribute.String("bridge", bridge),
+				attribute.String("lastScan", v.LastScan),
+			)
+
+			return
+		}
+
+		for _, l := range v.Lights {
+			res.Observe(
+				1,
+				attribute.String("bridge", bridge),
+				attribute.String("name", l),
+				attribute.String("lastScan", v.LastScan),
+			)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// newManyLights returns a bridge of n color lights, in groups of ten.
+func newManyLights(n int) *fakeBridge {
+	hue := newFakeBridge()
+	hue.lights, hue.groups = nil, nil
+	for i := 1; i <= n; i++ {
+		hue.lights = append(hue.lights, hueclient.Light{
+			ID:       i,
+			Name:     "Light " + strconv.Itoa(i),
+			Type:     "Extended color light",
+			ModelID:  "LCT015",
+			UniqueID: "00:17:88:01:00:00:00:" + strconv.Itoa(i) + "-0b",
+			State:    &hueclient.State{On: i%2 == 0, Bri: uint8(i), ColorMode: "xy", Xy: []float32{0.5, 0.25}, Reachable: true},
+		})
+
+		if i%10 == 1 {
+			hue.groups = append(hue.groups, hueclient.Group{
+				ID:   len(hue.groups) + 1,
+				Name: "Room " + strconv.Itoa(len(hue.groups)+1),
+				Type: "Room",
+			})
+		}
+		g := &hue.groups[len(hue.groups)-1]
+		g.Lights = append(g.Lights, strconv.Itoa(i))
+	}
+
+	return hue
+}
+
+func BenchmarkLightObservers(b *testing.B) {
+	hue := newManyLights(60)
+	l := &lights{log: testLogger, hue: newSnapshotBridge(hue), bridge: "fake", clock: systemClock{}, power: DefaultPowerTable}
+	if err := l.Collect(context.Background())(); err != nil {
+		b.Fatalf("failed to collect: %v", err)
+	}
+
+	ctx := context.Background()
+	discard := func([]attribute.KeyValue, ...metric.Observation) {}
+	hueValue := func(l hueclient.Light) float64 { return float64(l.State.Hue) }
+
+	s := l.snapshot()
+	int64s := []metric.Int64ObserverFunc{s.observeOn, s.observeReachable, s.observeInfo}
+	float64s := []metric.Float64ObserverFunc{
+		s.observeBrightnessPercent,
+		func(ctx context.Context, res metric.Float64ObserverResult) {
+			s.observeColor(res, hueValue)
+			s.observePower(res, l.power)
+		},
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for j := range int64s {
+			int64s[j].Run(ctx, nil, discard)
+		}
+		for j := range float64s {
+			float64s[j].Run(ctx, nil, discard)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ninnemana/tracelog"
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.uber.org/zap"
+)
+
+// FieldMapping declares a metric reporting a field of the lights, groups or
+// sensors of each bridge, so fields the built-in metrics leave out can be
+// reported without changes to the collector.
+type FieldMapping struct {
+	// Name is the name of the metric, prefixed as the built-in metrics are.
+	Name string `yaml:"name"`
+	Help string `yaml:"help"`
+	// Type is either gauge, the default, or counter.
+	Type string `yaml:"type"`
+	// Resource is the kind of resource the field is read from, one of
+	// lights, groups or sensors.
+	Resource string `yaml:"resource"`
+	// Path is the dot separated path of the field within each resource,
+	// such as state.bri or config.sensitivity, with list elements
+	// addressed by index. Numbers are reported as is and booleans as 0 or
+	// 1, resources without a number or boolean at the path are skipped.
+	Path string `yaml:"path"`
+	// Labels maps the names of labels added to the bridge and id labels to
+	// the path of the field their value is read from, such as type: type.
+	Labels map[string]string `yaml:"labels"`
+}
+
+// mappedResources are the kinds of resources fields may be mapped from.
+var mappedResources = map[string]bool{
+	"lights":  true,
+	"groups":  true,
+	"sensors": true,
+}
+
+// valid reports why the mapping can't be registered, if it can't.
+func (m FieldMapping) valid() error {
+	if !model.IsValidMetricName(model.LabelValue(m.Name)) {
+		return fmt.Errorf("%w: invalid metric name %q", ErrInvalidMapping, m.Name)
+	}
+
+	if m.Type != "" && m.Type != "gauge" && m.Type != "counter" {
+		return fmt.Errorf("%w: %s: type must be gauge or counter, got %q", ErrInvalidMapping, m.Name, m.Type)
+	}
+
+	if !mappedResources[m.Resource] {
+		return fmt.Errorf("%w: %s: resource must be lights, groups or sensors, got %q", ErrInvalidMapping, m.Name, m.Resource)
+	}
+
+	if m.Path == "" {
+		return fmt.Errorf("%w: %s: path is required", ErrInvalidMapping, m.Name)
+	}
+
+	for name := range m.Labels {
+		if !model.LabelName(name).IsValid() || name == "bridge" || name == "id" {
+			return fmt.Errorf("%w: %s: invalid label name %q", ErrInvalidMapping, m.Name, name)
+		}
+	}
+
+	return nil
+}
+
+// mappings reports the fields of resources declared by field mappings. The
+// resources are fetched undecoded, so fields the models leave out can be
+// mapped, each kind once per cycle.
+type mappings struct {
+	log      *tracelog.TraceLogger
+	hue      rawGetter
+	bridge   string
+	mappings []FieldMapping
+
+	mu sync.RWMutex
+	// resources holds the resources last collected of each kind mapped,
+	// keyed by id.
+	resources map[string]map[string]interface{}
+}
+
+func (m *mappings) snapshot(resource string) map[string]interface{} {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.resources[resource]
+}
+
+func (m *mappings) Collect(ctx context.Context) func() error {
+	ctx, span := tracer.Start(ctx, "mappings.Collect")
+	log := m.log.SetContext(ctx)
+
+	return func() error {
+		defer span.End()
+
+		resources := map[string]map[string]interface{}{}
+		for _, mapping := range m.mappings {
+			if _, ok := resources[mapping.Resource]; ok {
+				continue
+			}
+
+			var all map[string]interface{}
+			if err := m.hue.Get(ctx, mapping.Resource, &all); err != nil {
+				log.Error("failed to fetch mapped resources", zap.String("resource", mapping.Resource), zap.Error(err))
+
+				return err
+			}
+			resources[mapping.Resource] = all
+		}
+
+		log.Debug("collected mapped metrics", zap.Int("count", len(m.mappings)))
+
+		m.mu.Lock()
+		m.resources = resources
+		m.mu.Unlock()
+
+		return nil
+	}
+}
+
+func (m *mappings) register(inst *instruments) error {
+	for _, mapping := range m.mappings {
+		mapping := mapping
+		observe := func(ctx context.Context, res metric.Float64ObserverResult) {
+			mappingObserver(m.bridge, m.snapshot(mapping.Resource), mapping)(ctx, res)
+		}
+
+		add := inst.float64Gauge
+		if mapping.Type == "counter" {
+			add = inst.float64Counter
+		}
+
+		if err := add(mapping.Name, mapping.Help, unit.Dimensionless, observe); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mappingObserver observes the mapped field of each resource, labelled with
+// the fields of its labels.
+func mappingObserver(bridge string, resources map[string]interface{}, mapping FieldMapping) metric.Float64ObserverFunc {
+	return func(ctx context.Context, res metric.Float64ObserverResult) {
+		for id, resource := range resources {
+			var v float64
+			switch field := lookup(resource, mapping.Path).(type) {
+			case float64:
+				v = field
+			case bool:
+				v = float64(boolValue(field))
+			default:
+				continue
+			}
+
+			labels := []attribute.KeyValue{
+				attribute.String("bridge", bridge),
+				attribute.String("id", id),
+			}
+			for name, path := range mapping.Labels {
+				labels = append(labels, attribute.String(name, labelValue(lookup(resource, path))))
+			}
+
+			res.Observe(v, labels...)
+		}
+	}
+}
+
+// lookup returns the field at the dot separated path of the decoded JSON
+// value, nil when there is none.
+func lookup(v interface{}, path string) interface{} {
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			v = node[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil
+			}
+			v = node[i]
+		default:
+			return nil
+		}
+	}
+
+	return v
+}
+
+// labelValue formats a decoded JSON value as a label value, values other
+// than strings, numbers and booleans are left empty.
+func labelValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
+}
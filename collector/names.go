@@ -0,0 +1,53 @@
+package collector
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+)
+
+func lightNames(lights []hueclient.Light) map[int64]string {
+	names := make(map[int64]string, len(lights))
+	for _, l := range lights {
+		names[int64(l.ID)] = sanitizeName(l.Name)
+	}
+
+	return names
+}
+
+func sensorNames(sensors []hueclient.Sensor) map[int64]string {
+	names := make(map[int64]string, len(sensors))
+	for _, s := range sensors {
+		names[int64(s.ID)] = sanitizeName(s.Name)
+	}
+
+	return names
+}
+
+// sanitizeName prepares a device name for use as a label value. Names are
+// set through the Hue app and may hold invalid UTF-8, control characters
+// or stray whitespace, which are dropped or collapsed to a single space so
+// names that only differ by them don't split into separate series.
+func sanitizeName(name string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToValidUTF8(name, "") {
+		switch {
+		case unicode.IsSpace(r):
+			space = b.Len() > 0
+
+			continue
+		case !unicode.IsPrint(r):
+			continue
+		}
+
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
@@ -1,11 +1,16 @@
 package collector
 
 import (
+	"net/http"
+	"sort"
 	"time"
 
-	"github.com/amimof/huego"
+	"github.com/ninnemana/hue-exporter/discovery"
+	"github.com/ninnemana/hue-exporter/hueclient"
 	"github.com/ninnemana/tracelog"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.opentelemetry.io/otel/metric"
+	"golang.org/x/time/rate"
 )
 
 type Option func(*Gatherer)
@@ -18,19 +23,432 @@ func WithLogger(l *tracelog.TraceLogger) Option {
 
 func WithTicker(d time.Duration) Option {
 	return func(c *Gatherer) {
-		c.ticker = time.NewTicker(d)
+		c.interval = d
 	}
 }
 
+// WithMaxBackoff caps the time between attempts to collect from a bridge
+// that is unreachable. Collection backs off from the collection interval,
+// doubling with every failed attempt.
+func WithMaxBackoff(d time.Duration) Option {
+	return func(c *Gatherer) {
+		c.maxBackoff = d
+	}
+}
+
+// WithStaleTTL bounds how long the state last collected by a job is reported
+// once its collections start failing, e.g. while its bridge is unreachable.
+// hue_data_stale reports the jobs serving such state, whose series are
+// dropped after the TTL until they collect again. Zero, the default, reports
+// the state until then.
+func WithStaleTTL(ttl time.Duration) Option {
+	return func(c *Gatherer) {
+		c.staleTTL = ttl
+	}
+}
+
+// WithBridge adds a bridge collected from through the given implementation
+// of its API, labelled with name. CLIP v2 resources and rediscovery are not
+// available for these bridges.
+func WithBridge(name string, b Bridge) Option {
+	return func(c *Gatherer) {
+		c.bridges = append(c.bridges, bridge{
+			name: name,
+			api:  b,
+		})
+	}
+}
+
+// WithRemoteBridge adds a bridge collected from through the Hue remote API
+// at baseURL, labelled with name. Requests are sent through client, which
+// must authorize them with the remote API. CLIP v2 resources and
+// rediscovery are not available for these bridges.
+func WithRemoteBridge(name, baseURL, username string, client *http.Client) Option {
+	return func(c *Gatherer) {
+		c.bridges = append(c.bridges, bridge{
+			name: name,
+			api:  hueclient.New(baseURL, username, hueclient.WithHTTPClient(client)),
+		})
+	}
+}
+
+// RegisterJob adds a job run during each collection cycle alongside the
+// built-in jobs, e.g. to derive metrics of its own. The job reports its
+// metrics itself, its collections are tracked under name like those of the
+// built-in jobs. It may be passed multiple times.
+func RegisterJob(name string, job CollectJob) Option {
+	return func(c *Gatherer) {
+		c.custom = append(c.custom, customJob{
+			name: name,
+			job:  job,
+		})
+	}
+}
+
+// WithJobs registers each job under the name it is keyed by, see
+// RegisterJob.
+func WithJobs(jobs map[string]CollectJob) Option {
+	return func(c *Gatherer) {
+		names := make([]string, 0, len(jobs))
+		for name := range jobs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			RegisterJob(name, jobs[name])(c)
+		}
+	}
+}
+
+// WithHTTPClient sets the client v1 API requests are sent to the bridges
+// through, e.g. to route them through a proxy or instrumented transport.
+// CLIP v2 requests keep their own client, which trusts the certificate
+// bridges present.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Gatherer) {
+		c.client = client
+	}
+}
+
+// WithRateLimit caps the number of requests per second made to the
+// bridges, shared across every job and bridge. A limit of zero or less
+// disables rate limiting.
+func WithRateLimit(perSecond float64) Option {
+	return func(c *Gatherer) {
+		if perSecond <= 0 {
+			c.throttle.limit = rate.NewLimiter(rate.Inf, 1)
+
+			return
+		}
+
+		c.throttle.limit = rate.NewLimiter(rate.Limit(perSecond), 1)
+	}
+}
+
+// WithRequestTimeout bounds each request made to a bridge. A timeout of
+// zero disables it.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(c *Gatherer) {
+		c.throttle.timeout = d
+	}
+}
+
+// WithLegacyMetrics also reports metrics in the form used before their units
+// and types were corrected, such as brightness as a label of the group
+// metric and counters without the _total suffix, for dashboards and alerts
+// still relying on them.
+func WithLegacyMetrics() Option {
+	return func(c *Gatherer) {
+		c.legacy = true
+	}
+}
+
+// WithUniqueIDLabels identifies lights and sensors in the id label by their
+// Zigbee uniqueid, which survives re-pairing a device with the bridge, in
+// place of the numeric id the bridge assigns. Devices without one, such as
+// CLIP sensors, keep their numeric id, which light_info and sensor_info
+// report as the number label. light_info and sensor_info report the uniqueid
+// either way.
+func WithUniqueIDLabels() Option {
+	return func(c *Gatherer) {
+		c.uniqueIDs = true
+	}
+}
+
+// WithNameLabels also labels light and sensor metrics with the name of the
+// device, sanitized of control characters and stray whitespace, sparing a
+// join with light_info or sensor_info. Renaming a device starts new series.
+func WithNameLabels() Option {
+	return func(c *Gatherer) {
+		c.names = true
+	}
+}
+
+// WithoutCollectors disables the named collectors, listed in Collectors, on
+// every bridge, sparing the requests they send and the series they report.
+// Disabling v2 also disables the event stream.
+func WithoutCollectors(names ...string) Option {
+	return func(c *Gatherer) {
+		if c.disabled == nil {
+			c.disabled = map[string]bool{}
+		}
+
+		for _, name := range names {
+			c.disabled[name] = true
+		}
+	}
+}
+
+// WithFieldMappings reports a metric for each mapping from a field of the
+// lights, groups or sensors of every bridge, including fields the built-in
+// metrics leave out. Mappings are only collected from bridges whose API
+// fetches resources undecoded, such as those configured through
+// WithHueConfig.
+func WithFieldMappings(mappings ...FieldMapping) Option {
+	return func(c *Gatherer) {
+		c.mappings = append(c.mappings, mappings...)
+	}
+}
+
+// WithDerivedMetrics reports a metric for each expression over the state
+// collected from every bridge, see DerivedMetric for the fields available.
+// Expressions are evaluated whenever metrics are collected.
+func WithDerivedMetrics(metrics ...DerivedMetric) Option {
+	return func(c *Gatherer) {
+		c.derived = append(c.derived, metrics...)
+	}
+}
+
+// WithSeriesLimit caps the series each metric reports per collection across
+// all bridges, protecting Prometheus from pathological bridges such as one
+// with hundreds of scenes. Observations beyond the limit are summed into a
+// single series labelled overflow="true" and counted by
+// series_overflow_total. Zero, the default, leaves series unlimited.
+func WithSeriesLimit(n int) Option {
+	return func(c *Gatherer) {
+		c.seriesLimit = n
+	}
+}
+
+// WithLabelValueLimit truncates label values longer than n bytes, such as
+// long scene or rule names, marking the cut with an ellipsis. Zero, the
+// default, leaves label values whole.
+func WithLabelValueLimit(n int) Option {
+	return func(c *Gatherer) {
+		c.valueLimit = n
+	}
+}
+
+// WithConcurrency bounds the number of requests in flight to each bridge,
+// defaults to 3. Zero leaves them unbounded.
+func WithConcurrency(n int) Option {
+	return func(c *Gatherer) {
+		c.concurrency = n
+	}
+}
+
+// WithCycleTimeout bounds a collection cycle across all bridges, so a hung
+// bridge can't hold up the cycles following it. A timeout of zero disables
+// it.
+func WithCycleTimeout(d time.Duration) Option {
+	return func(c *Gatherer) {
+		c.timeout = d
+	}
+}
+
+// WithJitter delays each collection cycle by a random duration of up to d,
+// spreading the load of exporters sharing an interval over time.
+func WithJitter(d time.Duration) Option {
+	return func(c *Gatherer) {
+		c.jitter = d
+	}
+}
+
+// WithClock schedules collection cycles against the clock rather than the
+// wall clock, waiting on the tickers it creates unless WithTickerFactory is
+// also provided. Tests use it to drive cycles without sleeping.
+func WithClock(clock Clock) Option {
+	return func(c *Gatherer) {
+		c.clock = clock
+	}
+}
+
+// WithTickerFactory creates the ticker collection cycles wait on through
+// newTicker, keeping the time from the configured clock.
+func WithTickerFactory(newTicker TickerFactory) Option {
+	return func(c *Gatherer) {
+		c.newTicker = newTicker
+	}
+}
+
+// WithAlignment aligns collection cycles to multiples of the interval on the
+// wall clock, so a one minute interval collects at the start of every
+// minute. Any jitter is applied after aligning.
+func WithAlignment() Option {
+	return func(c *Gatherer) {
+		c.align = true
+	}
+}
+
+// WithPullMode disables the collection loop so the bridge is only queried
+// when Collect is called, usually from a scrape of the metrics endpoint.
+// Results are reused for the provided TTL, a zero TTL collects on every call.
+func WithPullMode(ttl time.Duration) Option {
+	return func(c *Gatherer) {
+		c.pull = true
+		c.cacheTTL = ttl
+	}
+}
+
+// WithExporter reports metrics through a meter of the provider. It may be
+// provided multiple times to report through several providers, such as a
+// Prometheus exporter alongside an OTLP push exporter.
 func WithExporter(ex metric.MeterProvider) Option {
 	return func(c *Gatherer) {
-		c.meter = ex.Meter("hue")
-		// c.exporter = ex
+		c.meters = append(c.meters, ex.Meter("hue"))
+	}
+}
+
+// WithMetricsHandler sets the handler the collector serves metrics through,
+// typically the handler of the exporter passed to WithExporter. Without it
+// the collector serves the state it last collected.
+func WithMetricsHandler(h http.Handler) Option {
+	return func(c *Gatherer) {
+		c.handler = h
+	}
+}
+
+// WithPrometheusRegistry reports metrics through a native Prometheus
+// collector registered with reg rather than an OTel meter. The metric names
+// match those exported through WithExporter, reg is typically wrapped with
+// the desired prefix. Only series reported this way carry exemplars linking
+// collections to their trace, the OTel exporters have no support for them.
+func WithPrometheusRegistry(reg prometheus.Registerer) Option {
+	return func(c *Gatherer) {
+		c.registry = reg
+	}
+}
+
+// WithPrefix sets the prefix of metric names served by the collector when no
+// metrics handler is configured, defaults to hue_. Exporters passed through
+// WithExporter or WithPrometheusRegistry apply their own prefix.
+func WithPrefix(prefix string) Option {
+	return func(c *Gatherer) {
+		c.prefix = prefix
 	}
 }
 
-func WithHueConfig(cfg HueConfig) Option {
+// WithDatastore fetches the lights, groups, sensors, scenes, schedules,
+// rules and config of each bridge through a single request for its full
+// datastore each cycle, rather than a request per resource. Bridges added
+// through WithBridge are still collected resource by resource.
+func WithDatastore() Option {
 	return func(c *Gatherer) {
-		c.hue = huego.New(cfg.IP, cfg.Username)
+		c.datastore = true
+	}
+}
+
+// WithPowerTable sets the power in watts drawn at full brightness by light
+// models, keyed by model identifier, adding to or overriding
+// DefaultPowerTable. Lights of models missing from the table don't report
+// an estimated power.
+func WithPowerTable(watts map[string]float64) Option {
+	return func(c *Gatherer) {
+		table := make(map[string]float64, len(c.power)+len(watts))
+		for model, w := range c.power {
+			table[model] = w
+		}
+		for model, w := range watts {
+			table[model] = w
+		}
+
+		c.power = table
+	}
+}
+
+// WithTemperatureUnits reports temperatures in each of the units, as
+// sensor_temperature_celsius and sensor_temperature_fahrenheit. Defaults to
+// Celsius, including when no unit is given.
+func WithTemperatureUnits(units ...TemperatureUnit) Option {
+	return func(c *Gatherer) {
+		if len(units) == 0 {
+			units = []TemperatureUnit{Celsius}
+		}
+
+		c.temperatureUnits = units
+	}
+}
+
+// WithBuildInfo sets the version and revision reported through
+// exporter_build_info, both default to unknown.
+func WithBuildInfo(version, revision string) Option {
+	return func(c *Gatherer) {
+		if version != "" {
+			c.build.version = version
+		}
+		if revision != "" {
+			c.build.revision = revision
+		}
+	}
+}
+
+// WithStaticLabels attaches the labels to every series reported, labels set
+// by the collector take precedence over static labels of the same name.
+func WithStaticLabels(labels map[string]string) Option {
+	return func(c *Gatherer) {
+		if c.labels == nil {
+			c.labels = map[string]string{}
+		}
+		for k, v := range labels {
+			c.labels[k] = v
+		}
+	}
+}
+
+// WithLabelReplacements rewrites label values, replacing every occurrence of
+// each key with its value. Use it to rename resources or strip characters
+// from the names configured on the bridge.
+func WithLabelReplacements(replace map[string]string) Option {
+	return func(c *Gatherer) {
+		if c.replace == nil {
+			c.replace = map[string]string{}
+		}
+		for old, repl := range replace {
+			c.replace[old] = repl
+		}
+	}
+}
+
+// WithDiscovery enables bridge discovery, used to resolve bridges configured
+// without an address and to find bridges again once their address stops
+// responding.
+func WithDiscovery(d discovery.Discoverer) Option {
+	return func(c *Gatherer) {
+		c.discover = d
+	}
+}
+
+// WithEventStream subscribes to the CLIP v2 event stream of bridges with
+// ClipV2 enabled, keeping light state current as events arrive rather than
+// polling it each cycle. Other v2 resources continue to be polled.
+func WithEventStream() Option {
+	return func(c *Gatherer) {
+		c.eventStream = true
+	}
+}
+
+// defaultBridgeName names a bridge configured with neither a name, ID nor
+// address, which is located through discovery.
+const defaultBridgeName = "default"
+
+// WithHueConfig adds the provided bridges to the set being collected from,
+// all bridges are collected concurrently. Bridges are named after their
+// name, ID or address, whichever is set first, and default otherwise.
+func WithHueConfig(cfgs ...HueConfig) Option {
+	return func(c *Gatherer) {
+		for _, cfg := range cfgs {
+			name := cfg.Name
+			if name == "" {
+				name = cfg.ID
+			}
+			if name == "" {
+				name = cfg.IP
+			}
+			if name == "" {
+				name = defaultBridgeName
+			}
+
+			b := bridge{
+				name: name,
+				id:   cfg.ID,
+				hue:  hueclient.New(cfg.IP, cfg.Username),
+			}
+			if cfg.ClipV2 {
+				b.v2 = b.hue.V2()
+			}
+
+			c.bridges = append(c.bridges, b)
+		}
 	}
 }
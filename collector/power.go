@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	// standbyWatts is drawn by a powered light while switched off.
+	standbyWatts = 0.4
+	// maxBrightness is the brightness of a light at full output.
+	maxBrightness = 254
+)
+
+// DefaultPowerTable is the power drawn at full brightness by common Hue
+// lights, keyed by model identifier.
+var DefaultPowerTable = map[string]float64{
+	// white and color ambiance bulbs
+	"LCT001": 8.5,
+	"LCT007": 9,
+	"LCT010": 10,
+	"LCT014": 9.5,
+	"LCT015": 9.5,
+	"LCT016": 9,
+	"LCA001": 9,
+	"LCA002": 9,
+	"LCA003": 9,
+	"LCT012": 6,
+	"LCG002": 6.5,
+	// white ambiance bulbs
+	"LTW001": 9.5,
+	"LTW010": 6.5,
+	"LTA001": 8,
+	"LTG002": 5,
+	// white bulbs
+	"LWB010": 9.5,
+	"LWB014": 9,
+	"LWA001": 9,
+	"LWG001": 5,
+	// lightstrips and lamps
+	"LST001": 20,
+	"LST002": 20,
+	"LCL001": 37.5,
+	"LCX001": 20,
+	"LLC020": 6,
+}
+
+// estimatePower estimates the power drawn by the light, scaling the power
+// of its model at full brightness by its brightness. Unreachable lights are
+// assumed to be switched off at the wall. It reports false for models
+// missing from the table.
+func estimatePower(table map[string]float64, l hueclient.Light) (float64, bool) {
+	max, ok := table[l.ModelID]
+	if !ok || l.State == nil {
+		return 0, false
+	}
+
+	switch {
+	case !l.State.Reachable:
+		return 0, true
+	case !l.State.On:
+		return standbyWatts, true
+	}
+
+	// lights without dimming report no brightness
+	if l.State.Bri == 0 {
+		return max, true
+	}
+
+	return standbyWatts + (max-standbyWatts)*float64(l.State.Bri)/maxBrightness, true
+}
+
+// observePower observes the power estimated to be drawn by each light with
+// a known model.
+func (s *lightsState) observePower(res metric.Float64ObserverResult, table map[string]float64) {
+	for i, l := range s.lights {
+		watts, ok := estimatePower(table, l)
+		if !ok {
+			continue
+		}
+
+		res.Observe(watts, s.labels[i].power...)
+	}
+}
+
+// observeTotalPower observes the power estimated to be drawn by all lights
+// of the bridge with a known model.
+func (s *lightsState) observeTotalPower(res metric.Float64ObserverResult, table map[string]float64) {
+	var total float64
+	for _, l := range s.lights {
+		if watts, ok := estimatePower(table, l); ok {
+			total += watts
+		}
+	}
+
+	res.Observe(total, s.bridge...)
+}
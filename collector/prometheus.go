@@ -0,0 +1,250 @@
+package collector
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/number"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// promCollector reports the registered instruments directly as Prometheus
+// metrics, without going through an OTel meter. Each scrape runs the
+// instrument callbacks against the state last collected by the jobs.
+type promCollector struct {
+	inst *instruments
+	// prefix is applied to the metric names, sparing the per metric
+	// wrapping of a prefixed registerer.
+	prefix string
+
+	mu sync.Mutex
+	// descs holds the description of the series of each instrument by
+	// their label names, created once rather than on every scrape.
+	descs map[string]map[string]*prometheus.Desc
+	// labels holds the label pairs of the series each instrument reported
+	// in the last scrape, most of which are reported again by the next.
+	labels map[string]map[attribute.Distinct]*promLabels
+}
+
+// promLabels are the label pairs of a series, or the reason it can't be
+// reported.
+type promLabels struct {
+	desc  *prometheus.Desc
+	pairs []*dto.LabelPair
+	err   error
+}
+
+// Describe implements prometheus.Collector. The label sets reported by the
+// callbacks are only known once they run, so the collector is unchecked.
+func (p *promCollector) Describe(chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector.
+func (p *promCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+
+	var buf []attribute.KeyValue
+	for _, def := range p.inst.all() {
+		valueType := prometheus.GaugeValue
+		if def.kind == int64CounterKind || def.kind == float64CounterKind {
+			valueType = prometheus.CounterValue
+		}
+
+		// observations with the same labels replace one another, as they do
+		// when reported through the meter
+		var (
+			keys   []attribute.Distinct
+			series = map[attribute.Distinct]promSeries{}
+			limit  = p.inst.newLimit(def.name)
+		)
+		add := func(labels []attribute.KeyValue, value float64) {
+			set := labelSet(&buf, labels)
+			if _, ok := series[set.Equivalent()]; !ok {
+				keys = append(keys, set.Equivalent())
+			}
+
+			series[set.Equivalent()] = promSeries{labels: set, value: value}
+		}
+		capture := func(labels []attribute.KeyValue, obs ...metric.Observation) {
+			for _, o := range obs {
+				n := o.Number()
+				value := n.CoerceToFloat64(numberKind(def.kind))
+				if limit.admit(labels, value) {
+					add(labels, value)
+				}
+			}
+		}
+
+		for _, cb := range def.int64s {
+			cb.Run(ctx, nil, capture)
+		}
+		for _, cb := range def.float64s {
+			cb.Run(ctx, nil, capture)
+		}
+		p.inst.flush(def.name, limit, func(v float64, labels []attribute.KeyValue) {
+			add(labels, v)
+		})
+
+		prev := p.lastLabels(def.name)
+		next := make(map[attribute.Distinct]*promLabels, len(keys))
+		for _, key := range keys {
+			s := series[key]
+			l, ok := prev[key]
+			if !ok {
+				l = p.newLabels(def, s.labels)
+			}
+			next[key] = l
+
+			var m prometheus.Metric = &promMetric{labels: l, valueType: valueType, value: s.value}
+			if l.err != nil {
+				m = prometheus.NewInvalidMetric(l.desc, l.err)
+			} else if e, ok := p.inst.exemplar(def.name, s.labels); ok && valueType == prometheus.CounterValue {
+				m = &exemplarMetric{Metric: m, exemplar: e}
+			}
+
+			ch <- m
+		}
+		p.setLabels(def.name, next)
+	}
+}
+
+// exemplarMetric attaches an exemplar to a counter, which client_golang only
+// supports for the counters it maintains itself. Exemplars are only served in
+// the OpenMetrics format.
+type exemplarMetric struct {
+	prometheus.Metric
+	exemplar exemplar
+}
+
+func (m *exemplarMetric) Write(out *dto.Metric) error {
+	if err := m.Metric.Write(out); err != nil {
+		return err
+	}
+
+	out.Counter.Exemplar = &dto.Exemplar{
+		Label: []*dto.LabelPair{{
+			Name:  proto.String("trace_id"),
+			Value: proto.String(m.exemplar.traceID),
+		}},
+		Value:     proto.Float64(m.exemplar.value),
+		Timestamp: timestamppb.New(m.exemplar.time),
+	}
+
+	return nil
+}
+
+// promSeries is a single observation of an instrument.
+type promSeries struct {
+	labels attribute.Set
+	value  float64
+}
+
+// lastLabels returns the label pairs of the series the instrument reported
+// in the last scrape.
+func (p *promCollector) lastLabels(name string) map[attribute.Distinct]*promLabels {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.labels[name]
+}
+
+// setLabels keeps the label pairs of the series the instrument reported,
+// dropping those of series no longer reported.
+func (p *promCollector) setLabels(name string, labels map[attribute.Distinct]*promLabels) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.labels == nil {
+		p.labels = map[string]map[attribute.Distinct]*promLabels{}
+	}
+	p.labels[name] = labels
+}
+
+// newLabels returns the label pairs of a series of the instrument, built
+// and validated as client_golang builds those of constant metrics. Sets are
+// sorted by name so series of the same instrument report consistent label
+// sets.
+func (p *promCollector) newLabels(def instrument, labels attribute.Set) *promLabels {
+	names := make([]string, 0, labels.Len())
+	values := make([]string, 0, labels.Len())
+	for iter := labels.Iter(); iter.Next(); {
+		kv := iter.Attribute()
+		names = append(names, string(kv.Key))
+		values = append(values, kv.Value.Emit())
+	}
+
+	desc := p.desc(def, names)
+	m, err := prometheus.NewConstMetric(desc, prometheus.UntypedValue, 0, values...)
+	if err != nil {
+		return &promLabels{desc: prometheus.NewDesc(p.prefix+def.name, def.desc, nil, nil), err: err}
+	}
+
+	var out dto.Metric
+	if err := m.Write(&out); err != nil {
+		return &promLabels{desc: desc, err: err}
+	}
+
+	return &promLabels{desc: desc, pairs: out.Label}
+}
+
+// desc returns the description of the series of the instrument with the
+// label names, created once for each set of names.
+func (p *promCollector) desc(def instrument, names []string) *prometheus.Desc {
+	key := strings.Join(names, ",")
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if d, ok := p.descs[def.name][key]; ok {
+		return d
+	}
+
+	d := prometheus.NewDesc(p.prefix+def.name, def.desc, names, nil)
+	if p.descs == nil {
+		p.descs = map[string]map[string]*prometheus.Desc{}
+	}
+	if p.descs[def.name] == nil {
+		p.descs[def.name] = map[string]*prometheus.Desc{}
+	}
+	p.descs[def.name][key] = d
+
+	return d
+}
+
+// promMetric is a series reported with label pairs kept across scrapes,
+// which client_golang would otherwise build anew for every constant
+// metric.
+type promMetric struct {
+	labels    *promLabels
+	valueType prometheus.ValueType
+	value     float64
+}
+
+func (m *promMetric) Desc() *prometheus.Desc {
+	return m.labels.desc
+}
+
+func (m *promMetric) Write(out *dto.Metric) error {
+	out.Label = m.labels.pairs
+	if m.valueType == prometheus.CounterValue {
+		out.Counter = &dto.Counter{Value: proto.Float64(m.value)}
+	} else {
+		out.Gauge = &dto.Gauge{Value: proto.Float64(m.value)}
+	}
+
+	return nil
+}
+
+// numberKind returns the kind of number observed by instruments of kind.
+func numberKind(kind instrumentKind) number.Kind {
+	if kind == float64GaugeKind || kind == float64CounterKind {
+		return number.Float64Kind
+	}
+
+	return number.Int64Kind
+}
@@ -0,0 +1,54 @@
+package collector
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestPromCollectorConcurrentScrapes(t *testing.T) {
+	g, reg := newTestGatherer(t, WithBridge("fake", newManyLights(20)), WithSeriesLimit(1000))
+	if err := g.Collect(context.Background()); err != nil {
+		t.Fatalf("failed to collect: %v", err)
+	}
+
+	want := gather(t, reg)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 10; j++ {
+				if _, err := reg.Gather(); err != nil {
+					t.Errorf("failed to gather metrics: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	got := gather(t, reg)
+	for name, v := range want {
+		if got[name] != v {
+			t.Errorf("%s = %v after concurrent scrapes, want %v", name, got[name], v)
+		}
+	}
+}
+
+func BenchmarkPromCollector(b *testing.B) {
+	g, reg := newTestGatherer(b, WithBridge("fake", newManyLights(60)))
+	if err := g.Collect(context.Background()); err != nil {
+		b.Fatalf("failed to collect: %v", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := reg.Gather(); err != nil {
+			b.Fatalf("failed to gather metrics: %v", err)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package collector
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"github.com/ninnemana/tracelog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.uber.org/zap"
+)
+
+// resourcelinker is implemented by bridges able to fetch their
+// resourcelinks, which the resourcelinks job is limited to.
+type resourcelinker interface {
+	GetResourcelinksContext(ctx context.Context) ([]*hueclient.Resourcelink, error)
+}
+
+var _ resourcelinker = (*hueclient.Client)(nil)
+
+// resourcelinks reports the resourcelinks of the bridge, created by Hue Labs
+// formulas and the setup of accessories, along with the links pointing at
+// resources no longer on the bridge. Such orphaned links are left behind
+// when resources are removed outside of the app that created them.
+type resourcelinks struct {
+	log    *tracelog.TraceLogger
+	links  resourcelinker
+	hue    Bridge
+	bridge string
+
+	mu    sync.RWMutex
+	state *resourcelinksState
+}
+
+// resourcelinksState is the state last collected, it is replaced as a whole
+// and never modified once collected.
+type resourcelinksState struct {
+	links []*hueclient.Resourcelink
+	// orphaned counts the links of each resourcelink to resources no
+	// longer on the bridge.
+	orphaned map[int]int
+}
+
+func (r *resourcelinks) snapshot() *resourcelinksState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.state
+}
+
+func (r *resourcelinks) Collect(ctx context.Context) func() error {
+	ctx, span := tracer.Start(ctx, "resourcelinks.Collect")
+	log := r.log.SetContext(ctx)
+
+	return func() error {
+		defer span.End()
+
+		links, err := r.links.GetResourcelinksContext(ctx)
+		if err != nil {
+			log.Error("failed to fetch resourcelinks", zap.Error(err))
+
+			return err
+		}
+
+		existing, err := r.existing(ctx, links)
+		if err != nil {
+			log.Error("failed to fetch linked resources", zap.Error(err))
+
+			return err
+		}
+
+		state := &resourcelinksState{
+			links:    links,
+			orphaned: map[int]int{},
+		}
+		for _, l := range links {
+			for _, link := range l.Links {
+				if kind, addr, ok := parseLink(link); ok && linkKinds[kind] && !existing[addr] {
+					state.orphaned[l.ID]++
+				}
+			}
+		}
+
+		log.Debug("collected resourcelink metrics", zap.Int("count", len(links)))
+
+		r.mu.Lock()
+		r.state = state
+		r.mu.Unlock()
+
+		return nil
+	}
+}
+
+// linkKinds are the kinds of resources whose links are checked.
+var linkKinds = map[string]bool{
+	"lights":        true,
+	"groups":        true,
+	"sensors":       true,
+	"scenes":        true,
+	"rules":         true,
+	"schedules":     true,
+	"resourcelinks": true,
+}
+
+// parseLink returns the kind of resource linked to and its address, such as
+// sensors and /sensors/3.
+func parseLink(link string) (kind, addr string, ok bool) {
+	parts := strings.Split(strings.Trim(link, "/"), "/")
+	if len(parts) != 2 {
+		return "", "", false
+	}
+
+	return parts[0], "/" + parts[0] + "/" + parts[1], true
+}
+
+// existing returns the addresses of the resources on the bridge of the
+// kinds linked to, fetched through the snapshot shared with the other jobs.
+func (r *resourcelinks) existing(ctx context.Context, links []*hueclient.Resourcelink) (map[string]bool, error) {
+	kinds := map[string]bool{}
+	for _, l := range links {
+		for _, link := range l.Links {
+			if kind, _, ok := parseLink(link); ok {
+				kinds[kind] = true
+			}
+		}
+	}
+
+	existing := map[string]bool{}
+	add := func(kind, id string) {
+		existing["/"+kind+"/"+id] = true
+	}
+
+	for kind := range kinds {
+		switch kind {
+		case "lights":
+			lights, err := r.hue.GetLightsContext(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, l := range lights {
+				add(kind, strconv.Itoa(l.ID))
+			}
+		case "groups":
+			groups, err := r.hue.GetGroupsContext(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, g := range groups {
+				add(kind, strconv.Itoa(g.ID))
+			}
+		case "sensors":
+			sensors, err := r.hue.GetSensorsContext(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range sensors {
+				add(kind, strconv.Itoa(s.ID))
+			}
+		case "scenes":
+			scenes, err := r.hue.GetScenesContext(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range scenes {
+				add(kind, s.ID)
+			}
+		case "rules":
+			rules, err := r.hue.GetRulesContext(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, rule := range rules {
+				add(kind, strconv.Itoa(rule.ID))
+			}
+		case "schedules":
+			schedules, err := r.hue.GetSchedulesContext(ctx)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range schedules {
+				add(kind, strconv.Itoa(s.ID))
+			}
+		case "resourcelinks":
+			for _, l := range links {
+				add(kind, strconv.Itoa(l.ID))
+			}
+		}
+	}
+
+	return existing, nil
+}
+
+func (r *resourcelinks) register(inst *instruments) error {
+	info := func(l *hueclient.Resourcelink) []attribute.KeyValue {
+		return []attribute.KeyValue{
+			attribute.String("name", l.Name),
+			attribute.String("description", l.Description),
+			attribute.String("type", l.Type),
+			attribute.Int("class_id", int(l.ClassID)),
+		}
+	}
+
+	if err := inst.int64Gauge(
+		"resourcelinks",
+		"Number of resourcelinks on the bridge, created by Hue Labs formulas and the setup of accessories.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			if s := r.snapshot(); s != nil {
+				res.Observe(int64(len(s.links)), attribute.String("bridge", r.bridge))
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"resourcelink_info",
+		"Resourcelink metadata, always 1. Includes name, description, type and class id.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			if s := r.snapshot(); s != nil {
+				resourcelinkObserver(r.bridge, s.links, func(*hueclient.Resourcelink) int64 { return 1 }, info)(ctx, res)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"resourcelink_links",
+		"Number of resources the resourcelink links to.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			if s := r.snapshot(); s != nil {
+				resourcelinkObserver(r.bridge, s.links, func(l *hueclient.Resourcelink) int64 {
+					return int64(len(l.Links))
+				}, nil)(ctx, res)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"resourcelink_orphaned_links",
+		"Number of links of the resourcelink to lights, groups, sensors, scenes, rules, schedules or resourcelinks no longer on the bridge.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			if s := r.snapshot(); s != nil {
+				resourcelinkObserver(r.bridge, s.links, func(l *hueclient.Resourcelink) int64 {
+					return int64(s.orphaned[l.ID])
+				}, nil)(ctx, res)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// resourcelinkObserver observes a value of each resourcelink, labelled with
+// its id and any labels returned by labels.
+func resourcelinkObserver(
+	bridge string,
+	links []*hueclient.Resourcelink,
+	value func(*hueclient.Resourcelink) int64,
+	labels func(*hueclient.Resourcelink) []attribute.KeyValue,
+) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for _, l := range links {
+			kvs := []attribute.KeyValue{
+				attribute.String("bridge", bridge),
+				attribute.Int("id", l.ID),
+			}
+			if labels != nil {
+				kvs = append(kvs, labels(l)...)
+			}
+
+			res.Observe(value(l), kvs...)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package collector
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"github.com/ninnemana/tracelog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.uber.org/zap"
+)
+
+type rules struct {
+	log    *tracelog.TraceLogger
+	hue    Bridge
+	bridge string
+	// legacy also reports rules in the form used before counters were
+	// suffixed with _total.
+	legacy bool
+
+	mu        sync.RWMutex
+	collected bool
+	rules     []*hueclient.Rule
+}
+
+// snapshot returns the rules last collected, reporting false until the
+// first collection succeeds.
+func (r *rules) snapshot() ([]*hueclient.Rule, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.rules, r.collected
+}
+
+func (r *rules) Collect(ctx context.Context) func() error {
+	ctx, span := tracer.Start(ctx, "rules.Collect")
+	log := r.log.SetContext(ctx)
+
+	return func() error {
+		defer span.End()
+
+		rules, err := r.hue.GetRulesContext(ctx)
+		if err != nil {
+			log.Error("failed to fetch rules", zap.Error(err))
+
+			return err
+		}
+
+		log.Debug("collected rule metrics", zap.Int("count", len(rules)))
+
+		r.mu.Lock()
+		r.rules = rules
+		r.collected = true
+		r.mu.Unlock()
+
+		return nil
+	}
+}
+
+func (r *rules) register(inst *instruments) error {
+	// observe adapts a rule value to read the last collected state
+	observe := func(value func(*hueclient.Rule) (int64, bool)) metric.Int64ObserverFunc {
+		return func(ctx context.Context, res metric.Int64ObserverResult) {
+			if rules, ok := r.snapshot(); ok {
+				ruleObserver(r.bridge, rules, value)(ctx, res)
+			}
+		}
+	}
+
+	if err := inst.int64Gauge(
+		"rule_enabled",
+		"Whether the rule is enabled.",
+		unit.Dimensionless,
+		observe(func(r *hueclient.Rule) (int64, bool) {
+			return boolValue(r.Status == "enabled"), true
+		}),
+	); err != nil {
+		return err
+	}
+
+	triggered := []string{"rule_triggered_total"}
+	if r.legacy {
+		triggered = append(triggered, "rule_triggered")
+	}
+
+	for _, name := range triggered {
+		if err := inst.int64Counter(
+			name,
+			"Number of times the rule has triggered.",
+			unit.Dimensionless,
+			observe(func(r *hueclient.Rule) (int64, bool) {
+				return int64(r.TimesTriggered), true
+			}),
+		); err != nil {
+			return err
+		}
+	}
+
+	if err := inst.int64Gauge(
+		"rule_last_triggered_timestamp_seconds",
+		"Time the rule last triggered, in seconds since the epoch.",
+		unitSeconds,
+		observe(func(r *hueclient.Rule) (int64, bool) {
+			t, ok := parseTime(r.LastTriggered)
+
+			return t.Unix(), ok
+		}),
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ruleObserver observes the value extracted from each rule, rules the value
+// can't be extracted from are skipped.
+func ruleObserver(bridge string, rules []*hueclient.Rule, value func(*hueclient.Rule) (int64, bool)) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for _, r := range rules {
+			v, ok := value(r)
+			if !ok {
+				continue
+			}
+
+			res.Observe(
+				v,
+				attribute.String("bridge", bridge),
+				attribute.Int("id", r.ID),
+				attribute.String("name", r.Name),
+			)
+		}
+	}
+}
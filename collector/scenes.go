@@ -0,0 +1,183 @@
+package collector
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"github.com/ninnemana/tracelog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.uber.org/zap"
+)
+
+type scenes struct {
+	log    *tracelog.TraceLogger
+	hue    Bridge
+	bridge string
+
+	mu    sync.RWMutex
+	state *scenesState
+}
+
+// scenesState is the scene state last collected from the bridge.
+type scenesState struct {
+	scenes []hueclient.Scene
+	groups []hueclient.Group
+}
+
+func (s *scenes) snapshot() *scenesState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.state
+}
+
+func (s *scenes) Collect(ctx context.Context) func() error {
+	ctx, span := tracer.Start(ctx, "scenes.Collect")
+	log := s.log.SetContext(ctx)
+
+	return func() error {
+		defer span.End()
+
+		scenes, err := s.hue.GetScenesContext(ctx)
+		if err != nil {
+			log.Error("failed to fetch scenes", zap.Error(err))
+
+			return err
+		}
+
+		groups, err := s.hue.GetGroupsContext(ctx)
+		if err != nil {
+			log.Error("failed to fetch groups", zap.Error(err))
+
+			return err
+		}
+
+		log.Debug("collected scene metrics", zap.Int("count", len(scenes)))
+
+		s.mu.Lock()
+		s.state = &scenesState{
+			scenes: scenes,
+			groups: groups,
+		}
+		s.mu.Unlock()
+
+		return nil
+	}
+}
+
+func (s *scenes) register(inst *instruments) error {
+	if err := inst.int64Gauge(
+		"scenes",
+		"Number of scenes stored on the bridge.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			if st := s.snapshot(); st != nil {
+				sceneCountObserver(s.bridge, st.scenes)(ctx, res)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"scene_info",
+		"Scenes stored on the bridge. Includes name, group, and owner.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			if st := s.snapshot(); st != nil {
+				sceneInfoObserver(s.bridge, st.scenes)(ctx, res)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"scene_last_updated_timestamp_seconds",
+		"Time the scene was last updated, in seconds since the epoch.",
+		unitSeconds,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			if st := s.snapshot(); st != nil {
+				sceneLastUpdatedObserver(s.bridge, st.scenes)(ctx, res)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"group_last_scene",
+		"Scene last recalled in the group, for groups reporting one.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			if st := s.snapshot(); st != nil {
+				groupSceneObserver(s.bridge, st.groups)(ctx, res)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func sceneCountObserver(bridge string, scenes []hueclient.Scene) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		res.Observe(int64(len(scenes)), attribute.String("bridge", bridge))
+	}
+}
+
+func sceneInfoObserver(bridge string, scenes []hueclient.Scene) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for _, s := range scenes {
+			res.Observe(
+				1,
+				attribute.String("bridge", bridge),
+				attribute.String("id", s.ID),
+				attribute.String("name", s.Name),
+				attribute.String("type", s.Type),
+				attribute.String("group", s.Group),
+				attribute.String("owner", s.Owner),
+			)
+		}
+	}
+}
+
+func sceneLastUpdatedObserver(bridge string, scenes []hueclient.Scene) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for _, s := range scenes {
+			updated, ok := parseTime(s.LastUpdated)
+			if !ok {
+				continue
+			}
+
+			res.Observe(
+				updated.Unix(),
+				attribute.String("bridge", bridge),
+				attribute.String("id", s.ID),
+				attribute.String("name", s.Name),
+			)
+		}
+	}
+}
+
+func groupSceneObserver(bridge string, groups []hueclient.Group) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for _, g := range groups {
+			if g.State == nil || g.State.Scene == "" {
+				continue
+			}
+
+			res.Observe(
+				1,
+				attribute.String("bridge", bridge),
+				attribute.Int("id", g.ID),
+				attribute.String("name", g.Name),
+				attribute.String("scene", g.State.Scene),
+			)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package collector
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"github.com/ninnemana/tracelog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.uber.org/zap"
+)
+
+type schedules struct {
+	log    *tracelog.TraceLogger
+	hue    Bridge
+	bridge string
+
+	mu    sync.RWMutex
+	state *schedulesState
+}
+
+// schedulesState is the schedule state last collected from the bridge.
+type schedulesState struct {
+	schedules []*hueclient.Schedule
+	// loc is the time zone of the bridge, schedules are expressed in its
+	// local time.
+	loc *time.Location
+}
+
+func (s *schedules) snapshot() *schedulesState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.state
+}
+
+func (s *schedules) Collect(ctx context.Context) func() error {
+	ctx, span := tracer.Start(ctx, "schedules.Collect")
+	log := s.log.SetContext(ctx)
+
+	return func() error {
+		defer span.End()
+
+		schedules, err := s.hue.GetSchedulesContext(ctx)
+		if err != nil {
+			log.Error("failed to fetch schedules", zap.Error(err))
+
+			return err
+		}
+
+		cfg, err := s.hue.GetConfigContext(ctx)
+		if err != nil {
+			log.Error("failed to fetch config", zap.Error(err))
+
+			return err
+		}
+
+		loc, err := time.LoadLocation(cfg.TimeZone)
+		if err != nil {
+			log.Warn("unknown bridge time zone, assuming UTC", zap.String("timezone", cfg.TimeZone))
+			loc = time.UTC
+		}
+
+		log.Debug("collected schedule metrics", zap.Int("count", len(schedules)))
+
+		s.mu.Lock()
+		s.state = &schedulesState{
+			schedules: schedules,
+			loc:       loc,
+		}
+		s.mu.Unlock()
+
+		return nil
+	}
+}
+
+func (s *schedules) register(inst *instruments) error {
+	if err := inst.int64Gauge(
+		"schedule_enabled",
+		"Whether the schedule is enabled.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			if st := s.snapshot(); st != nil {
+				scheduleEnabledObserver(s.bridge, st.schedules)(ctx, res)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"schedule_next_run_timestamp_seconds",
+		"Time the schedule next runs, in seconds since the epoch. Omitted for disabled or expired schedules.",
+		unitSeconds,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			if st := s.snapshot(); st != nil {
+				scheduleNextRunObserver(s.bridge, st.schedules, st.loc)(ctx, res)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func scheduleEnabledObserver(bridge string, schedules []*hueclient.Schedule) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for _, s := range schedules {
+			res.Observe(
+				boolValue(s.Status == "enabled"),
+				attribute.String("bridge", bridge),
+				attribute.Int("id", s.ID),
+				attribute.String("name", s.Name),
+			)
+		}
+	}
+}
+
+func scheduleNextRunObserver(bridge string, schedules []*hueclient.Schedule, loc *time.Location) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		now := time.Now()
+		for _, s := range schedules {
+			if s.Status != "enabled" {
+				continue
+			}
+
+			next, ok := nextRun(s, now, loc)
+			if !ok {
+				continue
+			}
+
+			res.Observe(
+				next.Unix(),
+				attribute.String("bridge", bridge),
+				attribute.Int("id", s.ID),
+				attribute.String("name", s.Name),
+			)
+		}
+	}
+}
+
+// nextRun computes the next time the schedule triggers after now. The bridge
+// supports absolute times, recurring weekly times (W<days>/T<time>) and
+// timers (PT<duration>, optionally repeated with R<n>/), each optionally
+// suffixed with a random offset (A<time>) which is ignored.
+func nextRun(s *hueclient.Schedule, now time.Time, loc *time.Location) (time.Time, bool) {
+	lt := s.LocalTime
+	if lt == "" {
+		lt = s.Time
+	}
+
+	if i := strings.Index(lt, "A"); i > 0 {
+		lt = lt[:i]
+	}
+
+	switch {
+	case strings.HasPrefix(lt, "W"):
+		parts := strings.SplitN(strings.TrimPrefix(lt, "W"), "/T", 2)
+		if len(parts) != 2 {
+			return time.Time{}, false
+		}
+
+		days, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return time.Time{}, false
+		}
+
+		at, err := time.Parse("15:04:05", parts[1])
+		if err != nil {
+			return time.Time{}, false
+		}
+
+		local := now.In(loc)
+		for i := 0; i <= 7; i++ {
+			d := local.AddDate(0, 0, i)
+			candidate := time.Date(d.Year(), d.Month(), d.Day(), at.Hour(), at.Minute(), at.Second(), 0, loc)
+
+			// days is a bitmask of 0MTWTFSS, Monday being the highest bit
+			bit := 64 >> ((int(candidate.Weekday()) + 6) % 7)
+			if days&bit != 0 && candidate.After(now) {
+				return candidate, true
+			}
+		}
+
+		return time.Time{}, false
+	case strings.HasPrefix(lt, "PT"), strings.HasPrefix(lt, "R"):
+		if i := strings.Index(lt, "PT"); i >= 0 {
+			lt = lt[i+2:]
+		}
+
+		at, err := time.Parse("15:04:05", lt)
+		if err != nil {
+			return time.Time{}, false
+		}
+
+		start, ok := parseTime(s.StartTime)
+		if !ok {
+			return time.Time{}, false
+		}
+
+		d := time.Duration(at.Hour())*time.Hour +
+			time.Duration(at.Minute())*time.Minute +
+			time.Duration(at.Second())*time.Second
+
+		return start.Add(d), true
+	default:
+		t, err := time.ParseInLocation(timeLayout, lt, loc)
+		if err != nil || !t.After(now) {
+			return time.Time{}, false
+		}
+
+		return t, true
+	}
+}
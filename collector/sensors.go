@@ -0,0 +1,740 @@
+package collector
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"github.com/ninnemana/tracelog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.uber.org/zap"
+)
+
+// TemperatureUnit is a unit temperatures are reported in.
+type TemperatureUnit string
+
+const (
+	Celsius    TemperatureUnit = "celsius"
+	Fahrenheit TemperatureUnit = "fahrenheit"
+)
+
+func (u TemperatureUnit) name() string {
+	if u == Fahrenheit {
+		return "Fahrenheit"
+	}
+
+	return "Celsius"
+}
+
+// ucum returns the UCUM code of the unit.
+func (u TemperatureUnit) ucum() unit.Unit {
+	if u == Fahrenheit {
+		return unitFahrenheit
+	}
+
+	return unitCelsius
+}
+
+// fromCelsius converts the temperature in degrees Celsius to the unit.
+func (u TemperatureUnit) fromCelsius(c float64) float64 {
+	if u == Fahrenheit {
+		return c*9/5 + 32
+	}
+
+	return c
+}
+
+type sensors struct {
+	log     *tracelog.TraceLogger
+	hue     Bridge
+	bridge  string
+	events  *broker
+	clock   Clock
+	buttons *buttonTracker
+	// units are the units temperatures are reported in.
+	units []TemperatureUnit
+	// legacy also reports sensors in the form used before their units and
+	// types were corrected.
+	legacy bool
+	// uniqueIDs identifies sensors by their uniqueid rather than their
+	// numeric id.
+	uniqueIDs bool
+	// names labels sensors with their name.
+	names bool
+
+	mu         sync.RWMutex
+	collected  bool
+	sensors    []hueclient.Sensor
+	newSensors *hueclient.NewSensor
+	// idLabels and nameLabels identify the sensors last collected when
+	// configured, computed once per cycle rather than on every collection
+	// of metrics.
+	idLabels   map[int64]string
+	nameLabels map[int64]string
+}
+
+// snapshot returns the sensors last collected, reporting false until the
+// first collection succeeds.
+func (s *sensors) snapshot() ([]hueclient.Sensor, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.sensors, s.collected
+}
+
+// newSnapshot returns the new sensors found by the last scan, nil until the
+// first collection succeeds.
+func (s *sensors) newSnapshot() *hueclient.NewSensor {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.newSensors
+}
+
+func (s *sensors) Collect(ctx context.Context) func() error {
+	ctx, span := tracer.Start(ctx, "sensors.Collect")
+	log := s.log.SetContext(ctx)
+
+	return func() error {
+		defer span.End()
+
+		sensors, err := s.hue.GetSensorsContext(ctx)
+		if err != nil {
+			log.Error("failed to fetch sensors", zap.Error(err))
+
+			return err
+		}
+
+		newSensors, err := s.hue.GetNewSensorsContext(ctx)
+		if err != nil {
+			log.Error("failed to fetch new sensors", zap.Error(err))
+
+			return err
+		}
+
+		s.buttons.observe(sensors)
+
+		var idLabels, nameLabels map[int64]string
+		if s.uniqueIDs {
+			idLabels = sensorUniqueIDs(sensors)
+		}
+		if s.names {
+			nameLabels = sensorNames(sensors)
+		}
+
+		log.Debug("collected sensor metrics", zap.Int("count", len(sensors)), zap.Int("new", len(newSensors.Sensors)))
+
+		s.mu.Lock()
+		if s.collected {
+			s.events.publish(diffSensors(s.bridge, s.sensors, sensors, s.clock.Now())...)
+		}
+		s.sensors = sensors
+		s.newSensors = newSensors
+		s.idLabels, s.nameLabels = idLabels, nameLabels
+		s.collected = true
+		s.mu.Unlock()
+
+		return nil
+	}
+}
+
+func (s *sensors) register(inst *instruments) error {
+	var id identifier
+	if s.uniqueIDs {
+		id.ids = func() map[int64]string {
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+
+			return s.idLabels
+		}
+	}
+	if s.names {
+		id.names = func() map[int64]string {
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+
+			return s.nameLabels
+		}
+	}
+
+	if err := s.buttons.register(inst, id); err != nil {
+		return err
+	}
+
+	// observe adapts an observer of sensors to read the last collected state
+	observe := func(fn func([]hueclient.Sensor) metric.Int64ObserverFunc) metric.Int64ObserverFunc {
+		return id.int64s(func(ctx context.Context, res metric.Int64ObserverResult) {
+			if sensors, ok := s.snapshot(); ok {
+				fn(sensors)(ctx, res)
+			}
+		})
+	}
+
+	if s.legacy {
+		if err := inst.int64Gauge(
+			"sensors",
+			"",
+			"",
+			func(ctx context.Context, res metric.Int64ObserverResult) {
+				if sensors, ok := s.snapshot(); ok {
+					sensorObserver(s.bridge, sensors)(ctx, res)
+				}
+			},
+		); err != nil {
+			return err
+		}
+	}
+
+	if err := inst.int64Gauge(
+		"sensor_info",
+		"Sensors known to the bridge, always 1. Includes name, type and uniqueid.",
+		unit.Dimensionless,
+		id.info(func(ctx context.Context, res metric.Int64ObserverResult) {
+			if sensors, ok := s.snapshot(); ok {
+				sensorInfoObserver(s.bridge, sensors)(ctx, res)
+			}
+		}),
+	); err != nil {
+		return err
+	}
+
+	for _, u := range s.units {
+		u := u
+		if err := inst.float64Gauge(
+			"sensor_temperature_"+string(u),
+			"Temperature reported by temperature sensors in degrees "+u.name()+".",
+			u.ucum(),
+			id.float64s(func(ctx context.Context, res metric.Float64ObserverResult) {
+				if sensors, ok := s.snapshot(); ok {
+					sensorTemperatureObserver(s.bridge, sensors, u)(ctx, res)
+				}
+			}),
+		); err != nil {
+			return err
+		}
+	}
+
+	if err := inst.float64Gauge(
+		"sensor_light_level_lux",
+		"Ambient light level reported by light level sensors in lux.",
+		unitLux,
+		id.float64s(func(ctx context.Context, res metric.Float64ObserverResult) {
+			if sensors, ok := s.snapshot(); ok {
+				sensorLightLevelObserver(s.bridge, sensors)(ctx, res)
+			}
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"sensor_dark",
+		"Whether the light level is below the sensor's dark threshold.",
+		unit.Dimensionless,
+		observe(func(sensors []hueclient.Sensor) metric.Int64ObserverFunc {
+			return sensorFlagObserver(s.bridge, sensors, "ZLLLightLevel", "dark")
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"sensor_daylight",
+		"Whether the light level is above the sensor's daylight threshold.",
+		unit.Dimensionless,
+		observe(func(sensors []hueclient.Sensor) metric.Int64ObserverFunc {
+			return sensorFlagObserver(s.bridge, sensors, "ZLLLightLevel", "daylight")
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"daylight",
+		"Whether the sun is up according to the built-in Daylight sensor, which the bridge computes from its configured location.",
+		unit.Dimensionless,
+		observe(func(sensors []hueclient.Sensor) metric.Int64ObserverFunc {
+			return sensorFlagObserver(s.bridge, sensors, "Daylight", "daylight")
+		}),
+	); err != nil {
+		return err
+	}
+
+	if s.legacy {
+		if err := inst.int64Gauge(
+			"daylight_sunrise_offset_minutes",
+			"Minutes after sunrise the Daylight sensor reports daylight, negative before sunrise.",
+			"",
+			observe(func(sensors []hueclient.Sensor) metric.Int64ObserverFunc {
+				return daylightOffsetObserver(s.bridge, sensors, "sunriseoffset", 1)
+			}),
+		); err != nil {
+			return err
+		}
+
+		if err := inst.int64Gauge(
+			"daylight_sunset_offset_minutes",
+			"Minutes after sunset the Daylight sensor stops reporting daylight, negative before sunset.",
+			"",
+			observe(func(sensors []hueclient.Sensor) metric.Int64ObserverFunc {
+				return daylightOffsetObserver(s.bridge, sensors, "sunsetoffset", 1)
+			}),
+		); err != nil {
+			return err
+		}
+	}
+
+	if err := inst.int64Gauge(
+		"daylight_sunrise_offset_seconds",
+		"Time after sunrise the Daylight sensor reports daylight, negative before sunrise.",
+		unitSeconds,
+		observe(func(sensors []hueclient.Sensor) metric.Int64ObserverFunc {
+			return daylightOffsetObserver(s.bridge, sensors, "sunriseoffset", 60)
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"daylight_sunset_offset_seconds",
+		"Time after sunset the Daylight sensor stops reporting daylight, negative before sunset.",
+		unitSeconds,
+		observe(func(sensors []hueclient.Sensor) metric.Int64ObserverFunc {
+			return daylightOffsetObserver(s.bridge, sensors, "sunsetoffset", 60)
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"sensor_generic_status",
+		"Status of CLIPGenericStatus sensors, which integrations and rules use to store state on the bridge.",
+		unit.Dimensionless,
+		observe(func(sensors []hueclient.Sensor) metric.Int64ObserverFunc {
+			return genericSensorObserver(s.bridge, sensors, "CLIPGenericStatus", "status")
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"sensor_generic_flag",
+		"Flag of CLIPGenericFlag sensors, which integrations and rules use to store state on the bridge.",
+		unit.Dimensionless,
+		observe(func(sensors []hueclient.Sensor) metric.Int64ObserverFunc {
+			return genericSensorObserver(s.bridge, sensors, "CLIPGenericFlag", "flag")
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"geofence_presence",
+		"Whether the device of each Geofence or CLIPPresence sensor, such as those the Hue app creates for home and away, is home.",
+		unit.Dimensionless,
+		observe(func(sensors []hueclient.Sensor) metric.Int64ObserverFunc {
+			return geofenceObserver(s.bridge, sensors)
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"sensor_last_updated_timestamp_seconds",
+		"Time the state of each sensor was last updated, in seconds since the epoch.",
+		unitSeconds,
+		observe(func(sensors []hueclient.Sensor) metric.Int64ObserverFunc {
+			return sensorLastUpdatedObserver(s.bridge, sensors)
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"new_sensor",
+		"Number of new sensors found by the last scan.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			if n := s.newSnapshot(); n != nil {
+				newSensorObserver(s.bridge, n)(ctx, res)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"new_sensors_last_scan_timestamp_seconds",
+		"Time of the last scan for new sensors, in seconds since the epoch.",
+		unitSeconds,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			n := s.newSnapshot()
+			if n == nil {
+				return
+			}
+
+			// the scan is reported as none before the first scan and
+			// active while scanning
+			if t, ok := parseTime(n.LastScan); ok {
+				res.Observe(t.Unix(), attribute.String("bridge", s.bridge))
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"sensor_on",
+		"Whether the sensor is enabled, disabled sensors don't update their state or trigger rules.",
+		unit.Dimensionless,
+		observe(func(sensors []hueclient.Sensor) metric.Int64ObserverFunc {
+			return sensorConfigObserver(s.bridge, sensors, "on")
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"sensor_sensitivity",
+		"Sensitivity configured on motion sensors, up to sensor_sensitivity_max.",
+		unit.Dimensionless,
+		observe(func(sensors []hueclient.Sensor) metric.Int64ObserverFunc {
+			return sensorConfigObserver(s.bridge, sensors, "sensitivity")
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"sensor_sensitivity_max",
+		"Highest sensitivity motion sensors can be configured with.",
+		unit.Dimensionless,
+		observe(func(sensors []hueclient.Sensor) metric.Int64ObserverFunc {
+			return sensorConfigObserver(s.bridge, sensors, "sensitivitymax")
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"sensor_led_indication",
+		"Whether the LED of motion sensors lights up when motion is detected.",
+		unit.Dimensionless,
+		observe(func(sensors []hueclient.Sensor) metric.Int64ObserverFunc {
+			return sensorConfigObserver(s.bridge, sensors, "ledindication")
+		}),
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"sensor_battery_percent",
+		"Battery level of battery powered sensors and switches in percent.",
+		unitPercent,
+		observe(func(sensors []hueclient.Sensor) metric.Int64ObserverFunc {
+			return sensorBatteryObserver(s.bridge, sensors)
+		}),
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// sensorState returns the numeric state field of the sensor.
+func sensorState(s hueclient.Sensor, key string) (float64, bool) {
+	v, ok := s.State[key].(float64)
+
+	return v, ok
+}
+
+func sensorBatteryObserver(bridge string, sensors []hueclient.Sensor) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for _, s := range sensors {
+			// mains powered and virtual sensors omit the battery field
+			battery, ok := s.Config["battery"].(float64)
+			if !ok {
+				continue
+			}
+
+			res.Observe(
+				int64(battery),
+				attribute.String("bridge", bridge),
+				attribute.Int("id", s.ID),
+				attribute.String("type", s.Type),
+			)
+		}
+	}
+}
+
+// sensorConfigObserver observes the numeric or boolean config field of
+// sensors, sensors without the field are skipped.
+func sensorConfigObserver(bridge string, sensors []hueclient.Sensor, key string) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for _, s := range sensors {
+			var v int64
+			switch config := s.Config[key].(type) {
+			case float64:
+				v = int64(config)
+			case bool:
+				v = boolValue(config)
+			default:
+				continue
+			}
+
+			res.Observe(
+				v,
+				attribute.String("bridge", bridge),
+				attribute.Int("id", s.ID),
+				attribute.String("type", s.Type),
+			)
+		}
+	}
+}
+
+// sensorLastUpdatedObserver observes when the state of each sensor last
+// changed, sensors which never reported a state are skipped.
+func sensorLastUpdatedObserver(bridge string, sensors []hueclient.Sensor) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for _, s := range sensors {
+			v, _ := s.State["lastupdated"].(string)
+			updated, ok := parseTime(v)
+			if !ok {
+				continue
+			}
+
+			res.Observe(
+				updated.Unix(),
+				attribute.String("bridge", bridge),
+				attribute.Int("id", s.ID),
+				attribute.String("type", s.Type),
+			)
+		}
+	}
+}
+
+func newSensorObserver(bridge string, v *hueclient.NewSensor) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		if len(v.Sensors) == 0 {
+			res.Observe(
+				0,
+				attribute.String("bridge", bridge),
+				attribute.String("lastScan", v.LastScan),
+			)
+
+			return
+		}
+
+		for _, s := range v.Sensors {
+			res.Observe(
+				1,
+				attribute.String("bridge", bridge),
+				attribute.Int("id", s.ID),
+				attribute.String("name", s.Name),
+				attribute.String("lastScan", v.LastScan),
+			)
+		}
+	}
+}
+
+// sensorStateBool returns the boolean state field of the sensor.
+func sensorStateBool(s hueclient.Sensor, key string) (bool, bool) {
+	v, ok := s.State[key].(bool)
+
+	return v, ok
+}
+
+func sensorLightLevelObserver(bridge string, sensors []hueclient.Sensor) metric.Float64ObserverFunc {
+	return func(ctx context.Context, res metric.Float64ObserverResult) {
+		for _, s := range sensors {
+			if s.Type != "ZLLLightLevel" {
+				continue
+			}
+
+			level, ok := sensorState(s, "lightlevel")
+			if !ok {
+				continue
+			}
+
+			// lightlevel is reported as 10000 * log10(lux) + 1
+			res.Observe(
+				math.Pow(10, (level-1)/10000),
+				attribute.String("bridge", bridge),
+				attribute.Int("id", s.ID),
+				attribute.String("type", s.Type),
+			)
+		}
+	}
+}
+
+// sensorFlagObserver observes a boolean state field of sensors of the given
+// type as 0 or 1.
+func sensorFlagObserver(bridge string, sensors []hueclient.Sensor, typ, key string) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for _, s := range sensors {
+			if s.Type != typ {
+				continue
+			}
+
+			flag, ok := sensorStateBool(s, key)
+			if !ok {
+				continue
+			}
+
+			var v int64
+			if flag {
+				v = 1
+			}
+
+			res.Observe(
+				v,
+				attribute.String("bridge", bridge),
+				attribute.Int("id", s.ID),
+				attribute.String("type", s.Type),
+			)
+		}
+	}
+}
+
+// daylightOffsetObserver observes the sunrise or sunset offset configured
+// on Daylight sensors, which only report daylight once a location is set.
+// The offset is configured in minutes and multiplied by scale.
+func daylightOffsetObserver(bridge string, sensors []hueclient.Sensor, key string, scale int64) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for _, s := range sensors {
+			if s.Type != "Daylight" {
+				continue
+			}
+
+			if configured, _ := s.Config["configured"].(bool); !configured {
+				continue
+			}
+
+			offset, ok := s.Config[key].(float64)
+			if !ok {
+				continue
+			}
+
+			res.Observe(
+				int64(offset)*scale,
+				attribute.String("bridge", bridge),
+				attribute.Int("id", s.ID),
+			)
+		}
+	}
+}
+
+// genericSensorObserver observes the numeric or boolean state field of
+// generic CLIP sensors of the given type, labelled with their name since
+// they are only identified by what integrations called them.
+func genericSensorObserver(bridge string, sensors []hueclient.Sensor, typ, key string) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for _, s := range sensors {
+			if s.Type != typ {
+				continue
+			}
+
+			var v int64
+			switch state := s.State[key].(type) {
+			case float64:
+				v = int64(state)
+			case bool:
+				v = boolValue(state)
+			default:
+				continue
+			}
+
+			res.Observe(
+				v,
+				attribute.String("bridge", bridge),
+				attribute.Int("id", s.ID),
+				attribute.String("name", s.Name),
+			)
+		}
+	}
+}
+
+// geofenceObserver observes the presence of Geofence and CLIPPresence
+// sensors, labelled with their name, which is the device they track.
+func geofenceObserver(bridge string, sensors []hueclient.Sensor) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for _, s := range sensors {
+			if s.Type != "Geofence" && s.Type != "CLIPPresence" {
+				continue
+			}
+
+			presence, ok := sensorStateBool(s, "presence")
+			if !ok {
+				continue
+			}
+
+			res.Observe(
+				boolValue(presence),
+				attribute.String("bridge", bridge),
+				attribute.Int("id", s.ID),
+				attribute.String("name", s.Name),
+				attribute.String("type", s.Type),
+			)
+		}
+	}
+}
+
+func sensorTemperatureObserver(bridge string, sensors []hueclient.Sensor, unit TemperatureUnit) metric.Float64ObserverFunc {
+	return func(ctx context.Context, res metric.Float64ObserverResult) {
+		for _, s := range sensors {
+			if s.Type != "ZLLTemperature" {
+				continue
+			}
+
+			// temperature is reported in hundredths of a degree
+			temp, ok := sensorState(s, "temperature")
+			if !ok {
+				continue
+			}
+
+			res.Observe(
+				unit.fromCelsius(temp/100),
+				attribute.String("bridge", bridge),
+				attribute.Int("id", s.ID),
+				attribute.String("type", s.Type),
+			)
+		}
+	}
+}
+
+func sensorInfoObserver(bridge string, sensors []hueclient.Sensor) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for _, s := range sensors {
+			res.Observe(
+				1,
+				attribute.String("bridge", bridge),
+				attribute.Int("id", s.ID),
+				attribute.String("name", s.Name),
+				attribute.String("type", s.Type),
+				attribute.String("uniqueid", s.UniqueID),
+			)
+		}
+	}
+}
+
+func sensorObserver(bridge string, sensors []hueclient.Sensor) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		if len(sensors) == 0 {
+			res.Observe(0, attribute.String("bridge", bridge))
+
+			return
+		}
+
+		for _, s := range sensors {
+			res.Observe(
+				1,
+				attribute.String("bridge", bridge),
+				attribute.String("type", s.Type),
+				attribute.Int("id", s.ID),
+			)
+		}
+	}
+}
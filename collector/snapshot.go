@@ -0,0 +1,375 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+)
+
+// snapshotBridge fetches each resource of the bridge at most once per
+// collection cycle, handing the same snapshot to every job asking for it,
+// e.g. the groups needed by the lights, groups and scenes jobs. Jobs must
+// treat the returned resources as read-only.
+type snapshotBridge struct {
+	Bridge
+	// full fetches the resources it holds through a single request for
+	// the full datastore of the bridge when set.
+	full rawGetter
+	// raw fetches the resources rawSnapshot serves when the datastore
+	// isn't fetched in full.
+	raw rawGetter
+
+	mu      sync.Mutex
+	fetches map[string]*fetch
+}
+
+// fetch is a resource fetched during the current cycle, done is closed once
+// v and err are set.
+type fetch struct {
+	done chan struct{}
+	v    interface{}
+	err  error
+}
+
+func newSnapshotBridge(b Bridge) *snapshotBridge {
+	return &snapshotBridge{
+		Bridge:  b,
+		fetches: map[string]*fetch{},
+	}
+}
+
+// reset discards the snapshots of the previous cycle.
+func (b *snapshotBridge) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.fetches = map[string]*fetch{}
+}
+
+// do returns the snapshot of the resource, fetching it through fn when it
+// hasn't been fetched this cycle. Concurrent callers wait on the first.
+func (b *snapshotBridge) do(ctx context.Context, resource string, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	b.mu.Lock()
+	f, ok := b.fetches[resource]
+	if !ok {
+		f = &fetch{done: make(chan struct{})}
+		b.fetches[resource] = f
+	}
+	b.mu.Unlock()
+
+	if !ok {
+		f.v, f.err = fn(ctx)
+		close(f.done)
+
+		return f.v, f.err
+	}
+
+	select {
+	case <-f.done:
+		return f.v, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// datastore returns the full state of the bridge fetched this cycle. The
+// bridge omits capabilities and the resources found by the last scan from
+// it, which are still fetched on their own.
+func (b *snapshotBridge) datastore(ctx context.Context) (*fullState, error) {
+	v, err := b.do(ctx, "datastore", func(ctx context.Context) (interface{}, error) {
+		var s fullState
+		if err := b.full.Get(ctx, "", &s); err != nil {
+			return nil, err
+		}
+
+		return &s, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*fullState), nil
+}
+
+// fullState is the full datastore of a bridge, decoded and with each kind
+// of resource as reported, so both come from a single request.
+type fullState struct {
+	hueclient.Datastore
+	resources map[string]json.RawMessage
+}
+
+func (s *fullState) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &s.Datastore); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &s.resources)
+}
+
+// rawResources are the resources of a kind as the bridge reports them,
+// keyed by id. Decoding anything but an object fails, so errors the bridge
+// reports in place of the resources are returned as such.
+type rawResources json.RawMessage
+
+func (r *rawResources) UnmarshalJSON(data []byte) error {
+	if len(data) == 0 || data[0] != '{' {
+		return errors.New("resources are not an object")
+	}
+
+	*r = append((*r)[:0], data...)
+
+	return nil
+}
+
+// resources returns the resources of a kind fetched this cycle as the
+// bridge reports them, taken from the datastore when it is fetched in full.
+func (b *snapshotBridge) resources(ctx context.Context, resource string) (json.RawMessage, error) {
+	if b.full != nil {
+		ds, err := b.datastore(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return ds.resources[resource], nil
+	}
+
+	v, err := b.do(ctx, resource+"_raw", func(ctx context.Context) (interface{}, error) {
+		var r rawResources
+		if err := b.raw.Get(ctx, resource, &r); err != nil {
+			return nil, err
+		}
+
+		return json.RawMessage(r), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(json.RawMessage), nil
+}
+
+// rawSnapshot serves the groups, lights and sensors of the bridge undecoded
+// from the snapshots of the cycle, to jobs decoding fields the models leave
+// out, rather than each fetching them again.
+type rawSnapshot struct {
+	*snapshotBridge
+}
+
+func (r rawSnapshot) Get(ctx context.Context, path string, v interface{}) error {
+	data, err := r.resources(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	// the datastore may omit a kind of resource
+	if len(data) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func (b *snapshotBridge) GetConfigContext(ctx context.Context) (*hueclient.Config, error) {
+	if b.full != nil {
+		ds, err := b.datastore(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return ds.Config, nil
+	}
+
+	v, err := b.do(ctx, "config", func(ctx context.Context) (interface{}, error) {
+		return b.Bridge.GetConfigContext(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*hueclient.Config), nil
+}
+
+func (b *snapshotBridge) GetCapabilitiesContext(ctx context.Context) (*hueclient.Capabilities, error) {
+	v, err := b.do(ctx, "capabilities", func(ctx context.Context) (interface{}, error) {
+		return b.Bridge.GetCapabilitiesContext(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*hueclient.Capabilities), nil
+}
+
+func (b *snapshotBridge) GetGroupsContext(ctx context.Context) ([]hueclient.Group, error) {
+	if b.full != nil {
+		ds, err := b.datastore(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return ds.Groups, nil
+	}
+
+	v, err := b.do(ctx, "groups", func(ctx context.Context) (interface{}, error) {
+		// decoded from the resources rawSnapshot serves when the bridge
+		// fetches them undecoded, rather than fetched a second time
+		if b.raw != nil {
+			data, err := b.resources(ctx, "groups")
+			if err != nil {
+				return nil, err
+			}
+
+			return hueclient.DecodeGroups(data)
+		}
+
+		return b.Bridge.GetGroupsContext(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]hueclient.Group), nil
+}
+
+func (b *snapshotBridge) GetLightsContext(ctx context.Context) ([]hueclient.Light, error) {
+	if b.full != nil {
+		ds, err := b.datastore(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return ds.Lights, nil
+	}
+
+	v, err := b.do(ctx, "lights", func(ctx context.Context) (interface{}, error) {
+		if b.raw != nil {
+			data, err := b.resources(ctx, "lights")
+			if err != nil {
+				return nil, err
+			}
+
+			return hueclient.DecodeLights(data)
+		}
+
+		return b.Bridge.GetLightsContext(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]hueclient.Light), nil
+}
+
+func (b *snapshotBridge) GetNewLightsContext(ctx context.Context) (*hueclient.NewLight, error) {
+	v, err := b.do(ctx, "new_lights", func(ctx context.Context) (interface{}, error) {
+		return b.Bridge.GetNewLightsContext(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*hueclient.NewLight), nil
+}
+
+func (b *snapshotBridge) GetRulesContext(ctx context.Context) ([]*hueclient.Rule, error) {
+	if b.full != nil {
+		ds, err := b.datastore(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return ds.Rules, nil
+	}
+
+	v, err := b.do(ctx, "rules", func(ctx context.Context) (interface{}, error) {
+		return b.Bridge.GetRulesContext(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]*hueclient.Rule), nil
+}
+
+func (b *snapshotBridge) GetScenesContext(ctx context.Context) ([]hueclient.Scene, error) {
+	if b.full != nil {
+		ds, err := b.datastore(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return ds.Scenes, nil
+	}
+
+	v, err := b.do(ctx, "scenes", func(ctx context.Context) (interface{}, error) {
+		return b.Bridge.GetScenesContext(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]hueclient.Scene), nil
+}
+
+func (b *snapshotBridge) GetSchedulesContext(ctx context.Context) ([]*hueclient.Schedule, error) {
+	if b.full != nil {
+		ds, err := b.datastore(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return ds.Schedules, nil
+	}
+
+	v, err := b.do(ctx, "schedules", func(ctx context.Context) (interface{}, error) {
+		return b.Bridge.GetSchedulesContext(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]*hueclient.Schedule), nil
+}
+
+func (b *snapshotBridge) GetSensorsContext(ctx context.Context) ([]hueclient.Sensor, error) {
+	if b.full != nil {
+		ds, err := b.datastore(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return ds.Sensors, nil
+	}
+
+	v, err := b.do(ctx, "sensors", func(ctx context.Context) (interface{}, error) {
+		if b.raw != nil {
+			data, err := b.resources(ctx, "sensors")
+			if err != nil {
+				return nil, err
+			}
+
+			return hueclient.DecodeSensors(data)
+		}
+
+		return b.Bridge.GetSensorsContext(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]hueclient.Sensor), nil
+}
+
+func (b *snapshotBridge) GetNewSensorsContext(ctx context.Context) (*hueclient.NewSensor, error) {
+	v, err := b.do(ctx, "new_sensors", func(ctx context.Context) (interface{}, error) {
+		return b.Bridge.GetNewSensorsContext(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*hueclient.NewSensor), nil
+}
@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+)
+
+// State is the state last collected from the bridges.
+type State struct {
+	Bridges []BridgeState `json:"bridges"`
+}
+
+// BridgeState is the state last collected from a single bridge. Resources
+// are omitted until they are first collected.
+type BridgeState struct {
+	Name    string   `json:"name"`
+	Lights  []Light  `json:"lights,omitempty"`
+	Groups  []Group  `json:"groups,omitempty"`
+	Sensors []Sensor `json:"sensors,omitempty"`
+}
+
+// Light is a light as reported by the bridge. hueclient omits identifiers
+// from its encoding, they are reported alongside.
+type Light struct {
+	ID int `json:"id"`
+	hueclient.Light
+}
+
+// Group is a group as reported by the bridge.
+type Group struct {
+	ID int `json:"id"`
+	hueclient.Group
+}
+
+// Sensor is a sensor as reported by the bridge.
+type Sensor struct {
+	ID int `json:"id"`
+	hueclient.Sensor
+}
+
+// State returns the state last collected from each bridge, without
+// contacting the bridges.
+func (g *Gatherer) State() State {
+	st := State{Bridges: make([]BridgeState, len(g.bridges))}
+	index := make(map[string]*BridgeState, len(g.bridges))
+	for i, b := range g.bridges {
+		st.Bridges[i].Name = b.name
+		index[b.name] = &st.Bridges[i]
+	}
+
+	for _, job := range g.jobs {
+		switch j := job.CollectJob.(type) {
+		case *lights:
+			b := index[j.bridge]
+			if s := j.snapshot(); s != nil {
+				for _, l := range s.lights {
+					b.Lights = append(b.Lights, Light{ID: l.ID, Light: l})
+				}
+				sort.Slice(b.Lights, func(x, y int) bool { return b.Lights[x].ID < b.Lights[y].ID })
+			}
+		case *groups:
+			b := index[j.bridge]
+			if groups, ok := j.snapshot(); ok {
+				for _, g := range groups {
+					b.Groups = append(b.Groups, Group{ID: g.ID, Group: g})
+				}
+				sort.Slice(b.Groups, func(x, y int) bool { return b.Groups[x].ID < b.Groups[y].ID })
+			}
+		case *sensors:
+			b := index[j.bridge]
+			if sensors, ok := j.snapshot(); ok {
+				for _, s := range sensors {
+					b.Sensors = append(b.Sensors, Sensor{ID: s.ID, Sensor: s})
+				}
+				sort.Slice(b.Sensors, func(x, y int) bool { return b.Sensors[x].ID < b.Sensors[y].ID })
+			}
+		}
+	}
+
+	return st
+}
+
+// StateHandler serves the state last collected by the collector as JSON,
+// for consumers reading the current state rather than metrics.
+func StateHandler(c Collector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(c.State()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,356 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ninnemana/hue-exporter/clipv2"
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// defaultRateLimit is the number of requests per second Philips
+	// recommends sending a bridge at most.
+	defaultRateLimit = 10
+
+	// defaultRequestTimeout bounds each request made to a bridge.
+	defaultRequestTimeout = time.Second * 10
+
+	// defaultCycleTimeout bounds a collection cycle across all bridges.
+	defaultCycleTimeout = time.Second * 30
+
+	// defaultConcurrency is the number of requests in flight to each bridge
+	// at most, leaving the bridge free to answer the Hue app.
+	defaultConcurrency = 3
+)
+
+// throttle spaces out requests across every job and bridge, so collection
+// leaves room for the commands of automations sharing the bridges, and
+// bounds how long each request may take.
+type throttle struct {
+	limit   *rate.Limiter
+	timeout time.Duration
+	// inflight holds a slot for every request in flight to the bridge, it
+	// is nil when the number isn't bounded.
+	inflight chan struct{}
+}
+
+func newThrottle() *throttle {
+	return &throttle{
+		limit:   rate.NewLimiter(defaultRateLimit, 1),
+		timeout: defaultRequestTimeout,
+	}
+}
+
+// forBridge returns a throttle sharing the rate limit and timeout which
+// bounds the requests in flight to a single bridge to concurrency, zero
+// leaves them unbounded.
+func (t *throttle) forBridge(concurrency int) *throttle {
+	bt := &throttle{
+		limit:   t.limit,
+		timeout: t.timeout,
+	}
+	if concurrency > 0 {
+		bt.inflight = make(chan struct{}, concurrency)
+	}
+
+	return bt
+}
+
+// do waits for a free slot and until the rate limit permits another request,
+// then sends it through fn.
+func (t *throttle) do(ctx context.Context, fn func(context.Context) error) error {
+	if t.inflight != nil {
+		select {
+		case t.inflight <- struct{}{}:
+			defer func() { <-t.inflight }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if err := t.limit.Wait(ctx); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// the request couldn't be sent before the deadline
+		return fmt.Errorf("%w: %v", ErrRateLimited, err)
+	}
+
+	if t.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+	}
+
+	return fn(ctx)
+}
+
+// throttledBridge sends the requests made by the jobs through a throttle.
+type throttledBridge struct {
+	Bridge
+	throttle *throttle
+}
+
+func (b *throttledBridge) GetConfigContext(ctx context.Context) (cfg *hueclient.Config, err error) {
+	err = b.throttle.do(ctx, func(ctx context.Context) error {
+		cfg, err = b.Bridge.GetConfigContext(ctx)
+
+		return err
+	})
+
+	return cfg, err
+}
+
+func (b *throttledBridge) GetCapabilitiesContext(ctx context.Context) (caps *hueclient.Capabilities, err error) {
+	err = b.throttle.do(ctx, func(ctx context.Context) error {
+		caps, err = b.Bridge.GetCapabilitiesContext(ctx)
+
+		return err
+	})
+
+	return caps, err
+}
+
+func (b *throttledBridge) GetGroupsContext(ctx context.Context) (groups []hueclient.Group, err error) {
+	err = b.throttle.do(ctx, func(ctx context.Context) error {
+		groups, err = b.Bridge.GetGroupsContext(ctx)
+
+		return err
+	})
+
+	return groups, err
+}
+
+func (b *throttledBridge) GetLightsContext(ctx context.Context) (lights []hueclient.Light, err error) {
+	err = b.throttle.do(ctx, func(ctx context.Context) error {
+		lights, err = b.Bridge.GetLightsContext(ctx)
+
+		return err
+	})
+
+	return lights, err
+}
+
+func (b *throttledBridge) GetNewLightsContext(ctx context.Context) (lights *hueclient.NewLight, err error) {
+	err = b.throttle.do(ctx, func(ctx context.Context) error {
+		lights, err = b.Bridge.GetNewLightsContext(ctx)
+
+		return err
+	})
+
+	return lights, err
+}
+
+func (b *throttledBridge) GetRulesContext(ctx context.Context) (rules []*hueclient.Rule, err error) {
+	err = b.throttle.do(ctx, func(ctx context.Context) error {
+		rules, err = b.Bridge.GetRulesContext(ctx)
+
+		return err
+	})
+
+	return rules, err
+}
+
+func (b *throttledBridge) GetScenesContext(ctx context.Context) (scenes []hueclient.Scene, err error) {
+	err = b.throttle.do(ctx, func(ctx context.Context) error {
+		scenes, err = b.Bridge.GetScenesContext(ctx)
+
+		return err
+	})
+
+	return scenes, err
+}
+
+func (b *throttledBridge) GetSchedulesContext(ctx context.Context) (schedules []*hueclient.Schedule, err error) {
+	err = b.throttle.do(ctx, func(ctx context.Context) error {
+		schedules, err = b.Bridge.GetSchedulesContext(ctx)
+
+		return err
+	})
+
+	return schedules, err
+}
+
+func (b *throttledBridge) GetNewSensorsContext(ctx context.Context) (sensors *hueclient.NewSensor, err error) {
+	err = b.throttle.do(ctx, func(ctx context.Context) error {
+		sensors, err = b.Bridge.GetNewSensorsContext(ctx)
+
+		return err
+	})
+
+	return sensors, err
+}
+
+func (b *throttledBridge) GetSensorsContext(ctx context.Context) (sensors []hueclient.Sensor, err error) {
+	err = b.throttle.do(ctx, func(ctx context.Context) error {
+		sensors, err = b.Bridge.GetSensorsContext(ctx)
+
+		return err
+	})
+
+	return sensors, err
+}
+
+// throttledRaw sends the raw v1 requests made by the jobs through a
+// throttle.
+type throttledRaw struct {
+	rawGetter
+	throttle *throttle
+}
+
+func (r *throttledRaw) Get(ctx context.Context, path string, v interface{}) error {
+	return r.throttle.do(ctx, func(ctx context.Context) error {
+		return r.rawGetter.Get(ctx, path, v)
+	})
+}
+
+// throttledSearcher sends the requests starting a search for new devices
+// through a throttle.
+type throttledSearcher struct {
+	searcher
+	throttle *throttle
+}
+
+func (s *throttledSearcher) FindLightsContext(ctx context.Context) error {
+	return s.throttle.do(ctx, s.searcher.FindLightsContext)
+}
+
+func (s *throttledSearcher) FindSensorsContext(ctx context.Context) error {
+	return s.throttle.do(ctx, s.searcher.FindSensorsContext)
+}
+
+// throttledActuator sends the requests changing the state of lights through
+// a throttle, sharing it with collection.
+type throttledActuator struct {
+	actuator
+	throttle *throttle
+}
+
+func (a *throttledActuator) SetLightStateContext(ctx context.Context, id int, action hueclient.Action) error {
+	return a.throttle.do(ctx, func(ctx context.Context) error {
+		return a.actuator.SetLightStateContext(ctx, id, action)
+	})
+}
+
+func (a *throttledActuator) SetGroupStateContext(ctx context.Context, id int, action hueclient.Action) error {
+	return a.throttle.do(ctx, func(ctx context.Context) error {
+		return a.actuator.SetGroupStateContext(ctx, id, action)
+	})
+}
+
+// throttledResourcelinker fetches resourcelinks through a throttle.
+type throttledResourcelinker struct {
+	resourcelinker
+	throttle *throttle
+}
+
+func (r *throttledResourcelinker) GetResourcelinksContext(ctx context.Context) (links []*hueclient.Resourcelink, err error) {
+	err = r.throttle.do(ctx, func(ctx context.Context) error {
+		links, err = r.resourcelinker.GetResourcelinksContext(ctx)
+
+		return err
+	})
+
+	return links, err
+}
+
+// throttledClient sends the CLIP v2 requests made by the jobs through a
+// throttle. The event stream subscription is long lived and bypasses it.
+type throttledClient struct {
+	*clipv2.Client
+	throttle *throttle
+}
+
+func (c *throttledClient) Devices(ctx context.Context) (devices []clipv2.Device, err error) {
+	err = c.throttle.do(ctx, func(ctx context.Context) error {
+		devices, err = c.Client.Devices(ctx)
+
+		return err
+	})
+
+	return devices, err
+}
+
+func (c *throttledClient) Lights(ctx context.Context) (lights []clipv2.Light, err error) {
+	err = c.throttle.do(ctx, func(ctx context.Context) error {
+		lights, err = c.Client.Lights(ctx)
+
+		return err
+	})
+
+	return lights, err
+}
+
+func (c *throttledClient) GroupedLights(ctx context.Context) (groups []clipv2.GroupedLight, err error) {
+	err = c.throttle.do(ctx, func(ctx context.Context) error {
+		groups, err = c.Client.GroupedLights(ctx)
+
+		return err
+	})
+
+	return groups, err
+}
+
+func (c *throttledClient) ZigbeeConnectivity(ctx context.Context) (connectivity []clipv2.ZigbeeConnectivity, err error) {
+	err = c.throttle.do(ctx, func(ctx context.Context) error {
+		connectivity, err = c.Client.ZigbeeConnectivity(ctx)
+
+		return err
+	})
+
+	return connectivity, err
+}
+
+func (c *throttledClient) DevicePower(ctx context.Context) (power []clipv2.DevicePower, err error) {
+	err = c.throttle.do(ctx, func(ctx context.Context) error {
+		power, err = c.Client.DevicePower(ctx)
+
+		return err
+	})
+
+	return power, err
+}
+
+func (c *throttledClient) Buttons(ctx context.Context) (buttons []clipv2.Button, err error) {
+	err = c.throttle.do(ctx, func(ctx context.Context) error {
+		buttons, err = c.Client.Buttons(ctx)
+
+		return err
+	})
+
+	return buttons, err
+}
+
+func (c *throttledClient) Scenes(ctx context.Context) (scenes []clipv2.Scene, err error) {
+	err = c.throttle.do(ctx, func(ctx context.Context) error {
+		scenes, err = c.Client.Scenes(ctx)
+
+		return err
+	})
+
+	return scenes, err
+}
+
+func (c *throttledClient) Rooms(ctx context.Context) (rooms []clipv2.Group, err error) {
+	err = c.throttle.do(ctx, func(ctx context.Context) error {
+		rooms, err = c.Client.Rooms(ctx)
+
+		return err
+	})
+
+	return rooms, err
+}
+
+func (c *throttledClient) Zones(ctx context.Context) (zones []clipv2.Group, err error) {
+	err = c.throttle.do(ctx, func(ctx context.Context) error {
+		zones, err = c.Client.Zones(ctx)
+
+		return err
+	})
+
+	return zones, err
+}
@@ -0,0 +1,134 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestThrottleConcurrency(t *testing.T) {
+	th := &throttle{limit: rate.NewLimiter(rate.Inf, 1)}
+	bt := th.forBridge(2)
+
+	var (
+		mu            sync.Mutex
+		inflight, max int
+		wg            sync.WaitGroup
+	)
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := bt.do(context.Background(), func(context.Context) error {
+				mu.Lock()
+				inflight++
+				if inflight > max {
+					max = inflight
+				}
+				mu.Unlock()
+
+				time.Sleep(10 * time.Millisecond)
+
+				mu.Lock()
+				inflight--
+				mu.Unlock()
+
+				return nil
+			})
+			if err != nil {
+				t.Errorf("failed to send request: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if max != 2 {
+		t.Errorf("%d requests in flight at most, want 2", max)
+	}
+}
+
+func TestThrottleTimeout(t *testing.T) {
+	th := &throttle{limit: rate.NewLimiter(rate.Inf, 1), timeout: time.Minute}
+
+	err := th.do(context.Background(), func(ctx context.Context) error {
+		deadline, ok := ctx.Deadline()
+		if !ok || time.Until(deadline) > time.Minute {
+			t.Errorf("request deadline %v, want within a minute", deadline)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+}
+
+func TestThrottleErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		// limit allows a request every second, after the first
+		limit bool
+		// full leaves no slot free for the request
+		full   bool
+		ctx    func() (context.Context, context.CancelFunc)
+		want   error
+		called bool
+	}{
+		{
+			name:   "sent",
+			ctx:    func() (context.Context, context.CancelFunc) { return context.WithCancel(context.Background()) },
+			called: true,
+		},
+		{
+			name:  "rate limited",
+			limit: true,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 10*time.Millisecond)
+			},
+			want: ErrRateLimited,
+		},
+		{
+			name: "canceled waiting for a slot",
+			full: true,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 10*time.Millisecond)
+			},
+			want: context.DeadlineExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit := rate.NewLimiter(rate.Inf, 1)
+			if tt.limit {
+				limit = rate.NewLimiter(1, 1)
+				limit.Allow()
+			}
+			th := (&throttle{limit: limit}).forBridge(1)
+			if tt.full {
+				th.inflight <- struct{}{}
+			}
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+
+			var called bool
+			err := th.do(ctx, func(context.Context) error {
+				called = true
+
+				return nil
+			})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("error: %v, want %v", err, tt.want)
+			}
+			if called != tt.called {
+				t.Errorf("request sent: %v, want %v", called, tt.called)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package collector
+
+import (
+	"context"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// identifier replaces the numeric id label of light and sensor observations
+// with the uniqueid of the device, its Zigbee MAC address and endpoint,
+// which survives re-pairing the device with the bridge. Devices without a
+// uniqueid, such as CLIP sensors, keep their numeric id. It also labels
+// observations with the name of the device, sparing a join with the info
+// metrics at the cost of a new series on every rename.
+type identifier struct {
+	// ids returns the uniqueid of the known devices by numeric id, it is nil
+	// while devices are identified by their numeric id.
+	ids func() map[int64]string
+	// names returns the sanitized name of the known devices by numeric id,
+	// it is nil while observations are not labelled with names.
+	names func() map[int64]string
+}
+
+// int64s wraps cb to identify devices by their uniqueid.
+func (i identifier) int64s(cb metric.Int64ObserverFunc) metric.Int64ObserverFunc {
+	return i.wrapInt64(cb, false)
+}
+
+// info wraps the callback of an info metric to identify devices by their
+// uniqueid, keeping the numeric id as the number label. Info metrics carry
+// the name of the device already.
+func (i identifier) info(cb metric.Int64ObserverFunc) metric.Int64ObserverFunc {
+	return i.wrapInt64(cb, true)
+}
+
+func (i identifier) wrapInt64(cb metric.Int64ObserverFunc, number bool) metric.Int64ObserverFunc {
+	if i.ids == nil && (i.names == nil || number) {
+		return cb
+	}
+
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		ids, names := i.maps(number)
+		cb.Run(ctx, nil, func(labels []attribute.KeyValue, obs ...metric.Observation) {
+			for _, o := range obs {
+				n := o.Number()
+				res.Observe(n.AsInt64(), identify(labels, ids, names, number)...)
+			}
+		})
+	}
+}
+
+// float64s wraps cb to identify devices by their uniqueid.
+func (i identifier) float64s(cb metric.Float64ObserverFunc) metric.Float64ObserverFunc {
+	if i.ids == nil && i.names == nil {
+		return cb
+	}
+
+	return func(ctx context.Context, res metric.Float64ObserverResult) {
+		ids, names := i.maps(false)
+		cb.Run(ctx, nil, func(labels []attribute.KeyValue, obs ...metric.Observation) {
+			for _, o := range obs {
+				n := o.Number()
+				res.Observe(n.AsFloat64(), identify(labels, ids, names, false)...)
+			}
+		})
+	}
+}
+
+// maps returns the uniqueids and names to label the observations of a
+// single collection with, either of which may be nil.
+func (i identifier) maps(info bool) (ids, names map[int64]string) {
+	if i.ids != nil {
+		ids = i.ids()
+	}
+	if i.names != nil && !info {
+		names = i.names()
+	}
+
+	return ids, names
+}
+
+// identify replaces the numeric id label with the uniqueid of the device,
+// adding the numeric id as the number label when number is set, and adds
+// the name of the device unless the observation is labelled with it.
+func identify(labels []attribute.KeyValue, ids, names map[int64]string, number bool) []attribute.KeyValue {
+	out := make([]attribute.KeyValue, 0, len(labels)+2)
+
+	var name string
+	for _, kv := range labels {
+		if kv.Key == "name" {
+			names = nil
+		}
+
+		if kv.Key != "id" || kv.Value.Type() != attribute.INT64 {
+			out = append(out, kv)
+
+			continue
+		}
+
+		if number {
+			out = append(out, attribute.Int64("number", kv.Value.AsInt64()))
+		}
+
+		name = names[kv.Value.AsInt64()]
+		if uid, ok := ids[kv.Value.AsInt64()]; ok {
+			kv = attribute.String("id", uid)
+		}
+		out = append(out, kv)
+	}
+
+	if names != nil && name != "" {
+		out = append(out, attribute.String("name", name))
+	}
+
+	return out
+}
+
+func lightUniqueIDs(lights []hueclient.Light) map[int64]string {
+	ids := make(map[int64]string, len(lights))
+	for _, l := range lights {
+		if l.UniqueID != "" {
+			ids[int64(l.ID)] = l.UniqueID
+		}
+	}
+
+	return ids
+}
+
+func sensorUniqueIDs(sensors []hueclient.Sensor) map[int64]string {
+	ids := make(map[int64]string, len(sensors))
+	for _, s := range sensors {
+		if s.UniqueID != "" {
+			ids[int64(s.ID)] = s.UniqueID
+		}
+	}
+
+	return ids
+}
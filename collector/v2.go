@@ -0,0 +1,345 @@
+package collector
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ninnemana/hue-exporter/clipv2"
+	"github.com/ninnemana/tracelog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/unit"
+	"go.uber.org/zap"
+)
+
+// v2Resources collects from the CLIP v2 API of a bridge.
+type v2Resources struct {
+	log    *tracelog.TraceLogger
+	client *throttledClient
+	bridge string
+	// streamed skips light state, which is kept current by the event stream.
+	streamed bool
+
+	mu    sync.RWMutex
+	state *v2State
+}
+
+// v2State is the CLIP v2 state last collected from the bridge.
+type v2State struct {
+	devices       []clipv2.Device
+	names         map[string]string
+	groupedLights []clipv2.GroupedLight
+	connectivity  []clipv2.ZigbeeConnectivity
+	power         []clipv2.DevicePower
+	counts        map[string]int
+}
+
+func (v *v2Resources) snapshot() *v2State {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	return v.state
+}
+
+func (v *v2Resources) Collect(ctx context.Context) func() error {
+	ctx, span := tracer.Start(ctx, "v2Resources.Collect")
+	log := v.log.SetContext(ctx)
+
+	return func() error {
+		defer span.End()
+
+		devices, err := v.client.Devices(ctx)
+		if err != nil {
+			log.Error("failed to fetch devices", zap.Error(err))
+
+			return err
+		}
+
+		var groupedLights []clipv2.GroupedLight
+		if !v.streamed {
+			groupedLights, err = v.client.GroupedLights(ctx)
+			if err != nil {
+				log.Error("failed to fetch grouped lights", zap.Error(err))
+
+				return err
+			}
+		}
+
+		connectivity, err := v.client.ZigbeeConnectivity(ctx)
+		if err != nil {
+			log.Error("failed to fetch zigbee connectivity", zap.Error(err))
+
+			return err
+		}
+
+		power, err := v.client.DevicePower(ctx)
+		if err != nil {
+			log.Error("failed to fetch device power", zap.Error(err))
+
+			return err
+		}
+
+		counts := map[string]int{
+			"device":              len(devices),
+			"zigbee_connectivity": len(connectivity),
+			"device_power":        len(power),
+		}
+		if !v.streamed {
+			counts["grouped_light"] = len(groupedLights)
+		}
+
+		log.Debug("collected v2 metrics", zap.Int("devices", len(devices)))
+
+		v.mu.Lock()
+		v.state = &v2State{
+			devices:       devices,
+			names:         deviceNames(devices),
+			groupedLights: groupedLights,
+			connectivity:  connectivity,
+			power:         power,
+			counts:        counts,
+		}
+		v.mu.Unlock()
+
+		return nil
+	}
+}
+
+func (v *v2Resources) register(inst *instruments) error {
+	if err := inst.int64Gauge(
+		"device",
+		"Devices known to the bridge. Includes name, archetype and model.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			if st := v.snapshot(); st != nil {
+				deviceObserver(v.bridge, st.devices)(ctx, res)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	if !v.streamed {
+		if err := inst.int64Gauge(
+			"grouped_light_on",
+			"Whether any light in the grouped light is on.",
+			unit.Dimensionless,
+			func(ctx context.Context, res metric.Int64ObserverResult) {
+				if st := v.snapshot(); st != nil {
+					groupedLightOnObserver(v.bridge, st.groupedLights)(ctx, res)
+				}
+			},
+		); err != nil {
+			return err
+		}
+
+		if err := inst.float64Gauge(
+			"grouped_light_brightness",
+			"Brightness of grouped lights in percent.",
+			unitPercent,
+			func(ctx context.Context, res metric.Float64ObserverResult) {
+				if st := v.snapshot(); st != nil {
+					groupedLightBrightnessObserver(v.bridge, st.groupedLights)(ctx, res)
+				}
+			},
+		); err != nil {
+			return err
+		}
+	}
+
+	if err := inst.int64Gauge(
+		"zigbee_connectivity_status",
+		"Zigbee connectivity of each device, 1 for the current status.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			if st := v.snapshot(); st != nil {
+				zigbeeConnectivityObserver(v.bridge, st.names, st.connectivity)(ctx, res)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"device_battery_percent",
+		"Battery level of battery powered devices in percent.",
+		unitPercent,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			if st := v.snapshot(); st != nil {
+				deviceBatteryObserver(v.bridge, st.names, st.power)(ctx, res)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"device_battery_state",
+		"Battery state of battery powered devices, 1 for the current state.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			if st := v.snapshot(); st != nil {
+				deviceBatteryStateObserver(v.bridge, st.names, st.power)(ctx, res)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	if err := inst.int64Gauge(
+		"v2_resources",
+		"Number of CLIP v2 resources by type.",
+		unit.Dimensionless,
+		func(ctx context.Context, res metric.Int64ObserverResult) {
+			if st := v.snapshot(); st != nil {
+				resourceCountObserver(v.bridge, st.counts)(ctx, res)
+			}
+		},
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func deviceObserver(bridge string, devices []clipv2.Device) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for _, d := range devices {
+			res.Observe(
+				1,
+				attribute.String("bridge", bridge),
+				attribute.String("id", d.ID),
+				attribute.String("name", d.Metadata.Name),
+				attribute.String("archetype", d.Metadata.Archetype),
+				attribute.String("model", d.ProductData.ModelID),
+			)
+		}
+	}
+}
+
+var (
+	// zigbeeStatuses are the connectivity statuses reported by the bridge.
+	zigbeeStatuses = []string{
+		"connected",
+		"disconnected",
+		"connectivity_issue",
+		"unidirectional_incoming",
+	}
+
+	// batteryStates are the battery states reported by the bridge.
+	batteryStates = []string{
+		"normal",
+		"low",
+		"critical",
+	}
+)
+
+// deviceNames maps device identifiers to their names, used to label
+// resources owned by a device.
+func deviceNames(devices []clipv2.Device) map[string]string {
+	names := make(map[string]string, len(devices))
+	for _, d := range devices {
+		names[d.ID] = d.Metadata.Name
+	}
+
+	return names
+}
+
+func zigbeeConnectivityObserver(bridge string, names map[string]string, connectivity []clipv2.ZigbeeConnectivity) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for _, c := range connectivity {
+			for _, status := range zigbeeStatuses {
+				res.Observe(
+					boolValue(c.Status == status),
+					attribute.String("bridge", bridge),
+					attribute.String("device", c.Owner.RID),
+					attribute.String("name", names[c.Owner.RID]),
+					attribute.String("mac", c.MACAddress),
+					attribute.String("status", status),
+				)
+			}
+		}
+	}
+}
+
+func deviceBatteryObserver(bridge string, names map[string]string, power []clipv2.DevicePower) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for _, p := range power {
+			// mains powered devices report no battery state
+			if p.PowerState.BatteryState == "" {
+				continue
+			}
+
+			res.Observe(
+				int64(p.PowerState.BatteryLevel),
+				attribute.String("bridge", bridge),
+				attribute.String("device", p.Owner.RID),
+				attribute.String("name", names[p.Owner.RID]),
+			)
+		}
+	}
+}
+
+func deviceBatteryStateObserver(bridge string, names map[string]string, power []clipv2.DevicePower) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for _, p := range power {
+			if p.PowerState.BatteryState == "" {
+				continue
+			}
+
+			for _, state := range batteryStates {
+				res.Observe(
+					boolValue(p.PowerState.BatteryState == state),
+					attribute.String("bridge", bridge),
+					attribute.String("device", p.Owner.RID),
+					attribute.String("name", names[p.Owner.RID]),
+					attribute.String("state", state),
+				)
+			}
+		}
+	}
+}
+
+func groupedLightOnObserver(bridge string, groups []clipv2.GroupedLight) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for _, g := range groups {
+			res.Observe(
+				boolValue(g.On.On),
+				attribute.String("bridge", bridge),
+				attribute.String("id", g.ID),
+				attribute.String("owner", g.Owner.RID),
+				attribute.String("owner_type", g.Owner.RType),
+			)
+		}
+	}
+}
+
+func groupedLightBrightnessObserver(bridge string, groups []clipv2.GroupedLight) metric.Float64ObserverFunc {
+	return func(ctx context.Context, res metric.Float64ObserverResult) {
+		for _, g := range groups {
+			if g.Dimming == nil {
+				continue
+			}
+
+			res.Observe(
+				g.Dimming.Brightness,
+				attribute.String("bridge", bridge),
+				attribute.String("id", g.ID),
+				attribute.String("owner", g.Owner.RID),
+				attribute.String("owner_type", g.Owner.RType),
+			)
+		}
+	}
+}
+
+func resourceCountObserver(bridge string, counts map[string]int) metric.Int64ObserverFunc {
+	return func(ctx context.Context, res metric.Int64ObserverResult) {
+		for typ, n := range counts {
+			res.Observe(
+				int64(n),
+				attribute.String("bridge", bridge),
+				attribute.String("type", typ),
+			)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	rdebug "runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ninnemana/hue-exporter/collector"
+	"github.com/ninnemana/hue-exporter/discovery"
+	"github.com/ninnemana/hue-exporter/hueclient"
+)
+
+// version and revision are set at build time through
+// -ldflags "-X main.version=... -X main.revision=...".
+var (
+	version  = "dev"
+	revision = "unknown"
+)
+
+// buildVersion returns the version set at build time, falling back to the
+// module version for binaries built through go install.
+func buildVersion() string {
+	if version != "dev" {
+		return version
+	}
+
+	if bi, ok := rdebug.ReadBuildInfo(); ok && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		return bi.Main.Version
+	}
+
+	return version
+}
+
+// commands are the subcommands of the binary along with their description.
+var commands = []struct {
+	name string
+	desc string
+}{
+	{"serve", "collect from the bridges and serve metrics, the default"},
+	{"discover", "find bridges on the network"},
+	{"pair", "create a bridge username by pressing the link button"},
+	{"remote-login", "authorize with the Hue remote API to collect from outside the network of the bridge"},
+	{"list", "list the lights, groups or sensors of the bridges"},
+	{"dashboard", "print a Grafana dashboard of the rooms and sensors of the bridges"},
+	{"rules", "print Prometheus alerting rules for the exported metrics"},
+	{"validate", "check the configuration, bridges and endpoints without serving"},
+	{"version", "print the version"},
+}
+
+// command splits the subcommand off the arguments, defaulting to serve when
+// the arguments start with a flag.
+func command(args []string) (string, []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return "serve", args
+	}
+
+	return args[0], args[1:]
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+
+	fmt.Fprintf(out, "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-13s %s\n", c.name, c.desc)
+	}
+
+	fmt.Fprintf(out, "\nlist takes the resource to list, one of lights, groups or sensors.\n")
+	fmt.Fprintf(out, "\nEvery flag may also be set through an environment variable named after it,\n")
+	fmt.Fprintf(out, "such as %s for -metric-port, or in the file of -config-file.\n", envName("metric-port"))
+	fmt.Fprintf(out, "Flags take precedence over the environment, which takes precedence over the file.\n\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func printVersion(w io.Writer) {
+	fmt.Fprintf(w, "hue-exporter %s (%s) %s/%s %s\n", buildVersion(), revision, runtime.GOOS, runtime.GOARCH, runtime.Version())
+}
+
+// discoverBridges prints the bridges found on the network.
+func discoverBridges(ctx context.Context, w io.Writer) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	found, err := discovery.Default().Discover(ctx)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tADDRESS")
+	for _, b := range found {
+		fmt.Fprintf(tw, "%s\t%s\n", b.ID, b.Address)
+	}
+
+	return tw.Flush()
+}
+
+// list prints the resources of every configured bridge as a table.
+func list(ctx context.Context, w io.Writer, resource string) error {
+	cfgs := hueConfigs()
+	creds, err := loadCredentials(*credentials)
+	switch {
+	case err == nil:
+		cfgs = applyCredentials(cfgs, creds)
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	switch resource {
+	case "lights":
+		fmt.Fprintln(tw, "BRIDGE\tID\tNAME\tTYPE\tMODEL\tON\tBRIGHTNESS\tREACHABLE")
+	case "groups":
+		fmt.Fprintln(tw, "BRIDGE\tID\tNAME\tTYPE\tCLASS\tLIGHTS\tANY ON")
+	case "sensors":
+		fmt.Fprintln(tw, "BRIDGE\tID\tNAME\tTYPE\tMODEL\tBATTERY\tREACHABLE")
+	default:
+		return fmt.Errorf("unknown resource %q, expected lights, groups or sensors", resource)
+	}
+
+	for _, cfg := range cfgs {
+		b, name, err := listBridge(ctx, cfg)
+		if err != nil {
+			return err
+		}
+
+		switch resource {
+		case "lights":
+			err = listLights(ctx, tw, b, name)
+		case "groups":
+			err = listGroups(ctx, tw, b, name)
+		case "sensors":
+			err = listSensors(ctx, tw, b, name)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list %s of bridge %q: %w", resource, name, err)
+		}
+	}
+
+	return tw.Flush()
+}
+
+// listBridge resolves a configured bridge, locating it through discovery
+// when it has no address.
+func listBridge(ctx context.Context, cfg collector.HueConfig) (*hueclient.Client, string, error) {
+	addr := cfg.IP
+	if addr == "" {
+		found, err := discovery.Default().Discover(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, f := range found {
+			if cfg.ID == "" || strings.EqualFold(cfg.ID, f.ID) {
+				addr = f.Address
+
+				break
+			}
+		}
+		if addr == "" {
+			return nil, "", fmt.Errorf("bridge %q: %w", cfg.ID, discovery.ErrNotFound)
+		}
+	}
+
+	name := cfg.Name
+	if name == "" {
+		name = cfg.ID
+	}
+	if name == "" {
+		name = addr
+	}
+
+	return hueclient.New(addr, cfg.Username), name, nil
+}
+
+func listLights(ctx context.Context, w io.Writer, b *hueclient.Client, bridge string) error {
+	lights, err := b.GetLightsContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(lights, func(i, j int) bool { return lights[i].ID < lights[j].ID })
+
+	for _, l := range lights {
+		var (
+			on, reachable bool
+			bri           uint8
+		)
+		if l.State != nil {
+			on, reachable, bri = l.State.On, l.State.Reachable, l.State.Bri
+		}
+
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%t\t%d\t%t\n", bridge, l.ID, l.Name, l.Type, l.ModelID, on, bri, reachable)
+	}
+
+	return nil
+}
+
+func listGroups(ctx context.Context, w io.Writer, b *hueclient.Client, bridge string) error {
+	groups, err := b.GetGroupsContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+
+	for _, g := range groups {
+		anyOn := g.GroupState != nil && g.GroupState.AnyOn
+
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%t\n", bridge, g.ID, g.Name, g.Type, g.Class, strings.Join(g.Lights, ","), anyOn)
+	}
+
+	return nil
+}
+
+func listSensors(ctx context.Context, w io.Writer, b *hueclient.Client, bridge string) error {
+	sensors, err := b.GetSensorsContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(sensors, func(i, j int) bool { return sensors[i].ID < sensors[j].ID })
+
+	for _, s := range sensors {
+		battery, reachable := "-", "-"
+		if v, ok := s.Config["battery"].(float64); ok {
+			battery = strconv.Itoa(int(v)) + "%"
+		}
+		if v, ok := s.Config["reachable"].(bool); ok {
+			reachable = strconv.FormatBool(v)
+		}
+
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n", bridge, s.ID, s.Name, s.Type, s.ModelID, battery, reachable)
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// envPrefix prefixes the environment variables flags are read from, e.g.
+// -metric-port is read from HUE_EXPORTER_METRIC_PORT and -collector.lights
+// from HUE_EXPORTER_COLLECTOR_LIGHTS.
+const envPrefix = "HUE_EXPORTER_"
+
+// envReplacer replaces the characters of flag names environment variable
+// names can't hold.
+var envReplacer = strings.NewReplacer("-", "_", ".", "_")
+
+// configFile is the YAML file flags are read from, keyed by flag name.
+var configFile = flag.String("config-file", "", "path of a YAML file setting flags by name, such as metric-port: 9100")
+
+// envName returns the environment variable the flag is read from.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(envReplacer.Replace(flagName))
+}
+
+// loadConfig fills in the flags not given on the command line, first from
+// their environment variable, then from the config file. Flags given on the
+// command line take precedence over the environment, which takes precedence
+// over the file, which takes precedence over the defaults.
+func loadConfig(fs *flag.FlagSet) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	// the config file may itself come from the environment
+	if !set["config-file"] {
+		if v, ok := os.LookupEnv(envName("config-file")); ok {
+			if err := fs.Set("config-file", v); err != nil {
+				return err
+			}
+			set["config-file"] = true
+		}
+	}
+
+	file, err := readConfigFile(*configFile)
+	if err != nil {
+		return err
+	}
+
+	for name := range file {
+		if name == "config-file" || fs.Lookup(name) == nil {
+			return fmt.Errorf("config file %s: unknown flag %q", *configFile, name)
+		}
+	}
+
+	var errs []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] {
+			return
+		}
+
+		var values []string
+		if v, ok := os.LookupEnv(envName(f.Name)); ok {
+			values = []string{v}
+			// repeated flags take a comma separated list from the
+			// environment
+			if _, ok := f.Value.(mapFlag); ok {
+				values = strings.Split(v, ",")
+			}
+		} else if v, ok := file[f.Name]; ok {
+			values = v
+		}
+
+		for _, v := range values {
+			if err := f.Value.Set(v); err != nil {
+				errs = append(errs, fmt.Sprintf("invalid value %q for %s: %v", v, f.Name, err))
+			}
+		}
+	})
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// readConfigFile reads the values of the flags set in the YAML file. Flags
+// which may be repeated take a list, or a map for flags of name=value pairs.
+func readConfigFile(path string) (map[string][]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to decode config file: %w", err)
+	}
+
+	values := make(map[string][]string, len(raw))
+	for name, v := range raw {
+		switch v := v.(type) {
+		case nil:
+		case []interface{}:
+			for _, item := range v {
+				values[name] = append(values[name], fmt.Sprint(item))
+			}
+		case map[interface{}]interface{}:
+			pairs := make([]string, 0, len(v))
+			for k, item := range v {
+				pairs = append(pairs, fmt.Sprintf("%v=%v", k, item))
+			}
+			sort.Strings(pairs)
+			values[name] = pairs
+		default:
+			values[name] = []string{fmt.Sprint(v)}
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"metric-port":      "HUE_EXPORTER_METRIC_PORT",
+		"config-file":      "HUE_EXPORTER_CONFIG_FILE",
+		"tls-client-ca":    "HUE_EXPORTER_TLS_CLIENT_CA",
+		"collector.lights": "HUE_EXPORTER_COLLECTOR_LIGHTS",
+		"collector.v2":     "HUE_EXPORTER_COLLECTOR_V2",
+	}
+
+	for flagName, want := range tests {
+		if got := envName(flagName); got != want {
+			t.Errorf("envName(%q) = %q, want %q", flagName, got, want)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("metric-port: 9100\nlog-level: debug\ninterval: 1m\ncollector.lights: false\n"), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	prev := *configFile
+	t.Cleanup(func() { *configFile = prev })
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.StringVar(configFile, "config-file", "", "")
+	port := fs.String("metric-port", "8080", "")
+	level := fs.String("log-level", "info", "")
+	interval := fs.String("interval", "30s", "")
+	lights := fs.Bool("collector.lights", true, "")
+	groups := fs.Bool("collector.groups", true, "")
+
+	t.Setenv("HUE_EXPORTER_CONFIG_FILE", path)
+	t.Setenv("HUE_EXPORTER_LOG_LEVEL", "warn")
+	t.Setenv("HUE_EXPORTER_COLLECTOR_GROUPS", "false")
+
+	if err := fs.Parse([]string{"-interval", "10s"}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+	if err := loadConfig(fs); err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	// the command line wins over the environment, which wins over the
+	// file, which wins over the defaults
+	if *interval != "10s" {
+		t.Errorf("interval = %s, want 10s from the command line", *interval)
+	}
+	if *level != "warn" {
+		t.Errorf("log-level = %s, want warn from the environment", *level)
+	}
+	if *port != "9100" {
+		t.Errorf("metric-port = %s, want 9100 from the file", *port)
+	}
+	if *lights {
+		t.Error("collector.lights is enabled, want it disabled by the file")
+	}
+	if *groups {
+		t.Error("collector.groups is enabled, want it disabled by the environment")
+	}
+}
+
+func TestLoadConfigUnknownFlag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("metric-prot: 9100\n"), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	prev := *configFile
+	t.Cleanup(func() { *configFile = prev })
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.StringVar(configFile, "config-file", "", "")
+	fs.String("metric-port", "8080", "")
+
+	if err := fs.Parse([]string{"-config-file", path}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+	if err := loadConfig(fs); err == nil {
+		t.Error("expected the misspelt flag to be rejected")
+	}
+}
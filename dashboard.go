@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+)
+
+// the width of the Grafana grid and the height of generated panels
+const (
+	gridWidth   = 24
+	panelHeight = 8
+)
+
+type grafanaDashboard struct {
+	Title         string           `json:"title"`
+	UID           string           `json:"uid"`
+	Tags          []string         `json:"tags"`
+	Timezone      string           `json:"timezone"`
+	SchemaVersion int              `json:"schemaVersion"`
+	Refresh       string           `json:"refresh"`
+	Time          grafanaTimeRange `json:"time"`
+	Templating    struct {
+		List []grafanaVariable `json:"list"`
+	} `json:"templating"`
+	Panels []grafanaPanel `json:"panels"`
+}
+
+type grafanaTimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type grafanaVariable struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Type  string `json:"type"`
+	Query string `json:"query"`
+}
+
+type grafanaPanel struct {
+	ID          int                 `json:"id"`
+	Title       string              `json:"title"`
+	Type        string              `json:"type"`
+	Datasource  string              `json:"datasource,omitempty"`
+	GridPos     grafanaGridPos      `json:"gridPos"`
+	Targets     []grafanaTarget     `json:"targets,omitempty"`
+	FieldConfig *grafanaFieldConfig `json:"fieldConfig,omitempty"`
+	Collapsed   *bool               `json:"collapsed,omitempty"`
+}
+
+type grafanaGridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type grafanaTarget struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat"`
+}
+
+type grafanaFieldConfig struct {
+	Defaults struct {
+		Unit string   `json:"unit,omitempty"`
+		Min  *float64 `json:"min,omitempty"`
+		Max  *float64 `json:"max,omitempty"`
+	} `json:"defaults"`
+}
+
+// dashboardBuilder lays out panels row by row on the Grafana grid.
+type dashboardBuilder struct {
+	prefix string
+	d      grafanaDashboard
+	id     int
+	y      int
+}
+
+func (b *dashboardBuilder) row(title string) {
+	b.id++
+	collapsed := false
+	b.d.Panels = append(b.d.Panels, grafanaPanel{
+		ID:        b.id,
+		Title:     title,
+		Type:      "row",
+		GridPos:   grafanaGridPos{H: 1, W: gridWidth, Y: b.y},
+		Collapsed: &collapsed,
+	})
+	b.y++
+}
+
+// panels adds the panels side by side on a single line of the grid.
+func (b *dashboardBuilder) panels(panels ...grafanaPanel) {
+	if len(panels) == 0 {
+		return
+	}
+
+	w := gridWidth / len(panels)
+	for i, p := range panels {
+		b.id++
+		p.ID = b.id
+		p.Datasource = "${datasource}"
+		p.GridPos = grafanaGridPos{H: panelHeight, W: w, X: i * w, Y: b.y}
+		for j := range p.Targets {
+			p.Targets[j].RefID = refID(j)
+		}
+
+		b.d.Panels = append(b.d.Panels, p)
+	}
+	b.y += panelHeight
+}
+
+// refID names the i-th query of a panel A through Z, then A1 onwards.
+func refID(i int) string {
+	id := string(rune('A' + i%26))
+	if i >= 26 {
+		id += strconv.Itoa(i / 26)
+	}
+
+	return id
+}
+
+func (b *dashboardBuilder) target(metric, bridge, id, legend string) grafanaTarget {
+	return grafanaTarget{
+		Expr:         fmt.Sprintf(`%s%s{bridge=%q,id=%q}`, b.prefix, metric, bridge, id),
+		LegendFormat: legend,
+	}
+}
+
+// deviceID returns the id label of a light or sensor, its uniqueid when
+// devices are identified by it.
+func deviceID(id int, uid string) string {
+	if *uniqueID && uid != "" {
+		return uid
+	}
+
+	return strconv.Itoa(id)
+}
+
+func fieldConfig(unit string, min, max float64) *grafanaFieldConfig {
+	var c grafanaFieldConfig
+	c.Defaults.Unit = unit
+	c.Defaults.Min = &min
+	c.Defaults.Max = &max
+
+	return &c
+}
+
+// dashboard prints a Grafana dashboard with a row for every room, graphing
+// the brightness of its lights, and rows graphing the sensors, titled with
+// the names configured on the bridges.
+func dashboard(ctx context.Context, w io.Writer) error {
+	cfgs := hueConfigs()
+	creds, err := loadCredentials(*credentials)
+	switch {
+	case err == nil:
+		cfgs = applyCredentials(cfgs, creds)
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+
+	b := &dashboardBuilder{prefix: *prefix}
+	b.d = grafanaDashboard{
+		Title:         "Philips Hue",
+		UID:           "hue-exporter",
+		Tags:          []string{"hue"},
+		Timezone:      "browser",
+		SchemaVersion: 30,
+		Refresh:       "1m",
+		Time:          grafanaTimeRange{From: "now-24h", To: "now"},
+	}
+	b.d.Templating.List = []grafanaVariable{
+		{Name: "datasource", Label: "Data source", Type: "datasource", Query: "prometheus"},
+	}
+
+	for _, cfg := range cfgs {
+		hue, name, err := listBridge(ctx, cfg)
+		if err != nil {
+			return err
+		}
+
+		if err := dashboardBridge(ctx, b, hue, name); err != nil {
+			return fmt.Errorf("failed to build dashboard of bridge %q: %w", name, err)
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(b.d)
+}
+
+func dashboardBridge(ctx context.Context, b *dashboardBuilder, hue *hueclient.Client, bridge string) error {
+	lights, err := hue.GetLightsContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	groups, err := hue.GetGroupsContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	sensors, err := hue.GetSensorsContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[int]string, len(lights))
+	ids := make(map[int]string, len(lights))
+	for _, l := range lights {
+		names[l.ID] = l.Name
+		ids[l.ID] = deviceID(l.ID, l.UniqueID)
+	}
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	for _, g := range groups {
+		if g.Type != "Room" && g.Type != "Zone" {
+			continue
+		}
+
+		brightness := grafanaPanel{
+			Title:       "Brightness",
+			Type:        "timeseries",
+			FieldConfig: fieldConfig("percent", 0, 100),
+		}
+		for _, id := range g.Lights {
+			n, err := strconv.Atoi(id)
+			if err != nil {
+				continue
+			}
+
+			brightness.Targets = append(brightness.Targets, b.target("light_brightness_percent", bridge, ids[n], names[n]))
+		}
+
+		b.row(fmt.Sprintf("%s (%s)", g.Name, bridge))
+		b.panels(
+			brightness,
+			grafanaPanel{
+				Title:       "Any light on",
+				Type:        "state-timeline",
+				Targets:     []grafanaTarget{b.target("group_any_on", bridge, strconv.Itoa(g.ID), g.Name)},
+				FieldConfig: fieldConfig("bool_on_off", 0, 1),
+			},
+			grafanaPanel{
+				Title: "Lights on",
+				Type:  "stat",
+				Targets: []grafanaTarget{
+					b.target("group_lights_on_count", bridge, strconv.Itoa(g.ID), "on"),
+					b.target("group_lights_total", bridge, strconv.Itoa(g.ID), "total"),
+				},
+				FieldConfig: fieldConfig("none", 0, float64(len(g.Lights))),
+			},
+		)
+	}
+
+	sort.Slice(sensors, func(i, j int) bool { return sensors[i].Name < sensors[j].Name })
+
+	// graph temperatures in Fahrenheit only when Celsius isn't reported
+	tempMetric, temperature := "sensor_temperature_celsius", grafanaPanel{Title: "Temperature", Type: "timeseries", FieldConfig: fieldConfig("celsius", -10, 40)}
+	if *tempUnit == "fahrenheit" {
+		tempMetric, temperature.FieldConfig = "sensor_temperature_fahrenheit", fieldConfig("fahrenheit", 14, 104)
+	}
+	lightLevel := grafanaPanel{Title: "Light level", Type: "timeseries", FieldConfig: fieldConfig("lux", 0, 1000)}
+	battery := grafanaPanel{Title: "Battery", Type: "bargauge", FieldConfig: fieldConfig("percent", 0, 100)}
+	for _, s := range sensors {
+		switch s.Type {
+		case "ZLLTemperature":
+			temperature.Targets = append(temperature.Targets, b.target(tempMetric, bridge, deviceID(s.ID, s.UniqueID), s.Name))
+		case "ZLLLightLevel":
+			lightLevel.Targets = append(lightLevel.Targets, b.target("sensor_light_level_lux", bridge, deviceID(s.ID, s.UniqueID), s.Name))
+		}
+
+		if _, ok := s.Config["battery"].(float64); ok {
+			battery.Targets = append(battery.Targets, b.target("sensor_battery_percent", bridge, deviceID(s.ID, s.UniqueID), s.Name))
+		}
+	}
+
+	var panels []grafanaPanel
+	for _, p := range []grafanaPanel{temperature, lightLevel, battery} {
+		if len(p.Targets) > 0 {
+			panels = append(panels, p)
+		}
+	}
+
+	if len(panels) > 0 {
+		b.row(fmt.Sprintf("Sensors (%s)", bridge))
+		b.panels(panels...)
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	// DefaultCloudURL is the Hue cloud discovery service, it lists the
+	// bridges that recently checked in from the caller's public address.
+	DefaultCloudURL = "https://discovery.meethue.com"
+)
+
+// Cloud discovers bridges through the Hue cloud discovery service.
+type Cloud struct {
+	// URL overrides DefaultCloudURL.
+	URL string
+	// Client overrides http.DefaultClient.
+	Client *http.Client
+}
+
+func (c *Cloud) Discover(ctx context.Context) ([]Bridge, error) {
+	ctx, span := tracer.Start(ctx, "discovery.Cloud.Discover")
+	defer span.End()
+
+	url := c.URL
+	if url == "" {
+		url = DefaultCloudURL
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query discovery service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery service responded with %s", resp.Status)
+	}
+
+	var bridges []Bridge
+	if err := json.NewDecoder(resp.Body).Decode(&bridges); err != nil {
+		return nil, fmt.Errorf("failed to decode discovery response: %w", err)
+	}
+
+	return bridges, nil
+}
@@ -0,0 +1,63 @@
+package discovery
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCloud(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    []Bridge
+		wantErr bool
+	}{
+		{
+			name:   "bridges",
+			status: http.StatusOK,
+			body:   `[{"id":"001788fffe000001","internalipaddress":"192.168.1.2","port":443}]`,
+			want:   []Bridge{{ID: "001788fffe000001", Address: "192.168.1.2"}},
+		},
+		{
+			name:   "none",
+			status: http.StatusOK,
+			body:   `[]`,
+			want:   []Bridge{},
+		},
+		{
+			name:    "rate limited",
+			status:  http.StatusTooManyRequests,
+			wantErr: true,
+		},
+		{
+			name:    "malformed",
+			status:  http.StatusOK,
+			body:    `{"error"`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			c := &Cloud{URL: srv.URL, Client: srv.Client()}
+
+			got, err := c.Discover(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error: %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bridges: %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+)
+
+var (
+	tracer = otel.GetTracerProvider().Tracer("discovery")
+
+	// ErrNotFound is returned when no bridges could be located.
+	ErrNotFound = errors.New("no hue bridges were discovered")
+)
+
+// Bridge is a Hue bridge located on the network.
+type Bridge struct {
+	ID      string `json:"id"`
+	Address string `json:"internalipaddress"`
+}
+
+// Discoverer locates Hue bridges on the network.
+type Discoverer interface {
+	Discover(ctx context.Context) ([]Bridge, error)
+}
+
+// Chain tries each Discoverer in order, returning the bridges found by the
+// first one to locate any.
+type Chain []Discoverer
+
+func (c Chain) Discover(ctx context.Context) ([]Bridge, error) {
+	var errs []error
+	for _, d := range c {
+		bridges, err := d.Discover(ctx)
+		if err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		if len(bridges) > 0 {
+			return bridges, nil
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs[len(errs)-1]
+	}
+
+	return nil, ErrNotFound
+}
+
+// Default returns a Discoverer that searches the local network over mDNS
+// before falling back to the Hue cloud discovery service.
+func Default() Discoverer {
+	return Chain{
+		&MDNS{},
+		&Cloud{},
+	}
+}
@@ -0,0 +1,95 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// static is a Discoverer answering with fixed bridges or an error.
+type static struct {
+	bridges []Bridge
+	err     error
+	calls   int
+}
+
+func (s *static) Discover(context.Context) ([]Bridge, error) {
+	s.calls++
+
+	return s.bridges, s.err
+}
+
+func TestChain(t *testing.T) {
+	errFailed := errors.New("failed")
+	found := []Bridge{{ID: "001788fffe000001", Address: "192.168.1.2"}}
+
+	tests := []struct {
+		name    string
+		chain   []*static
+		want    []Bridge
+		wantErr error
+		// calls is how many Discoverers in the chain should be consulted
+		calls int
+	}{
+		{
+			name:  "first finds",
+			chain: []*static{{bridges: found}, {}},
+			want:  found,
+			calls: 1,
+		},
+		{
+			name:  "falls back after nothing found",
+			chain: []*static{{}, {bridges: found}},
+			want:  found,
+			calls: 2,
+		},
+		{
+			name:  "falls back after error",
+			chain: []*static{{err: errFailed}, {bridges: found}},
+			want:  found,
+			calls: 2,
+		},
+		{
+			name:    "nothing found",
+			chain:   []*static{{}, {}},
+			wantErr: ErrNotFound,
+			calls:   2,
+		},
+		{
+			name:    "last error",
+			chain:   []*static{{err: errors.New("other")}, {err: errFailed}},
+			wantErr: errFailed,
+			calls:   2,
+		},
+		{
+			name:    "empty",
+			wantErr: ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Chain
+			for _, d := range tt.chain {
+				c = append(c, d)
+			}
+
+			got, err := c.Discover(context.Background())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error: %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bridges: %v, want %v", got, tt.want)
+			}
+
+			var calls int
+			for _, d := range tt.chain {
+				calls += d.calls
+			}
+			if calls != tt.calls {
+				t.Errorf("consulted %d discoverers, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	hueService = "_hue._tcp.local."
+
+	defaultMDNSTimeout = time.Second * 3
+)
+
+var (
+	mdnsAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+)
+
+// MDNS discovers bridges advertising the `_hue._tcp` service on the local
+// network.
+type MDNS struct {
+	// Timeout bounds how long responses are collected for, defaults to three
+	// seconds.
+	Timeout time.Duration
+}
+
+func (m *MDNS) Discover(ctx context.Context) ([]Bridge, error) {
+	ctx, span := tracer.Start(ctx, "discovery.MDNS.Discover")
+	defer span.End()
+
+	timeout := m.Timeout
+	if timeout == 0 {
+		timeout = defaultMDNSTimeout
+	}
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mdns socket: %w", err)
+	}
+	defer conn.Close()
+
+	query, err := mdnsQuery()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.WriteToUDP(query, mdnsAddr); err != nil {
+		return nil, fmt.Errorf("failed to send mdns query: %w", err)
+	}
+
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	found := map[string]Bridge{}
+	buf := make([]byte, 65536)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var nerr net.Error
+			if errors.As(err, &nerr) && nerr.Timeout() {
+				break
+			}
+
+			return nil, fmt.Errorf("failed to read mdns response: %w", err)
+		}
+
+		b, ok := parseMDNSResponse(buf[:n])
+		if !ok {
+			continue
+		}
+
+		if b.Address == "" {
+			b.Address = from.IP.String()
+		}
+
+		found[b.Address] = b
+	}
+
+	bridges := make([]Bridge, 0, len(found))
+	for _, b := range found {
+		bridges = append(bridges, b)
+	}
+
+	return bridges, nil
+}
+
+func mdnsQuery() ([]byte, error) {
+	name, err := dnsmessage.NewName(hueService)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := dnsmessage.Message{
+		Questions: []dnsmessage.Question{
+			{
+				Name:  name,
+				Type:  dnsmessage.TypePTR,
+				Class: dnsmessage.ClassINET,
+			},
+		},
+	}
+
+	return msg.Pack()
+}
+
+// parseMDNSResponse extracts the bridge address and identifier from an mDNS
+// answer, reporting false for answers unrelated to the Hue service.
+func parseMDNSResponse(data []byte) (Bridge, bool) {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(data); err != nil {
+		return Bridge{}, false
+	}
+
+	var (
+		b     Bridge
+		isHue bool
+	)
+
+	records := append(msg.Answers, msg.Additionals...)
+	for _, r := range records {
+		switch body := r.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if strings.EqualFold(r.Header.Name.String(), hueService) {
+				isHue = true
+			}
+		case *dnsmessage.AResource:
+			b.Address = net.IP(body.A[:]).String()
+		case *dnsmessage.TXTResource:
+			for _, txt := range body.TXT {
+				if strings.HasPrefix(txt, "bridgeid=") {
+					b.ID = strings.TrimPrefix(txt, "bridgeid=")
+				}
+			}
+		}
+	}
+
+	return b, isHue
+}
@@ -0,0 +1,83 @@
+package discovery
+
+import (
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestParseMDNSResponse(t *testing.T) {
+	hue := dnsmessage.MustNewName(hueService)
+	instance := dnsmessage.MustNewName("Hue Bridge - 000001._hue._tcp.local.")
+	host := dnsmessage.MustNewName("001788000001.local.")
+	other := dnsmessage.MustNewName("_googlecast._tcp.local.")
+
+	ptr := func(name dnsmessage.Name) dnsmessage.Resource {
+		return dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET},
+			Body:   &dnsmessage.PTRResource{PTR: instance},
+		}
+	}
+	txt := dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: instance, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET},
+		Body:   &dnsmessage.TXTResource{TXT: []string{"modelid=BSB002", "bridgeid=001788fffe000001"}},
+	}
+	a := dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: host, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET},
+		Body:   &dnsmessage.AResource{A: [4]byte{192, 168, 1, 2}},
+	}
+
+	tests := []struct {
+		name        string
+		answers     []dnsmessage.Resource
+		additionals []dnsmessage.Resource
+		want        Bridge
+		ok          bool
+	}{
+		{
+			name:        "bridge",
+			answers:     []dnsmessage.Resource{ptr(hue)},
+			additionals: []dnsmessage.Resource{txt, a},
+			want:        Bridge{ID: "001788fffe000001", Address: "192.168.1.2"},
+			ok:          true,
+		},
+		{
+			name:    "no address",
+			answers: []dnsmessage.Resource{ptr(hue), txt},
+			want:    Bridge{ID: "001788fffe000001"},
+			ok:      true,
+		},
+		{
+			name:        "other service",
+			answers:     []dnsmessage.Resource{ptr(other)},
+			additionals: []dnsmessage.Resource{a},
+			want:        Bridge{Address: "192.168.1.2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := dnsmessage.Message{
+				Header:      dnsmessage.Header{Response: true, Authoritative: true},
+				Answers:     tt.answers,
+				Additionals: tt.additionals,
+			}
+			data, err := msg.Pack()
+			if err != nil {
+				t.Fatalf("failed to pack response: %v", err)
+			}
+
+			got, ok := parseMDNSResponse(data)
+			if ok != tt.ok {
+				t.Errorf("hue response: %v, want %v", ok, tt.ok)
+			}
+			if got != tt.want {
+				t.Errorf("bridge: %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, ok := parseMDNSResponse([]byte("garbage")); ok {
+		t.Error("garbage was parsed as a hue response")
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ninnemana/hue-exporter/collector"
+)
+
+// mapFlag collects repeated key=value flags into a map.
+type mapFlag map[string]string
+
+func (m mapFlag) String() string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ",")
+}
+
+func (m mapFlag) Set(v string) error {
+	kv := strings.SplitN(v, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("expected key=value, got %q", v)
+	}
+
+	m[kv[0]] = kv[1]
+
+	return nil
+}
+
+// envOr returns the value of the environment variable, or def when unset.
+func envOr(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+
+	return def
+}
+
+// envFloat returns the value of the environment variable parsed as a float,
+// or def when unset or invalid.
+func envFloat(key string, def float64) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return def
+	}
+
+	return v
+}
+
+// temperatureUnits parses the units temperatures are reported in, either
+// celsius, fahrenheit or both.
+func temperatureUnits(v string) ([]collector.TemperatureUnit, error) {
+	switch v {
+	case "celsius":
+		return []collector.TemperatureUnit{collector.Celsius}, nil
+	case "fahrenheit":
+		return []collector.TemperatureUnit{collector.Fahrenheit}, nil
+	case "both":
+		return []collector.TemperatureUnit{collector.Celsius, collector.Fahrenheit}, nil
+	default:
+		return nil, fmt.Errorf("expected celsius, fahrenheit or both, got %q", v)
+	}
+}
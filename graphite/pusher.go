@@ -0,0 +1,211 @@
+// Package graphite pushes the collected metrics to a Graphite carbon
+// receiver in its plaintext protocol, for stacks without Prometheus.
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ninnemana/hue-exporter/series"
+	"github.com/ninnemana/tracelog"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultTemplate places the metric name under the hue prefix, labels
+	// it doesn't reference are appended as <label>.<value>.
+	DefaultTemplate = "hue.{name}"
+
+	// dialTimeout bounds connecting to carbon and writing each push.
+	dialTimeout = time.Second * 10
+)
+
+var (
+	// ErrInvalidLogger is returned when the pusher is created without a
+	// logger.
+	ErrInvalidLogger = errors.New("a logger is required to push to graphite")
+
+	// ErrInvalidGatherer is returned when the pusher is created without a
+	// gatherer to read metrics from.
+	ErrInvalidGatherer = errors.New("a gatherer is required to push to graphite")
+
+	placeholder = regexp.MustCompile(`\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+	unsafe      = regexp.MustCompile(`[^a-zA-Z0-9_\-:]`)
+)
+
+// Pusher writes every series of a gatherer to carbon on an interval, one
+// line of <path> <value> <timestamp> per series.
+//
+// Paths are rendered from a template of dot separated nodes, where {name}
+// is replaced with the metric name and {<label>} with the value of the
+// label, e.g. hue.{bridge}.{name}. Labels the template doesn't reference are
+// appended to the path as <label>.<value> in name order so series stay
+// distinct.
+type Pusher struct {
+	log      *tracelog.TraceLogger
+	addr     string
+	gatherer prometheus.Gatherer
+	template string
+	interval time.Duration
+}
+
+type Option func(*Pusher)
+
+func WithLogger(l *tracelog.TraceLogger) Option {
+	return func(p *Pusher) {
+		p.log = l
+	}
+}
+
+// WithGatherer sets the registry metrics are read from.
+func WithGatherer(g prometheus.Gatherer) Option {
+	return func(p *Pusher) {
+		p.gatherer = g
+	}
+}
+
+// WithTemplate sets the template metric paths are rendered from, defaults to
+// DefaultTemplate.
+func WithTemplate(t string) Option {
+	return func(p *Pusher) {
+		p.template = t
+	}
+}
+
+// WithInterval sets how often metrics are pushed, defaults to a minute.
+func WithInterval(d time.Duration) Option {
+	return func(p *Pusher) {
+		p.interval = d
+	}
+}
+
+// New creates a pusher to the carbon plaintext receiver at addr, given as
+// host:port.
+func New(addr string, opts ...Option) (*Pusher, error) {
+	p := &Pusher{
+		addr:     addr,
+		template: DefaultTemplate,
+		interval: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if p.log == nil {
+		return nil, ErrInvalidLogger
+	}
+
+	if p.gatherer == nil {
+		return nil, ErrInvalidGatherer
+	}
+
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid carbon address %q: %w", addr, err)
+	}
+
+	return p, nil
+}
+
+// Run pushes the metrics on every interval until ctx is done. Failed pushes
+// are logged and retried on the next interval.
+func (p *Pusher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if err := p.Push(ctx, now); err != nil {
+				p.log.Error("failed to push metrics to graphite", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Push writes the current value of every series to carbon, timestamped
+// with now.
+func (p *Pusher) Push(ctx context.Context, now time.Time) error {
+	samples, err := series.Gather(p.gatherer)
+	if err != nil {
+		return err
+	}
+
+	d := net.Dialer{Timeout: dialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", p.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to carbon: %w", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetWriteDeadline(time.Now().Add(dialTimeout)); err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(conn)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	for _, s := range samples {
+		if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+			continue
+		}
+
+		if _, err := fmt.Fprintf(w, "%s %s %s\n", p.path(s.Name, s.Labels), strconv.FormatFloat(s.Value, 'f', -1, 64), ts); err != nil {
+			return fmt.Errorf("failed to write metrics: %w", err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+
+	return nil
+}
+
+// path renders the template for the series.
+func (p *Pusher) path(name string, labels map[string]string) string {
+	used := map[string]bool{}
+	path := placeholder.ReplaceAllStringFunc(p.template, func(m string) string {
+		key := m[1 : len(m)-1]
+		if key == "name" {
+			return node(name)
+		}
+
+		used[key] = true
+
+		return node(labels[key])
+	})
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		if !used[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	nodes := []string{path}
+	for _, k := range keys {
+		nodes = append(nodes, node(k), node(labels[k]))
+	}
+
+	// labels missing from the series leave empty nodes behind
+	return strings.Join(strings.FieldsFunc(strings.Join(nodes, "."), func(r rune) bool {
+		return r == '.'
+	}), ".")
+}
+
+// node replaces the characters carbon treats as separators or can't store.
+func node(s string) string {
+	return unsafe.ReplaceAllString(s, "_")
+}
@@ -0,0 +1,137 @@
+package graphite
+
+import (
+	"context"
+	"io"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ninnemana/tracelog"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var testLogger = tracelog.NewLogger(tracelog.WithLogger(zap.NewNop()))
+
+func newTestPusher(t *testing.T, addr string, reg prometheus.Gatherer, opts ...Option) *Pusher {
+	t.Helper()
+
+	opts = append([]Option{
+		WithLogger(testLogger),
+		WithGatherer(reg),
+	}, opts...)
+
+	p, err := New(addr, opts...)
+	if err != nil {
+		t.Fatalf("failed to create pusher: %v", err)
+	}
+
+	return p
+}
+
+func TestNew(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	if _, err := New("localhost:2003", WithGatherer(reg)); err != ErrInvalidLogger {
+		t.Errorf("without logger: %v, want %v", err, ErrInvalidLogger)
+	}
+
+	if _, err := New("localhost:2003", WithLogger(testLogger)); err != ErrInvalidGatherer {
+		t.Errorf("without gatherer: %v, want %v", err, ErrInvalidGatherer)
+	}
+
+	if _, err := New("localhost", WithLogger(testLogger), WithGatherer(reg)); err == nil {
+		t.Error("created a pusher without a port")
+	}
+}
+
+func TestPath(t *testing.T) {
+	labels := map[string]string{"bridge": "Office", "name": "Desk Lamp", "room": "Study.1"}
+
+	tests := []struct {
+		name     string
+		template string
+		labels   map[string]string
+		want     string
+	}{
+		{
+			name:   "default",
+			labels: labels,
+			want:   "hue.hue_light_brightness.bridge.Office.name.Desk_Lamp.room.Study_1",
+		},
+		{
+			name:     "labels in template",
+			template: "hue.{bridge}.{room}.{name}",
+			labels:   labels,
+			want:     "hue.Office.Study_1.hue_light_brightness.name.Desk_Lamp",
+		},
+		{
+			name:     "missing label",
+			template: "hue.{zone}.{name}",
+			labels:   map[string]string{"bridge": "Office"},
+			want:     "hue.hue_light_brightness.bridge.Office",
+		},
+		{
+			name: "no labels",
+			want: "hue.hue_light_brightness",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []Option
+			if tt.template != "" {
+				opts = append(opts, WithTemplate(tt.template))
+			}
+			p := newTestPusher(t, "localhost:2003", prometheus.NewRegistry(), opts...)
+
+			if got := p.path("hue_light_brightness", tt.labels); got != tt.want {
+				t.Errorf("path: %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPush(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			received <- ""
+
+			return
+		}
+		defer conn.Close()
+
+		b, _ := io.ReadAll(conn)
+		received <- string(b)
+	}()
+
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "hue_sensor_temperature"}, []string{"name"})
+	g.WithLabelValues("Kitchen").Set(21.5)
+	g.WithLabelValues("Hallway").Set(math.NaN())
+	reg.MustRegister(g)
+
+	p := newTestPusher(t, l.Addr().String(), reg, WithTemplate("hue.{name}"))
+	if err := p.Push(context.Background(), time.Unix(1600000000, 0)); err != nil {
+		t.Fatalf("failed to push: %v", err)
+	}
+
+	select {
+	case got := <-received:
+		if want := "hue.hue_sensor_temperature.name.Kitchen 21.5 1600000000\n"; got != want {
+			t.Errorf("pushed %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("carbon never received the push")
+	}
+}
@@ -0,0 +1,399 @@
+// Package history records snapshots of the collected state in an embedded
+// SQLite database, keeping a window of light and sensor history for setups
+// without a time series database.
+package history
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ninnemana/hue-exporter/collector"
+	"github.com/ninnemana/tracelog"
+	"go.uber.org/zap"
+
+	// registers the pure Go sqlite driver, so the exporter builds without
+	// cgo
+	_ "modernc.org/sqlite"
+)
+
+const (
+	// defaultRetention is how long snapshots are kept, a week.
+	defaultRetention = time.Hour * 24 * 7
+
+	// defaultWindow is the history returned when a query doesn't bound it.
+	defaultWindow = time.Hour * 24
+
+	schema = `
+CREATE TABLE IF NOT EXISTS light_states (
+	time      INTEGER NOT NULL,
+	bridge    TEXT    NOT NULL,
+	id        INTEGER NOT NULL,
+	name      TEXT    NOT NULL,
+	on_state  INTEGER NOT NULL,
+	bri       INTEGER NOT NULL,
+	reachable INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS light_states_time ON light_states (time);
+CREATE TABLE IF NOT EXISTS sensor_readings (
+	time   INTEGER NOT NULL,
+	bridge TEXT    NOT NULL,
+	id     INTEGER NOT NULL,
+	name   TEXT    NOT NULL,
+	type   TEXT    NOT NULL,
+	state  TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS sensor_readings_time ON sensor_readings (time);
+`
+)
+
+var (
+	// ErrInvalidLogger is returned when the store is opened without a
+	// logger.
+	ErrInvalidLogger = errors.New("a logger is required to record history")
+
+	// ErrUnknownResource is returned when history is queried for a
+	// resource which isn't recorded.
+	ErrUnknownResource = errors.New("unknown resource, expected lights or sensors")
+)
+
+// Store records the state of every light and sensor on an interval,
+// dropping snapshots older than the retention.
+type Store struct {
+	log       *tracelog.TraceLogger
+	db        *sql.DB
+	interval  time.Duration
+	retention time.Duration
+}
+
+type Option func(*Store)
+
+func WithLogger(l *tracelog.TraceLogger) Option {
+	return func(s *Store) {
+		s.log = l
+	}
+}
+
+// WithInterval sets how often a snapshot is recorded, defaults to a minute.
+func WithInterval(d time.Duration) Option {
+	return func(s *Store) {
+		s.interval = d
+	}
+}
+
+// WithRetention sets how long snapshots are kept, defaults to a week.
+func WithRetention(d time.Duration) Option {
+	return func(s *Store) {
+		s.retention = d
+	}
+}
+
+// Open opens the database at path, creating it when it doesn't exist.
+func Open(path string, opts ...Option) (*Store, error) {
+	s := &Store{
+		interval:  time.Minute,
+		retention: defaultRetention,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.log == nil {
+		return nil, ErrInvalidLogger
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database: %w", err)
+	}
+
+	// sqlite serializes writes, a single connection avoids busy errors
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+
+		return nil, fmt.Errorf("failed to create history schema: %w", err)
+	}
+
+	s.db = db
+
+	return s, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Run records a snapshot of the state collected by c on every interval
+// until ctx is done.
+func (s *Store) Run(ctx context.Context, c collector.Collector) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if err := s.Record(ctx, c.State(), now); err != nil {
+				s.log.Error("failed to record history", zap.Error(err))
+			}
+
+			if err := s.Prune(ctx, now.Add(-s.retention)); err != nil {
+				s.log.Error("failed to prune history", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Record stores the state of every light and sensor at now.
+func (s *Store) Record(ctx context.Context, st collector.State, now time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // a no-op once committed
+
+	ts := now.Unix()
+	for _, b := range st.Bridges {
+		for _, l := range b.Lights {
+			if l.State == nil {
+				continue
+			}
+
+			if _, err := tx.ExecContext(
+				ctx,
+				`INSERT INTO light_states (time, bridge, id, name, on_state, bri, reachable) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				ts, b.Name, l.ID, l.Name, l.State.On, l.State.Bri, l.State.Reachable,
+			); err != nil {
+				return fmt.Errorf("failed to record light %d: %w", l.ID, err)
+			}
+		}
+
+		for _, sn := range b.Sensors {
+			state, err := json.Marshal(sn.State)
+			if err != nil {
+				return fmt.Errorf("failed to encode sensor %d: %w", sn.ID, err)
+			}
+
+			if _, err := tx.ExecContext(
+				ctx,
+				`INSERT INTO sensor_readings (time, bridge, id, name, type, state) VALUES (?, ?, ?, ?, ?, ?)`,
+				ts, b.Name, sn.ID, sn.Name, sn.Type, string(state),
+			); err != nil {
+				return fmt.Errorf("failed to record sensor %d: %w", sn.ID, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit history: %w", err)
+	}
+
+	return nil
+}
+
+// Prune deletes snapshots recorded before the cutoff.
+func (s *Store) Prune(ctx context.Context, before time.Time) error {
+	for _, table := range []string{"light_states", "sensor_readings"} {
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM `+table+` WHERE time < ?`, before.Unix()); err != nil {
+			return fmt.Errorf("failed to prune %s: %w", table, err)
+		}
+	}
+
+	return nil
+}
+
+// LightState is the recorded state of a light.
+type LightState struct {
+	Time      time.Time `json:"time"`
+	Bridge    string    `json:"bridge"`
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	On        bool      `json:"on"`
+	Bri       uint8     `json:"bri"`
+	Reachable bool      `json:"reachable"`
+}
+
+// SensorReading is the recorded state of a sensor.
+type SensorReading struct {
+	Time   time.Time       `json:"time"`
+	Bridge string          `json:"bridge"`
+	ID     int             `json:"id"`
+	Name   string          `json:"name"`
+	Type   string          `json:"type"`
+	State  json.RawMessage `json:"state"`
+}
+
+// Query selects the history recorded between since and until, optionally
+// filtered by bridge and identifier.
+type Query struct {
+	Bridge string
+	ID     int
+	Since  time.Time
+	Until  time.Time
+}
+
+func (q Query) where() (string, []interface{}) {
+	clause := `time >= ? AND time <= ?`
+	args := []interface{}{q.Since.Unix(), q.Until.Unix()}
+	if q.Bridge != "" {
+		clause += ` AND bridge = ?`
+		args = append(args, q.Bridge)
+	}
+
+	if q.ID != 0 {
+		clause += ` AND id = ?`
+		args = append(args, q.ID)
+	}
+
+	return clause, args
+}
+
+// Lights returns the recorded light states matching the query, oldest
+// first.
+func (s *Store) Lights(ctx context.Context, q Query) ([]LightState, error) {
+	where, args := q.where()
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT time, bridge, id, name, on_state, bri, reachable FROM light_states WHERE `+where+` ORDER BY time, bridge, id`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query light history: %w", err)
+	}
+	defer rows.Close()
+
+	out := []LightState{}
+	for rows.Next() {
+		var (
+			l  LightState
+			ts int64
+		)
+		if err := rows.Scan(&ts, &l.Bridge, &l.ID, &l.Name, &l.On, &l.Bri, &l.Reachable); err != nil {
+			return nil, fmt.Errorf("failed to read light history: %w", err)
+		}
+
+		l.Time = time.Unix(ts, 0).UTC()
+		out = append(out, l)
+	}
+
+	return out, rows.Err()
+}
+
+// Sensors returns the recorded sensor readings matching the query, oldest
+// first.
+func (s *Store) Sensors(ctx context.Context, q Query) ([]SensorReading, error) {
+	where, args := q.where()
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT time, bridge, id, name, type, state FROM sensor_readings WHERE `+where+` ORDER BY time, bridge, id`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sensor history: %w", err)
+	}
+	defer rows.Close()
+
+	out := []SensorReading{}
+	for rows.Next() {
+		var (
+			r     SensorReading
+			ts    int64
+			state string
+		)
+		if err := rows.Scan(&ts, &r.Bridge, &r.ID, &r.Name, &r.Type, &state); err != nil {
+			return nil, fmt.Errorf("failed to read sensor history: %w", err)
+		}
+
+		r.Time = time.Unix(ts, 0).UTC()
+		r.State = json.RawMessage(state)
+		out = append(out, r)
+	}
+
+	return out, rows.Err()
+}
+
+// Handler serves the recorded history as JSON. The resource is selected with
+// the resource parameter, either lights or sensors, and filtered with the
+// bridge, id, since and until parameters, the latter two as RFC 3339 times.
+// Without bounds the last day of history is returned.
+func (s *Store) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		q, err := parseQuery(r, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		var res interface{}
+		switch resource := r.URL.Query().Get("resource"); resource {
+		case "", "lights":
+			res, err = s.Lights(r.Context(), q)
+		case "sensors":
+			res, err = s.Sensors(r.Context(), q)
+		default:
+			http.Error(w, ErrUnknownResource.Error(), http.StatusBadRequest)
+
+			return
+		}
+		if err != nil {
+			s.log.Error("failed to query history", zap.Error(err))
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+func parseQuery(r *http.Request, now time.Time) (Query, error) {
+	params := r.URL.Query()
+	q := Query{
+		Bridge: params.Get("bridge"),
+		Since:  now.Add(-defaultWindow),
+		Until:  now,
+	}
+
+	if v := params.Get("id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return q, fmt.Errorf("invalid id %q", v)
+		}
+		q.ID = id
+	}
+
+	for name, t := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		v := params.Get(name)
+		if v == "" {
+			continue
+		}
+
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return q, fmt.Errorf("invalid %s %q, expected an RFC 3339 time", name, v)
+		}
+		*t = parsed
+	}
+
+	return q, nil
+}
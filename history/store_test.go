@@ -0,0 +1,212 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ninnemana/hue-exporter/collector"
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"github.com/ninnemana/tracelog"
+	"go.uber.org/zap"
+)
+
+var testLogger = tracelog.NewLogger(tracelog.WithLogger(zap.NewNop()))
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	s, err := Open(filepath.Join(t.TempDir(), "history.db"), WithLogger(testLogger))
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	t.Cleanup(func() {
+		s.Close()
+	})
+
+	return s
+}
+
+func testState(bri uint8) collector.State {
+	return collector.State{Bridges: []collector.BridgeState{
+		{
+			Name: "Office",
+			Lights: []collector.Light{
+				{ID: 1, Light: hueclient.Light{Name: "Desk", State: &hueclient.State{On: true, Bri: bri, Reachable: true}}},
+				// lights which haven't reported a state aren't recorded
+				{ID: 2, Light: hueclient.Light{Name: "Shelf"}},
+			},
+			Sensors: []collector.Sensor{
+				{ID: 4, Sensor: hueclient.Sensor{Name: "Hallway", Type: "ZLLTemperature", State: map[string]interface{}{"temperature": float64(2150)}}},
+			},
+		},
+		{
+			Name: "Home",
+			Lights: []collector.Light{
+				{ID: 1, Light: hueclient.Light{Name: "Porch", State: &hueclient.State{Bri: bri}}},
+			},
+		},
+	}}
+}
+
+func TestOpen(t *testing.T) {
+	if _, err := Open(filepath.Join(t.TempDir(), "history.db")); err != ErrInvalidLogger {
+		t.Errorf("without logger: %v, want %v", err, ErrInvalidLogger)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	start := time.Unix(1600000000, 0).UTC()
+	for i := 0; i < 3; i++ {
+		if err := s.Record(ctx, testState(uint8(i+1)), start.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatalf("failed to record: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		q    Query
+		// want are the brightness of the matching light states
+		want []uint8
+	}{
+		{
+			name: "everything",
+			q:    Query{Since: start, Until: start.Add(time.Hour)},
+			want: []uint8{1, 1, 2, 2, 3, 3},
+		},
+		{
+			name: "bridge",
+			q:    Query{Bridge: "Office", Since: start, Until: start.Add(time.Hour)},
+			want: []uint8{1, 2, 3},
+		},
+		{
+			name: "window",
+			q:    Query{Since: start.Add(time.Minute), Until: start.Add(time.Minute)},
+			want: []uint8{2, 2},
+		},
+		{
+			name: "unknown light",
+			q:    Query{ID: 2, Since: start, Until: start.Add(time.Hour)},
+			want: []uint8{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lights, err := s.Lights(ctx, tt.q)
+			if err != nil {
+				t.Fatalf("failed to query lights: %v", err)
+			}
+
+			got := make([]uint8, 0, len(lights))
+			for _, l := range lights {
+				got = append(got, l.Bri)
+			}
+			if string(got) != string(tt.want) {
+				t.Errorf("brightness: %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	readings, err := s.Sensors(ctx, Query{ID: 4, Since: start, Until: start})
+	if err != nil {
+		t.Fatalf("failed to query sensors: %v", err)
+	}
+	if len(readings) != 1 {
+		t.Fatalf("got %d readings, want 1", len(readings))
+	}
+	if r := readings[0]; r.Name != "Hallway" || r.Type != "ZLLTemperature" || string(r.State) != `{"temperature":2150}` || !r.Time.Equal(start) {
+		t.Errorf("reading: %+v", r)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t)
+
+	start := time.Unix(1600000000, 0)
+	for i := 0; i < 3; i++ {
+		if err := s.Record(ctx, testState(uint8(i+1)), start.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("failed to record: %v", err)
+		}
+	}
+
+	if err := s.Prune(ctx, start.Add(2*time.Hour)); err != nil {
+		t.Fatalf("failed to prune: %v", err)
+	}
+
+	q := Query{Since: start, Until: start.Add(time.Hour * 24)}
+	lights, err := s.Lights(ctx, q)
+	if err != nil {
+		t.Fatalf("failed to query lights: %v", err)
+	}
+	if len(lights) != 2 || lights[0].Bri != 3 {
+		t.Errorf("kept %+v, want the last snapshot", lights)
+	}
+
+	readings, err := s.Sensors(ctx, q)
+	if err != nil {
+		t.Fatalf("failed to query sensors: %v", err)
+	}
+	if len(readings) != 1 {
+		t.Errorf("kept %d readings, want 1", len(readings))
+	}
+}
+
+func TestHandler(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.Record(context.Background(), testState(127), time.Now()); err != nil {
+		t.Fatalf("failed to record: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		status int
+		// results is the number of entries returned
+		results int
+	}{
+		{name: "lights", target: "/?bridge=Office", status: http.StatusOK, results: 1},
+		{name: "sensors", target: "/?resource=sensors", status: http.StatusOK, results: 1},
+		{name: "before window", target: "/?until=2020-01-01T00:00:00Z", status: http.StatusOK},
+		{name: "unknown resource", target: "/?resource=scenes", status: http.StatusBadRequest},
+		{name: "invalid id", target: "/?id=desk", status: http.StatusBadRequest},
+		{name: "invalid time", target: "/?since=yesterday", status: http.StatusBadRequest},
+		{name: "method", method: http.MethodPost, target: "/", status: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, httptest.NewRequest(method, tt.target, nil))
+
+			if rec.Code != tt.status {
+				t.Fatalf("status: %d, want %d", rec.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var res []json.RawMessage
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(res) != tt.results {
+				t.Errorf("got %d results, want %d", len(res), tt.results)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+// Package hueclient talks to the v1 API of a Hue bridge. Its models mirror
+// those of huego, which it replaces, so they can be swapped one for the
+// other, while requests take a context and are sent through a configurable
+// client. The CLIP v2 API is modelled by the clipv2 package, reached
+// through V2.
+package hueclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/ninnemana/hue-exporter/clipv2"
+)
+
+// Client requests the v1 API of a single Hue bridge.
+type Client struct {
+	// mu guards host, the bridge address, which may be updated through
+	// SetHost between requests when the bridge is rediscovered.
+	mu   sync.RWMutex
+	host string
+
+	User string
+
+	http *http.Client
+}
+
+type Option func(*Client)
+
+// WithHTTPClient overrides the client requests are sent through, e.g. to
+// route them through a proxy or the Hue remote API.
+func WithHTTPClient(c *http.Client) Option {
+	return func(cl *Client) {
+		cl.http = c
+	}
+}
+
+// WithTransport sends requests through the given transport, e.g. to
+// instrument them or serve them from a fake bridge.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(cl *Client) {
+		cl.http = &http.Client{Transport: rt}
+	}
+}
+
+// New returns a client for the bridge at host, authorized as user. The
+// user may be empty to create one through CreateUserContext.
+func New(host, user string, opts ...Option) *Client {
+	c := &Client{
+		host: host,
+		User: user,
+		http: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// Host returns the address of the bridge.
+func (c *Client) Host() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.host
+}
+
+// SetHost updates the address requests are sent to, e.g. once the bridge
+// is rediscovered. Requests already sent are unaffected.
+func (c *Client) SetHost(host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.host = host
+}
+
+// V2 returns a client for the CLIP v2 API of the same bridge.
+func (c *Client) V2(opts ...clipv2.Option) *clipv2.Client {
+	return clipv2.New(c.Host(), c.User, opts...)
+}
+
+// APIError is an error reported by the bridge in place of a response.
+type APIError struct {
+	Type        int    `json:"type"`
+	Address     string `json:"address"`
+	Description string `json:"description"`
+}
+
+func (a *APIError) Error() string {
+	return fmt.Sprintf("ERROR %d [%s]: %q", a.Type, a.Address, a.Description)
+}
+
+// StatusError is returned for requests the bridge failed with a status other
+// than 200 OK.
+type StatusError struct {
+	Code   int
+	Status string
+}
+
+func (e *StatusError) Error() string {
+	return "unexpected response: " + e.Status
+}
+
+// APIResponse is a single entry of the list the bridge responds to changes
+// with, holding either the changed values or an error.
+type APIResponse struct {
+	Success map[string]interface{} `json:"success,omitempty"`
+	Error   *APIError              `json:"error,omitempty"`
+}
+
+// Get fetches a path under the API of the user and decodes it into v, the
+// empty path fetching the full datastore. Errors the bridge reports in
+// place of the resource are returned as a *APIError.
+func (c *Client) Get(ctx context.Context, path string, v interface{}) error {
+	body, err := c.do(ctx, http.MethodGet, c.User+"/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", path, err)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		// the bridge responds with a list of errors, e.g. for an
+		// unauthorized user
+		if err := responseError(body); err != nil {
+			return err
+		}
+
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// Put sends body encoded as JSON to a path under the API of the user, as
+// Post does.
+func (c *Client) Put(ctx context.Context, path string, body interface{}) ([]APIResponse, error) {
+	return c.send(ctx, http.MethodPut, path, body)
+}
+
+// Post sends body encoded as JSON to a path under the API of the user,
+// returning the entries of the response. The first error the bridge
+// reports in the response is returned as a *APIError.
+func (c *Client) Post(ctx context.Context, path string, body interface{}) ([]APIResponse, error) {
+	return c.send(ctx, http.MethodPost, path, body)
+}
+
+// CreateUserContext creates a user identified by deviceType, which the
+// bridge only allows while its link button is pressed. It returns the
+// generated username.
+func (c *Client) CreateUserContext(ctx context.Context, deviceType string) (string, error) {
+	req := struct {
+		DeviceType string `json:"devicetype"`
+	}{deviceType}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := c.do(ctx, http.MethodPost, "", data)
+	if err != nil {
+		return "", fmt.Errorf("failed to create user: %w", err)
+	}
+
+	if err := responseError(body); err != nil {
+		return "", err
+	}
+
+	var res []struct {
+		Success struct {
+			Username string `json:"username"`
+		} `json:"success"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return "", fmt.Errorf("failed to decode user: %w", err)
+	}
+
+	for _, r := range res {
+		if r.Success.Username != "" {
+			return r.Success.Username, nil
+		}
+	}
+
+	return "", fmt.Errorf("failed to create user: no username in response")
+}
+
+// send sends body, if any, to a path under the API of the user.
+func (c *Client) send(ctx context.Context, method, path string, body interface{}) ([]APIResponse, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := c.do(ctx, method, c.User+"/"+strings.TrimPrefix(path, "/"), data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send %s: %w", path, err)
+	}
+
+	var res []APIResponse
+	if err := json.Unmarshal(resp, &res); err != nil {
+		return nil, fmt.Errorf("failed to decode response to %s: %w", path, err)
+	}
+
+	for _, r := range res {
+		if r.Error != nil {
+			return res, r.Error
+		}
+	}
+
+	return res, nil
+}
+
+// do sends a request for the path under /api and returns the response body.
+func (c *Client) do(ctx context.Context, method, path string, data []byte) ([]byte, error) {
+	host := c.Host()
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		host = "http://" + host
+	}
+
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		method,
+		strings.TrimSuffix(strings.TrimSuffix(host, "/")+"/api/"+path, "/"),
+		body,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// responseError returns the first error of a response holding a list of
+// them, nil for any other response.
+func responseError(body []byte) error {
+	var res []APIResponse
+	if json.Unmarshal(body, &res) != nil {
+		return nil
+	}
+
+	for _, r := range res {
+		if r.Error != nil {
+			return r.Error
+		}
+	}
+
+	return nil
+}
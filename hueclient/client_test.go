@@ -0,0 +1,211 @@
+package hueclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/ninnemana/hue-exporter/collector/huetest"
+	"github.com/ninnemana/hue-exporter/hueclient"
+)
+
+func TestGetLights(t *testing.T) {
+	s := huetest.NewServer()
+	defer s.Close()
+
+	lights, err := s.Bridge().GetLightsContext(context.Background())
+	if err != nil {
+		t.Fatalf("failed to fetch lights: %v", err)
+	}
+	sort.Slice(lights, func(i, j int) bool { return lights[i].ID < lights[j].ID })
+
+	if len(lights) != 2 {
+		t.Fatalf("got %d lights, want 2", len(lights))
+	}
+
+	ceiling := lights[0]
+	if ceiling.ID != 1 || ceiling.Name != "Ceiling" || ceiling.ModelID != "LCT015" {
+		t.Errorf("got light %d %q of model %q, want light 1 \"Ceiling\" of model \"LCT015\"", ceiling.ID, ceiling.Name, ceiling.ModelID)
+	}
+	if ceiling.State == nil || !ceiling.State.On || ceiling.State.Bri != 200 || ceiling.State.ColorMode != "ct" {
+		t.Errorf("got state %+v of light 1, want it on at brightness 200 in ct mode", ceiling.State)
+	}
+
+	if lamp := lights[1]; lamp.ID != 2 || lamp.State == nil || lamp.State.On {
+		t.Errorf("got light %d with state %+v, want light 2 off", lamp.ID, lamp.State)
+	}
+}
+
+func TestGetGroups(t *testing.T) {
+	s := huetest.NewServer()
+	defer s.Close()
+
+	groups, err := s.Bridge().GetGroupsContext(context.Background())
+	if err != nil {
+		t.Fatalf("failed to fetch groups: %v", err)
+	}
+
+	if len(groups) != 1 {
+		t.Fatalf("got %d groups, want 1", len(groups))
+	}
+
+	g := groups[0]
+	if g.ID != 1 || g.Name != "Living room" || g.Type != "Room" || len(g.Lights) != 2 {
+		t.Errorf("got group %d %q of type %q with lights %v, want room 1 \"Living room\" with lights 1 and 2", g.ID, g.Name, g.Type, g.Lights)
+	}
+	if g.GroupState == nil || !g.GroupState.AnyOn || g.GroupState.AllOn {
+		t.Errorf("got group state %+v, want any but not all lights on", g.GroupState)
+	}
+}
+
+func TestGetSensors(t *testing.T) {
+	s := huetest.NewServer()
+	defer s.Close()
+
+	sensors, err := s.Bridge().GetSensorsContext(context.Background())
+	if err != nil {
+		t.Fatalf("failed to fetch sensors: %v", err)
+	}
+
+	if len(sensors) != 7 {
+		t.Fatalf("got %d sensors, want 7", len(sensors))
+	}
+
+	for _, sensor := range sensors {
+		if sensor.ID != 4 {
+			continue
+		}
+
+		if sensor.Type != "ZLLTemperature" || sensor.State["temperature"] != 2100.0 || sensor.Config["battery"] != 75.0 {
+			t.Errorf("got sensor %q with state %v and config %v, want a temperature sensor at 2100 with 75%% battery", sensor.Type, sensor.State, sensor.Config)
+		}
+
+		return
+	}
+
+	t.Error("sensor 4 is missing")
+}
+
+func TestGetConfig(t *testing.T) {
+	s := huetest.NewServer()
+	defer s.Close()
+
+	cfg, err := s.Bridge().GetConfigContext(context.Background())
+	if err != nil {
+		t.Fatalf("failed to fetch config: %v", err)
+	}
+
+	if cfg.Name != "Fake bridge" || cfg.ModelID != "BSB002" || cfg.UTC == "" {
+		t.Errorf("got bridge %q of model %q at %q, want \"Fake bridge\" of model \"BSB002\" with its time", cfg.Name, cfg.ModelID, cfg.UTC)
+	}
+}
+
+func TestGetDatastore(t *testing.T) {
+	s := huetest.NewServer()
+	defer s.Close()
+
+	var ds hueclient.Datastore
+	if err := s.Bridge().Get(context.Background(), "", &ds); err != nil {
+		t.Fatalf("failed to fetch datastore: %v", err)
+	}
+
+	if len(ds.Lights) != 2 || len(ds.Groups) != 1 || len(ds.Sensors) != 7 {
+		t.Errorf("got %d lights, %d groups and %d sensors, want 2, 1 and 7", len(ds.Lights), len(ds.Groups), len(ds.Sensors))
+	}
+	if ds.Config == nil || ds.Config.Name != "Fake bridge" {
+		t.Errorf("got config %+v, want that of \"Fake bridge\"", ds.Config)
+	}
+	if s.Requests() != 1 {
+		t.Errorf("sent %d requests, want 1", s.Requests())
+	}
+}
+
+func TestDecodeGroups(t *testing.T) {
+	s := huetest.NewServer()
+	defer s.Close()
+
+	var raw json.RawMessage
+	if err := s.Bridge().Get(context.Background(), "groups", &raw); err != nil {
+		t.Fatalf("failed to fetch groups: %v", err)
+	}
+
+	groups, err := hueclient.DecodeGroups(raw)
+	if err != nil {
+		t.Fatalf("failed to decode groups: %v", err)
+	}
+
+	if len(groups) != 1 || groups[0].ID != 1 || groups[0].Name != "Living room" {
+		t.Errorf("got groups %+v, want group 1 \"Living room\"", groups)
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	s := huetest.NewServer()
+	defer s.Close()
+
+	_, err := hueclient.New(s.Host(), "nobody").GetLightsContext(context.Background())
+
+	var apiErr *hueclient.APIError
+	if !errors.As(err, &apiErr) || apiErr.Type != 1 {
+		t.Errorf("got error %v, want an unauthorized user error", err)
+	}
+}
+
+func TestSetLightState(t *testing.T) {
+	s := huetest.NewServer()
+	defer s.Close()
+
+	ctx := context.Background()
+	hue := s.Bridge()
+
+	on, bri := false, uint8(100)
+	if err := hue.SetLightStateContext(ctx, 1, hueclient.Action{On: &on, Bri: &bri}); err != nil {
+		t.Fatalf("failed to change light: %v", err)
+	}
+
+	lights, err := hue.GetLightsContext(ctx)
+	if err != nil {
+		t.Fatalf("failed to fetch lights: %v", err)
+	}
+
+	for _, l := range lights {
+		if l.ID == 1 && (l.State.On || l.State.Bri != 100) {
+			t.Errorf("got state %+v of light 1, want it off at brightness 100", l.State)
+		}
+	}
+
+	var apiErr *hueclient.APIError
+	if err := hue.SetLightStateContext(ctx, 9, hueclient.Action{On: &on}); !errors.As(err, &apiErr) || apiErr.Type != 3 {
+		t.Errorf("got error %v changing a missing light, want a resource not available error", err)
+	}
+}
+
+func TestFindLights(t *testing.T) {
+	s := huetest.NewServer()
+	defer s.Close()
+
+	ctx := context.Background()
+	hue := s.Bridge()
+
+	found, err := hue.GetNewLightsContext(ctx)
+	if err != nil {
+		t.Fatalf("failed to fetch new lights: %v", err)
+	}
+	if found.LastScan != "none" {
+		t.Errorf("got last scan %q before searching, want none", found.LastScan)
+	}
+
+	if err := hue.FindLightsContext(ctx); err != nil {
+		t.Fatalf("failed to search for lights: %v", err)
+	}
+
+	found, err = hue.GetNewLightsContext(ctx)
+	if err != nil {
+		t.Fatalf("failed to fetch new lights: %v", err)
+	}
+	if found.LastScan != "active" || len(found.Lights) != 0 {
+		t.Errorf("got last scan %q finding %v, want an active scan finding nothing", found.LastScan, found.Lights)
+	}
+}
@@ -0,0 +1,290 @@
+package hueclient
+
+// Light is a light as reported by the bridge. The bridge reports lights
+// keyed by id, which is filled in from the key.
+type Light struct {
+	State            *State `json:"state,omitempty"`
+	Type             string `json:"type,omitempty"`
+	Name             string `json:"name,omitempty"`
+	ModelID          string `json:"modelid,omitempty"`
+	ManufacturerName string `json:"manufacturername,omitempty"`
+	UniqueID         string `json:"uniqueid,omitempty"`
+	SwVersion        string `json:"swversion,omitempty"`
+	SwConfigID       string `json:"swconfigid,omitempty"`
+	ProductID        string `json:"productid,omitempty"`
+	ID               int    `json:"-"`
+}
+
+// State is the state of a light, or the last action sent to a group.
+type State struct {
+	On             bool      `json:"on"`
+	Bri            uint8     `json:"bri,omitempty"`
+	Hue            uint16    `json:"hue,omitempty"`
+	Sat            uint8     `json:"sat,omitempty"`
+	Xy             []float32 `json:"xy,omitempty"`
+	Ct             uint16    `json:"ct,omitempty"`
+	Alert          string    `json:"alert,omitempty"`
+	Effect         string    `json:"effect,omitempty"`
+	TransitionTime uint16    `json:"transitiontime,omitempty"`
+	BriInc         int       `json:"bri_inc,omitempty"`
+	SatInc         int       `json:"sat_inc,omitempty"`
+	HueInc         int       `json:"hue_inc,omitempty"`
+	CtInc          int       `json:"ct_inc,omitempty"`
+	XyInc          int       `json:"xy_inc,omitempty"`
+	ColorMode      string    `json:"colormode,omitempty"`
+	Reachable      bool      `json:"reachable,omitempty"`
+	Scene          string    `json:"scene,omitempty"`
+}
+
+// Action changes the state of a light, or of the lights of a group. Fields
+// left unset are left unchanged, unlike those of State.
+type Action struct {
+	On             *bool     `json:"on,omitempty"`
+	Bri            *uint8    `json:"bri,omitempty"`
+	Hue            *uint16   `json:"hue,omitempty"`
+	Sat            *uint8    `json:"sat,omitempty"`
+	Xy             []float32 `json:"xy,omitempty"`
+	Ct             *uint16   `json:"ct,omitempty"`
+	Alert          string    `json:"alert,omitempty"`
+	Effect         string    `json:"effect,omitempty"`
+	TransitionTime *uint16   `json:"transitiontime,omitempty"`
+	// Scene recalls a scene, only for groups.
+	Scene string `json:"scene,omitempty"`
+}
+
+// NewLight holds the lights found by the last scan.
+type NewLight struct {
+	Lights   []string
+	LastScan string `json:"lastscan"`
+}
+
+// Group is a room, zone or other group of lights.
+type Group struct {
+	Name       string      `json:"name,omitempty"`
+	Lights     []string    `json:"lights,omitempty"`
+	Type       string      `json:"type,omitempty"`
+	GroupState *GroupState `json:"state,omitempty"`
+	Recycle    bool        `json:"recycle,omitempty"`
+	Class      string      `json:"class,omitempty"`
+	State      *State      `json:"action,omitempty"`
+	ID         int         `json:"-"`
+}
+
+// GroupState summarizes the lights of a group.
+type GroupState struct {
+	AllOn bool `json:"all_on,omitempty"`
+	AnyOn bool `json:"any_on,omitempty"`
+}
+
+// Sensor is a sensor as reported by the bridge. Its state and config depend
+// on its type, and are left undecoded.
+type Sensor struct {
+	State            map[string]interface{} `json:"state,omitempty"`
+	Config           map[string]interface{} `json:"config,omitempty"`
+	Name             string                 `json:"name,omitempty"`
+	Type             string                 `json:"type,omitempty"`
+	ModelID          string                 `json:"modelid,omitempty"`
+	ManufacturerName string                 `json:"manufacturername,omitempty"`
+	UniqueID         string                 `json:"uniqueid,omitempty"`
+	SwVersion        string                 `json:"swversion,omitempty"`
+	ID               int                    `json:",omitempty"`
+}
+
+// NewSensor holds the sensors found by the last scan.
+type NewSensor struct {
+	Sensors  []*Sensor
+	LastScan string `json:"lastscan"`
+}
+
+// Scene is a stored state of a set of lights.
+type Scene struct {
+	Name            string        `json:"name,omitempty"`
+	Type            string        `json:"type,omitempty"`
+	Group           string        `json:"group,omitempty"`
+	Lights          []string      `json:"lights,omitempty"`
+	Owner           string        `json:"owner,omitempty"`
+	Recycle         bool          `json:"recycle,omitempty"`
+	Locked          bool          `json:"locked,omitempty"`
+	AppData         interface{}   `json:"appdata,omitempty"`
+	Picture         string        `json:"picture,omitempty"`
+	LastUpdated     string        `json:"lastupdated,omitempty"`
+	Version         int           `json:"version,omitempty"`
+	StoreSceneState bool          `json:"storescenestate,omitempty"`
+	LightStates     map[int]State `json:"lightstates,omitempty"`
+	ID              string        `json:"-"`
+}
+
+// Rule runs its actions when all of its conditions are met.
+type Rule struct {
+	Name           string        `json:"name,omitempty"`
+	LastTriggered  string        `json:"lasttriggered,omitempty"`
+	CreationTime   string        `json:"creationtime,omitempty"`
+	TimesTriggered int           `json:"timestriggered,omitempty"`
+	Owner          string        `json:"owner,omitempty"`
+	Status         string        `json:"status,omitempty"`
+	Conditions     []*Condition  `json:"conditions,omitempty"`
+	Actions        []*RuleAction `json:"actions,omitempty"`
+	ID             int           `json:",omitempty"`
+}
+
+// Condition is a condition of a rule on a resource attribute.
+type Condition struct {
+	Address  string `json:"address,omitempty"`
+	Operator string `json:"operator,omitempty"`
+	Value    string `json:"value,omitempty"`
+}
+
+// RuleAction is a request a rule sends when triggered.
+type RuleAction struct {
+	Address string      `json:"address,omitempty"`
+	Method  string      `json:"method,omitempty"`
+	Body    interface{} `json:"body,omitempty"`
+}
+
+// Resourcelink groups the resources created for a single purpose, such as
+// a Hue Labs formula or the configuration of an accessory, so they can be
+// found and removed together.
+type Resourcelink struct {
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Type        string   `json:"type,omitempty"`
+	ClassID     uint16   `json:"classid,omitempty"`
+	Owner       string   `json:"owner,omitempty"`
+	Recycle     bool     `json:"recycle,omitempty"`
+	Links       []string `json:"links,omitempty"`
+	ID          int      `json:",omitempty"`
+}
+
+// Schedule sends its command at the given time.
+type Schedule struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Command     *Command `json:"command"`
+	Time        string   `json:"time,omitempty"`
+	LocalTime   string   `json:"localtime"`
+	StartTime   string   `json:"starttime,omitempty"`
+	Status      string   `json:"status,omitempty"`
+	AutoDelete  bool     `json:"autodelete,omitempty"`
+	ID          int      `json:"-"`
+}
+
+// Command is the request a schedule sends.
+type Command struct {
+	Address string      `json:"address"`
+	Method  string      `json:"method"`
+	Body    interface{} `json:"body"`
+}
+
+// Config is the configuration of the bridge. The bridge reports its
+// whitelist keyed by username, which is listed in Whitelist.
+type Config struct {
+	Name             string               `json:"name,omitempty"`
+	SwUpdate         SwUpdate             `json:"swupdate"`
+	SwUpdate2        SwUpdate2            `json:"swupdate2"`
+	WhitelistMap     map[string]Whitelist `json:"whitelist"`
+	Whitelist        []Whitelist          `json:"-"`
+	PortalState      PortalState          `json:"portalstate"`
+	APIVersion       string               `json:"apiversion,omitempty"`
+	SwVersion        string               `json:"swversion,omitempty"`
+	ProxyAddress     string               `json:"proxyaddress,omitempty"`
+	ProxyPort        uint16               `json:"proxyport,omitempty"`
+	LinkButton       bool                 `json:"linkbutton,omitempty"`
+	IPAddress        string               `json:"ipaddress,omitempty"`
+	Mac              string               `json:"mac,omitempty"`
+	NetMask          string               `json:"netmask,omitempty"`
+	Gateway          string               `json:"gateway,omitempty"`
+	Dhcp             bool                 `json:"dhcp,omitempty"`
+	PortalServices   bool                 `json:"portalservices,omitempty"`
+	UTC              string               `json:"UTC,omitempty"`
+	LocalTime        string               `json:"localtime,omitempty"`
+	TimeZone         string               `json:"timezone,omitempty"`
+	ZigbeeChannel    uint8                `json:"zigbeechannel,omitempty"`
+	ModelID          string               `json:"modelid,omitempty"`
+	BridgeID         string               `json:"bridgeid,omitempty"`
+	FactoryNew       bool                 `json:"factorynew,omitempty"`
+	ReplacesBridgeID string               `json:"replacesbridgeid,omitempty"`
+	DatastoreVersion string               `json:"datastoreversion,omitempty"`
+	StarterKitID     string               `json:"starterkitid,omitempty"`
+	InternetService  InternetService      `json:"internetservices,omitempty"`
+}
+
+// SwUpdate is the legacy software update state of the bridge.
+type SwUpdate struct {
+	CheckForUpdate bool        `json:"checkforupdate,omitempty"`
+	DeviceTypes    DeviceTypes `json:"devicetypes"`
+	UpdateState    uint8       `json:"updatestate,omitempty"`
+	Notify         bool        `json:"notify,omitempty"`
+	URL            string      `json:"url,omitempty"`
+	Text           string      `json:"text,omitempty"`
+}
+
+// SwUpdate2 is the software update state of the bridge and its devices.
+type SwUpdate2 struct {
+	Bridge         BridgeConfig `json:"bridge"`
+	CheckForUpdate bool         `json:"checkforupdate,omitempty"`
+	State          string       `json:"state,omitempty"`
+	Install        bool         `json:"install,omitempty"`
+	AutoInstall    AutoInstall  `json:"autoinstall"`
+	LastChange     string       `json:"lastchange,omitempty"`
+	LastInstall    string       `json:"lastinstall,omitempty"`
+}
+
+// DeviceTypes lists the devices an update is available for.
+type DeviceTypes struct {
+	Bridge  bool     `json:"bridge,omitempty"`
+	Lights  []string `json:"lights,omitempty"`
+	Sensors []string `json:"sensors,omitempty"`
+}
+
+// BridgeConfig is the update state of the bridge itself.
+type BridgeConfig struct {
+	State       string `json:"state,omitempty"`
+	LastInstall string `json:"lastinstall,omitempty"`
+}
+
+// AutoInstall is when updates are installed automatically.
+type AutoInstall struct {
+	On         bool   `json:"on,omitempty"`
+	UpdateTime string `json:"updatetime,omitempty"`
+}
+
+// InternetService is the connectivity of the bridge to the Hue cloud.
+type InternetService struct {
+	Internet     string `json:"internet,omitempty"`
+	RemoteAccess string `json:"remoteaccess,omitempty"`
+	Time         string `json:"time,omitempty"`
+	SwUpdate     string `json:"swupdate,omitempty"`
+}
+
+// Whitelist is a user of the bridge.
+type Whitelist struct {
+	Name        string `json:"name"`
+	Username    string
+	CreateDate  string `json:"create date"`
+	LastUseDate string `json:"last use date"`
+}
+
+// PortalState is the connection of the bridge to the Hue portal.
+type PortalState struct {
+	SignedOn      bool   `json:"signedon,omitempty"`
+	Incoming      bool   `json:"incoming,omitempty"`
+	Outgoing      bool   `json:"outgoing,omitempty"`
+	Communication string `json:"communication,omitempty"`
+}
+
+// Capabilities holds the resources of each kind the bridge has room for.
+type Capabilities struct {
+	Groups        Capability `json:"groups,omitempty"`
+	Lights        Capability `json:"lights,omitempty"`
+	Resourcelinks Capability `json:"resourcelinks,omitempty"`
+	Schedules     Capability `json:"schedules,omitempty"`
+	Rules         Capability `json:"rules,omitempty"`
+	Scenes        Capability `json:"scenes,omitempty"`
+	Sensors       Capability `json:"sensors,omitempty"`
+	Streaming     Capability `json:"streaming,omitempty"`
+}
+
+// Capability is the number of resources of a kind still available.
+type Capability struct {
+	Available int `json:"available,omitempty"`
+}
@@ -0,0 +1,368 @@
+package hueclient
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+)
+
+func (c *Client) GetConfigContext(ctx context.Context) (*Config, error) {
+	var cfg Config
+	if err := c.Get(ctx, "config", &cfg); err != nil {
+		return nil, err
+	}
+
+	return configFrom(&cfg), nil
+}
+
+func (c *Client) GetCapabilitiesContext(ctx context.Context) (*Capabilities, error) {
+	var caps Capabilities
+	if err := c.Get(ctx, "capabilities", &caps); err != nil {
+		return nil, err
+	}
+
+	return &caps, nil
+}
+
+func (c *Client) GetGroupsContext(ctx context.Context) ([]Group, error) {
+	var m map[string]Group
+	if err := c.Get(ctx, "groups", &m); err != nil {
+		return nil, err
+	}
+
+	return groupsFrom(m)
+}
+
+func (c *Client) GetLightsContext(ctx context.Context) ([]Light, error) {
+	var m map[string]Light
+	if err := c.Get(ctx, "lights", &m); err != nil {
+		return nil, err
+	}
+
+	return lightsFrom(m)
+}
+
+// GetNewLightsContext returns the lights found by the last scan, which the
+// bridge reports as keys alongside the time of the scan.
+func (c *Client) GetNewLightsContext(ctx context.Context) (*NewLight, error) {
+	var m map[string]interface{}
+	if err := c.Get(ctx, "lights/new", &m); err != nil {
+		return nil, err
+	}
+
+	n := &NewLight{Lights: make([]string, 0, len(m))}
+	for k, v := range m {
+		if k == "lastscan" {
+			n.LastScan, _ = v.(string)
+
+			continue
+		}
+
+		n.Lights = append(n.Lights, k)
+	}
+
+	return n, nil
+}
+
+// GetNewSensorsContext returns the sensors found by the last scan, which the
+// bridge reports keyed by id alongside the time of the scan.
+func (c *Client) GetNewSensorsContext(ctx context.Context) (*NewSensor, error) {
+	var m map[string]json.RawMessage
+	if err := c.Get(ctx, "sensors/new", &m); err != nil {
+		return nil, err
+	}
+
+	n := &NewSensor{Sensors: make([]*Sensor, 0, len(m))}
+	for k, v := range m {
+		if k == "lastscan" {
+			_ = json.Unmarshal(v, &n.LastScan)
+
+			continue
+		}
+
+		var s Sensor
+		if err := json.Unmarshal(v, &s); err != nil {
+			return nil, err
+		}
+
+		var err error
+		if s.ID, err = strconv.Atoi(k); err != nil {
+			return nil, err
+		}
+
+		n.Sensors = append(n.Sensors, &s)
+	}
+
+	return n, nil
+}
+
+// FindLightsContext starts a search for new lights, which the bridge runs
+// for about a minute and reports through GetNewLightsContext.
+func (c *Client) FindLightsContext(ctx context.Context) error {
+	_, err := c.Post(ctx, "lights", nil)
+
+	return err
+}
+
+// FindSensorsContext starts a search for new sensors, which the bridge runs
+// for about a minute and reports through GetNewSensorsContext.
+func (c *Client) FindSensorsContext(ctx context.Context) error {
+	_, err := c.Post(ctx, "sensors", nil)
+
+	return err
+}
+
+// SetLightStateContext changes the state of the light with the given id.
+func (c *Client) SetLightStateContext(ctx context.Context, id int, action Action) error {
+	_, err := c.Put(ctx, "lights/"+strconv.Itoa(id)+"/state", action)
+
+	return err
+}
+
+// SetGroupStateContext changes the state of the lights of the group with the
+// given id, group 0 holding every light of the bridge.
+func (c *Client) SetGroupStateContext(ctx context.Context, id int, action Action) error {
+	_, err := c.Put(ctx, "groups/"+strconv.Itoa(id)+"/action", action)
+
+	return err
+}
+
+func (c *Client) GetRulesContext(ctx context.Context) ([]*Rule, error) {
+	var m map[string]Rule
+	if err := c.Get(ctx, "rules", &m); err != nil {
+		return nil, err
+	}
+
+	return rulesFrom(m)
+}
+
+func (c *Client) GetResourcelinksContext(ctx context.Context) ([]*Resourcelink, error) {
+	var m map[string]Resourcelink
+	if err := c.Get(ctx, "resourcelinks", &m); err != nil {
+		return nil, err
+	}
+
+	return resourcelinksFrom(m)
+}
+
+func (c *Client) GetScenesContext(ctx context.Context) ([]Scene, error) {
+	var m map[string]Scene
+	if err := c.Get(ctx, "scenes", &m); err != nil {
+		return nil, err
+	}
+
+	return scenesFrom(m), nil
+}
+
+func (c *Client) GetSchedulesContext(ctx context.Context) ([]*Schedule, error) {
+	var m map[string]Schedule
+	if err := c.Get(ctx, "schedules", &m); err != nil {
+		return nil, err
+	}
+
+	return schedulesFrom(m)
+}
+
+func (c *Client) GetSensorsContext(ctx context.Context) ([]Sensor, error) {
+	var m map[string]Sensor
+	if err := c.Get(ctx, "sensors", &m); err != nil {
+		return nil, err
+	}
+
+	return sensorsFrom(m)
+}
+
+// DecodeGroups decodes groups as the bridge reports them, keyed by id, such
+// as fetched undecoded through Get.
+func DecodeGroups(data []byte) ([]Group, error) {
+	var m map[string]Group
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	return groupsFrom(m)
+}
+
+// DecodeLights decodes lights as DecodeGroups does groups.
+func DecodeLights(data []byte) ([]Light, error) {
+	var m map[string]Light
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	return lightsFrom(m)
+}
+
+// DecodeSensors decodes sensors as DecodeGroups does groups.
+func DecodeSensors(data []byte) ([]Sensor, error) {
+	var m map[string]Sensor
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	return sensorsFrom(m)
+}
+
+// Datastore is the full state of a bridge, fetched in a single request for
+// the empty path. The bridge omits capabilities and the resources found by
+// the last scan.
+type Datastore struct {
+	Config    *Config
+	Groups    []Group
+	Lights    []Light
+	Rules     []*Rule
+	Scenes    []Scene
+	Schedules []*Schedule
+	Sensors   []Sensor
+}
+
+// UnmarshalJSON decodes the datastore as reported by the bridge, with each
+// kind of resource keyed by id.
+func (d *Datastore) UnmarshalJSON(data []byte) error {
+	var full struct {
+		Config    Config              `json:"config"`
+		Groups    map[string]Group    `json:"groups"`
+		Lights    map[string]Light    `json:"lights"`
+		Rules     map[string]Rule     `json:"rules"`
+		Scenes    map[string]Scene    `json:"scenes"`
+		Schedules map[string]Schedule `json:"schedules"`
+		Sensors   map[string]Sensor   `json:"sensors"`
+	}
+	if err := json.Unmarshal(data, &full); err != nil {
+		return err
+	}
+
+	d.Config = configFrom(&full.Config)
+	d.Scenes = scenesFrom(full.Scenes)
+
+	var err error
+	if d.Groups, err = groupsFrom(full.Groups); err != nil {
+		return err
+	}
+	if d.Lights, err = lightsFrom(full.Lights); err != nil {
+		return err
+	}
+	if d.Rules, err = rulesFrom(full.Rules); err != nil {
+		return err
+	}
+	if d.Schedules, err = schedulesFrom(full.Schedules); err != nil {
+		return err
+	}
+	if d.Sensors, err = sensorsFrom(full.Sensors); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// configFrom fills in the whitelist of the decoded config, which the bridge
+// reports keyed by username.
+func configFrom(cfg *Config) *Config {
+	cfg.Whitelist = make([]Whitelist, 0, len(cfg.WhitelistMap))
+	for user, w := range cfg.WhitelistMap {
+		w.Username = user
+		cfg.Whitelist = append(cfg.Whitelist, w)
+	}
+
+	return cfg
+}
+
+func groupsFrom(m map[string]Group) ([]Group, error) {
+	groups := make([]Group, 0, len(m))
+	for id, g := range m {
+		var err error
+		if g.ID, err = strconv.Atoi(id); err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, g)
+	}
+
+	return groups, nil
+}
+
+func lightsFrom(m map[string]Light) ([]Light, error) {
+	lights := make([]Light, 0, len(m))
+	for id, l := range m {
+		var err error
+		if l.ID, err = strconv.Atoi(id); err != nil {
+			return nil, err
+		}
+
+		lights = append(lights, l)
+	}
+
+	return lights, nil
+}
+
+func rulesFrom(m map[string]Rule) ([]*Rule, error) {
+	rules := make([]*Rule, 0, len(m))
+	for id, r := range m {
+		r := r
+
+		var err error
+		if r.ID, err = strconv.Atoi(id); err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, &r)
+	}
+
+	return rules, nil
+}
+
+func resourcelinksFrom(m map[string]Resourcelink) ([]*Resourcelink, error) {
+	links := make([]*Resourcelink, 0, len(m))
+	for id, l := range m {
+		l := l
+
+		var err error
+		if l.ID, err = strconv.Atoi(id); err != nil {
+			return nil, err
+		}
+
+		links = append(links, &l)
+	}
+
+	return links, nil
+}
+
+func scenesFrom(m map[string]Scene) []Scene {
+	scenes := make([]Scene, 0, len(m))
+	for id, s := range m {
+		s.ID = id
+		scenes = append(scenes, s)
+	}
+
+	return scenes
+}
+
+func schedulesFrom(m map[string]Schedule) ([]*Schedule, error) {
+	schedules := make([]*Schedule, 0, len(m))
+	for id, s := range m {
+		s := s
+
+		var err error
+		if s.ID, err = strconv.Atoi(id); err != nil {
+			return nil, err
+		}
+
+		schedules = append(schedules, &s)
+	}
+
+	return schedules, nil
+}
+
+func sensorsFrom(m map[string]Sensor) ([]Sensor, error) {
+	sensors := make([]Sensor, 0, len(m))
+	for id, s := range m {
+		var err error
+		if s.ID, err = strconv.Atoi(id); err != nil {
+			return nil, err
+		}
+
+		sensors = append(sensors, s)
+	}
+
+	return sensors, nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// newLogger builds the structured logger from the logging flags.
+func newLogger(level, format, output string) (*zap.Logger, error) {
+	var lvl zapcore.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	if format != "json" && format != "console" {
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+
+	cfg := zap.NewDevelopmentConfig()
+	cfg.Level = zap.NewAtomicLevelAt(lvl)
+	cfg.Encoding = format
+	cfg.OutputPaths = []string{output}
+
+	return cfg.Build()
+}
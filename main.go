@@ -2,30 +2,166 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/ninnemana/hue-exporter/alert"
 	"github.com/ninnemana/hue-exporter/collector"
+	"github.com/ninnemana/hue-exporter/discovery"
+	"github.com/ninnemana/hue-exporter/graphite"
+	"github.com/ninnemana/hue-exporter/history"
+	"github.com/ninnemana/hue-exporter/mqtt"
+	"github.com/ninnemana/hue-exporter/pushgateway"
+	"github.com/ninnemana/hue-exporter/remote"
+	"github.com/ninnemana/hue-exporter/remotewrite"
+	"github.com/ninnemana/hue-exporter/statsd"
+	"github.com/ninnemana/hue-exporter/web"
 	"github.com/ninnemana/tracelog"
+	prom "github.com/prometheus/client_golang/prometheus"
 
 	"go.opentelemetry.io/otel/metric/global"
 	"go.uber.org/zap"
 )
 
 var (
-	promPort = flag.String("metric-port", "8080", "indicates the port for Prometheus metrics to be served")
+	promPort      = flag.String("metric-port", "8080", "indicates the port for Prometheus metrics to be served")
+	pullMode      = flag.Bool("pull", false, "collect from the bridge when metrics are scraped instead of on a fixed interval")
+	cacheTTL      = flag.Duration("cache-ttl", 0, "duration to reuse collected state between scrapes when running with -pull")
+	tempUnit      = flag.String("temperature-unit", "celsius", "unit temperatures are reported in, one of celsius, fahrenheit or both")
+	nameLabels    = flag.Bool("name-labels", false, "also label light and sensor metrics with the device name, which starts new series whenever a device is renamed")
+	uniqueID      = flag.Bool("uniqueid-labels", false, "identify lights and sensors by their Zigbee uniqueid in the id label, which survives re-pairing, rather than the numeric id the bridge assigns")
+	legacyMetrics = flag.Bool("legacy-metrics", false, "also serve metrics in the form used before their units and types were corrected, for existing dashboards")
+	datastore     = flag.Bool("full-datastore", false, "fetch the lights, groups, sensors, scenes, schedules, rules and config of each bridge in a single request per cycle")
+	events        = flag.Bool("event-stream", false, "subscribe to the CLIP v2 event stream instead of polling v2 light state, requires HUE_CLIP_V2")
+	triggerWait   = flag.Duration("collect-trigger-interval", 10*time.Second, "minimum time between collections triggered through POST /-/collect")
+	scanWait      = flag.Duration("scan-interval", time.Minute, "minimum time between searches for new devices started through POST /-/scan, which is only served when clients authenticate")
+	controls      = flag.Bool("control-api", false, "serve an API changing the state of lights and groups and recalling scenes under /api/v1/bridges/, requires authentication through -web-config-file, or -tls-client-ca with -tls-cert and -tls-key")
+	jitter        = flag.Duration("collect-jitter", 0, "maximum random delay added to each collection cycle")
+	align         = flag.Bool("collect-align", false, "align collection cycles to multiples of the collection interval on the wall clock")
+	rateLim       = flag.Float64("rate-limit", 10, "maximum requests per second sent to the bridges across all collectors, 0 disables the limit")
+	inflight      = flag.Int("max-concurrent-requests", 3, "maximum requests in flight to each bridge, 0 disables the limit")
+	reqTime       = flag.Duration("request-timeout", 10*time.Second, "maximum duration of each request to a bridge, 0 disables the timeout")
+	cycTime       = flag.Duration("cycle-timeout", 30*time.Second, "maximum duration of a collection cycle across all bridges, 0 disables the timeout")
+	backoff       = flag.Duration("max-backoff", 5*time.Minute, "maximum time between attempts to collect from an unreachable bridge")
+	staleTTL      = flag.Duration("stale-ttl", 0, "how long the state last collected keeps being served once collection from a bridge fails, 0 serves it until collection recovers")
+	backend       = flag.String("metrics-backend", "otel", "metrics pipeline to export through, either otel or prometheus, only prometheus serves exemplars linking collections to their traces")
+	tlsCert       = flag.String("tls-cert", "", "path of the certificate to serve metrics over TLS with, requires -tls-key")
+	tlsKey        = flag.String("tls-key", "", "path of the private key of the TLS certificate")
+	tlsWatch      = flag.Bool("tls-reload", false, "reload the TLS certificate and key when the files change")
+	clientCA      = flag.String("tls-client-ca", "", "path of the CA bundle scraper client certificates must be signed by, enables mutual TLS, requires -tls-cert and -tls-key")
+	webCfg        = flag.String("web-config-file", "", "path of a web configuration file enabling TLS and authentication, in the format used by Prometheus exporters")
+	traces        = flag.String("trace-exporter", "otlp", "exporter spans are sent through, one of otlp, zipkin, stdout or none")
+	sampler       = flag.String("trace-sampler", envOr("OTEL_TRACES_SAMPLER", "parentbased_always_on"), "sampler deciding which traces are recorded, one of always_on, always_off, traceidratio or their parentbased_ variants")
+	ratio         = flag.Float64("trace-sampler-arg", envFloat("OTEL_TRACES_SAMPLER_ARG", 1), "fraction of traces recorded by the traceidratio samplers")
+	otlpPush      = flag.Bool("otlp-metrics", false, "push metrics over OTLP alongside serving them, configured through the OTEL_EXPORTER_OTLP_* environment variables")
+	seriesLimit   = flag.Int("series-limit", 0, "maximum series reported per metric, beyond which observations are summed into a series labelled overflow=\"true\", 0 disables the limit")
+	mappings      = flag.String("mapping-file", "", "path of a YAML file declaring metrics reported from fields of lights, groups and sensors by JSON path, and metrics derived from them by expressions")
+	labelLen      = flag.Int("label-value-limit", 0, "maximum length in bytes of label values, longer values are truncated, 0 disables the limit")
+	prefix        = flag.String("metric-prefix", "hue_", "prefix applied to the name of every metric")
+	mqttURL       = flag.String("mqtt-broker", "", "URL of an MQTT broker to publish state to, such as tcp://localhost:1883, disabled when empty")
+	mqttPre       = flag.String("mqtt-topic-prefix", "hue", "prefix of the topics state is published to over MQTT")
+	mqttID        = flag.String("mqtt-client-id", "hue-exporter", "client identifier presented to the MQTT broker")
+	mqttUser      = flag.String("mqtt-username", os.Getenv("MQTT_USERNAME"), "username to authenticate with the MQTT broker, the password is read from MQTT_PASSWORD")
+	mqttHA        = flag.Bool("mqtt-homeassistant", false, "publish Home Assistant MQTT discovery configuration for sensors, requires -mqtt-broker")
+	mqttDisc      = flag.String("mqtt-homeassistant-prefix", mqtt.DefaultDiscoveryPrefix, "topic prefix Home Assistant discovers entities under")
+	debug         = flag.String("debug-addr", "", "address to serve pprof and expvar debug endpoints on, disabled when empty")
+
+	carbon    = flag.String("graphite-address", "", "host:port of a Graphite carbon plaintext receiver to push metrics to, disabled when empty")
+	carbonTpl = flag.String("graphite-template", graphite.DefaultTemplate, "path metrics are pushed to Graphite under, {name} is replaced with the metric name and {<label>} with label values, remaining labels are appended as <label>.<value>")
+	carbonInt = flag.Duration("graphite-interval", time.Minute, "how often metrics are pushed to Graphite")
+
+	statsdAddr = flag.String("statsd-address", "", "host:port of a StatsD server to push metrics to over UDP, disabled when empty")
+	statsdPre  = flag.String("statsd-prefix", "", "prefix prepended to the name of every metric pushed to StatsD")
+	statsdInt  = flag.Duration("statsd-interval", 10*time.Second, "how often metrics are pushed to StatsD")
+	dogstatsd  = flag.Bool("statsd-dogstatsd", false, "send labels as DogStatsD tags instead of appending them to metric names")
+
+	pushURL   = flag.String("pushgateway-url", "", "URL of a Prometheus Pushgateway to push metrics to, disabled when empty")
+	pushJob   = flag.String("pushgateway-job", "hue-exporter", "job label of the metrics pushed to the Pushgateway")
+	pushUser  = flag.String("pushgateway-username", os.Getenv("PUSHGATEWAY_USERNAME"), "username to authenticate with the Pushgateway, the password is read from PUSHGATEWAY_PASSWORD")
+	pushInt   = flag.Duration("pushgateway-interval", 30*time.Second, "how often metrics are pushed to the Pushgateway")
+	pushClear = flag.Bool("pushgateway-delete-on-shutdown", false, "delete the pushed metrics from the Pushgateway on shutdown")
+
+	rwURL     = flag.String("remote-write-url", "", "URL of a Prometheus remote write endpoint to send metrics to, disabled when empty")
+	rwUser    = flag.String("remote-write-username", os.Getenv("REMOTE_WRITE_USERNAME"), "username to authenticate with the remote write endpoint, the password is read from REMOTE_WRITE_PASSWORD")
+	rwInt     = flag.Duration("remote-write-interval", 30*time.Second, "how often metrics are sent to the remote write endpoint")
+	rwRetries = flag.Int("remote-write-retries", 3, "number of times a failed remote write is retried")
+
+	historyDB  = flag.String("history-db", "", "path of a SQLite database recording light and sensor history, served on /api/v1/history, disabled when empty")
+	historyInt = flag.Duration("history-interval", time.Minute, "how often a snapshot of light and sensor state is recorded")
+	historyRet = flag.Duration("history-retention", 7*24*time.Hour, "how long recorded history is kept")
+
+	alertHook    = flag.String("alert-webhook", "", "URL alerts are POSTed to as JSON when detected, disabled when empty")
+	alertURL     = flag.String("alert-url-template", "", "template of a URL requested when an alert fires or resolves, such as https://example.com/notify?msg={{query .Name}}")
+	alertInt     = flag.Duration("alert-interval", time.Minute, "how often the collected state is checked for alerts")
+	alertBattery = flag.Float64("alert-battery-threshold", 15, "battery percentage below which sensors alert")
+	alertReach   = flag.Duration("alert-unreachable-after", 10*time.Minute, "how long a light must be unreachable before it alerts")
+
+	remoteMode   = flag.Bool("remote", false, "also collect from a bridge through the Hue remote API, authorized with the remote-login command, for exporters running outside the network of the bridge")
+	remoteName   = flag.String("remote-bridge-name", "remote", "bridge label of the metrics collected through the Hue remote API")
+	remoteTokens = flag.String("remote-token-file", "hue-remote-token.json", "path of the file Hue remote API tokens are persisted to, refreshed tokens are written back to it")
+
+	logLevel  = flag.String("log-level", "info", "minimum level of logs written, one of debug, info, warn or error")
+	logFormat = flag.String("log-format", "json", "encoding of logs, either json or console")
+	logOutput = flag.String("log-output", "stderr", "where logs are written, stderr, stdout or a file path")
+
+	ruleBattery = flag.Int("rules-battery-threshold", 15, "battery percentage below which the generated rules alert")
+	ruleStale   = flag.Duration("rules-stale-after", 10*time.Minute, "time since the last successful collection after which the generated rules alert")
+
+	pairMode    = flag.Bool("pair", false, "create a bridge username by pressing the link button, then exit, same as the pair command")
+	pairTimeout = flag.Duration("pair-timeout", time.Minute, "duration to wait for the link button to be pressed")
+	credentials = flag.String("credentials", "hue-credentials.json", "path of the file bridge usernames are persisted to when pairing")
+
+	validateMode = flag.Bool("validate", false, "check the configuration, bridges and endpoints, print a summary and exit non-zero on problems, same as the validate command")
 
 	defaultPort = "8080"
+
+	staticLabels  = mapFlag{}
+	labelReplaces = mapFlag{}
+	pushGrouping  = mapFlag{}
+	lightPower    = mapFlag{}
+
+	// collectorsOn enables each collector through a -collector.<name> flag,
+	// as node_exporter does.
+	collectorsOn = map[string]*bool{}
 )
 
+func init() {
+	flag.Var(staticLabels, "label", "static label attached to every series as name=value, may be repeated")
+	flag.Var(labelReplaces, "label-replace", "replace occurrences of old in label values with new as old=new, may be repeated")
+	flag.Var(lightPower, "light-power", "power in watts drawn at full brightness by a light model as model=watts, such as LCT015=9.5, may be repeated, adds to the built-in table of common Hue lights")
+	flag.Var(pushGrouping, "pushgateway-grouping", "grouping label identifying the metrics pushed to the Pushgateway as name=value, may be repeated")
+
+	for _, name := range collector.Collectors {
+		collectorsOn[name] = flag.Bool("collector."+name, true, "enable the "+name+" collector, disable with -collector."+name+"=false")
+	}
+}
+
 func main() {
-	flag.Parse()
+	cmd, args := command(os.Args[1:])
+	flag.Usage = usage
+	_ = flag.CommandLine.Parse(args)
 
-	logConfig := zap.NewDevelopmentConfig()
-	logConfig.Encoding = "json"
+	// list takes the resource to list ahead of its flags
+	var resource string
+	if cmd == "list" && flag.NArg() > 0 {
+		resource = flag.Arg(0)
+		_ = flag.CommandLine.Parse(flag.Args()[1:])
+	}
+
+	if err := loadConfig(flag.CommandLine); err != nil {
+		log.Fatalf("failed to load configuration: %v", err)
+	}
 
-	logger, err := logConfig.Build()
+	logger, err := newLogger(*logLevel, *logFormat, *logOutput)
 	if err != nil {
 		log.Fatalf("failed to create structured logger: %v", err)
 	}
@@ -34,39 +170,512 @@ func main() {
 		_ = logger.Sync()
 	}()
 
+	ctx := context.Background()
+
+	switch {
+	case cmd == "pair" || *pairMode:
+		if err := pair(ctx, logger, *credentials, *pairTimeout); err != nil {
+			logger.Fatal("failed to pair with bridge", zap.Error(err))
+		}
+	case cmd == "remote-login":
+		if err := remoteLogin(ctx, os.Stdin, os.Stdout, remoteConfig()); err != nil {
+			logger.Fatal("failed to authorize with the hue remote api", zap.Error(err))
+		}
+	case cmd == "validate" || *validateMode:
+		if !validate(ctx, os.Stdout) {
+			os.Exit(1)
+		}
+	case cmd == "serve":
+		serve(ctx, logger)
+	case cmd == "discover":
+		if err := discoverBridges(ctx, os.Stdout); err != nil {
+			logger.Fatal("failed to discover bridges", zap.Error(err))
+		}
+	case cmd == "list":
+		if err := list(ctx, os.Stdout, resource); err != nil {
+			logger.Fatal("failed to list resources", zap.Error(err))
+		}
+	case cmd == "dashboard":
+		if err := dashboard(ctx, os.Stdout); err != nil {
+			logger.Fatal("failed to generate dashboard", zap.Error(err))
+		}
+	case cmd == "rules":
+		if err := alertRules(os.Stdout, *prefix, *ruleBattery, *ruleStale); err != nil {
+			logger.Fatal("failed to generate rules", zap.Error(err))
+		}
+	case cmd == "version":
+		printVersion(os.Stdout)
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+// serve collects from the configured bridges and serves the metrics until
+// the process is interrupted or terminated.
+func serve(ctx context.Context, logger *zap.Logger) {
+	// spans and metrics are flushed once the context stopping the
+	// exporter is done
+	flushCtx := ctx
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	// workers are the goroutines running until ctx is done, which are
+	// waited on so they can clean up, such as deleting the metrics pushed
+	// to the Pushgateway
+	var workers sync.WaitGroup
+
 	if promPort == nil {
 		promPort = &defaultPort
 	}
 
-	flush, err := initTracer("hue")
+	sample, err := newSampler(*sampler, *ratio)
+	if err != nil {
+		logger.Fatal("failed to create sampler", zap.Error(err))
+	}
+
+	flush, err := initTracer(ctx, "hue", *traces, sample)
 	if err != nil {
 		logger.Fatal("failed to start tracer", zap.Error(err))
 	}
 
 	defer func() {
-		if err := flush(context.Background()); err != nil {
+		if err := flush(flushCtx); err != nil {
 			logger.Fatal("failed to flush spans", zap.Error(err))
 		}
 	}()
 
+	mapped, err := readMappings(*mappings)
+	if err != nil {
+		logger.Fatal("failed to load field mappings", zap.Error(err))
+	}
+	mirrored := collector.MirroredCounters(mapped.Metrics...)
+
 	logger.Info("Starting metric collector")
-	if err := initMeter("hue", *promPort); err != nil {
-		logger.Fatal("failed to start metric server", zap.Error(err))
+	var (
+		metrics  http.Handler
+		gatherer prom.Gatherer
+		export   collector.Option
+	)
+	switch *backend {
+	case "otel":
+		metrics, gatherer, err = initMeter(*prefix, mirrored)
+		if err != nil {
+			logger.Fatal("failed to start metric server", zap.Error(err))
+		}
+		export = collector.WithExporter(global.GetMeterProvider())
+		if *traces != "none" {
+			logger.Warn("collections are traced but only linked to their traces through exemplars with -metrics-backend=prometheus")
+		}
+	case "prometheus":
+		var reg prom.Registerer
+		metrics, reg, gatherer = initRegistry(*prefix, mirrored)
+		export = collector.WithPrometheusRegistry(reg)
+	default:
+		logger.Fatal("unknown metrics backend", zap.String("backend", *backend))
+	}
+
+	bridges := hueConfigs()
+	creds, err := loadCredentials(*credentials)
+	switch {
+	case err == nil:
+		bridges = applyCredentials(bridges, creds)
+	case !errors.Is(err, os.ErrNotExist):
+		logger.Fatal("failed to load credentials", zap.Error(err))
 	}
 
-	coll, err := collector.NewGatherer(
+	// a remote bridge on its own shouldn't fall back to discovering bridges
+	// on the local network
+	if *remoteMode && os.Getenv("HUE_ADDRESS") == "" && os.Getenv("HUE_BRIDGE_ID") == "" {
+		bridges = nil
+	}
+
+	opts := []collector.Option{
 		collector.WithLogger(tracelog.NewLogger(tracelog.WithLogger(logger))),
-		collector.WithExporter(global.GetMeterProvider()),
-		collector.WithHueConfig(collector.HueConfig{
-			IP:       os.Getenv("HUE_ADDRESS"),
-			Username: os.Getenv("HUE_USERNAME"),
-		}),
-	)
+		export,
+		collector.WithMetricsHandler(metrics),
+		collector.WithPrefix(*prefix),
+		collector.WithBuildInfo(buildVersion(), revision),
+		collector.WithStaticLabels(staticLabels),
+		collector.WithLabelReplacements(labelReplaces),
+		collector.WithHueConfig(bridges...),
+		collector.WithDiscovery(discovery.Default()),
+		collector.WithMaxBackoff(*backoff),
+		collector.WithStaleTTL(*staleTTL),
+		collector.WithRateLimit(*rateLim),
+		collector.WithConcurrency(*inflight),
+		collector.WithRequestTimeout(*reqTime),
+		collector.WithCycleTimeout(*cycTime),
+	}
+	if *remoteMode {
+		client, username, err := remoteConfig().Client(ctx)
+		if err != nil {
+			logger.Fatal("failed to authorize with the hue remote api", zap.Error(err))
+		}
+
+		opts = append(opts, collector.WithRemoteBridge(*remoteName, remote.BaseURL, username, client))
+	}
+	if *pullMode {
+		opts = append(opts, collector.WithPullMode(*cacheTTL))
+	}
+	units, err := temperatureUnits(*tempUnit)
+	if err != nil {
+		logger.Fatal("invalid temperature unit", zap.Error(err))
+	}
+	opts = append(opts, collector.WithTemperatureUnits(units...))
+	if len(lightPower) > 0 {
+		watts := make(map[string]float64, len(lightPower))
+		for model, v := range lightPower {
+			w, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				logger.Fatal("invalid light power", zap.String("model", model), zap.Error(err))
+			}
+			watts[model] = w
+		}
+
+		opts = append(opts, collector.WithPowerTable(watts))
+	}
+	if *datastore {
+		opts = append(opts, collector.WithDatastore())
+	}
+	if *legacyMetrics {
+		opts = append(opts, collector.WithLegacyMetrics())
+	}
+	if *uniqueID {
+		opts = append(opts, collector.WithUniqueIDLabels())
+	}
+	if *nameLabels {
+		opts = append(opts, collector.WithNameLabels())
+	}
+
+	if *seriesLimit > 0 {
+		opts = append(opts, collector.WithSeriesLimit(*seriesLimit))
+	}
+	if *labelLen > 0 {
+		opts = append(opts, collector.WithLabelValueLimit(*labelLen))
+	}
+	if len(mapped.Metrics) > 0 {
+		opts = append(opts, collector.WithFieldMappings(mapped.Metrics...))
+	}
+	if len(mapped.Derived) > 0 {
+		opts = append(opts, collector.WithDerivedMetrics(mapped.Derived...))
+	}
+
+	var disabled []string
+	for _, name := range collector.Collectors {
+		if !*collectorsOn[name] {
+			disabled = append(disabled, name)
+		}
+	}
+	if len(disabled) > 0 {
+		opts = append(opts, collector.WithoutCollectors(disabled...))
+	}
+	if *events {
+		opts = append(opts, collector.WithEventStream())
+	}
+	if *jitter > 0 {
+		opts = append(opts, collector.WithJitter(*jitter))
+	}
+	if *align {
+		opts = append(opts, collector.WithAlignment())
+	}
+	if *otlpPush {
+		provider, stop, err := initOTLPMeter(ctx, "hue")
+		if err != nil {
+			logger.Fatal("failed to start otlp metrics", zap.Error(err))
+		}
+
+		defer func() {
+			if err := stop(flushCtx); err != nil {
+				logger.Error("failed to flush otlp metrics", zap.Error(err))
+			}
+		}()
+
+		opts = append(opts, collector.WithExporter(provider))
+	}
+
+	coll, err := collector.NewGatherer(opts...)
 	if err != nil {
 		logger.Fatal("failed to create collector", zap.Error(err))
 	}
 
-	if err := coll.Run(context.Background()); err != nil {
+	if *mqttURL != "" {
+		mopts := []mqtt.Option{
+			mqtt.WithLogger(tracelog.NewLogger(tracelog.WithLogger(logger))),
+			mqtt.WithTopicPrefix(*mqttPre),
+			mqtt.WithClientID(*mqttID),
+			mqtt.WithCredentials(*mqttUser, os.Getenv("MQTT_PASSWORD")),
+		}
+		if *mqttHA {
+			mopts = append(mopts, mqtt.WithHomeAssistant(*mqttDisc))
+		}
+
+		pub, err := mqtt.New(*mqttURL, mopts...)
+		if err != nil {
+			logger.Fatal("failed to create mqtt publisher", zap.Error(err))
+		}
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+
+			if err := pub.Run(ctx, coll); err != nil && !errors.Is(err, context.Canceled) {
+				logger.Error("mqtt publisher stopped", zap.Error(err))
+			}
+		}()
+	}
+
+	if *carbon != "" {
+		pusher, err := graphite.New(
+			*carbon,
+			graphite.WithLogger(tracelog.NewLogger(tracelog.WithLogger(logger))),
+			graphite.WithGatherer(gatherer),
+			graphite.WithTemplate(*carbonTpl),
+			graphite.WithInterval(*carbonInt),
+		)
+		if err != nil {
+			logger.Fatal("failed to create graphite pusher", zap.Error(err))
+		}
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+
+			if err := pusher.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				logger.Error("graphite pusher stopped", zap.Error(err))
+			}
+		}()
+	}
+
+	if *statsdAddr != "" {
+		sopts := []statsd.Option{
+			statsd.WithLogger(tracelog.NewLogger(tracelog.WithLogger(logger))),
+			statsd.WithGatherer(gatherer),
+			statsd.WithPrefix(*statsdPre),
+			statsd.WithInterval(*statsdInt),
+		}
+		if *dogstatsd {
+			sopts = append(sopts, statsd.WithDogStatsD())
+		}
+
+		pusher, err := statsd.New(*statsdAddr, sopts...)
+		if err != nil {
+			logger.Fatal("failed to create statsd pusher", zap.Error(err))
+		}
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+
+			if err := pusher.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				logger.Error("statsd pusher stopped", zap.Error(err))
+			}
+		}()
+	}
+
+	if *pushURL != "" {
+		popts := []pushgateway.Option{
+			pushgateway.WithLogger(tracelog.NewLogger(tracelog.WithLogger(logger))),
+			pushgateway.WithGatherer(gatherer),
+			pushgateway.WithJob(*pushJob),
+			pushgateway.WithGrouping(pushGrouping),
+			pushgateway.WithCredentials(*pushUser, os.Getenv("PUSHGATEWAY_PASSWORD")),
+			pushgateway.WithInterval(*pushInt),
+		}
+		if *pushClear {
+			popts = append(popts, pushgateway.WithDeleteOnShutdown())
+		}
+
+		pusher, err := pushgateway.New(*pushURL, popts...)
+		if err != nil {
+			logger.Fatal("failed to create pushgateway pusher", zap.Error(err))
+		}
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+
+			if err := pusher.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				logger.Error("pushgateway pusher stopped", zap.Error(err))
+			}
+		}()
+	}
+
+	if *rwURL != "" {
+		writer, err := remotewrite.New(
+			*rwURL,
+			remotewrite.WithLogger(tracelog.NewLogger(tracelog.WithLogger(logger))),
+			remotewrite.WithGatherer(gatherer),
+			remotewrite.WithCredentials(*rwUser, os.Getenv("REMOTE_WRITE_PASSWORD")),
+			remotewrite.WithInterval(*rwInt),
+			remotewrite.WithRetries(*rwRetries),
+		)
+		if err != nil {
+			logger.Fatal("failed to create remote writer", zap.Error(err))
+		}
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+
+			if err := writer.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				logger.Error("remote writer stopped", zap.Error(err))
+			}
+		}()
+	}
+
+	if *alertHook != "" || *alertURL != "" {
+		alerter, err := alert.New(
+			alert.WithLogger(tracelog.NewLogger(tracelog.WithLogger(logger))),
+			alert.WithWebhook(*alertHook),
+			alert.WithURLTemplate(*alertURL),
+			alert.WithInterval(*alertInt),
+			alert.WithBatteryThreshold(*alertBattery),
+			alert.WithUnreachableAfter(*alertReach),
+		)
+		if err != nil {
+			logger.Fatal("failed to create alerter", zap.Error(err))
+		}
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+
+			if err := alerter.Run(ctx, coll); err != nil && !errors.Is(err, context.Canceled) {
+				logger.Error("alerter stopped", zap.Error(err))
+			}
+		}()
+	}
+
+	if *debug != "" {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+
+			// profiles are served over plain HTTP without authentication,
+			// the debug address is meant to stay local
+			if err := web.ListenAndServeContext(ctx, *debug, debugHandler(), web.Config{}); err != nil {
+				logger.Error("debug server stopped", zap.Error(err))
+			}
+		}()
+	}
+
+	// importing pprof registers it with the default mux, metrics are served
+	// from their own so profiles stay on the debug address
+	mux := http.NewServeMux()
+	mux.Handle("/", coll)
+	mux.Handle("/api/v1/state", collector.StateHandler(coll))
+	mux.Handle("/events", collector.EventsHandler(coll))
+	mux.Handle("/-/collect", collector.CollectHandler(coll, *triggerWait))
+	if *historyDB != "" {
+		store, err := history.Open(
+			*historyDB,
+			history.WithLogger(tracelog.NewLogger(tracelog.WithLogger(logger))),
+			history.WithInterval(*historyInt),
+			history.WithRetention(*historyRet),
+		)
+		if err != nil {
+			logger.Fatal("failed to open history database", zap.Error(err))
+		}
+		defer store.Close()
+
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+
+			if err := store.Run(ctx, coll); err != nil && !errors.Is(err, context.Canceled) {
+				logger.Error("history recorder stopped", zap.Error(err))
+			}
+		}()
+
+		mux.Handle("/api/v1/history", store.Handler())
+	}
+	var webConfig web.Config
+	if *webCfg != "" {
+		webConfig, err = web.LoadConfig(*webCfg)
+		if err != nil {
+			logger.Fatal("failed to load web config", zap.Error(err))
+		}
+	}
+	if *tlsCert != "" || *tlsKey != "" {
+		webConfig.TLS.CertFile = *tlsCert
+		webConfig.TLS.KeyFile = *tlsKey
+	}
+	if *tlsWatch {
+		webConfig.TLS.ReloadCerts = true
+	}
+	if *clientCA != "" {
+		webConfig.TLS.ClientCAFile = *clientCA
+	}
+	if _, err := webConfig.TLSConfig(); err != nil {
+		logger.Fatal("invalid TLS configuration", zap.Error(err))
+	}
+
+	// searching makes the bridges pair with devices in range, it is only
+	// served to authenticated clients
+	if webConfig.Authenticates() {
+		mux.Handle("/-/scan", collector.ScanHandler(coll, *scanWait))
+	} else {
+		logger.Info("not serving /-/scan, it requires basic auth users, a bearer token or client certificates to be configured")
+	}
+
+	// the control API changes the state of the home, it is never served
+	// unauthenticated
+	if *controls {
+		if !webConfig.Authenticates() {
+			logger.Fatal("the control API requires basic auth users, a bearer token or client certificates to be configured")
+		}
+
+		mux.Handle("/api/v1/bridges/", http.StripPrefix("/api/v1/bridges", collector.ControlHandler(coll)))
+	}
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+
+		if err := web.ListenAndServeContext(ctx, ":"+*promPort, mux, webConfig); err != nil {
+			logger.Fatal("failed to serve metrics", zap.Error(err))
+		}
+	}()
+
+	if err := coll.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
 		logger.Fatal("fell out", zap.Error(err))
 	}
+
+	logger.Info("Stopping metric collector")
+	workers.Wait()
+}
+
+// hueConfigs builds the bridge configuration from the environment. Multiple
+// bridges are configured by providing comma separated values for
+// HUE_ADDRESS, HUE_USERNAME and optionally HUE_BRIDGE_NAME and HUE_BRIDGE_ID,
+// matched up by position. Bridges without an address are located through
+// discovery. Setting HUE_CLIP_V2 enables collection through the CLIP v2 API.
+func hueConfigs() []collector.HueConfig {
+	addrs := strings.Split(os.Getenv("HUE_ADDRESS"), ",")
+	users := strings.Split(os.Getenv("HUE_USERNAME"), ",")
+	names := strings.Split(os.Getenv("HUE_BRIDGE_NAME"), ",")
+	ids := strings.Split(os.Getenv("HUE_BRIDGE_ID"), ",")
+	clipV2, _ := strconv.ParseBool(os.Getenv("HUE_CLIP_V2"))
+
+	var cfgs []collector.HueConfig
+	for i, addr := range addrs {
+		cfg := collector.HueConfig{
+			IP:     strings.TrimSpace(addr),
+			ClipV2: clipV2,
+		}
+		if i < len(users) {
+			cfg.Username = strings.TrimSpace(users[i])
+		}
+		if i < len(names) {
+			cfg.Name = strings.TrimSpace(names[i])
+		}
+		if i < len(ids) {
+			cfg.ID = strings.TrimSpace(ids[i])
+		}
+
+		cfgs = append(cfgs, cfg)
+	}
+
+	return cfgs
 }
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ninnemana/hue-exporter/collector"
+	"gopkg.in/yaml.v2"
+)
+
+// mappingFile declares metrics reported from fields of lights, groups and
+// sensors, and metrics derived from the collected state by expressions,
+// such as:
+//
+//	metrics:
+//	  - name: sensor_sensitivity_raw
+//	    help: Sensitivity configured on the motion sensor.
+//	    resource: sensors
+//	    path: config.sensitivity
+//	    labels:
+//	      type: type
+//	derived:
+//	  - name: kitchen_lights_on
+//	    help: Number of lights on in the kitchen.
+//	    expr: count(lights.on && group == "Kitchen")
+type mappingFile struct {
+	Metrics []collector.FieldMapping  `yaml:"metrics"`
+	Derived []collector.DerivedMetric `yaml:"derived"`
+}
+
+// readMappings reads the field mappings and derived metrics of the file at
+// path, none when path is empty.
+func readMappings(path string) (*mappingFile, error) {
+	if path == "" {
+		return &mappingFile{}, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mapping file: %w", err)
+	}
+
+	var file mappingFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to decode mapping file: %w", err)
+	}
+
+	return &file, nil
+}
@@ -0,0 +1,144 @@
+package mqtt
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ninnemana/hue-exporter/collector"
+)
+
+// DefaultDiscoveryPrefix is the topic prefix Home Assistant discovers
+// entities under unless configured otherwise.
+const DefaultDiscoveryPrefix = "homeassistant"
+
+// discoveryConfig is the configuration of a Home Assistant entity, published
+// to <discovery prefix>/<component>/<node>/<object>/config.
+type discoveryConfig struct {
+	Name              string          `json:"name"`
+	UniqueID          string          `json:"unique_id"`
+	StateTopic        string          `json:"state_topic"`
+	ValueTemplate     string          `json:"value_template"`
+	AvailabilityTopic string          `json:"availability_topic"`
+	DeviceClass       string          `json:"device_class,omitempty"`
+	StateClass        string          `json:"state_class,omitempty"`
+	UnitOfMeasurement string          `json:"unit_of_measurement,omitempty"`
+	PayloadOn         string          `json:"payload_on,omitempty"`
+	PayloadOff        string          `json:"payload_off,omitempty"`
+	Device            discoveryDevice `json:"device"`
+}
+
+type discoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer,omitempty"`
+	Model        string   `json:"model,omitempty"`
+	SwVersion    string   `json:"sw_version,omitempty"`
+}
+
+// entity is a Home Assistant entity derived from a Hue sensor.
+type entity struct {
+	component string
+	object    string
+	config    discoveryConfig
+}
+
+// entities returns the Home Assistant entities exposing the sensor, reading
+// its state from the sensor's state topic.
+func (p *Publisher) entities(bridge string, s collector.Sensor) []entity {
+	id := s.UniqueID
+	if id == "" {
+		id = bridge + "-" + strconv.Itoa(s.ID)
+	}
+
+	// the temperature, light level and presence sensors of a motion sensor
+	// share the MAC address prefix of their unique identifier, so they're
+	// grouped under one device
+	device := id
+	if i := strings.Index(device, "-"); i > 0 && s.UniqueID != "" {
+		device = device[:i]
+	}
+
+	base := discoveryConfig{
+		StateTopic:        p.topic(bridge, "sensors", s.ID),
+		AvailabilityTopic: p.prefix + "/status",
+		Device: discoveryDevice{
+			Identifiers:  []string{"hue_" + device},
+			Name:         s.Name,
+			Manufacturer: s.ManufacturerName,
+			Model:        s.ModelID,
+			SwVersion:    s.SwVersion,
+		},
+	}
+
+	var out []entity
+	add := func(component, kind string, fn func(*discoveryConfig)) {
+		c := base
+		c.Name = s.Name + " " + kind
+		c.UniqueID = "hue_" + objectID(id) + "_" + kind
+		fn(&c)
+
+		out = append(out, entity{component, objectID(id) + "_" + kind, c})
+	}
+
+	switch s.Type {
+	case "ZLLTemperature":
+		add("sensor", "temperature", func(c *discoveryConfig) {
+			c.DeviceClass = "temperature"
+			c.StateClass = "measurement"
+			c.UnitOfMeasurement = "°C"
+			c.ValueTemplate = "{{ value_json.state.temperature / 100 }}"
+		})
+	case "ZLLLightLevel":
+		add("sensor", "illuminance", func(c *discoveryConfig) {
+			c.DeviceClass = "illuminance"
+			c.StateClass = "measurement"
+			c.UnitOfMeasurement = "lx"
+			// lightlevel is reported as 10000 * log10(lux) + 1
+			c.ValueTemplate = "{{ (10 ** ((value_json.state.lightlevel - 1) / 10000)) | round(1) }}"
+		})
+	case "ZLLPresence":
+		add("binary_sensor", "motion", func(c *discoveryConfig) {
+			c.DeviceClass = "motion"
+			c.PayloadOn = "ON"
+			c.PayloadOff = "OFF"
+			c.ValueTemplate = "{{ 'ON' if value_json.state.presence else 'OFF' }}"
+		})
+	}
+
+	if _, ok := s.Config["battery"].(float64); ok {
+		add("sensor", "battery", func(c *discoveryConfig) {
+			c.DeviceClass = "battery"
+			c.StateClass = "measurement"
+			c.UnitOfMeasurement = "%"
+			c.ValueTemplate = "{{ value_json.config.battery }}"
+		})
+	}
+
+	return out
+}
+
+// publishDiscovery publishes the Home Assistant discovery configuration of
+// every supported sensor.
+func (p *Publisher) publishDiscovery(st collector.State) {
+	for _, b := range st.Bridges {
+		node := "hue_" + objectID(b.Name)
+		for _, s := range b.Sensors {
+			for _, e := range p.entities(b.Name, s) {
+				p.publishRetained(p.discovery+"/"+e.component+"/"+node+"/"+e.object+"/config", e.config)
+			}
+		}
+	}
+}
+
+// objectID replaces the characters Home Assistant doesn't allow in node
+// and object identifiers.
+func objectID(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
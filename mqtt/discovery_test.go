@@ -0,0 +1,84 @@
+package mqtt
+
+import (
+	"testing"
+
+	"github.com/ninnemana/hue-exporter/collector"
+	"github.com/ninnemana/hue-exporter/hueclient"
+)
+
+func TestEntities(t *testing.T) {
+	tests := []struct {
+		name   string
+		sensor hueclient.Sensor
+		// want are the object identifiers of the entities
+		want   []string
+		device string
+	}{
+		{
+			name: "temperature",
+			sensor: hueclient.Sensor{
+				Name:     "Hallway",
+				Type:     "ZLLTemperature",
+				UniqueID: "00:17:88:01:02:03:04:05-02-0402",
+				Config:   map[string]interface{}{"battery": float64(80)},
+			},
+			want:   []string{"00_17_88_01_02_03_04_05-02-0402_temperature", "00_17_88_01_02_03_04_05-02-0402_battery"},
+			device: "hue_00:17:88:01:02:03:04:05",
+		},
+		{
+			name:   "presence",
+			sensor: hueclient.Sensor{Name: "Hallway", Type: "ZLLPresence"},
+			want:   []string{"Office-4_motion"},
+			device: "hue_Office-4",
+		},
+		{
+			name:   "light level",
+			sensor: hueclient.Sensor{Name: "Hallway", Type: "ZLLLightLevel"},
+			want:   []string{"Office-4_illuminance"},
+			device: "hue_Office-4",
+		},
+		{
+			name:   "unsupported",
+			sensor: hueclient.Sensor{Name: "Daylight", Type: "Daylight"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestPublisher(t, WithHomeAssistant(DefaultDiscoveryPrefix))
+
+			entities := p.entities("Office", collector.Sensor{ID: 4, Sensor: tt.sensor})
+			if len(entities) != len(tt.want) {
+				t.Fatalf("got %d entities, want %d", len(entities), len(tt.want))
+			}
+
+			for i, e := range entities {
+				if e.object != tt.want[i] {
+					t.Errorf("entity %d: %s, want %s", i, e.object, tt.want[i])
+				}
+				if got := e.config.Device.Identifiers[0]; got != tt.device {
+					t.Errorf("entity %d device: %s, want %s", i, got, tt.device)
+				}
+				if want := "hue/Office/sensors/4"; e.config.StateTopic != want {
+					t.Errorf("entity %d state topic: %s, want %s", i, e.config.StateTopic, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPublishDiscovery(t *testing.T) {
+	p, c := newTestPublisher(t, WithHomeAssistant("ha/"))
+
+	p.publishState(testState(127))
+
+	want := []string{
+		"ha/sensor/hue_Up_stairs/Up_stairs-4_temperature/config",
+		"hue/Up_stairs/lights/1",
+		"hue/Up_stairs/sensors/4",
+	}
+	if got := c.topics(); !equal(got, want) {
+		t.Errorf("published %q, want %q", got, want)
+	}
+}
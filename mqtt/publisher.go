@@ -0,0 +1,282 @@
+// Package mqtt publishes the state collected from the bridges to an MQTT
+// broker, for consumers such as Home Assistant or Node-RED.
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/ninnemana/hue-exporter/collector"
+	"github.com/ninnemana/tracelog"
+	"go.uber.org/zap"
+)
+
+const (
+	// connectTimeout bounds connecting to the broker and each publish.
+	connectTimeout = time.Second * 10
+)
+
+// ErrInvalidLogger is returned when the publisher is created without a
+// logger.
+var ErrInvalidLogger = errors.New("a logger is required to publish to mqtt")
+
+// Publisher publishes the state of every light, group and sensor as a
+// retained message on its own topic, republished as it changes, and state
+// changes as they are found on events topics:
+//
+//	<prefix>/status                          online or offline
+//	<prefix>/<bridge>/<lights|groups|sensors>/<id>
+//	<prefix>/<bridge>/events/<type>
+//
+// With Home Assistant discovery enabled, the configuration of an entity for
+// each temperature, light level, motion and battery reading is published
+// too, so sensors appear in Home Assistant without configuring them.
+type Publisher struct {
+	log       *tracelog.TraceLogger
+	client    paho.Client
+	prefix    string
+	interval  time.Duration
+	qos       byte
+	discovery string
+
+	// published are the payloads last published to each state topic, so
+	// unchanged state isn't republished.
+	mu        sync.Mutex
+	published map[string][]byte
+}
+
+type Option func(*Publisher, *paho.ClientOptions)
+
+func WithLogger(l *tracelog.TraceLogger) Option {
+	return func(p *Publisher, _ *paho.ClientOptions) {
+		p.log = l
+	}
+}
+
+// WithTopicPrefix sets the prefix of every topic published to, defaults to
+// hue.
+func WithTopicPrefix(prefix string) Option {
+	return func(p *Publisher, _ *paho.ClientOptions) {
+		p.prefix = strings.TrimSuffix(prefix, "/")
+	}
+}
+
+// WithCredentials authenticates with the broker.
+func WithCredentials(username, password string) Option {
+	return func(_ *Publisher, o *paho.ClientOptions) {
+		o.SetUsername(username)
+		o.SetPassword(password)
+	}
+}
+
+// WithClientID sets the client identifier presented to the broker, defaults
+// to hue-exporter.
+func WithClientID(id string) Option {
+	return func(_ *Publisher, o *paho.ClientOptions) {
+		o.SetClientID(id)
+	}
+}
+
+// WithInterval sets how often the state is checked for changes to publish,
+// in addition to whenever a change is found between collection cycles.
+func WithInterval(d time.Duration) Option {
+	return func(p *Publisher, _ *paho.ClientOptions) {
+		p.interval = d
+	}
+}
+
+// WithQoS sets the quality of service messages are published with.
+func WithQoS(qos byte) Option {
+	return func(p *Publisher, _ *paho.ClientOptions) {
+		p.qos = qos
+	}
+}
+
+// WithHomeAssistant publishes Home Assistant MQTT discovery configuration
+// under the discovery prefix, usually DefaultDiscoveryPrefix.
+func WithHomeAssistant(prefix string) Option {
+	return func(p *Publisher, _ *paho.ClientOptions) {
+		p.discovery = strings.TrimSuffix(prefix, "/")
+	}
+}
+
+// New creates a publisher to the broker, given as a URL such as
+// tcp://localhost:1883.
+func New(broker string, opts ...Option) (*Publisher, error) {
+	p := &Publisher{
+		prefix:    "hue",
+		interval:  time.Second * 30,
+		published: map[string][]byte{},
+	}
+
+	o := paho.NewClientOptions().
+		AddBroker(broker).
+		SetClientID("hue-exporter").
+		SetAutoReconnect(true).
+		SetConnectRetry(true)
+	for _, opt := range opts {
+		opt(p, o)
+	}
+
+	if p.log == nil {
+		return nil, ErrInvalidLogger
+	}
+
+	o.SetWill(p.prefix+"/status", "offline", p.qos, true)
+	o.SetOnConnectHandler(func(c paho.Client) {
+		// the retained state may have been lost along with the broker, so
+		// all of it is published again
+		p.mu.Lock()
+		p.published = map[string][]byte{}
+		p.mu.Unlock()
+
+		c.Publish(p.prefix+"/status", p.qos, true, "online")
+	})
+	o.SetConnectionLostHandler(func(_ paho.Client, err error) {
+		p.log.Warn("lost connection to mqtt broker", zap.Error(err))
+	})
+
+	p.client = paho.NewClient(o)
+
+	return p, nil
+}
+
+// Run publishes the state collected by c until ctx is done. The broker is
+// connected to in the background, retrying until it is reachable.
+func (p *Publisher) Run(ctx context.Context, c collector.Collector) error {
+	connect := p.client.Connect()
+	go func() {
+		<-connect.Done()
+		if err := connect.Error(); err != nil {
+			p.log.Error("failed to connect to mqtt broker", zap.Error(err))
+		}
+	}()
+
+	defer p.client.Disconnect(250)
+
+	events := c.Subscribe(ctx)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	p.publishState(c.State())
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return ctx.Err()
+			}
+
+			p.publishEvent(e)
+			p.publishState(c.State())
+		case <-ticker.C:
+			p.publishState(c.State())
+		case <-ctx.Done():
+			if !p.client.IsConnectionOpen() {
+				return ctx.Err()
+			}
+
+			if err := wait(p.client.Publish(p.prefix+"/status", p.qos, true, "offline")); err != nil {
+				p.log.Error("failed to publish offline status", zap.Error(err))
+			}
+
+			return ctx.Err()
+		}
+	}
+}
+
+// publishState publishes the state of every resource which changed since
+// it was last published.
+func (p *Publisher) publishState(st collector.State) {
+	if !p.client.IsConnectionOpen() {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != "" {
+		p.publishDiscovery(st)
+	}
+
+	for _, b := range st.Bridges {
+		for _, l := range b.Lights {
+			p.publishRetained(p.topic(b.Name, "lights", l.ID), l)
+		}
+
+		for _, g := range b.Groups {
+			p.publishRetained(p.topic(b.Name, "groups", g.ID), g)
+		}
+
+		for _, s := range b.Sensors {
+			p.publishRetained(p.topic(b.Name, "sensors", s.ID), s)
+		}
+	}
+}
+
+func (p *Publisher) publishRetained(topic string, v interface{}) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		p.log.Error("failed to encode state", zap.String("topic", topic), zap.Error(err))
+
+		return
+	}
+
+	if bytes.Equal(p.published[topic], payload) {
+		return
+	}
+
+	if err := wait(p.client.Publish(topic, p.qos, true, payload)); err != nil {
+		p.log.Error("failed to publish state", zap.String("topic", topic), zap.Error(err))
+
+		return
+	}
+
+	p.published[topic] = payload
+}
+
+func (p *Publisher) publishEvent(e collector.Event) {
+	if !p.client.IsConnectionOpen() {
+		return
+	}
+
+	topic := p.prefix + "/" + topicLevel(e.Bridge) + "/events/" + e.Type
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		p.log.Error("failed to encode event", zap.String("topic", topic), zap.Error(err))
+
+		return
+	}
+
+	if err := wait(p.client.Publish(topic, p.qos, false, payload)); err != nil {
+		p.log.Error("failed to publish event", zap.String("topic", topic), zap.Error(err))
+	}
+}
+
+func (p *Publisher) topic(bridge, resource string, id int) string {
+	return p.prefix + "/" + topicLevel(bridge) + "/" + resource + "/" + strconv.Itoa(id)
+}
+
+// topicLevel replaces the characters MQTT reserves in topic names.
+func topicLevel(s string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(s)
+}
+
+// wait waits for the operation to complete, failing when it takes longer
+// than connectTimeout.
+func wait(t paho.Token) error {
+	if !t.WaitTimeout(connectTimeout) {
+		return errors.New("timed out waiting for mqtt broker")
+	}
+
+	return t.Error()
+}
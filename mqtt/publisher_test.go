@@ -0,0 +1,176 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/ninnemana/hue-exporter/collector"
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"github.com/ninnemana/tracelog"
+	"go.uber.org/zap"
+)
+
+var testLogger = tracelog.NewLogger(tracelog.WithLogger(zap.NewNop()))
+
+// message is a message published through fakeClient.
+type message struct {
+	topic    string
+	retained bool
+	payload  []byte
+}
+
+// fakeClient records the messages published through it, the methods the
+// publisher doesn't use are left unimplemented.
+type fakeClient struct {
+	paho.Client
+	open      bool
+	published []message
+}
+
+func (c *fakeClient) IsConnectionOpen() bool {
+	return c.open
+}
+
+func (c *fakeClient) Publish(topic string, _ byte, retained bool, payload interface{}) paho.Token {
+	var b []byte
+	switch p := payload.(type) {
+	case []byte:
+		b = p
+	case string:
+		b = []byte(p)
+	}
+	c.published = append(c.published, message{topic, retained, b})
+
+	return doneToken{}
+}
+
+// topics returns the topics published to since the last call, sorted.
+func (c *fakeClient) topics() []string {
+	out := make([]string, 0, len(c.published))
+	for _, m := range c.published {
+		out = append(out, m.topic)
+	}
+	sort.Strings(out)
+	c.published = nil
+
+	return out
+}
+
+// doneToken is a completed operation.
+type doneToken struct{}
+
+func (doneToken) Wait() bool                     { return true }
+func (doneToken) WaitTimeout(time.Duration) bool { return true }
+func (doneToken) Done() <-chan struct{}          { c := make(chan struct{}); close(c); return c }
+func (doneToken) Error() error                   { return nil }
+
+func newTestPublisher(t *testing.T, opts ...Option) (*Publisher, *fakeClient) {
+	t.Helper()
+
+	p, err := New("tcp://localhost:1883", append([]Option{WithLogger(testLogger)}, opts...)...)
+	if err != nil {
+		t.Fatalf("failed to create publisher: %v", err)
+	}
+
+	c := &fakeClient{open: true}
+	p.client = c
+
+	return p, c
+}
+
+func testState(brightness uint8) collector.State {
+	return collector.State{Bridges: []collector.BridgeState{{
+		Name: "Up/stairs",
+		Lights: []collector.Light{
+			{ID: 1, Light: hueclient.Light{Name: "Desk", State: &hueclient.State{On: true, Bri: brightness}}},
+		},
+		Sensors: []collector.Sensor{
+			{ID: 4, Sensor: hueclient.Sensor{Name: "Hallway", Type: "ZLLTemperature"}},
+		},
+	}}}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("tcp://localhost:1883"); err != ErrInvalidLogger {
+		t.Errorf("without logger: %v, want %v", err, ErrInvalidLogger)
+	}
+}
+
+func TestPublishState(t *testing.T) {
+	p, c := newTestPublisher(t, WithTopicPrefix("home/hue/"))
+
+	p.publishState(testState(127))
+	want := []string{"home/hue/Up_stairs/lights/1", "home/hue/Up_stairs/sensors/4"}
+	if got := c.topics(); !equal(got, want) {
+		t.Errorf("published %q, want %q", got, want)
+	}
+
+	p.publishState(testState(127))
+	if got := c.topics(); len(got) != 0 {
+		t.Errorf("republished unchanged state to %q", got)
+	}
+
+	p.publishState(testState(254))
+	want = []string{"home/hue/Up_stairs/lights/1"}
+	if got := c.topics(); !equal(got, want) {
+		t.Errorf("published %q after a change, want %q", got, want)
+	}
+
+	c.open = false
+	p.publishState(testState(1))
+	if got := c.topics(); len(got) != 0 {
+		t.Errorf("published %q while disconnected", got)
+	}
+}
+
+func TestPublishStateRetained(t *testing.T) {
+	p, c := newTestPublisher(t)
+
+	p.publishState(testState(127))
+	for _, m := range c.published {
+		if !m.retained {
+			t.Errorf("%s was not retained", m.topic)
+		}
+	}
+
+	var l collector.Light
+	if err := json.Unmarshal(c.published[0].payload, &l); err != nil {
+		t.Fatalf("failed to decode %s: %v", c.published[0].topic, err)
+	}
+	if l.ID != 1 || l.State.Bri != 127 {
+		t.Errorf("published light %d at %d, want light 1 at 127", l.ID, l.State.Bri)
+	}
+}
+
+func TestPublishEvent(t *testing.T) {
+	p, c := newTestPublisher(t)
+
+	p.publishEvent(collector.Event{Type: "button", Bridge: "Up/stairs", ID: 7})
+	if len(c.published) != 1 {
+		t.Fatalf("published %d messages, want 1", len(c.published))
+	}
+
+	m := c.published[0]
+	if want := "hue/Up_stairs/events/button"; m.topic != want {
+		t.Errorf("topic: %s, want %s", m.topic, want)
+	}
+	if m.retained {
+		t.Error("event was retained")
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,195 @@
+// Package openmetrics serves Prometheus metrics in the OpenMetrics format to
+// scrapers asking for it, including the _created series of counters which
+// the client library doesn't write, and in the text format to the others.
+package openmetrics
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Handler serves the metrics of g. Counters report when they were created:
+// series present from the first scrape on were created as the exporter
+// started, series appearing later when they were first scraped.
+func Handler(g prometheus.Gatherer, opts ...Option) http.Handler {
+	h := &handler{
+		gatherer: g,
+		text:     promhttp.HandlerFor(g, promhttp.HandlerOpts{}),
+		start:    time.Now(),
+		mirrored: map[string]bool{},
+		created:  map[string]time.Time{},
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
+}
+
+// Option configures the handler.
+type Option func(*handler)
+
+// WithoutCreated writes the counters with the given names without their
+// _created series. It is meant for counters mirroring counts kept
+// elsewhere, which started before the exporter saw them.
+func WithoutCreated(names ...string) Option {
+	return func(h *handler) {
+		for _, name := range names {
+			h.mirrored[name] = true
+		}
+	}
+}
+
+type handler struct {
+	gatherer prometheus.Gatherer
+	// text serves the scrapers not negotiating OpenMetrics.
+	text  http.Handler
+	start time.Time
+	// mirrored are the names of the counters written without _created.
+	mirrored map[string]bool
+
+	mu      sync.Mutex
+	scraped bool
+	// created holds when each series was first scraped, series missing
+	// from a scrape are dropped so they are created anew when they return.
+	created map[string]time.Time
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if expfmt.NegotiateIncludingOpenMetrics(r.Header) != expfmt.FmtOpenMetrics {
+		h.text.ServeHTTP(w, r)
+
+		return
+	}
+
+	mfs, err := h.gatherer.Gather()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to gather metrics: %v", err), http.StatusInternalServerError)
+
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := h.encode(&buf, mfs); err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode metrics: %v", err), http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", string(expfmt.FmtOpenMetrics))
+	_, _ = buf.WriteTo(w)
+}
+
+// encode writes the families in the OpenMetrics format, following the
+// sample of every counter with its _created series.
+func (h *handler) encode(buf *bytes.Buffer, mfs []*dto.MetricFamily) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	seen := make(map[string]bool, len(h.created))
+	for _, mf := range mfs {
+		if mf.GetType() != dto.MetricType_COUNTER || h.mirrored[mf.GetName()] {
+			if _, err := expfmt.MetricFamilyToOpenMetrics(buf, mf); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		var family bytes.Buffer
+		if _, err := expfmt.MetricFamilyToOpenMetrics(&family, mf); err != nil {
+			return err
+		}
+
+		// each metric of a counter family is written as a single sample, in
+		// order, after the metadata
+		name := strings.TrimSuffix(mf.GetName(), "_total") + "_created"
+		sc := bufio.NewScanner(&family)
+		i := 0
+		for sc.Scan() {
+			line := sc.Text()
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+
+			if strings.HasPrefix(line, "#") || i >= len(mf.Metric) {
+				continue
+			}
+
+			labels := labelString(mf.Metric[i].Label)
+			seen[name+labels] = true
+			created := h.createdAt(name+labels, now)
+			fmt.Fprintf(buf, "%s%s %s\n", name, labels, strconv.FormatFloat(float64(created.UnixNano())/1e9, 'f', 3, 64))
+			i++
+		}
+		if err := sc.Err(); err != nil {
+			return err
+		}
+	}
+	h.scraped = true
+
+	for series := range h.created {
+		if !seen[series] {
+			delete(h.created, series)
+		}
+	}
+
+	_, err := expfmt.FinalizeOpenMetrics(buf)
+
+	return err
+}
+
+// createdAt returns when the series was created, recording it when the
+// series is scraped for the first time.
+func (h *handler) createdAt(series string, now time.Time) time.Time {
+	if t, ok := h.created[series]; ok {
+		return t
+	}
+
+	t := now
+	if !h.scraped {
+		t = h.start
+	}
+	h.created[series] = t
+
+	return t
+}
+
+// labelString formats the label pairs as they are written in a sample.
+func labelString(pairs []*dto.LabelPair) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	sorted := make([]*dto.LabelPair, len(pairs))
+	copy(sorted, pairs)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].GetName() < sorted[j].GetName()
+	})
+
+	escape := strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, p := range sorted {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, p.GetName(), escape.Replace(p.GetValue()))
+	}
+	b.WriteByte('}')
+
+	return b.String()
+}
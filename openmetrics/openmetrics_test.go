@@ -0,0 +1,90 @@
+package openmetrics
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// scrape returns the value of each sample served by h in the OpenMetrics
+// format, keyed by the series.
+func scrape(t *testing.T, h http.Handler) map[string]string {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", string(expfmt.FmtOpenMetrics))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", rec.Code)
+	}
+
+	samples := map[string]string{}
+	sc := bufio.NewScanner(rec.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if i := strings.LastIndexByte(line, ' '); i > 0 {
+			samples[line[:i]] = line[i+1:]
+		}
+	}
+
+	return samples
+}
+
+func TestHandlerCreated(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	collections := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "collections_total", Help: "Collections."}, []string{"bridge"})
+	triggered := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "rule_triggered_total", Help: "Triggers."}, []string{"id"})
+	reg.MustRegister(collections, triggered)
+
+	collections.WithLabelValues("home").Inc()
+	triggered.WithLabelValues("1").Add(42)
+
+	h := Handler(reg, WithoutCreated("rule_triggered_total"))
+
+	got := scrape(t, h)
+	created, ok := got[`collections_created{bridge="home"}`]
+	if !ok {
+		t.Fatal("collections_created is not served")
+	}
+	if _, ok := got[`rule_triggered_created{id="1"}`]; ok {
+		t.Error("rule_triggered_created is served for a mirrored counter")
+	}
+	if got[`rule_triggered_total{id="1"}`] != "42.0" {
+		t.Errorf("rule_triggered_total = %s, want 42.0", got[`rule_triggered_total{id="1"}`])
+	}
+
+	// a series missing from a scrape is created anew when it returns
+	collections.DeleteLabelValues("home")
+	scrape(t, h)
+	time.Sleep(10 * time.Millisecond)
+	collections.WithLabelValues("home").Inc()
+
+	if again := scrape(t, h)[`collections_created{bridge="home"}`]; again == created {
+		t.Errorf("collections_created is still %s once the series returned", created)
+	}
+}
+
+func TestHandlerText(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := prometheus.NewCounter(prometheus.CounterOpts{Name: "collections_total", Help: "Collections."})
+	reg.MustRegister(c)
+
+	rec := httptest.NewRecorder()
+	Handler(reg).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if body := rec.Body.String(); strings.Contains(body, "_created") || !strings.Contains(body, "collections_total 0") {
+		t.Errorf("got %q, want the counter in the text format", body)
+	}
+}
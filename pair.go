@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ninnemana/hue-exporter/collector"
+	"github.com/ninnemana/hue-exporter/discovery"
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"go.uber.org/zap"
+)
+
+const (
+	// linkButtonNotPressed is the Hue API error type returned while the link
+	// button has not been pressed.
+	linkButtonNotPressed = 101
+)
+
+// credential is a bridge username persisted by the pairing flow.
+type credential struct {
+	ID       string `json:"id,omitempty"`
+	Address  string `json:"address"`
+	Username string `json:"username"`
+}
+
+// pair creates a new user on the bridge, waiting for the link button to be
+// pressed, and persists the generated username to the credentials file.
+func pair(ctx context.Context, logger *zap.Logger, path string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cred, err := pairTarget(ctx)
+	if err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	bridge := hueclient.New(cred.Address, "")
+
+	logger.Info("press the link button on the bridge to complete pairing", zap.String("address", cred.Address))
+
+	ticker := time.NewTicker(time.Second * 2)
+	defer ticker.Stop()
+
+	for {
+		user, err := bridge.CreateUserContext(ctx, "hue-exporter#"+hostname)
+		if err == nil {
+			cred.Username = user
+			break
+		}
+
+		var apiErr *hueclient.APIError
+		if !errors.As(err, &apiErr) || apiErr.Type != linkButtonNotPressed {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("link button was not pressed: %w", ctx.Err())
+		}
+	}
+
+	creds, err := loadCredentials(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	// replace any previous pairing with the same bridge
+	kept := creds[:0]
+	for _, c := range creds {
+		if c.Address == cred.Address || (cred.ID != "" && strings.EqualFold(c.ID, cred.ID)) {
+			continue
+		}
+
+		kept = append(kept, c)
+	}
+
+	if err := saveCredentials(path, append(kept, cred)); err != nil {
+		return err
+	}
+
+	logger.Info("paired with bridge", zap.String("address", cred.Address), zap.String("credentials", path))
+
+	return nil
+}
+
+// pairTarget resolves the bridge to pair with, preferring HUE_ADDRESS and
+// falling back to discovery.
+func pairTarget(ctx context.Context) (credential, error) {
+	if addr := os.Getenv("HUE_ADDRESS"); addr != "" {
+		return credential{
+			ID:      os.Getenv("HUE_BRIDGE_ID"),
+			Address: strings.Split(addr, ",")[0],
+		}, nil
+	}
+
+	bridges, err := discovery.Default().Discover(ctx)
+	if err != nil {
+		return credential{}, fmt.Errorf("failed to discover bridge to pair with: %w", err)
+	}
+
+	return credential{
+		ID:      bridges[0].ID,
+		Address: bridges[0].Address,
+	}, nil
+}
+
+func loadCredentials(path string) ([]credential, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var creds []credential
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("failed to decode credentials file: %w", err)
+	}
+
+	return creds, nil
+}
+
+func saveCredentials(path string, creds []credential) error {
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write credentials file: %w", err)
+	}
+
+	return nil
+}
+
+// applyCredentials fills in usernames for bridges configured without one
+// from the persisted credentials, matching on bridge ID or address.
+func applyCredentials(cfgs []collector.HueConfig, creds []credential) []collector.HueConfig {
+	for i, cfg := range cfgs {
+		if cfg.Username != "" {
+			continue
+		}
+
+		for _, c := range creds {
+			switch {
+			case cfg.ID != "" && strings.EqualFold(cfg.ID, c.ID),
+				cfg.IP != "" && cfg.IP == c.Address,
+				cfg.IP == "" && cfg.ID == "" && len(cfgs) == 1:
+				cfgs[i].Username = c.Username
+				if cfgs[i].ID == "" {
+					cfgs[i].ID = c.ID
+				}
+				if cfgs[i].IP == "" {
+					cfgs[i].IP = c.Address
+				}
+			}
+
+			if cfgs[i].Username != "" {
+				break
+			}
+		}
+	}
+
+	return cfgs
+}
@@ -0,0 +1,184 @@
+// Package pushgateway pushes the collected metrics to a Prometheus
+// Pushgateway, for exporters running on networks Prometheus can't scrape.
+package pushgateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/ninnemana/tracelog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"go.uber.org/zap"
+)
+
+// pushTimeout bounds each push to the gateway.
+const pushTimeout = time.Second * 10
+
+var (
+	// ErrInvalidLogger is returned when the pusher is created without a
+	// logger.
+	ErrInvalidLogger = errors.New("a logger is required to push to a pushgateway")
+
+	// ErrInvalidGatherer is returned when the pusher is created without a
+	// gatherer to read metrics from.
+	ErrInvalidGatherer = errors.New("a gatherer is required to push to a pushgateway")
+)
+
+// Pusher replaces the metrics of its group on the gateway with those of a
+// gatherer on an interval. The group is identified by the job and grouping
+// labels, which the gateway attaches to every pushed series.
+type Pusher struct {
+	log      *tracelog.TraceLogger
+	gatherer prometheus.Gatherer
+	interval time.Duration
+	clear    bool
+
+	url      string
+	job      string
+	grouping map[string]string
+	username string
+	password string
+}
+
+type Option func(*Pusher)
+
+func WithLogger(l *tracelog.TraceLogger) Option {
+	return func(p *Pusher) {
+		p.log = l
+	}
+}
+
+// WithGatherer sets the registry metrics are read from.
+func WithGatherer(g prometheus.Gatherer) Option {
+	return func(p *Pusher) {
+		p.gatherer = g
+	}
+}
+
+// WithJob sets the job label of the pushed group, defaults to hue-exporter.
+func WithJob(job string) Option {
+	return func(p *Pusher) {
+		p.job = job
+	}
+}
+
+// WithGrouping adds grouping labels identifying the pushed group alongside
+// the job, such as an instance label when several exporters push to the
+// same gateway.
+func WithGrouping(labels map[string]string) Option {
+	return func(p *Pusher) {
+		for k, v := range labels {
+			p.grouping[k] = v
+		}
+	}
+}
+
+// WithCredentials authenticates with the gateway using basic auth.
+func WithCredentials(username, password string) Option {
+	return func(p *Pusher) {
+		p.username = username
+		p.password = password
+	}
+}
+
+// WithInterval sets how often metrics are pushed, defaults to 30 seconds.
+func WithInterval(d time.Duration) Option {
+	return func(p *Pusher) {
+		p.interval = d
+	}
+}
+
+// WithDeleteOnShutdown deletes the group from the gateway when Run returns,
+// so series of a stopped exporter aren't served indefinitely.
+func WithDeleteOnShutdown() Option {
+	return func(p *Pusher) {
+		p.clear = true
+	}
+}
+
+// New creates a pusher to the gateway at url.
+func New(url string, opts ...Option) (*Pusher, error) {
+	p := &Pusher{
+		url:      url,
+		job:      "hue-exporter",
+		grouping: map[string]string{},
+		interval: time.Second * 30,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if p.log == nil {
+		return nil, ErrInvalidLogger
+	}
+
+	if p.gatherer == nil {
+		return nil, ErrInvalidGatherer
+	}
+
+	if p.job == "" {
+		return nil, errors.New("a job is required to push to a pushgateway")
+	}
+
+	return p, nil
+}
+
+// Run pushes the metrics on every interval until ctx is done. Failed pushes
+// are logged and retried on the next interval.
+func (p *Pusher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.Push(); err != nil {
+				p.log.Error("failed to push metrics to pushgateway", zap.Error(err))
+			}
+		case <-ctx.Done():
+			if p.clear {
+				if err := p.pusher().Delete(); err != nil {
+					p.log.Error("failed to delete metrics from pushgateway", zap.Error(err))
+				}
+			}
+
+			return ctx.Err()
+		}
+	}
+}
+
+// Push replaces the metrics of the group on the gateway.
+func (p *Pusher) Push() error {
+	if err := p.pusher().Push(); err != nil {
+		return fmt.Errorf("failed to push metrics: %w", err)
+	}
+
+	return nil
+}
+
+func (p *Pusher) pusher() *push.Pusher {
+	pusher := push.New(p.url, p.job).
+		Gatherer(p.gatherer).
+		Client(&http.Client{Timeout: pushTimeout})
+
+	keys := make([]string, 0, len(p.grouping))
+	for k := range p.grouping {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		pusher = pusher.Grouping(k, p.grouping[k])
+	}
+
+	if p.username != "" {
+		pusher = pusher.BasicAuth(p.username, p.password)
+	}
+
+	return pusher
+}
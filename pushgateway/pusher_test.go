@@ -0,0 +1,187 @@
+package pushgateway
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ninnemana/tracelog"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var testLogger = tracelog.NewLogger(tracelog.WithLogger(zap.NewNop()))
+
+// request is a request received by the gateway.
+type request struct {
+	method string
+	path   string
+	body   string
+	user   string
+	pass   string
+}
+
+// gateway records the requests sent to it.
+type gateway struct {
+	mu       sync.Mutex
+	requests []request
+	pushed   chan struct{}
+}
+
+func (g *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	user, pass, _ := r.BasicAuth()
+
+	g.mu.Lock()
+	g.requests = append(g.requests, request{r.Method, r.URL.Path, string(body), user, pass})
+	g.mu.Unlock()
+
+	if r.Method == http.MethodPut {
+		select {
+		case g.pushed <- struct{}{}:
+		default:
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func newTestPusher(t *testing.T, opts ...Option) (*Pusher, *gateway) {
+	t.Helper()
+
+	gw := &gateway{pushed: make(chan struct{}, 1)}
+	srv := httptest.NewServer(gw)
+	t.Cleanup(srv.Close)
+
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "hue_light_brightness"})
+	g.Set(127)
+	reg.MustRegister(g)
+
+	opts = append([]Option{
+		WithLogger(testLogger),
+		WithGatherer(reg),
+	}, opts...)
+
+	p, err := New(srv.URL, opts...)
+	if err != nil {
+		t.Fatalf("failed to create pusher: %v", err)
+	}
+
+	return p, gw
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want error
+	}{
+		{name: "without logger", opts: []Option{WithGatherer(prometheus.NewRegistry())}, want: ErrInvalidLogger},
+		{name: "without gatherer", opts: []Option{WithLogger(testLogger)}, want: ErrInvalidGatherer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New("http://localhost", tt.opts...); !errors.Is(err, tt.want) {
+				t.Errorf("error: %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := New("http://localhost", WithLogger(testLogger), WithGatherer(prometheus.NewRegistry()), WithJob("")); err == nil {
+		t.Error("created a pusher without a job")
+	}
+}
+
+func TestPush(t *testing.T) {
+	p, gw := newTestPusher(t,
+		WithJob("hue"),
+		WithGrouping(map[string]string{"instance": "pi", "bridge": "office"}),
+		WithCredentials("prometheus", "secret"),
+	)
+
+	if err := p.Push(); err != nil {
+		t.Fatalf("failed to push: %v", err)
+	}
+
+	if len(gw.requests) != 1 {
+		t.Fatalf("sent %d requests, want 1", len(gw.requests))
+	}
+	r := gw.requests[0]
+
+	if r.method != http.MethodPut {
+		t.Errorf("method: %s, want %s", r.method, http.MethodPut)
+	}
+	// the client orders grouping labels arbitrarily
+	if got, want := grouping(r.path), map[string]string{"job": "hue", "bridge": "office", "instance": "pi"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("grouping of %s: %v, want %v", r.path, got, want)
+	}
+	if r.user != "prometheus" || r.pass != "secret" {
+		t.Errorf("basic auth: %q %q, want the credentials", r.user, r.pass)
+	}
+	if !strings.Contains(r.body, "hue_light_brightness") {
+		t.Error("pushed metrics are missing hue_light_brightness")
+	}
+}
+
+// grouping returns the grouping labels of a /metrics/<label>/<value>/...
+// path.
+func grouping(path string) map[string]string {
+	parts := strings.Split(strings.TrimPrefix(path, "/metrics/"), "/")
+	out := map[string]string{}
+	for i := 0; i+1 < len(parts); i += 2 {
+		out[parts[i]] = parts[i+1]
+	}
+
+	return out
+}
+
+func TestRunDeletesOnShutdown(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		delete bool
+	}{
+		{name: "keep"},
+		{name: "delete", opts: []Option{WithDeleteOnShutdown()}, delete: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, gw := newTestPusher(t, append(tt.opts, WithInterval(10*time.Millisecond))...)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() {
+				done <- p.Run(ctx)
+			}()
+
+			select {
+			case <-gw.pushed:
+			case <-time.After(5 * time.Second):
+				t.Fatal("metrics were never pushed")
+			}
+
+			cancel()
+			if err := <-done; !errors.Is(err, context.Canceled) {
+				t.Errorf("run: %v, want %v", err, context.Canceled)
+			}
+
+			gw.mu.Lock()
+			defer gw.mu.Unlock()
+
+			last := gw.requests[len(gw.requests)-1]
+			if deleted := last.method == http.MethodDelete; deleted != tt.delete {
+				t.Errorf("deleted: %v, want %v", deleted, tt.delete)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+// Package remote authorizes the exporter with the Hue remote API, which
+// relays requests to a bridge through the Hue cloud so the exporter can run
+// outside the network of the bridge.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// BaseURL is the address the remote API serves the v1 API of the
+	// authorized bridge under, in place of the bridge address.
+	BaseURL = "https://api.meethue.com/route"
+
+	authURL  = "https://api.meethue.com/v2/oauth2/authorize"
+	tokenURL = "https://api.meethue.com/v2/oauth2/token"
+)
+
+// ErrNotAuthorized is returned when no token has been persisted yet, the
+// exporter must be authorized through Login first.
+var ErrNotAuthorized = errors.New("not authorized with the hue remote api, run the remote-login command")
+
+// Config identifies the application registered with the Hue developer
+// program and where its tokens are persisted.
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	// TokenFile persists the token, refreshed tokens are written back to
+	// it so the exporter stays authorized across restarts.
+	TokenFile string
+}
+
+// token is the persisted token along with the bridge username created
+// through the remote API.
+type token struct {
+	*oauth2.Token
+	Username string `json:"username"`
+}
+
+func (c Config) oauthConfig() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   authURL,
+			TokenURL:  tokenURL,
+			AuthStyle: oauth2.AuthStyleInHeader,
+		},
+	}
+}
+
+// AuthCodeURL returns the address to authorize the application at, the
+// code the user is redirected with is passed to Login.
+func (c Config) AuthCodeURL(state string) string {
+	return c.oauthConfig().AuthCodeURL(state)
+}
+
+// Login exchanges the authorization code for a token, creates a bridge
+// username through the remote API and persists both.
+func (c Config) Login(ctx context.Context, code, deviceType string) error {
+	tok, err := c.oauthConfig().Exchange(ctx, code)
+	if err != nil {
+		return fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+
+	client := c.oauthConfig().Client(ctx, tok)
+
+	// creating a username requires the link button, which is pressed
+	// virtually through the remote API
+	if err := call(ctx, client, http.MethodPut, BaseURL+"/api/0/config", map[string]bool{"linkbutton": true}, nil); err != nil {
+		return fmt.Errorf("failed to press link button: %w", err)
+	}
+
+	var res []struct {
+		Success struct {
+			Username string `json:"username"`
+		} `json:"success"`
+		Error *struct {
+			Description string `json:"description"`
+		} `json:"error"`
+	}
+	if err := call(ctx, client, http.MethodPost, BaseURL+"/api", map[string]string{"devicetype": deviceType}, &res); err != nil {
+		return fmt.Errorf("failed to create username: %w", err)
+	}
+
+	if len(res) == 0 || res[0].Success.Username == "" {
+		if len(res) > 0 && res[0].Error != nil {
+			return fmt.Errorf("failed to create username: %s", res[0].Error.Description)
+		}
+
+		return errors.New("failed to create username: empty response")
+	}
+
+	return c.save(token{Token: tok, Username: res[0].Success.Username})
+}
+
+// Client returns a client authorized with the persisted token, refreshing
+// it as it expires, along with the bridge username to address the v1 API
+// with.
+func (c Config) Client(ctx context.Context) (*http.Client, string, error) {
+	tok, err := c.load()
+	if err != nil {
+		return nil, "", err
+	}
+
+	src := &persistingSource{
+		config: c,
+		last:   tok,
+		src:    c.oauthConfig().TokenSource(ctx, tok.Token),
+	}
+
+	return oauth2.NewClient(ctx, src), tok.Username, nil
+}
+
+func (c Config) load() (token, error) {
+	data, err := os.ReadFile(c.TokenFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return token{}, ErrNotAuthorized
+	}
+	if err != nil {
+		return token{}, fmt.Errorf("failed to read token: %w", err)
+	}
+
+	var tok token
+	if err := json.Unmarshal(data, &tok); err != nil {
+		return token{}, fmt.Errorf("failed to decode token: %w", err)
+	}
+
+	if tok.Token == nil || tok.Username == "" {
+		return token{}, ErrNotAuthorized
+	}
+
+	return tok, nil
+}
+
+// save writes the token through a temporary file, so a failed write
+// doesn't lose the refresh token.
+func (c Config) save(tok token) error {
+	data, err := json.MarshalIndent(tok, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode token: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.TokenFile), ".token-*")
+	if err != nil {
+		return fmt.Errorf("failed to write token: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("failed to write token: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write token: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), c.TokenFile); err != nil {
+		return fmt.Errorf("failed to write token: %w", err)
+	}
+
+	return nil
+}
+
+// persistingSource persists tokens as src refreshes them, refresh tokens
+// are rotated by the remote API so the previous one stops working.
+type persistingSource struct {
+	config Config
+	src    oauth2.TokenSource
+
+	mu   sync.Mutex
+	last token
+}
+
+func (s *persistingSource) Token() (*oauth2.Token, error) {
+	tok, err := s.src.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if tok.AccessToken != s.last.AccessToken {
+		s.last.Token = tok
+		if err := s.config.save(s.last); err != nil {
+			return nil, err
+		}
+	}
+
+	return tok, nil
+}
+
+func call(ctx context.Context, client *http.Client, method, url string, body, v interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	if v == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+
+		return err
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
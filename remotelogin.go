@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ninnemana/hue-exporter/remote"
+)
+
+// remoteConfig configures the Hue remote API with the application
+// credentials from HUE_REMOTE_CLIENT_ID and HUE_REMOTE_CLIENT_SECRET.
+func remoteConfig() remote.Config {
+	return remote.Config{
+		ClientID:     os.Getenv("HUE_REMOTE_CLIENT_ID"),
+		ClientSecret: os.Getenv("HUE_REMOTE_CLIENT_SECRET"),
+		TokenFile:    *remoteTokens,
+	}
+}
+
+// remoteLogin prints the address to authorize the exporter at, then reads
+// the code the browser is redirected with and exchanges it for a token.
+func remoteLogin(ctx context.Context, r io.Reader, w io.Writer, cfg remote.Config) error {
+	if cfg.ClientID == "" || cfg.ClientSecret == "" {
+		return errors.New("HUE_REMOTE_CLIENT_ID and HUE_REMOTE_CLIENT_SECRET are required")
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	state := hex.EncodeToString(nonce)
+
+	fmt.Fprintf(w, "Open the following address and authorize the exporter:\n\n  %s\n\n", cfg.AuthCodeURL(state))
+	fmt.Fprint(w, "Enter the code parameter of the address redirected to: ")
+
+	code, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read code: %w", err)
+	}
+
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return errors.New("no code was entered")
+	}
+
+	hostname, _ := os.Hostname()
+	if err := cfg.Login(ctx, code, "hue-exporter#"+hostname); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nAuthorized, tokens were saved to %s. Run with -remote to collect through the remote API.\n", cfg.TokenFile)
+
+	return nil
+}
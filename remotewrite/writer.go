@@ -0,0 +1,281 @@
+// Package remotewrite sends the collected metrics to storage implementing
+// the Prometheus remote write protocol, such as Mimir, VictoriaMetrics or
+// Grafana Cloud, without a Prometheus server scraping the exporter.
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/ninnemana/hue-exporter/series"
+	"github.com/ninnemana/tracelog"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// writeTimeout bounds each attempt to send samples.
+	writeTimeout = time.Second * 30
+
+	minBackoff = time.Second
+	maxBackoff = time.Second * 30
+)
+
+var (
+	// ErrInvalidLogger is returned when the writer is created without a
+	// logger.
+	ErrInvalidLogger = errors.New("a logger is required for remote write")
+
+	// ErrInvalidGatherer is returned when the writer is created without a
+	// gatherer to read metrics from.
+	ErrInvalidGatherer = errors.New("a gatherer is required for remote write")
+)
+
+// Writer sends the current value of every series of a gatherer to a remote
+// write endpoint on an interval. Requests failing with a server error, rate
+// limiting or a network error are retried with exponential backoff, other
+// errors are dropped as retrying wouldn't change the outcome.
+type Writer struct {
+	log      *tracelog.TraceLogger
+	url      string
+	gatherer prometheus.Gatherer
+	client   *http.Client
+	interval time.Duration
+	retries  int
+	username string
+	password string
+}
+
+type Option func(*Writer)
+
+func WithLogger(l *tracelog.TraceLogger) Option {
+	return func(w *Writer) {
+		w.log = l
+	}
+}
+
+// WithGatherer sets the registry metrics are read from.
+func WithGatherer(g prometheus.Gatherer) Option {
+	return func(w *Writer) {
+		w.gatherer = g
+	}
+}
+
+// WithCredentials authenticates with the endpoint using basic auth.
+func WithCredentials(username, password string) Option {
+	return func(w *Writer) {
+		w.username = username
+		w.password = password
+	}
+}
+
+// WithInterval sets how often samples are sent, defaults to 30 seconds.
+func WithInterval(d time.Duration) Option {
+	return func(w *Writer) {
+		w.interval = d
+	}
+}
+
+// WithRetries sets how many times a failed request is retried, defaults to
+// 3.
+func WithRetries(n int) Option {
+	return func(w *Writer) {
+		w.retries = n
+	}
+}
+
+// WithHTTPClient sets the client requests are sent through, defaults to a
+// client timing out after 30 seconds.
+func WithHTTPClient(c *http.Client) Option {
+	return func(w *Writer) {
+		w.client = c
+	}
+}
+
+// New creates a writer to the remote write endpoint at url.
+func New(url string, opts ...Option) (*Writer, error) {
+	w := &Writer{
+		url:      url,
+		client:   &http.Client{Timeout: writeTimeout},
+		interval: time.Second * 30,
+		retries:  3,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	if w.log == nil {
+		return nil, ErrInvalidLogger
+	}
+
+	if w.gatherer == nil {
+		return nil, ErrInvalidGatherer
+	}
+
+	return w, nil
+}
+
+// Run sends samples on every interval until ctx is done. Failed writes are
+// logged and the samples dropped, the next interval sends current values.
+func (w *Writer) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if err := w.Write(ctx, now); err != nil {
+				w.log.Error("failed to remote write metrics", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Write sends the current value of every series, timestamped with now.
+func (w *Writer) Write(ctx context.Context, now time.Time) error {
+	samples, err := series.Gather(w.gatherer)
+	if err != nil {
+		return err
+	}
+
+	body := snappy.Encode(nil, encode(samples, now))
+
+	backoff := minBackoff
+	for attempt := 0; ; attempt++ {
+		err := w.send(ctx, body)
+		if err == nil {
+			return nil
+		}
+
+		var rerr *recoverableError
+		if !errors.As(err, &rerr) || attempt >= w.retries {
+			return err
+		}
+
+		w.log.Warn("retrying remote write", zap.Int("attempt", attempt+1), zap.Error(err))
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// recoverableError is a failed request which may succeed when retried.
+type recoverableError struct {
+	err error
+}
+
+func (e *recoverableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *recoverableError) Unwrap() error {
+	return e.err
+}
+
+func (w *Writer) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "hue-exporter")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return &recoverableError{fmt.Errorf("failed to send samples: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("failed to send samples: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+		return &recoverableError{err}
+	}
+
+	return err
+}
+
+// encode encodes the samples as a remote write WriteRequest protobuf.
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label        { string name = 1; string value = 2; }
+//	message Sample       { double value = 1; int64 timestamp = 2; }
+func encode(samples []series.Sample, now time.Time) []byte {
+	ts := now.UnixNano() / int64(time.Millisecond)
+
+	var req []byte
+	for _, s := range samples {
+		if math.IsNaN(s.Value) {
+			continue
+		}
+
+		// labels, including the metric name, must be sorted by name
+		labels := map[string]string{"__name__": s.Name}
+		names := []string{"__name__"}
+		for k, v := range s.Labels {
+			labels[k] = v
+			names = append(names, k)
+		}
+		sort.Strings(names)
+
+		var ser []byte
+		for _, k := range names {
+			ser = protowire.AppendTag(ser, 1, protowire.BytesType)
+			ser = protowire.AppendBytes(ser, label(k, labels[k]))
+		}
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(ts))
+
+		ser = protowire.AppendTag(ser, 2, protowire.BytesType)
+		ser = protowire.AppendBytes(ser, sample)
+
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ser)
+	}
+
+	return req
+}
+
+func label(name, value string) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, name)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, value)
+
+	return b
+}
@@ -0,0 +1,272 @@
+package remotewrite
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/ninnemana/tracelog"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var testLogger = tracelog.NewLogger(tracelog.WithLogger(zap.NewNop()))
+
+// timeSeries is a decoded remote write TimeSeries with a single sample.
+type timeSeries struct {
+	labels    map[string]string
+	value     float64
+	timestamp int64
+}
+
+// receiver is a remote write endpoint answering with the queued statuses,
+// then 204, recording the series it was sent.
+type receiver struct {
+	t        *testing.T
+	mu       sync.Mutex
+	statuses []int
+	requests int
+	series   []timeSeries
+	header   http.Header
+}
+
+func (rcv *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+
+	rcv.requests++
+	rcv.header = r.Header.Clone()
+
+	if len(rcv.statuses) > 0 {
+		w.WriteHeader(rcv.statuses[0])
+		rcv.statuses = rcv.statuses[1:]
+
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		rcv.t.Errorf("failed to read request: %v", err)
+	}
+	req, err := snappy.Decode(nil, body)
+	if err != nil {
+		rcv.t.Errorf("failed to decompress request: %v", err)
+	}
+	rcv.series = decode(rcv.t, req)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func decode(t *testing.T, req []byte) []timeSeries {
+	var out []timeSeries
+	fields(t, req, func(_ protowire.Number, ser []byte) {
+		ts := timeSeries{labels: map[string]string{}}
+		fields(t, ser, func(n protowire.Number, b []byte) {
+			switch n {
+			case 1:
+				var name, value string
+				fields(t, b, func(n protowire.Number, v []byte) {
+					if n == 1 {
+						name = string(v)
+					} else {
+						value = string(v)
+					}
+				})
+				ts.labels[name] = value
+			case 2:
+				for len(b) > 0 {
+					n, typ, l := protowire.ConsumeTag(b)
+					b = b[l:]
+					switch {
+					case n == 1 && typ == protowire.Fixed64Type:
+						v, l := protowire.ConsumeFixed64(b)
+						ts.value = math.Float64frombits(v)
+						b = b[l:]
+					case n == 2 && typ == protowire.VarintType:
+						v, l := protowire.ConsumeVarint(b)
+						ts.timestamp = int64(v)
+						b = b[l:]
+					default:
+						t.Fatalf("unexpected sample field %d", n)
+					}
+				}
+			}
+		})
+		out = append(out, ts)
+	})
+
+	return out
+}
+
+// fields calls fn with every length delimited field of the message.
+func fields(t *testing.T, b []byte, fn func(protowire.Number, []byte)) {
+	for len(b) > 0 {
+		n, typ, l := protowire.ConsumeTag(b)
+		if l < 0 || typ != protowire.BytesType {
+			t.Fatalf("unexpected field %d of type %d", n, typ)
+		}
+		b = b[l:]
+
+		v, l := protowire.ConsumeBytes(b)
+		if l < 0 {
+			t.Fatalf("malformed field %d", n)
+		}
+		b = b[l:]
+
+		fn(n, v)
+	}
+}
+
+func newTestWriter(t *testing.T, rcv *receiver, opts ...Option) *Writer {
+	t.Helper()
+
+	srv := httptest.NewServer(rcv)
+	t.Cleanup(srv.Close)
+
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "hue_light_brightness"}, []string{"name", "bridge"})
+	g.WithLabelValues("Desk", "Office").Set(127)
+	reg.MustRegister(g)
+
+	opts = append([]Option{
+		WithLogger(testLogger),
+		WithGatherer(reg),
+		WithHTTPClient(srv.Client()),
+	}, opts...)
+
+	w, err := New(srv.URL, opts...)
+	if err != nil {
+		t.Fatalf("failed to create writer: %v", err)
+	}
+
+	return w
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("http://localhost", WithGatherer(prometheus.NewRegistry())); err != ErrInvalidLogger {
+		t.Errorf("without logger: %v, want %v", err, ErrInvalidLogger)
+	}
+
+	if _, err := New("http://localhost", WithLogger(testLogger)); err != ErrInvalidGatherer {
+		t.Errorf("without gatherer: %v, want %v", err, ErrInvalidGatherer)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	rcv := &receiver{t: t}
+	w := newTestWriter(t, rcv, WithCredentials("prometheus", "secret"))
+
+	now := time.Unix(1600000000, 0)
+	if err := w.Write(context.Background(), now); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	want := []timeSeries{{
+		labels: map[string]string{
+			"__name__": "hue_light_brightness",
+			"bridge":   "Office",
+			"name":     "Desk",
+		},
+		value:     127,
+		timestamp: now.UnixNano() / int64(time.Millisecond),
+	}}
+	if !reflect.DeepEqual(rcv.series, want) {
+		t.Errorf("series: %+v, want %+v", rcv.series, want)
+	}
+
+	for k, v := range map[string]string{
+		"Content-Encoding":                  "snappy",
+		"Content-Type":                      "application/x-protobuf",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	} {
+		if got := rcv.header.Get(k); got != v {
+			t.Errorf("%s header: %q, want %q", k, got, v)
+		}
+	}
+
+	r := http.Request{Header: rcv.header}
+	if user, pass, ok := r.BasicAuth(); !ok || user != "prometheus" || pass != "secret" {
+		t.Errorf("basic auth: %q %q %v, want the credentials", user, pass, ok)
+	}
+}
+
+func TestWriteRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		retries  int
+		requests int
+		wantErr  bool
+	}{
+		{
+			name:     "server error",
+			statuses: []int{http.StatusServiceUnavailable},
+			retries:  1,
+			requests: 2,
+		},
+		{
+			name:     "rate limited",
+			statuses: []int{http.StatusTooManyRequests},
+			retries:  1,
+			requests: 2,
+		},
+		{
+			name:     "out of retries",
+			statuses: []int{http.StatusInternalServerError, http.StatusInternalServerError},
+			retries:  1,
+			requests: 2,
+			wantErr:  true,
+		},
+		{
+			name:     "client error",
+			statuses: []int{http.StatusBadRequest},
+			retries:  1,
+			requests: 1,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rcv := &receiver{t: t, statuses: tt.statuses}
+			w := newTestWriter(t, rcv, WithRetries(tt.retries))
+
+			err := w.Write(context.Background(), time.Now())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error: %v, want error %v", err, tt.wantErr)
+			}
+			if rcv.requests != tt.requests {
+				t.Errorf("sent %d requests, want %d", rcv.requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestWriteSkipsNaN(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "hue_sensor_temperature"}, []string{"name"})
+	g.WithLabelValues("Hallway").Set(math.NaN())
+	g.WithLabelValues("Kitchen").Set(21.5)
+	reg.MustRegister(g)
+
+	rcv := &receiver{t: t}
+	w := newTestWriter(t, rcv, WithGatherer(reg))
+	if err := w.Write(context.Background(), time.Now()); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	if len(rcv.series) != 1 || rcv.series[0].labels["name"] != "Kitchen" {
+		t.Errorf("series: %+v, want only Kitchen", rcv.series)
+	}
+}
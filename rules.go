@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+type ruleFile struct {
+	Groups []ruleGroup `yaml:"groups"`
+}
+
+type ruleGroup struct {
+	Name  string `yaml:"name"`
+	Rules []rule `yaml:"rules"`
+}
+
+type rule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         model.Duration    `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// alertRules prints Prometheus alerting rules for the metrics of the
+// exporter, named with the configured metric prefix.
+func alertRules(w io.Writer, prefix string, battery int, stale time.Duration) error {
+	severity := func(s string) map[string]string {
+		return map[string]string{"severity": s}
+	}
+
+	rules := []rule{
+		{
+			Alert:  "HueBridgeDown",
+			Expr:   fmt.Sprintf("%sbridge_up == 0", prefix),
+			For:    model.Duration(5 * time.Minute),
+			Labels: severity("critical"),
+			Annotations: map[string]string{
+				"summary":     "Hue bridge {{ $labels.bridge }} is down",
+				"description": "Collections from bridge {{ $labels.bridge }} have been failing for 5 minutes.",
+			},
+		},
+		{
+			Alert:  "HueCollectionStale",
+			Expr:   fmt.Sprintf("time() - %slast_collect_success_timestamp_seconds > %d", prefix, int(stale.Seconds())),
+			For:    model.Duration(5 * time.Minute),
+			Labels: severity("warning"),
+			Annotations: map[string]string{
+				"summary":     "Hue {{ $labels.collector }} of bridge {{ $labels.bridge }} are stale",
+				"description": fmt.Sprintf("The {{ $labels.collector }} of bridge {{ $labels.bridge }} haven't been collected in over %s.", model.Duration(stale)),
+			},
+		},
+		{
+			Alert:  "HueLightUnreachable",
+			Expr:   fmt.Sprintf("%slight_reachable == 0", prefix),
+			For:    model.Duration(10 * time.Minute),
+			Labels: severity("warning"),
+			Annotations: map[string]string{
+				"summary":     "Hue light {{ $labels.id }} in {{ $labels.group }} is unreachable",
+				"description": "Bridge {{ $labels.bridge }} hasn't been able to reach light {{ $labels.id }}, it may be switched off at the wall.",
+			},
+		},
+		{
+			// temperature and light level sensors update every few minutes,
+			// unlike motion sensors and switches which only update on use
+			Alert:  "HueSensorStale",
+			Expr:   fmt.Sprintf(`time() - %ssensor_last_updated_timestamp_seconds{type=~"ZLLTemperature|ZLLLightLevel"} > 7200`, prefix),
+			For:    model.Duration(15 * time.Minute),
+			Labels: severity("warning"),
+			Annotations: map[string]string{
+				"summary":     "Hue sensor {{ $labels.id }} stopped reporting",
+				"description": "Sensor {{ $labels.id }} of bridge {{ $labels.bridge }} hasn't updated in over 2 hours, its battery may be flat or it may be out of range.",
+			},
+		},
+		{
+			Alert:  "HueBatteryLow",
+			Expr:   fmt.Sprintf("%ssensor_battery_percent < %d", prefix, battery),
+			For:    model.Duration(time.Hour),
+			Labels: severity("warning"),
+			Annotations: map[string]string{
+				"summary":     "Hue sensor {{ $labels.id }} battery is low",
+				"description": "The battery of sensor {{ $labels.id }} of bridge {{ $labels.bridge }} is at {{ $value }}%.",
+			},
+		},
+		{
+			Alert:  "HueDeviceBatteryLow",
+			Expr:   fmt.Sprintf("%sdevice_battery_percent < %d", prefix, battery),
+			For:    model.Duration(time.Hour),
+			Labels: severity("warning"),
+			Annotations: map[string]string{
+				"summary":     "Hue device {{ $labels.name }} battery is low",
+				"description": "The battery of device {{ $labels.name }} of bridge {{ $labels.bridge }} is at {{ $value }}%.",
+			},
+		},
+	}
+
+	out, err := yaml.Marshal(ruleFile{
+		Groups: []ruleGroup{{Name: "hue-exporter", Rules: rules}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode rules: %w", err)
+	}
+
+	_, err = w.Write(out)
+
+	return err
+}
@@ -0,0 +1,91 @@
+// Package series flattens gathered Prometheus metric families into
+// individual series, for the outputs pushing metrics to systems without
+// Prometheus' data model.
+package series
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Sample is the current value of a single series.
+type Sample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+	// Counter reports whether the value only ever increases, as counters
+	// and the _sum, _count and _bucket series of summaries and histograms
+	// do.
+	Counter bool
+}
+
+// Gather gathers g and flattens every metric family into its samples.
+func Gather(g prometheus.Gatherer) ([]Sample, error) {
+	families, err := g.Gather()
+	if err != nil {
+		return nil, fmt.Errorf("failed to gather metrics: %w", err)
+	}
+
+	var out []Sample
+	for _, mf := range families {
+		out = append(out, Flatten(mf)...)
+	}
+
+	return out, nil
+}
+
+// Flatten flattens the metric family into its series, summaries and
+// histograms are flattened into their _sum, _count and quantile or bucket
+// series.
+func Flatten(mf *dto.MetricFamily) []Sample {
+	var out []Sample
+	name := mf.GetName()
+	for _, m := range mf.GetMetric() {
+		labels := make(map[string]string, len(m.GetLabel()))
+		for _, l := range m.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+
+		with := func(key, value string) map[string]string {
+			l := make(map[string]string, len(labels)+1)
+			for k, v := range labels {
+				l[k] = v
+			}
+			l[key] = value
+
+			return l
+		}
+
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			out = append(out, Sample{name, labels, m.GetCounter().GetValue(), true})
+		case dto.MetricType_GAUGE:
+			out = append(out, Sample{name, labels, m.GetGauge().GetValue(), false})
+		case dto.MetricType_UNTYPED:
+			out = append(out, Sample{name, labels, m.GetUntyped().GetValue(), false})
+		case dto.MetricType_SUMMARY:
+			s := m.GetSummary()
+			out = append(out,
+				Sample{name + "_sum", labels, s.GetSampleSum(), true},
+				Sample{name + "_count", labels, float64(s.GetSampleCount()), true},
+			)
+			for _, q := range s.GetQuantile() {
+				out = append(out, Sample{name, with("quantile", strconv.FormatFloat(q.GetQuantile(), 'f', -1, 64)), q.GetValue(), false})
+			}
+		case dto.MetricType_HISTOGRAM:
+			h := m.GetHistogram()
+			out = append(out,
+				Sample{name + "_sum", labels, h.GetSampleSum(), true},
+				Sample{name + "_count", labels, float64(h.GetSampleCount()), true},
+			)
+			for _, b := range h.GetBucket() {
+				out = append(out, Sample{name + "_bucket", with("le", strconv.FormatFloat(b.GetUpperBound(), 'f', -1, 64)), float64(b.GetCumulativeCount()), true})
+			}
+		}
+	}
+
+	return out
+}
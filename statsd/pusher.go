@@ -0,0 +1,255 @@
+// Package statsd pushes the collected metrics to a StatsD server, optionally
+// tagging them with their labels using the DogStatsD extension understood by
+// the Datadog agent.
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ninnemana/hue-exporter/series"
+	"github.com/ninnemana/tracelog"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// maxPacket is the largest datagram written, small enough to avoid
+// fragmentation on an ethernet MTU.
+const maxPacket = 1432
+
+var (
+	// ErrInvalidLogger is returned when the pusher is created without a
+	// logger.
+	ErrInvalidLogger = errors.New("a logger is required to push to statsd")
+
+	// ErrInvalidGatherer is returned when the pusher is created without a
+	// gatherer to read metrics from.
+	ErrInvalidGatherer = errors.New("a gatherer is required to push to statsd")
+
+	nameReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", " ", "_", "\n", "_")
+	tagReplacer  = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+)
+
+// Pusher sends every series of a gatherer to StatsD on an interval. Gauges
+// are sent as gauges and counters as the increase since the previous push.
+//
+// Plain StatsD has no labels, so they're appended to the metric name as
+// .<label>.<value> in name order. With DogStatsD they're sent as tags.
+type Pusher struct {
+	log      *tracelog.TraceLogger
+	addr     string
+	gatherer prometheus.Gatherer
+	prefix   string
+	interval time.Duration
+	tags     bool
+
+	// counters are the counter values last pushed, keyed by the series'
+	// name and labels, as StatsD counters are incremented by deltas.
+	counters map[string]float64
+}
+
+type Option func(*Pusher)
+
+func WithLogger(l *tracelog.TraceLogger) Option {
+	return func(p *Pusher) {
+		p.log = l
+	}
+}
+
+// WithGatherer sets the registry metrics are read from.
+func WithGatherer(g prometheus.Gatherer) Option {
+	return func(p *Pusher) {
+		p.gatherer = g
+	}
+}
+
+// WithPrefix prepends prefix to the name of every metric sent.
+func WithPrefix(prefix string) Option {
+	return func(p *Pusher) {
+		p.prefix = prefix
+	}
+}
+
+// WithInterval sets how often metrics are pushed, defaults to ten seconds,
+// the flush interval of StatsD and the Datadog agent.
+func WithInterval(d time.Duration) Option {
+	return func(p *Pusher) {
+		p.interval = d
+	}
+}
+
+// WithDogStatsD sends labels as DogStatsD tags rather than in the metric
+// name.
+func WithDogStatsD() Option {
+	return func(p *Pusher) {
+		p.tags = true
+	}
+}
+
+// New creates a pusher to the StatsD server listening for UDP at addr,
+// given as host:port.
+func New(addr string, opts ...Option) (*Pusher, error) {
+	p := &Pusher{
+		addr:     addr,
+		interval: time.Second * 10,
+		counters: map[string]float64{},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if p.log == nil {
+		return nil, ErrInvalidLogger
+	}
+
+	if p.gatherer == nil {
+		return nil, ErrInvalidGatherer
+	}
+
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid statsd address %q: %w", addr, err)
+	}
+
+	return p, nil
+}
+
+// Run pushes the metrics on every interval until ctx is done. Failed pushes
+// are logged and retried on the next interval.
+func (p *Pusher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.Push(ctx); err != nil {
+				p.log.Error("failed to push metrics to statsd", zap.Error(err))
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Push sends the current value of every series to StatsD.
+func (p *Pusher) Push(ctx context.Context) error {
+	samples, err := series.Gather(p.gatherer)
+	if err != nil {
+		return err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", p.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to statsd: %w", err)
+	}
+	defer conn.Close()
+
+	var packet bytes.Buffer
+	flush := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+
+		_, err := conn.Write(packet.Bytes())
+		packet.Reset()
+		if err != nil {
+			return fmt.Errorf("failed to write metrics: %w", err)
+		}
+
+		return nil
+	}
+
+	for _, s := range samples {
+		if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+			continue
+		}
+
+		for _, line := range p.lines(s) {
+			if packet.Len() > 0 && packet.Len()+1+len(line) > maxPacket {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+
+			if packet.Len() > 0 {
+				packet.WriteByte('\n')
+			}
+			packet.WriteString(line)
+		}
+	}
+
+	return flush()
+}
+
+// lines formats the sample as StatsD lines.
+func (p *Pusher) lines(s series.Sample) []string {
+	keys := make([]string, 0, len(s.Labels))
+	for k := range s.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	name := p.prefix + s.Name
+	var tags string
+	if p.tags {
+		pairs := make([]string, 0, len(keys))
+		for _, k := range keys {
+			pairs = append(pairs, tagReplacer.Replace(k+":"+s.Labels[k]))
+		}
+
+		if len(pairs) > 0 {
+			tags = "|#" + strings.Join(pairs, ",")
+		}
+	} else {
+		for _, k := range keys {
+			name += "." + strings.ReplaceAll(k, ".", "_") + "." + strings.ReplaceAll(s.Labels[k], ".", "_")
+		}
+	}
+	name = nameReplacer.Replace(name)
+
+	if s.Counter {
+		key := name + tags
+		last, seen := p.counters[key]
+		p.counters[key] = s.Value
+		if !seen {
+			// the first push only records where the counter starts
+			return nil
+		}
+
+		delta := s.Value - last
+		if delta < 0 {
+			// the counter was reset
+			delta = s.Value
+		}
+
+		if delta == 0 {
+			return nil
+		}
+
+		return []string{name + ":" + format(delta) + "|c" + tags}
+	}
+
+	if s.Value < 0 {
+		// a signed gauge value adjusts the gauge rather than setting it,
+		// so it's zeroed first
+		return []string{
+			name + ":0|g" + tags,
+			name + ":" + format(s.Value) + "|g" + tags,
+		}
+	}
+
+	return []string{name + ":" + format(s.Value) + "|g" + tags}
+}
+
+func format(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,148 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ninnemana/hue-exporter/series"
+	"github.com/ninnemana/tracelog"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var testLogger = tracelog.NewLogger(tracelog.WithLogger(zap.NewNop()))
+
+func newTestPusher(t *testing.T, addr string, reg prometheus.Gatherer, opts ...Option) *Pusher {
+	t.Helper()
+
+	opts = append([]Option{
+		WithLogger(testLogger),
+		WithGatherer(reg),
+	}, opts...)
+
+	p, err := New(addr, opts...)
+	if err != nil {
+		t.Fatalf("failed to create pusher: %v", err)
+	}
+
+	return p
+}
+
+func TestNew(t *testing.T) {
+	reg := prometheus.NewRegistry()
+
+	if _, err := New("localhost:8125", WithGatherer(reg)); err != ErrInvalidLogger {
+		t.Errorf("without logger: %v, want %v", err, ErrInvalidLogger)
+	}
+
+	if _, err := New("localhost:8125", WithLogger(testLogger)); err != ErrInvalidGatherer {
+		t.Errorf("without gatherer: %v, want %v", err, ErrInvalidGatherer)
+	}
+
+	if _, err := New("localhost", WithLogger(testLogger), WithGatherer(reg)); err == nil {
+		t.Error("created a pusher without a port")
+	}
+}
+
+func TestLines(t *testing.T) {
+	labels := map[string]string{"room": "Living Room", "name": "hue.go"}
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		samples []series.Sample
+		want    [][]string
+	}{
+		{
+			name:    "gauge",
+			opts:    []Option{WithPrefix("hue.")},
+			samples: []series.Sample{{Name: "light_brightness", Labels: labels, Value: 127}},
+			want:    [][]string{{"hue.light_brightness.name.hue_go.room.Living_Room:127|g"}},
+		},
+		{
+			name:    "dogstatsd gauge",
+			opts:    []Option{WithDogStatsD()},
+			samples: []series.Sample{{Name: "light_brightness", Labels: labels, Value: 127}},
+			want:    [][]string{{"light_brightness:127|g|#name:hue.go,room:Living Room"}},
+		},
+		{
+			name:    "negative gauge",
+			opts:    []Option{WithDogStatsD()},
+			samples: []series.Sample{{Name: "sensor_temperature", Value: -2.5}},
+			want:    [][]string{{"sensor_temperature:0|g", "sensor_temperature:-2.5|g"}},
+		},
+		{
+			name: "counter",
+			opts: []Option{WithDogStatsD()},
+			samples: []series.Sample{
+				{Name: "button_presses_total", Value: 3, Counter: true},
+				{Name: "button_presses_total", Value: 5, Counter: true},
+				{Name: "button_presses_total", Value: 5, Counter: true},
+				{Name: "button_presses_total", Value: 1, Counter: true},
+			},
+			// the first push only records the starting value, unchanged
+			// counters aren't sent and resets send the new value
+			want: [][]string{nil, {"button_presses_total:2|c"}, nil, {"button_presses_total:1|c"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPusher(t, "localhost:8125", prometheus.NewRegistry(), tt.opts...)
+
+			for i, s := range tt.samples {
+				if got := p.lines(s); !reflect.DeepEqual(got, tt.want[i]) {
+					t.Errorf("push %d: %q, want %q", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPush(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "hue_light_brightness"}, []string{"name"})
+	// enough series to overflow a single packet
+	for i := 0; i < 100; i++ {
+		g.WithLabelValues(strings.Repeat("x", i)).Set(float64(i))
+	}
+	reg.MustRegister(g)
+
+	p := newTestPusher(t, conn.LocalAddr().String(), reg)
+	if err := p.Push(context.Background()); err != nil {
+		t.Fatalf("failed to push: %v", err)
+	}
+
+	var lines int
+	buf := make([]byte, 65536)
+	for lines < 100 {
+		if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatal(err)
+		}
+
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("received %d lines, want 100: %v", lines, err)
+		}
+		if n > maxPacket {
+			t.Errorf("packet of %d bytes exceeds %d", n, maxPacket)
+		}
+
+		for _, l := range strings.Split(string(buf[:n]), "\n") {
+			if !strings.HasPrefix(l, "hue_light_brightness.name.") || !strings.HasSuffix(l, "|g") {
+				t.Errorf("unexpected line %q", l)
+			}
+			lines++
+		}
+	}
+}
@@ -4,11 +4,21 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"os"
 
+	"github.com/ninnemana/hue-exporter/openmetrics"
 	prom "github.com/prometheus/client_golang/prometheus"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/exporters/zipkin"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/metric/global"
 	"go.opentelemetry.io/otel/propagation"
 	export "go.opentelemetry.io/otel/sdk/export/metric"
@@ -17,14 +27,30 @@ import (
 	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
 	selector "go.opentelemetry.io/otel/sdk/metric/selector/simple"
 	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	tracesdk "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
 )
 
-// initTracer creates a new trace provider instance and registers it as global trace provider.
-func initTracer(serviceName string) (func(context.Context) error, error) {
-	exp, err := jaeger.New(jaeger.WithCollectorEndpoint())
+const (
+	// defaultZipkinEndpoint is the span endpoint of a local Zipkin, used
+	// unless OTEL_EXPORTER_ZIPKIN_ENDPOINT is set.
+	defaultZipkinEndpoint = "http://localhost:9411/api/v2/spans"
+)
+
+// initTracer creates a new trace provider exporting spans through the named
+// exporter and registers it as global trace provider. With the none
+// exporter spans are not recorded.
+func initTracer(ctx context.Context, serviceName, exporter string, sampler tracesdk.Sampler) (func(context.Context) error, error) {
+	if exporter == "none" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exp, err := spanExporter(ctx, exporter)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := newResource(ctx, serviceName)
 	if err != nil {
 		return nil, err
 	}
@@ -32,12 +58,8 @@ func initTracer(serviceName string) (func(context.Context) error, error) {
 	tp := tracesdk.NewTracerProvider(
 		// Always be sure to batch in production.
 		tracesdk.WithBatcher(exp),
-		// Record information about this application in an Resource.
-		tracesdk.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String(serviceName),
-		)),
-		tracesdk.WithSampler(sdktrace.AlwaysSample()),
+		tracesdk.WithResource(res),
+		tracesdk.WithSampler(sampler),
 	)
 
 	otel.SetTextMapPropagator(
@@ -51,11 +73,120 @@ func initTracer(serviceName string) (func(context.Context) error, error) {
 	return tp.Shutdown, nil
 }
 
-func initMeter(serviceName, port string) error {
+// newSampler creates the named sampler, using the names of the
+// OTEL_TRACES_SAMPLER environment variable. The ratio samplers sample the
+// fraction arg of traces.
+func newSampler(name string, arg float64) (tracesdk.Sampler, error) {
+	switch name {
+	case "always_on":
+		return tracesdk.AlwaysSample(), nil
+	case "always_off":
+		return tracesdk.NeverSample(), nil
+	case "traceidratio":
+		return tracesdk.TraceIDRatioBased(arg), nil
+	case "parentbased_always_on":
+		return tracesdk.ParentBased(tracesdk.AlwaysSample()), nil
+	case "parentbased_always_off":
+		return tracesdk.ParentBased(tracesdk.NeverSample()), nil
+	case "parentbased_traceidratio":
+		return tracesdk.ParentBased(tracesdk.TraceIDRatioBased(arg)), nil
+	default:
+		return nil, fmt.Errorf("unknown trace sampler %q", name)
+	}
+}
+
+// spanExporter creates the named span exporter. The otlp exporter is
+// configured through the standard OTEL_EXPORTER_OTLP_* environment variables,
+// Jaeger accepts OTLP directly when its OTLP receiver is enabled.
+func spanExporter(ctx context.Context, name string) (tracesdk.SpanExporter, error) {
+	switch name {
+	case "otlp":
+		var client otlptrace.Client
+		switch protocol := otlpProtocol("TRACES"); protocol {
+		case "grpc":
+			client = otlptracegrpc.NewClient()
+		case "http/protobuf":
+			client = otlptracehttp.NewClient()
+		default:
+			return nil, fmt.Errorf("unsupported OTLP protocol %q", protocol)
+		}
+
+		exp, err := otlptrace.New(ctx, client)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize otlp trace exporter: %w", err)
+		}
+
+		return exp, nil
+	case "zipkin":
+		endpoint := os.Getenv("OTEL_EXPORTER_ZIPKIN_ENDPOINT")
+		if endpoint == "" {
+			endpoint = defaultZipkinEndpoint
+		}
+
+		exp, err := zipkin.New(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize zipkin exporter: %w", err)
+		}
+
+		return exp, nil
+	case "stdout":
+		exp, err := stdouttrace.New()
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize stdout exporter: %w", err)
+		}
+
+		return exp, nil
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", name)
+	}
+}
+
+// newResource describes the exporter process to telemetry backends. The
+// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES environment variables take
+// precedence over the detected attributes.
+func newResource(ctx context.Context, serviceName string) (*resource.Resource, error) {
+	res, err := resource.New(ctx,
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithAttributes(semconv.ServiceNameKey.String(serviceName)),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithProcessPID(),
+		resource.WithProcessExecutableName(),
+		resource.WithProcessRuntimeName(),
+		resource.WithProcessRuntimeVersion(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect resource: %w", err)
+	}
+
+	return res, nil
+}
+
+// otlpProtocol returns the OTLP protocol configured for the signal through
+// OTEL_EXPORTER_OTLP_<signal>_PROTOCOL or OTEL_EXPORTER_OTLP_PROTOCOL,
+// defaulting to grpc.
+func otlpProtocol(signal string) string {
+	if p := os.Getenv("OTEL_EXPORTER_OTLP_" + signal + "_PROTOCOL"); p != "" {
+		return p
+	}
+
+	if p := os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL"); p != "" {
+		return p
+	}
+
+	return "grpc"
+}
+
+// initMeter registers a Prometheus backed meter provider as the global meter
+// provider and returns the handler serving its metrics, along with the
+// registry gathering them. Metric names are prefixed with prefix, the
+// mirrored counters are served without _created.
+func initMeter(prefix string, mirrored []string) (http.Handler, prom.Gatherer, error) {
 	reg := prom.NewRegistry()
 	config := prometheus.Config{
 		Registry:   reg,
-		Registerer: prom.WrapRegistererWithPrefix(serviceName+"_", reg),
+		Registerer: prom.WrapRegistererWithPrefix(prefix, reg),
 	}
 
 	ctrl := controller.New(
@@ -64,19 +195,86 @@ func initMeter(serviceName, port string) error {
 				histogram.WithExplicitBoundaries(config.DefaultHistogramBoundaries),
 			),
 			export.CumulativeExportKindSelector(),
-			processor.WithMemory(true),
+			// only the series observed in a collection are exported, so
+			// devices removed from a bridge drop out at the next scrape
+			// rather than freezing at their last values
+			processor.WithMemory(false),
 		),
+		// observers only read the state last collected, so each scrape
+		// observes it afresh instead of reusing a recent checkpoint
+		controller.WithCollectPeriod(0),
 	)
 	exporter, err := prometheus.New(config, ctrl)
 	if err != nil {
-		return fmt.Errorf("failed to initialize prometheus exporter: %w", err)
+		return nil, nil, fmt.Errorf("failed to initialize prometheus exporter: %w", err)
 	}
 	global.SetMeterProvider(exporter.MeterProvider())
 
-	http.HandleFunc("/", exporter.ServeHTTP)
-	go func() {
-		_ = http.ListenAndServe(":"+port, nil)
-	}()
+	// the exporter collects through the registry, which is served directly
+	// so scrapers may negotiate OpenMetrics
+	return openmetrics.Handler(reg, openmetrics.WithoutCreated(prefixed(prefix, mirrored)...)), reg, nil
+}
+
+// initRegistry creates a Prometheus registry for the native collector, along
+// with the handler serving it and the registry as a gatherer. The returned
+// registerer prefixes metric names with prefix, the mirrored counters are
+// served without _created.
+func initRegistry(prefix string, mirrored []string) (http.Handler, prom.Registerer, prom.Gatherer) {
+	reg := prom.NewRegistry()
+	reg.MustRegister(
+		prom.NewGoCollector(),
+		prom.NewProcessCollector(prom.ProcessCollectorOpts{}),
+	)
+
+	return openmetrics.Handler(reg, openmetrics.WithoutCreated(prefixed(prefix, mirrored)...)), prom.WrapRegistererWithPrefix(prefix, reg), reg
+}
+
+// prefixed returns the metric names with prefix applied.
+func prefixed(prefix string, names []string) []string {
+	out := make([]string, 0, len(names))
+	for _, name := range names {
+		out = append(out, prefix+name)
+	}
+
+	return out
+}
+
+// initOTLPMeter creates a meter provider pushing metrics to an OTLP endpoint,
+// configured through the standard OTEL_EXPORTER_OTLP_* environment
+// variables. The returned func stops the provider, pushing any pending
+// metrics.
+func initOTLPMeter(ctx context.Context, serviceName string) (metric.MeterProvider, func(context.Context) error, error) {
+	res, err := newResource(ctx, serviceName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var client otlpmetric.Client
+	switch protocol := otlpProtocol("METRICS"); protocol {
+	case "grpc":
+		client = otlpmetricgrpc.NewClient()
+	case "http/protobuf":
+		client = otlpmetrichttp.NewClient()
+	default:
+		return nil, nil, fmt.Errorf("unsupported OTLP protocol %q", protocol)
+	}
+
+	exporter, err := otlpmetric.New(ctx, client)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize otlp exporter: %w", err)
+	}
+
+	ctrl := controller.New(
+		processor.New(
+			selector.NewWithInexpensiveDistribution(),
+			exporter,
+		),
+		controller.WithExporter(exporter),
+		controller.WithResource(res),
+	)
+	if err := ctrl.Start(ctx); err != nil {
+		return nil, nil, fmt.Errorf("failed to start otlp exporter: %w", err)
+	}
 
-	return nil
+	return ctrl.MeterProvider(), ctrl.Stop, nil
 }
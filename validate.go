@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ninnemana/hue-exporter/hueclient"
+	"github.com/ninnemana/hue-exporter/web"
+)
+
+// validateTimeout bounds each connectivity check.
+const validateTimeout = time.Second * 5
+
+// check is the outcome of a single validation.
+type check struct {
+	name   string
+	detail string
+	err    error
+}
+
+// validate loads the configuration, checks the bridges can be reached with
+// their credentials and the configured endpoints accept connections, then
+// prints a summary. It reports whether every check passed.
+func validate(ctx context.Context, w io.Writer) bool {
+	var checks []check
+	add := func(name, detail string, err error) {
+		checks = append(checks, check{name: name, detail: detail, err: err})
+	}
+
+	switch *backend {
+	case "otel", "prometheus":
+		add("metrics backend", *backend, nil)
+	default:
+		add("metrics backend", *backend, errors.New("expected otel or prometheus"))
+	}
+
+	_, err := newSampler(*sampler, *ratio)
+	add("trace sampler", *sampler, err)
+
+	add("metrics port", ":"+*promPort, listenCheck(*promPort))
+	checks = append(checks, validateWeb()...)
+	checks = append(checks, validateBridges(ctx)...)
+
+	if *remoteMode {
+		_, _, err := remoteConfig().Client(ctx)
+		add("hue remote api", *remoteTokens, err)
+	}
+
+	endpoints := []struct {
+		name, addr string
+	}{
+		{"mqtt broker", *mqttURL},
+		{"graphite", *carbon},
+		{"pushgateway", *pushURL},
+		{"remote write", *rwURL},
+		{"alert webhook", *alertHook},
+	}
+	for _, e := range endpoints {
+		if e.addr == "" {
+			continue
+		}
+
+		add(e.name, e.addr, dialCheck(ctx, e.addr))
+	}
+
+	if *statsdAddr != "" {
+		_, err := net.ResolveUDPAddr("udp", *statsdAddr)
+		add("statsd", *statsdAddr, err)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CHECK\tSTATUS\tDETAIL")
+
+	ok := true
+	for _, c := range checks {
+		status, detail := "ok", c.detail
+		if c.err != nil {
+			ok = false
+			status, detail = "FAIL", fmt.Sprintf("%s: %v", c.detail, c.err)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", c.name, status, detail)
+	}
+	_ = tw.Flush()
+
+	return ok
+}
+
+// validateWeb checks the web config file and TLS certificate load.
+func validateWeb() []check {
+	var checks []check
+	if *webCfg != "" {
+		_, err := web.LoadConfig(*webCfg)
+		checks = append(checks, check{name: "web config", detail: *webCfg, err: err})
+	}
+
+	if *tlsCert != "" || *tlsKey != "" {
+		_, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		checks = append(checks, check{name: "tls certificate", detail: *tlsCert, err: err})
+	}
+
+	return checks
+}
+
+// validateBridges checks every configured bridge is reachable and accepts
+// its username.
+func validateBridges(ctx context.Context) []check {
+	cfgs := hueConfigs()
+	creds, err := loadCredentials(*credentials)
+	switch {
+	case err == nil:
+		cfgs = applyCredentials(cfgs, creds)
+	case !errors.Is(err, os.ErrNotExist):
+		return []check{{name: "credentials", detail: *credentials, err: err}}
+	}
+
+	// as when serving, a remote bridge on its own doesn't fall back to
+	// discovery
+	if *remoteMode && os.Getenv("HUE_ADDRESS") == "" && os.Getenv("HUE_BRIDGE_ID") == "" {
+		return nil
+	}
+
+	checks := make([]check, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		ctx, cancel := context.WithTimeout(ctx, validateTimeout*2)
+		b, name, err := listBridge(ctx, cfg)
+		if err != nil {
+			cancel()
+			checks = append(checks, check{name: "bridge " + cfg.Name + cfg.ID, detail: "discovery", err: err})
+
+			continue
+		}
+
+		c := check{name: "bridge " + name, detail: b.Host()}
+		if cfg.Username == "" {
+			c.err = errors.New("no username, run the pair command")
+		} else {
+			var lights []hueclient.Light
+			lights, c.err = b.GetLightsContext(ctx)
+			if c.err == nil {
+				c.detail = fmt.Sprintf("%s, %d lights", b.Host(), len(lights))
+			}
+		}
+		cancel()
+
+		checks = append(checks, c)
+	}
+
+	return checks
+}
+
+// listenCheck verifies the port metrics are served on is free.
+func listenCheck(port string) error {
+	l, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
+	}
+
+	return l.Close()
+}
+
+// dialCheck verifies a TCP connection can be opened to the address, either
+// host:port or a URL whose scheme implies the port.
+func dialCheck(ctx context.Context, addr string) error {
+	hostport := addr
+	if u, err := url.Parse(addr); err == nil && u.Host != "" {
+		hostport = u.Host
+		if u.Port() == "" {
+			port, ok := map[string]string{
+				"http":  "80",
+				"https": "443",
+				"tcp":   "1883",
+				"mqtt":  "1883",
+				"ssl":   "8883",
+				"tls":   "8883",
+				"mqtts": "8883",
+				"ws":    "80",
+				"wss":   "443",
+			}[u.Scheme]
+			if !ok {
+				return fmt.Errorf("unknown scheme %q", u.Scheme)
+			}
+
+			hostport = net.JoinHostPort(u.Hostname(), port)
+		}
+	}
+
+	if _, _, err := net.SplitHostPort(hostport); err != nil {
+		return err
+	}
+
+	d := net.Dialer{Timeout: validateTimeout}
+	conn, err := d.DialContext(ctx, "tcp", hostport)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
@@ -0,0 +1,84 @@
+package web
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Authenticate wraps handler to require the basic auth credentials or
+// bearer token from the configuration. The handler is returned as is when
+// neither is configured.
+func Authenticate(handler http.Handler, cfg Config) http.Handler {
+	if len(cfg.BasicAuthUsers) == 0 && cfg.BearerToken == "" {
+		return handler
+	}
+
+	a := &authenticator{
+		users:    cfg.BasicAuthUsers,
+		token:    cfg.BearerToken,
+		verified: map[[sha256.Size]byte]bool{},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.allowed(r) {
+			if len(a.users) > 0 {
+				w.Header().Set("WWW-Authenticate", `Basic realm="hue-exporter"`)
+			}
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+type authenticator struct {
+	users map[string]string
+	token string
+
+	// verified caches credentials that passed the bcrypt comparison, which
+	// is deliberately slow, keyed by a hash of the username and password.
+	mu       sync.Mutex
+	verified map[[sha256.Size]byte]bool
+}
+
+func (a *authenticator) allowed(r *http.Request) bool {
+	if a.token != "" {
+		header := r.Header.Get("Authorization")
+		if token := strings.TrimPrefix(header, "Bearer "); token != header {
+			return subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+		}
+	}
+
+	user, pass, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+
+	hash, known := a.users[user]
+	if !known {
+		return false
+	}
+
+	key := sha256.Sum256([]byte(user + "\x00" + pass))
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.verified[key] {
+		return true
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)); err != nil {
+		return false
+	}
+	a.verified[key] = true
+
+	return true
+}
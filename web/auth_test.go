@@ -0,0 +1,103 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthenticate(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name string
+		cfg  Config
+		// auth sets the credentials of the request
+		auth func(r *http.Request)
+		want int
+	}{
+		{name: "unconfigured", want: http.StatusNoContent},
+		{
+			name: "basic auth",
+			cfg:  Config{BasicAuthUsers: map[string]string{"admin": string(hash)}},
+			auth: func(r *http.Request) { r.SetBasicAuth("admin", "hunter2") },
+			want: http.StatusNoContent,
+		},
+		{
+			name: "wrong password",
+			cfg:  Config{BasicAuthUsers: map[string]string{"admin": string(hash)}},
+			auth: func(r *http.Request) { r.SetBasicAuth("admin", "hunter3") },
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "unknown user",
+			cfg:  Config{BasicAuthUsers: map[string]string{"admin": string(hash)}},
+			auth: func(r *http.Request) { r.SetBasicAuth("root", "hunter2") },
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "no credentials",
+			cfg:  Config{BasicAuthUsers: map[string]string{"admin": string(hash)}},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "bearer token",
+			cfg:  Config{BearerToken: "secret"},
+			auth: func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") },
+			want: http.StatusNoContent,
+		},
+		{
+			name: "wrong bearer token",
+			cfg:  Config{BearerToken: "secret"},
+			auth: func(r *http.Request) { r.Header.Set("Authorization", "Bearer guess") },
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "basic auth alongside a bearer token",
+			cfg:  Config{BasicAuthUsers: map[string]string{"admin": string(hash)}, BearerToken: "secret"},
+			auth: func(r *http.Request) { r.SetBasicAuth("admin", "hunter2") },
+			want: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Authenticate(ok, tt.cfg)
+
+			// the second request is served from the cache of verified
+			// credentials
+			for i := 0; i < 2; i++ {
+				r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+				if tt.auth != nil {
+					tt.auth(r)
+				}
+				rec := httptest.NewRecorder()
+				h.ServeHTTP(rec, r)
+
+				if rec.Code != tt.want {
+					t.Errorf("got status %d, want %d", rec.Code, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthenticateChallenge(t *testing.T) {
+	h := Authenticate(http.NotFoundHandler(), Config{BasicAuthUsers: map[string]string{"admin": "hash"}})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if got := rec.Header().Get("WWW-Authenticate"); got != `Basic realm="hue-exporter"` {
+		t.Errorf("got challenge %q, want basic auth", got)
+	}
+}
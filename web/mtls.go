@@ -0,0 +1,112 @@
+package web
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var (
+	// clientAuthTypes maps the client_auth_type values of the web
+	// configuration file to their TLS equivalent.
+	clientAuthTypes = map[string]tls.ClientAuthType{
+		"NoClientCert":               tls.NoClientCert,
+		"RequestClientCert":          tls.RequestClientCert,
+		"RequireAnyClientCert":       tls.RequireAnyClientCert,
+		"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+		"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+	}
+
+	// ErrClientNotAllowed is returned when a client certificate verifies but
+	// names none of the allowed SANs.
+	ErrClientNotAllowed = errors.New("client certificate is not allowed")
+
+	// ErrClientAuthWithoutTLS is returned when client certificates are
+	// configured without the certificate and key TLS is served with.
+	ErrClientAuthWithoutTLS = errors.New("client certificate auth requires cert_file and key_file")
+)
+
+// clientAuth configures verification of client certificates.
+func (c TLSConfig) clientAuth(cfg *tls.Config) error {
+	authType := c.ClientAuthType
+	if authType == "" && c.ClientCAFile != "" {
+		authType = "RequireAndVerifyClientCert"
+	}
+	if authType == "" {
+		return nil
+	}
+
+	auth, ok := clientAuthTypes[authType]
+	if !ok {
+		return fmt.Errorf("unknown client_auth_type %q", authType)
+	}
+	cfg.ClientAuth = auth
+
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", c.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+	}
+
+	if len(c.ClientAllowedSANs) > 0 {
+		cfg.VerifyPeerCertificate = allowSANs(c.ClientAllowedSANs)
+	}
+
+	return nil
+}
+
+// verifiesClients reports whether TLS is served requiring every client to
+// present a certificate signed by the client CA.
+func (c TLSConfig) verifiesClients() bool {
+	if c.CertFile == "" || c.KeyFile == "" || c.ClientCAFile == "" {
+		return false
+	}
+
+	authType := c.ClientAuthType
+	if authType == "" {
+		authType = "RequireAndVerifyClientCert"
+	}
+
+	return authType == "RequireAndVerifyClientCert"
+}
+
+// allowSANs verifies the client certificate names one of the allowed SANs.
+// It runs after the chain was verified against the client CA.
+func allowSANs(allowed []string) func([][]byte, [][]*x509.Certificate) error {
+	return func(_ [][]byte, chains [][]*x509.Certificate) error {
+		for _, chain := range chains {
+			if len(chain) == 0 {
+				continue
+			}
+
+			leaf := chain[0]
+			names := append([]string{}, leaf.DNSNames...)
+			names = append(names, leaf.EmailAddresses...)
+			for _, uri := range leaf.URIs {
+				names = append(names, uri.String())
+			}
+			for _, ip := range leaf.IPAddresses {
+				names = append(names, ip.String())
+			}
+
+			for _, name := range names {
+				for _, a := range allowed {
+					if name == a {
+						return nil
+					}
+				}
+			}
+		}
+
+		return ErrClientNotAllowed
+	}
+}
@@ -0,0 +1,144 @@
+package web
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config configures how the exporter is served. It follows the web
+// configuration file used by the Prometheus exporters, extended with a
+// static bearer token.
+type Config struct {
+	TLS TLSConfig `yaml:"tls_server_config"`
+	// BasicAuthUsers maps usernames to bcrypt hashes of their passwords.
+	BasicAuthUsers map[string]string `yaml:"basic_auth_users"`
+	// BearerToken is accepted in the Authorization header as an alternative
+	// to basic auth.
+	BearerToken string `yaml:"bearer_token"`
+}
+
+// TLSConfig configures TLS for the server.
+type TLSConfig struct {
+	// CertFile and KeyFile enable TLS when both are set.
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ReloadCerts reloads the certificate and key when the files change.
+	ReloadCerts bool `yaml:"reload_certs"`
+
+	// ClientCAFile is the CA bundle client certificates are verified
+	// against. ClientAuthType defaults to RequireAndVerifyClientCert when it
+	// is set.
+	ClientCAFile   string `yaml:"client_ca_file"`
+	ClientAuthType string `yaml:"client_auth_type"`
+	// ClientAllowedSANs restricts verified clients to certificates with one
+	// of the subject alternative names, any verified client is allowed when
+	// empty.
+	ClientAllowedSANs []string `yaml:"client_allowed_sans"`
+}
+
+// LoadConfig reads the configuration from the YAML file at path.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read web config: %w", err)
+	}
+
+	if err := yaml.UnmarshalStrict(b, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse web config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// TLSConfig returns the TLS configuration for the server, nil when TLS is
+// disabled. Client certificates can't be verified without TLS, configuring
+// them without a certificate and key is an error rather than serving
+// plain HTTP.
+func (c Config) TLSConfig() (*tls.Config, error) {
+	if c.TLS.CertFile == "" && c.TLS.KeyFile == "" {
+		if c.TLS.ClientCAFile != "" || c.TLS.ClientAuthType != "" {
+			return nil, ErrClientAuthWithoutTLS
+		}
+
+		return nil, nil
+	}
+
+	certs, err := NewCertReloader(c.TLS.CertFile, c.TLS.KeyFile, c.TLS.ReloadCerts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &tls.Config{
+		GetCertificate: certs.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+
+	if err := c.TLS.clientAuth(cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Authenticates reports whether clients must authenticate, through basic
+// auth, a bearer token or a client certificate. Client certificates only
+// authenticate when TLS is served and every client must present one signed
+// by the client CA.
+func (c Config) Authenticates() bool {
+	return len(c.BasicAuthUsers) > 0 || c.BearerToken != "" || c.TLS.verifiesClients()
+}
+
+// shutdownTimeout bounds how long requests in flight are waited on when the
+// server shuts down.
+const shutdownTimeout = 5 * time.Second
+
+// ListenAndServe serves handler on addr according to the configuration.
+func ListenAndServe(addr string, handler http.Handler, cfg Config) error {
+	return ListenAndServeContext(context.Background(), addr, handler, cfg)
+}
+
+// ListenAndServeContext serves handler on addr according to the
+// configuration until ctx is done, then shuts the server down gracefully,
+// returning nil once it has.
+func ListenAndServeContext(ctx context.Context, addr string, handler http.Handler, cfg Config) error {
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:      addr,
+		Handler:   Authenticate(handler, cfg),
+		TLSConfig: tlsConfig,
+	}
+
+	shutdown := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+
+		sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		shutdown <- srv.Shutdown(sctx)
+	}()
+
+	if tlsConfig == nil {
+		err = srv.ListenAndServe()
+	} else {
+		err = srv.ListenAndServeTLS("", "")
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return <-shutdown
+}
@@ -0,0 +1,296 @@
+package web
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate for localhost and its key to
+// dir, returning their paths. The certificate doubles as a CA.
+func writeCert(t *testing.T, dir string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	cert, key := writeCert(t, t.TempDir())
+
+	tests := []struct {
+		name string
+		tls  TLSConfig
+		// auth is the client auth the server is configured with, nil when
+		// TLS is disabled
+		auth *tls.ClientAuthType
+		err  error
+	}{
+		{name: "plain"},
+		{
+			name: "tls",
+			tls:  TLSConfig{CertFile: cert, KeyFile: key},
+			auth: clientAuthType(tls.NoClientCert),
+		},
+		{
+			name: "mtls",
+			tls:  TLSConfig{CertFile: cert, KeyFile: key, ClientCAFile: cert},
+			auth: clientAuthType(tls.RequireAndVerifyClientCert),
+		},
+		{
+			name: "client auth type",
+			tls:  TLSConfig{CertFile: cert, KeyFile: key, ClientCAFile: cert, ClientAuthType: "VerifyClientCertIfGiven"},
+			auth: clientAuthType(tls.VerifyClientCertIfGiven),
+		},
+		{
+			name: "client ca without tls",
+			tls:  TLSConfig{ClientCAFile: cert},
+			err:  ErrClientAuthWithoutTLS,
+		},
+		{
+			name: "client auth type without tls",
+			tls:  TLSConfig{ClientAuthType: "RequireAndVerifyClientCert"},
+			err:  ErrClientAuthWithoutTLS,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Config{TLS: tt.tls}.TLSConfig()
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+
+			switch {
+			case tt.auth == nil && cfg != nil:
+				t.Error("TLS is enabled, want it disabled")
+			case tt.auth != nil && cfg == nil:
+				t.Error("TLS is disabled, want it enabled")
+			case tt.auth != nil && cfg.ClientAuth != *tt.auth:
+				t.Errorf("got client auth %v, want %v", cfg.ClientAuth, *tt.auth)
+			}
+		})
+	}
+}
+
+func TestTLSConfigInvalid(t *testing.T) {
+	cert, key := writeCert(t, t.TempDir())
+
+	for name, c := range map[string]TLSConfig{
+		"cert without key":    {CertFile: cert},
+		"key without cert":    {KeyFile: key},
+		"unknown auth type":   {CertFile: cert, KeyFile: key, ClientAuthType: "Sometimes"},
+		"missing client ca":   {CertFile: cert, KeyFile: key, ClientCAFile: filepath.Join(t.TempDir(), "ca.pem")},
+		"client ca not a pem": {CertFile: cert, KeyFile: key, ClientCAFile: key},
+	} {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			if _, err := (Config{TLS: c}).TLSConfig(); err == nil {
+				t.Error("expected the configuration to be rejected")
+			}
+		})
+	}
+}
+
+// TestAuthenticates covers the guard of the control API, which is refused
+// unless clients authenticate.
+func TestAuthenticates(t *testing.T) {
+	type test struct {
+		name string
+		cfg  Config
+		want bool
+	}
+
+	tests := []test{
+		{name: "none"},
+		{name: "basic auth", cfg: Config{BasicAuthUsers: map[string]string{"admin": "hash"}}, want: true},
+		{name: "bearer token", cfg: Config{BearerToken: "secret"}, want: true},
+		{
+			name: "mtls",
+			cfg:  Config{TLS: TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", ClientCAFile: "ca.pem"}},
+			want: true,
+		},
+		{
+			name: "mtls required",
+			cfg: Config{TLS: TLSConfig{
+				CertFile:       "cert.pem",
+				KeyFile:        "key.pem",
+				ClientCAFile:   "ca.pem",
+				ClientAuthType: "RequireAndVerifyClientCert",
+			}},
+			want: true,
+		},
+		{name: "client ca without tls", cfg: Config{TLS: TLSConfig{ClientCAFile: "ca.pem"}}},
+		{name: "client ca without key", cfg: Config{TLS: TLSConfig{CertFile: "cert.pem", ClientCAFile: "ca.pem"}}},
+		{name: "tls without client ca", cfg: Config{TLS: TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem"}}},
+	}
+	for _, authType := range []string{"NoClientCert", "RequestClientCert", "RequireAnyClientCert", "VerifyClientCertIfGiven"} {
+		// none of these authenticate the client
+		tests = append(tests, test{
+			name: authType,
+			cfg: Config{TLS: TLSConfig{
+				CertFile:       "cert.pem",
+				KeyFile:        "key.pem",
+				ClientCAFile:   "ca.pem",
+				ClientAuthType: authType,
+			}},
+		})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.Authenticates(); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func clientAuthType(a tls.ClientAuthType) *tls.ClientAuthType {
+	return &a
+}
+
+// serveTLS serves a handler answering 204 according to cfg until the test
+// ends, returning the address it listens on.
+func serveTLS(t *testing.T, cfg Config) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- ListenAndServeContext(ctx, addr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}), cfg)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("failed to serve: %v", err)
+		}
+	})
+
+	for i := 0; i < 100; i++ {
+		if c, err := net.Dial("tcp", addr); err == nil {
+			c.Close()
+
+			return addr
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("server did not start listening on %s", addr)
+
+	return ""
+}
+
+func TestListenAndServeMutualTLS(t *testing.T) {
+	cert, key := writeCert(t, t.TempDir())
+
+	pair, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		t.Fatalf("failed to load certificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(mustParse(t, pair.Certificate[0]))
+
+	tests := []struct {
+		name string
+		sans []string
+		// present is whether the client presents its certificate
+		present bool
+		ok      bool
+	}{
+		{name: "verified", present: true, ok: true},
+		{name: "no certificate"},
+		{name: "allowed san", sans: []string{"localhost"}, present: true, ok: true},
+		{name: "other san", sans: []string{"scraper.example.com"}, present: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := serveTLS(t, Config{TLS: TLSConfig{
+				CertFile:          cert,
+				KeyFile:           key,
+				ClientCAFile:      cert,
+				ClientAllowedSANs: tt.sans,
+			}})
+
+			tc := &tls.Config{RootCAs: roots, ServerName: "localhost", MinVersion: tls.VersionTLS12}
+			if tt.present {
+				tc.Certificates = []tls.Certificate{pair}
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: tc}}
+
+			res, err := client.Get("https://" + addr + "/metrics")
+			if err == nil {
+				res.Body.Close()
+			}
+
+			if ok := err == nil && res.StatusCode == http.StatusNoContent; ok != tt.ok {
+				t.Errorf("served: %v (error %v), want %v", ok, err, tt.ok)
+			}
+		})
+	}
+}
+
+func mustParse(t *testing.T, der []byte) *x509.Certificate {
+	t.Helper()
+
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+
+	return c
+}
@@ -0,0 +1,97 @@
+// Package web serves the exporter over HTTP, optionally secured with TLS.
+package web
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// CertReloader loads a certificate and key pair, reloading them when the
+// files change so certificates can be renewed without a restart.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	reload   bool
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewCertReloader loads the certificate and key pair from the provided files.
+// When reload is set the files are checked for changes as connections are
+// accepted.
+func NewCertReloader(certFile, keyFile string, reload bool) (*CertReloader, error) {
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		reload:   reload,
+	}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate. When the files fail
+// to reload, such as while only one of them has been replaced, the previous
+// certificate continues to be served.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.reload {
+		if mod, err := r.latestModTime(); err == nil && mod.After(r.modTime) {
+			_ = r.loadLocked()
+		}
+	}
+
+	return r.cert, nil
+}
+
+func (r *CertReloader) load() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.loadLocked()
+}
+
+func (r *CertReloader) loadLocked() error {
+	mod, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	r.cert = &cert
+	r.modTime = mod
+
+	return nil
+}
+
+// latestModTime returns the most recent modification time of the
+// certificate and key files.
+func (r *CertReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to stat %s: %w", f, err)
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
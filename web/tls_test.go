@@ -0,0 +1,75 @@
+package web
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCertReloader(t *testing.T) {
+	for _, reload := range []bool{false, true} {
+		reload := reload
+		name := "static"
+		if reload {
+			name = "reload"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			certFile, keyFile := writeCert(t, dir)
+
+			r, err := NewCertReloader(certFile, keyFile, reload)
+			if err != nil {
+				t.Fatalf("failed to load certificate: %v", err)
+			}
+
+			first, _ := r.GetCertificate(nil)
+
+			// the certificate is renewed, dated later so the change is
+			// seen despite coarse file system timestamps
+			writeCert(t, dir)
+			later := time.Now().Add(time.Minute)
+			for _, f := range []string{certFile, keyFile} {
+				if err := os.Chtimes(f, later, later); err != nil {
+					t.Fatalf("failed to touch %s: %v", f, err)
+				}
+			}
+
+			second, _ := r.GetCertificate(nil)
+			if renewed := !bytes.Equal(first.Certificate[0], second.Certificate[0]); renewed != reload {
+				t.Errorf("renewed certificate served: %v, want %v", renewed, reload)
+			}
+		})
+	}
+}
+
+func TestCertReloaderKeepsCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir)
+
+	r, err := NewCertReloader(certFile, keyFile, true)
+	if err != nil {
+		t.Fatalf("failed to load certificate: %v", err)
+	}
+	first, _ := r.GetCertificate(nil)
+
+	// only the certificate has been replaced, it no longer matches the key
+	later := time.Now().Add(time.Minute)
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatalf("failed to replace certificate: %v", err)
+	}
+	if err := os.Chtimes(certFile, later, later); err != nil {
+		t.Fatalf("failed to touch certificate: %v", err)
+	}
+
+	if cert, _ := r.GetCertificate(nil); cert != first {
+		t.Error("the previous certificate is no longer served once the files failed to load")
+	}
+}
+
+func TestNewCertReloaderMissingFiles(t *testing.T) {
+	if _, err := NewCertReloader("missing.pem", "missing-key.pem", false); err == nil {
+		t.Error("expected missing files to be rejected")
+	}
+}